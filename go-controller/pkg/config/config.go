@@ -68,6 +68,7 @@ var (
 		MonitorAll:            true,
 		LFlowCacheEnable:      true,
 		RawClusterSubnets:     "10.128.0.0/14/23",
+		PodRetryMaxAttempts:   15,
 	}
 
 	// Logging holds logging-related parsed config file parameters and command-line overrides
@@ -112,7 +113,10 @@ var (
 	}
 
 	// Metrics holds Prometheus metrics-related parameters.
-	Metrics MetricsConfig
+	Metrics = MetricsConfig{
+		SubnetUsageRefreshInterval: 60,
+		ObjectCountRefreshInterval: 60,
+	}
 
 	// OVNKubernetesFeatureConfig holds OVN-Kubernetes feature enhancement config file parameters and command-line overrides
 	OVNKubernetesFeature = OVNKubernetesFeatureConfig{
@@ -226,6 +230,82 @@ type DefaultConfig struct {
 	// of small UDP packets by allowing them to be aggregated before passing through
 	// the kernel network stack. This requires a new-enough kernel (5.15 or RHEL 8.5).
 	EnableUDPAggregation bool `gcfg:"enable-udp-aggregation"`
+	// EnableNodePortSecurity is true if port security should be set on the ports
+	// ovn-kubernetes creates on each node switch: the switch to cluster router port
+	// and the management port.
+	EnableNodePortSecurity bool `gcfg:"enable-node-port-security"`
+	// ManagementPortOnly is true if node switches should only hold the management port
+	// of their node, without being connected to the cluster router or getting a gateway.
+	ManagementPortOnly bool `gcfg:"management-port-only"`
+	// RetryCacheDir is the directory the keys of pods and nodes pending retry are
+	// persisted to, so they are retried right away after a restart. Persistence
+	// is disabled if empty.
+	RetryCacheDir string `gcfg:"retry-cache-dir"`
+	// PodRetryMaxAttempts is the number of failed attempts to add, update or delete
+	// a pod after which it is no longer retried until its next event.
+	PodRetryMaxAttempts int `gcfg:"pod-retry-max-attempts"`
+	// NamespaceAddressSetMaxIPs is the maximum number of IPs a namespace address set
+	// can hold. The IPs of pods that would exceed it are not added to it. Unlimited if 0.
+	NamespaceAddressSetMaxIPs int `gcfg:"namespace-address-set-max-ips"`
+	// HostSubnetAlignmentBits aligns the node subnets allocated from the cluster
+	// subnets to blocks this many bits shorter than the host subnet length, eg
+	// 4 allocates /24 node subnets at the start of /20 blocks. No alignment if 0.
+	HostSubnetAlignmentBits int `gcfg:"host-subnet-alignment-bits"`
+	// DisableDeferredAddressSetDestroy destroys the address set of a deleted namespace
+	// right away, instead of keeping it empty for a while in case the namespace is
+	// recreated or network policies still reference it
+	DisableDeferredAddressSetDestroy bool `gcfg:"disable-deferred-address-set-destroy"`
+	// AllowSingleFamilyNodes allows nodes annotated with k8s.ovn.org/node-ip-families
+	// to only get host subnets for some of the IP families of a dual-stack cluster
+	AllowSingleFamilyNodes bool `gcfg:"allow-single-family-nodes"`
+	// AllowSingleFamilyOnSubnetExhaustion gives new nodes of a dual-stack cluster the subnet
+	// of only one IP family when the node subnets of the other family are exhausted, instead
+	// of failing to add them
+	AllowSingleFamilyOnSubnetExhaustion bool `gcfg:"allow-single-family-on-subnet-exhaustion"`
+	// NodeSubnetReserve is the number of node subnets of each IP family kept free for
+	// critical nodes: other nodes are refused new subnets that would leave fewer free.
+	// No reserve if 0.
+	NodeSubnetReserve int `gcfg:"node-subnet-reserve"`
+	// RawCriticalNodes is the label selector of the critical nodes, which may get node
+	// subnets out of the reserve
+	RawCriticalNodes string `gcfg:"critical-nodes"`
+	CriticalNodes    *metav1.LabelSelector
+	// NodeSubnetsAnnotationFallback is the annotation key the host subnets of a node are
+	// read from when the node has no k8s.ovn.org/node-subnets annotation, eg the key
+	// used by the version being upgraded from
+	NodeSubnetsAnnotationFallback string `gcfg:"node-subnets-annotation-fallback"`
+	// NodeSwitchTransactTimeout is the time in milliseconds after which a transaction
+	// creating or updating a node logical switch is cancelled and the node retried,
+	// rather than holding up the worker adding it. Only shortens the default ovsdb
+	// transaction timeout, which applies if 0.
+	NodeSwitchTransactTimeout int `gcfg:"node-switch-transact-timeout"`
+	// MaxNodeGatewayChassis is the maximum number of gateway chassis of the cluster router
+	// port of a node: its own chassis and the backup chassis it is annotated with in
+	// k8s.ovn.org/node-backup-chassis. Only the node's own chassis if 0 or 1.
+	MaxNodeGatewayChassis int `gcfg:"max-node-gateway-chassis"`
+	// DisableNodeDeleteAddressSetCleanup leaves the IPs of the pods of a deleted node in
+	// the namespace address sets until each pod delete is handled, instead of removing
+	// all the IPs of the node subnets from them when the node is deleted
+	DisableNodeDeleteAddressSetCleanup bool `gcfg:"disable-node-delete-address-set-cleanup"`
+	// MulticastFloodUnregistered floods the multicast traffic of groups with no registered
+	// receiver within the node switches, which only snoop multicast when multicast is
+	// enabled. The node switch other-config annotation still overrides it per node.
+	MulticastFloodUnregistered bool `gcfg:"multicast-flood-unregistered"`
+	// NodeSwitchDatapathCheckTimeout is the time in milliseconds the southbound datapath
+	// of a newly created node logical switch is waited for before a warning event is
+	// posted for the node. The southbound database is not checked if 0.
+	NodeSwitchDatapathCheckTimeout int `gcfg:"node-switch-datapath-check-timeout"`
+	// RawClusterRouterExternalIDs holds the unparsed comma separated key=value external IDs
+	// the cluster router is tagged with, eg ownership or cost metadata
+	RawClusterRouterExternalIDs string `gcfg:"cluster-router-external-ids"`
+	ClusterRouterExternalIDs    map[string]string
+	// RawClusterSubnetMaxNodes holds the unparsed comma separated CIDR=count maximum
+	// numbers of nodes allocated host subnets from cluster subnets, whatever the number
+	// of host subnets they have room for
+	RawClusterSubnetMaxNodes string `gcfg:"cluster-subnet-max-nodes"`
+	// ClusterSubnetMaxNodes holds the maximum number of nodes of each capped cluster
+	// subnet, keyed by CIDR
+	ClusterSubnetMaxNodes map[string]int
 }
 
 // LoggingConfig holds logging-related parsed config file parameters and command-line overrides
@@ -306,6 +386,27 @@ type KubernetesConfig struct {
 	NoHostSubnetNodes    *metav1.LabelSelector
 	HostNetworkNamespace string `gcfg:"host-network-namespace"`
 	PlatformType         string `gcfg:"platform-type"`
+	// NodeStartupSyncRate is the maximum number of existing nodes processed per second
+	// during the initial node sync at master startup; 0 means no limit.
+	NodeStartupSyncRate int `gcfg:"node-startup-sync-rate"`
+	// AllowForceReleaseNodeSubnets enables the administrative release of the subnets
+	// of a node that still exists, for incident recovery.
+	AllowForceReleaseNodeSubnets bool `gcfg:"allow-force-release-node-subnets"`
+	// NodeSubnetReleaseDelay is how many seconds the subnets of a deleted node are kept
+	// before being released, so that a node re-added in the meantime gets them back;
+	// 0 releases them right away.
+	NodeSubnetReleaseDelay int `gcfg:"node-subnet-release-delay"`
+	// NodeHandlerStallTimeout is how many seconds the node handler may go without
+	// completing a node event while some are being handled before it is reported as
+	// stalled; 0 disables the watchdog.
+	NodeHandlerStallTimeout int `gcfg:"node-handler-stall-timeout"`
+	// PodNodeSwitchWaitTimeout is how many seconds a pod added while its node is being
+	// handled waits for the logical switch of the node to be created before it is
+	// retried; 0 retries it right away.
+	PodNodeSwitchWaitTimeout int `gcfg:"pod-node-switch-wait-timeout"`
+	// FilterNodeUpdates skips the node updates that only change fields the node handler
+	// doesn't act upon, such as the heartbeats of the node status conditions.
+	FilterNodeUpdates bool `gcfg:"filter-node-updates"`
 
 	// CompatMetricsBindAddress is overridden by the corresponding option in MetricsConfig
 	CompatMetricsBindAddress string `gcfg:"metrics-bind-address"`
@@ -327,6 +428,12 @@ type MetricsConfig struct {
 	// configuration duration and optionally, its application to all nodes
 	EnableConfigDuration  bool `gcfg:"enable-config-duration"`
 	EnableEIPScaleMetrics bool `gcfg:"enable-eip-scale-metrics"`
+	// SubnetUsageRefreshInterval is the interval in seconds at which the master
+	// refreshes the host subnet usage metrics. Disabled if 0.
+	SubnetUsageRefreshInterval int `gcfg:"subnet-usage-refresh-interval"`
+	// ObjectCountRefreshInterval is the interval in seconds at which the master
+	// refreshes the managed OVN object count metrics. Disabled if 0.
+	ObjectCountRefreshInterval int `gcfg:"object-count-refresh-interval"`
 }
 
 // OVNKubernetesFeatureConfig holds OVN-Kubernetes feature enhancement config file parameters and command-line overrides
@@ -745,6 +852,116 @@ var CommonFlags = []cli.Flag{
 		Usage:       "Adds multicast support. Valid only with --init-master option.",
 		Destination: &EnableMulticast,
 	},
+	&cli.BoolFlag{
+		Name:        "enable-node-port-security",
+		Usage:       "Set port security on the router and management ports of node switches. Valid only with --init-master option.",
+		Destination: &cliConfig.Default.EnableNodePortSecurity,
+		Value:       Default.EnableNodePortSecurity,
+	},
+	&cli.BoolFlag{
+		Name:        "management-port-only",
+		Usage:       "Only create the management port on node switches, without connecting them to the cluster router or setting up node gateways. Valid only with --init-master option.",
+		Destination: &cliConfig.Default.ManagementPortOnly,
+		Value:       Default.ManagementPortOnly,
+	},
+	&cli.StringFlag{
+		Name:        "retry-cache-dir",
+		Usage:       "Directory to persist the keys of pods and nodes pending retry to, so they are retried right after a restart. Valid only with --init-master option.",
+		Destination: &cliConfig.Default.RetryCacheDir,
+		Value:       Default.RetryCacheDir,
+	},
+	&cli.IntFlag{
+		Name:        "pod-retry-max-attempts",
+		Usage:       "Number of failed attempts to set up or tear down a pod after which it is given up on until its next event (default: 15). Valid only with --init-master option.",
+		Destination: &cliConfig.Default.PodRetryMaxAttempts,
+		Value:       Default.PodRetryMaxAttempts,
+	},
+	&cli.IntFlag{
+		Name:        "namespace-address-set-max-ips",
+		Usage:       "Maximum number of IPs in the address set of a namespace, the IPs of pods that would exceed it are not added to it (default: 0, unlimited). Valid only with --init-master option.",
+		Destination: &cliConfig.Default.NamespaceAddressSetMaxIPs,
+		Value:       Default.NamespaceAddressSetMaxIPs,
+	},
+	&cli.IntFlag{
+		Name:        "host-subnet-alignment-bits",
+		Usage:       "Allocate node subnets aligned to blocks this many bits shorter than the host subnet length, eg 4 for /24 node subnets at the start of /20 blocks (default: 0, no alignment)",
+		Destination: &cliConfig.Default.HostSubnetAlignmentBits,
+		Value:       Default.HostSubnetAlignmentBits,
+	},
+	&cli.BoolFlag{
+		Name:        "disable-deferred-address-set-destroy",
+		Usage:       "Destroy the address set of a deleted namespace right away instead of after a delay (default: false)",
+		Destination: &cliConfig.Default.DisableDeferredAddressSetDestroy,
+		Value:       Default.DisableDeferredAddressSetDestroy,
+	},
+	&cli.BoolFlag{
+		Name:        "allow-single-family-nodes",
+		Usage:       "Allow nodes annotated with k8s.ovn.org/node-ip-families to be single-stack in a dual-stack cluster (default: false)",
+		Destination: &cliConfig.Default.AllowSingleFamilyNodes,
+		Value:       Default.AllowSingleFamilyNodes,
+	},
+	&cli.BoolFlag{
+		Name:        "allow-single-family-on-subnet-exhaustion",
+		Usage:       "In a dual-stack cluster, give nodes the subnet of only one IP family when the node subnets of the other are exhausted, instead of failing to add them (default: false)",
+		Destination: &cliConfig.Default.AllowSingleFamilyOnSubnetExhaustion,
+		Value:       Default.AllowSingleFamilyOnSubnetExhaustion,
+	},
+	&cli.IntFlag{
+		Name:        "node-subnet-reserve",
+		Usage:       "Number of node subnets of each IP family kept free for the nodes matching --critical-nodes, other nodes are refused subnets out of it (default: 0, no reserve). Valid only with --init-master option.",
+		Destination: &cliConfig.Default.NodeSubnetReserve,
+		Value:       Default.NodeSubnetReserve,
+	},
+	&cli.StringFlag{
+		Name:        "critical-nodes",
+		Usage:       "Label selector of the critical nodes, which may get node subnets out of the --node-subnet-reserve",
+		Destination: &cliConfig.Default.RawCriticalNodes,
+	},
+	&cli.StringFlag{
+		Name:        "cluster-router-external-ids",
+		Usage:       "Comma separated key=value external IDs added to those of the cluster router, eg to tag it with ownership or cost metadata",
+		Destination: &cliConfig.Default.RawClusterRouterExternalIDs,
+	},
+	&cli.StringFlag{
+		Name:        "cluster-subnet-max-nodes",
+		Usage:       "Comma separated CIDR=count maximum numbers of nodes allocated host subnets from cluster subnets, even if they have room for more (default: no maximum). Valid only with --init-master option.",
+		Destination: &cliConfig.Default.RawClusterSubnetMaxNodes,
+	},
+	&cli.StringFlag{
+		Name:        "node-subnets-annotation-fallback",
+		Usage:       "Annotation key the host subnets of a node are read from when it has no k8s.ovn.org/node-subnets annotation, they are then written under k8s.ovn.org/node-subnets. Valid only with --init-master option.",
+		Destination: &cliConfig.Default.NodeSubnetsAnnotationFallback,
+	},
+	&cli.IntFlag{
+		Name:        "node-switch-transact-timeout",
+		Usage:       "Time in milliseconds after which a transaction creating or updating a node logical switch is cancelled and the node retried (default: 0, the ovsdb transaction timeout). Valid only with --init-master option.",
+		Destination: &cliConfig.Default.NodeSwitchTransactTimeout,
+		Value:       Default.NodeSwitchTransactTimeout,
+	},
+	&cli.IntFlag{
+		Name:        "max-node-gateway-chassis",
+		Usage:       "Maximum number of gateway chassis of the cluster router port of a node, its own chassis followed by the ones in its k8s.ovn.org/node-backup-chassis annotation (default: 0, only its own chassis). Valid only with --init-master option.",
+		Destination: &cliConfig.Default.MaxNodeGatewayChassis,
+		Value:       Default.MaxNodeGatewayChassis,
+	},
+	&cli.BoolFlag{
+		Name:        "disable-node-delete-address-set-cleanup",
+		Usage:       "Keep the IPs of the pods of a deleted node in the namespace address sets until each pod is deleted, instead of removing the IPs of the node subnets when the node is deleted (default: false)",
+		Destination: &cliConfig.Default.DisableNodeDeleteAddressSetCleanup,
+		Value:       Default.DisableNodeDeleteAddressSetCleanup,
+	},
+	&cli.BoolFlag{
+		Name:        "multicast-flood-unregistered",
+		Usage:       "Flood unregistered multicast traffic within the node switches instead of only sending it to the multicast routers. Requires --enable-multicast (default: false)",
+		Destination: &cliConfig.Default.MulticastFloodUnregistered,
+		Value:       Default.MulticastFloodUnregistered,
+	},
+	&cli.IntFlag{
+		Name:        "node-switch-datapath-check-timeout",
+		Usage:       "Time in milliseconds the southbound datapath of a new node logical switch is waited for before posting a warning event for the node (default: 0, not checked). Valid only with --init-master option.",
+		Destination: &cliConfig.Default.NodeSwitchDatapathCheckTimeout,
+		Value:       Default.NodeSwitchDatapathCheckTimeout,
+	},
 	// Logging options
 	&cli.IntFlag{
 		Name:        "loglevel",
@@ -970,6 +1187,48 @@ var K8sFlags = []cli.Flag{
 		Destination: &cliConfig.Kubernetes.PlatformType,
 		Value:       Kubernetes.PlatformType,
 	},
+	&cli.IntFlag{
+		Name: "node-startup-sync-rate",
+		Usage: "Maximum number of existing nodes processed per second during the initial " +
+			"node sync at master startup (default: 0, no limit)",
+		Destination: &cliConfig.Kubernetes.NodeStartupSyncRate,
+		Value:       Kubernetes.NodeStartupSyncRate,
+	},
+	&cli.BoolFlag{
+		Name: "filter-node-updates",
+		Usage: "Skip the node updates that only change fields the node handler doesn't act " +
+			"upon, such as status heartbeats (default: false)",
+		Destination: &cliConfig.Kubernetes.FilterNodeUpdates,
+		Value:       Kubernetes.FilterNodeUpdates,
+	},
+	&cli.BoolFlag{
+		Name: "allow-force-release-node-subnets",
+		Usage: "Allow administrators to forcibly release the subnets of a node that still " +
+			"exists, for incident recovery (default: false)",
+		Destination: &cliConfig.Kubernetes.AllowForceReleaseNodeSubnets,
+		Value:       Kubernetes.AllowForceReleaseNodeSubnets,
+	},
+	&cli.IntFlag{
+		Name: "node-subnet-release-delay",
+		Usage: "Number of seconds the subnets of a deleted node are kept for the node to be " +
+			"re-added before they are released (default: 0, released right away)",
+		Destination: &cliConfig.Kubernetes.NodeSubnetReleaseDelay,
+		Value:       Kubernetes.NodeSubnetReleaseDelay,
+	},
+	&cli.IntFlag{
+		Name: "node-handler-stall-timeout",
+		Usage: "Number of seconds without any node event completed, while some are being " +
+			"handled, after which the node handler is reported as stalled (default: 0, disabled)",
+		Destination: &cliConfig.Kubernetes.NodeHandlerStallTimeout,
+		Value:       Kubernetes.NodeHandlerStallTimeout,
+	},
+	&cli.IntFlag{
+		Name: "pod-node-switch-wait-timeout",
+		Usage: "Number of seconds a pod added while its node is being handled waits for the " +
+			"logical switch of the node before it is retried (default: 0, retried right away)",
+		Destination: &cliConfig.Kubernetes.PodNodeSwitchWaitTimeout,
+		Value:       Kubernetes.PodNodeSwitchWaitTimeout,
+	},
 }
 
 // MetricsFlags capture metrics-related options
@@ -1015,6 +1274,18 @@ var MetricsFlags = []cli.Flag{
 		Usage:       "Enables metrics related to Egress IP scaling",
 		Destination: &cliConfig.Metrics.EnableEIPScaleMetrics,
 	},
+	&cli.IntFlag{
+		Name:        "metrics-subnet-usage-refresh-interval",
+		Usage:       "The interval in seconds at which the host subnet usage metrics are refreshed, or 0 to only update them when subnets are allocated or released",
+		Destination: &cliConfig.Metrics.SubnetUsageRefreshInterval,
+		Value:       Metrics.SubnetUsageRefreshInterval,
+	},
+	&cli.IntFlag{
+		Name:        "metrics-object-count-refresh-interval",
+		Usage:       "The interval in seconds at which the managed OVN object count metrics are refreshed, or 0 to disable them",
+		Destination: &cliConfig.Metrics.ObjectCountRefreshInterval,
+		Value:       Metrics.ObjectCountRefreshInterval,
+	},
 }
 
 // OvnNBFlags capture OVN northbound database options
@@ -1447,6 +1718,19 @@ func buildKubernetesConfig(exec kexec.Interface, cli, file *config, saPath strin
 		return fmt.Errorf("kubernetes service-cidrs is required")
 	}
 
+	if Kubernetes.NodeStartupSyncRate < 0 {
+		return fmt.Errorf("invalid node-startup-sync-rate %d: must not be negative", Kubernetes.NodeStartupSyncRate)
+	}
+	if Kubernetes.NodeSubnetReleaseDelay < 0 {
+		return fmt.Errorf("invalid node-subnet-release-delay %d: must not be negative", Kubernetes.NodeSubnetReleaseDelay)
+	}
+	if Kubernetes.NodeHandlerStallTimeout < 0 {
+		return fmt.Errorf("invalid node-handler-stall-timeout %d: must not be negative", Kubernetes.NodeHandlerStallTimeout)
+	}
+	if Kubernetes.PodNodeSwitchWaitTimeout < 0 {
+		return fmt.Errorf("invalid pod-node-switch-wait-timeout %d: must not be negative", Kubernetes.PodNodeSwitchWaitTimeout)
+	}
+
 	return nil
 }
 
@@ -1499,6 +1783,15 @@ func buildMetricsConfig(cli, file *config) error {
 		return err
 	}
 
+	if Metrics.SubnetUsageRefreshInterval < 0 {
+		return fmt.Errorf("invalid metrics-subnet-usage-refresh-interval %d: must not be negative",
+			Metrics.SubnetUsageRefreshInterval)
+	}
+	if Metrics.ObjectCountRefreshInterval < 0 {
+		return fmt.Errorf("invalid metrics-object-count-refresh-interval %d: must not be negative",
+			Metrics.ObjectCountRefreshInterval)
+	}
+
 	return nil
 }
 
@@ -1705,10 +1998,67 @@ func buildDefaultConfig(cli, file *config) error {
 	if Default.RawClusterSubnets == "" {
 		return fmt.Errorf("cluster subnet is required")
 	}
+	if Default.NamespaceAddressSetMaxIPs < 0 {
+		return fmt.Errorf("invalid namespace-address-set-max-ips %d: must not be negative",
+			Default.NamespaceAddressSetMaxIPs)
+	}
+	if Default.PodRetryMaxAttempts < 1 || Default.PodRetryMaxAttempts > 255 {
+		return fmt.Errorf("invalid pod-retry-max-attempts %d: must be between 1 and 255",
+			Default.PodRetryMaxAttempts)
+	}
+	if Default.MulticastFloodUnregistered && !EnableMulticast {
+		return fmt.Errorf("multicast-flood-unregistered requires enable-multicast, " +
+			"unregistered multicast is only flooded by switches snooping multicast")
+	}
+	if Default.NodeSubnetReserve < 0 {
+		return fmt.Errorf("invalid node-subnet-reserve %d: must not be negative", Default.NodeSubnetReserve)
+	}
+	if Default.RawCriticalNodes != "" {
+		nodeSelector, err := metav1.ParseToLabelSelector(Default.RawCriticalNodes)
+		if err != nil {
+			return fmt.Errorf("labelSelector \"%s\" is invalid: %v", Default.RawCriticalNodes, err)
+		}
+		Default.CriticalNodes = nodeSelector
+	}
+	externalIDs, err := parseClusterRouterExternalIDs(Default.RawClusterRouterExternalIDs)
+	if err != nil {
+		return err
+	}
+	Default.ClusterRouterExternalIDs = externalIDs
 
 	return nil
 }
 
+// clusterRouterOwnedExternalIDs are the external IDs of the cluster router set by
+// ovn-kubernetes itself, which cannot be configured
+var clusterRouterOwnedExternalIDs = map[string]bool{
+	"k8s-cluster-router":              true,
+	"k8s-cluster-router-external-ids": true,
+	"k8s-ovn-topo-version":            true,
+}
+
+// parseClusterRouterExternalIDs parses the comma separated key=value cluster router
+// external IDs
+func parseClusterRouterExternalIDs(raw string) (map[string]string, error) {
+	externalIDs := map[string]string{}
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("invalid cluster-router-external-ids entry %q: must be key=value", entry)
+		}
+		if clusterRouterOwnedExternalIDs[kv[0]] {
+			return nil, fmt.Errorf("invalid cluster-router-external-ids entry %q: %s is set by ovn-kubernetes",
+				entry, kv[0])
+		}
+		externalIDs[kv[0]] = kv[1]
+	}
+	return externalIDs, nil
+}
+
 // completeDefaultConfig completes the Default config by parsing raw values
 // into their final form.
 func completeDefaultConfig(allSubnets *configSubnets) error {
@@ -1721,9 +2071,65 @@ func completeDefaultConfig(allSubnets *configSubnets) error {
 		allSubnets.append(configSubnetCluster, subnet.CIDR)
 	}
 
+	if Default.HostSubnetAlignmentBits < 0 {
+		return fmt.Errorf("invalid host-subnet-alignment-bits %d: must not be negative", Default.HostSubnetAlignmentBits)
+	}
+	for _, subnet := range Default.ClusterSubnets {
+		clusterSubnetLength, addrLen := subnet.CIDR.Mask.Size()
+		if subnet.HostSubnetLength-Default.HostSubnetAlignmentBits < clusterSubnetLength {
+			return fmt.Errorf("cannot align /%d host subnets of cluster subnet %s to /%d blocks",
+				subnet.HostSubnetLength, subnet.CIDR, subnet.HostSubnetLength-Default.HostSubnetAlignmentBits)
+		}
+		// IPv6 host subnets with all 0s in their low word are never allocated
+		if addrLen == 128 && subnet.HostSubnetLength-clusterSubnetLength >= 16 && Default.HostSubnetAlignmentBits >= 16 {
+			return fmt.Errorf("cannot align /%d host subnets of cluster subnet %s to /%d blocks: the blocks must be less than 2^16 subnets",
+				subnet.HostSubnetLength, subnet.CIDR, subnet.HostSubnetLength-Default.HostSubnetAlignmentBits)
+		}
+	}
+	Default.ClusterSubnetMaxNodes, err = parseClusterSubnetMaxNodes(Default.RawClusterSubnetMaxNodes, Default.ClusterSubnets)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// parseClusterSubnetMaxNodes parses the comma separated CIDR=count maximum numbers of
+// nodes of the cluster subnets, which must be among the given ones
+func parseClusterSubnetMaxNodes(raw string, clusterSubnets []CIDRNetworkEntry) (map[string]int, error) {
+	maxNodes := map[string]int{}
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid cluster-subnet-max-nodes entry %q: must be CIDR=count", entry)
+		}
+		_, cidr, err := net.ParseCIDR(strings.TrimSpace(kv[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid cluster-subnet-max-nodes entry %q: %v", entry, err)
+		}
+		max, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+		if err != nil || max < 1 {
+			return nil, fmt.Errorf("invalid cluster-subnet-max-nodes entry %q: count must be a positive integer", entry)
+		}
+		found := false
+		for _, subnet := range clusterSubnets {
+			if subnet.CIDR.String() == cidr.String() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("invalid cluster-subnet-max-nodes entry %q: %s is not a cluster subnet", entry, cidr)
+		}
+		maxNodes[cidr.String()] = max
+	}
+	return maxNodes, nil
+}
+
 // getConfigFilePath returns config file path and 'true' if the config file is
 // the fallback path (eg not given by the user), 'false' if given explicitly
 // by the user
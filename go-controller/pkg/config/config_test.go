@@ -15,6 +15,7 @@ import (
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/types"
 
 	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
 	"github.com/onsi/gomega"
 )
 
@@ -854,6 +855,127 @@ cluster-subnets=172.18.0.0/23
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 	})
 
+	It("returns an error when multicast-flood-unregistered is set without enable-multicast", func() {
+		app.Action = func(ctx *cli.Context) error {
+			_, err := InitConfig(ctx, kexec.New(), nil)
+			gomega.Expect(err).To(gomega.MatchError("multicast-flood-unregistered requires enable-multicast, " +
+				"unregistered multicast is only flooded by switches snooping multicast"))
+			return nil
+		}
+		err := app.Run([]string{app.Name, "-multicast-flood-unregistered"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	It("accepts multicast-flood-unregistered with enable-multicast", func() {
+		app.Action = func(ctx *cli.Context) error {
+			_, err := InitConfig(ctx, kexec.New(), nil)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(Default.MulticastFloodUnregistered).To(gomega.BeTrue())
+			return nil
+		}
+		err := app.Run([]string{app.Name, "-enable-multicast", "-multicast-flood-unregistered"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	It("parses the cluster router external IDs", func() {
+		app.Action = func(ctx *cli.Context) error {
+			_, err := InitConfig(ctx, kexec.New(), nil)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(Default.ClusterRouterExternalIDs).To(gomega.Equal(map[string]string{
+				"owner":       "team-a",
+				"cost-center": "1234",
+			}))
+			return nil
+		}
+		err := app.Run([]string{app.Name, "-cluster-router-external-ids=owner=team-a, cost-center=1234"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	It("returns an error for cluster router external IDs set by ovn-kubernetes", func() {
+		app.Action = func(ctx *cli.Context) error {
+			_, err := InitConfig(ctx, kexec.New(), nil)
+			gomega.Expect(err).To(gomega.MatchError(
+				`invalid cluster-router-external-ids entry "k8s-ovn-topo-version=1": k8s-ovn-topo-version is set by ovn-kubernetes`))
+			return nil
+		}
+		err := app.Run([]string{app.Name, "-cluster-router-external-ids=owner=team-a,k8s-ovn-topo-version=1"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	It("parses the maximum number of nodes of the cluster subnets", func() {
+		app.Action = func(ctx *cli.Context) error {
+			_, err := InitConfig(ctx, kexec.New(), nil)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(Default.ClusterSubnetMaxNodes).To(gomega.Equal(map[string]int{
+				"10.132.0.0/14": 100,
+				"fd00:10::/48":  50,
+			}))
+			return nil
+		}
+		cliArgs := []string{
+			app.Name,
+			"-cluster-subnets=10.132.0.0/14/23,10.136.0.0/14/23,fd00:10::/48/64",
+			"-cluster-subnet-max-nodes=10.132.0.0/14=100, fd00:10:0::/48=50",
+			"-k8s-service-cidrs=172.30.0.0/16,fd00:30::/112",
+		}
+		err := app.Run(cliArgs)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	table.DescribeTable("returns an error for an invalid maximum number of nodes of a cluster subnet",
+		func(maxNodes, expectedErr string) {
+			app.Action = func(ctx *cli.Context) error {
+				_, err := InitConfig(ctx, kexec.New(), nil)
+				gomega.Expect(err).To(gomega.MatchError(expectedErr))
+				return nil
+			}
+			cliArgs := []string{
+				app.Name,
+				"-cluster-subnets=10.132.0.0/14/23",
+				"-cluster-subnet-max-nodes=" + maxNodes,
+			}
+			err := app.Run(cliArgs)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		},
+		table.Entry("without a count", "10.132.0.0/14",
+			`invalid cluster-subnet-max-nodes entry "10.132.0.0/14": must be CIDR=count`),
+		table.Entry("with a zero count", "10.132.0.0/14=0",
+			`invalid cluster-subnet-max-nodes entry "10.132.0.0/14=0": count must be a positive integer`),
+		table.Entry("with another subnet", "10.136.0.0/14=10",
+			`invalid cluster-subnet-max-nodes entry "10.136.0.0/14=10": 10.136.0.0/14 is not a cluster subnet`),
+	)
+
+	It("returns an error when the host subnet alignment does not fit the cluster subnets", func() {
+		app.Action = func(ctx *cli.Context) error {
+			_, err := InitConfig(ctx, kexec.New(), nil)
+			gomega.Expect(err).To(gomega.MatchError("cannot align /24 host subnets of cluster subnet 10.132.0.0/22 to /20 blocks"))
+			return nil
+		}
+		cliArgs := []string{
+			app.Name,
+			"-cluster-subnets=10.132.0.0/22/24",
+			"-host-subnet-alignment-bits=4",
+		}
+		err := app.Run(cliArgs)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	It("returns an error when the host subnet alignment leaves no IPv6 host subnet to allocate", func() {
+		app.Action = func(ctx *cli.Context) error {
+			_, err := InitConfig(ctx, kexec.New(), nil)
+			gomega.Expect(err).To(gomega.MatchError("cannot align /64 host subnets of cluster subnet fd01::/32 to /48 blocks: " +
+				"the blocks must be less than 2^16 subnets"))
+			return nil
+		}
+		cliArgs := []string{
+			app.Name,
+			"-cluster-subnets=fd01::/32/64",
+			"-host-subnet-alignment-bits=16",
+		}
+		err := app.Run(cliArgs)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
 	It("returns an error when the hybrid overlay cluster-subnets is invalid", func() {
 		app.Action = func(ctx *cli.Context) error {
 			_, err := InitConfig(ctx, kexec.New(), nil)
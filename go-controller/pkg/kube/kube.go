@@ -29,6 +29,7 @@ type Interface interface {
 	SetTaintOnNode(nodeName string, taint *kapi.Taint) error
 	RemoveTaintFromNode(nodeName string, taint *kapi.Taint) error
 	PatchNode(old, new *kapi.Node) error
+	PatchNodeStatus(old, new *kapi.Node) error
 	UpdateEgressFirewall(egressfirewall *egressfirewall.EgressFirewall) error
 	UpdateEgressIP(eIP *egressipv1.EgressIP) error
 	PatchEgressIP(name string, patchData []byte) error
@@ -226,6 +227,36 @@ func (k *Kube) PatchNode(old, new *kapi.Node) error {
 	return nil
 }
 
+// PatchNodeStatus patches the status of the old node object with the changes provided in
+// the status of the new node object.
+func (k *Kube) PatchNodeStatus(old, new *kapi.Node) error {
+	oldNodeObjectJson, err := json.Marshal(old)
+	if err != nil {
+		klog.Errorf("Unable to marshal node %s: %v", old.Name, err)
+		return err
+	}
+
+	newNodeObjectJson, err := json.Marshal(new)
+	if err != nil {
+		klog.Errorf("Unable to marshal node %s: %v", new.Name, err)
+		return err
+	}
+
+	patchBytes, err := strategicpatch.CreateTwoWayMergePatch(oldNodeObjectJson, newNodeObjectJson, kapi.Node{})
+	if err != nil {
+		klog.Errorf("Unable to patch status of node %s: %v", old.Name, err)
+		return err
+	}
+
+	if _, err = k.KClient.CoreV1().Nodes().Patch(context.TODO(), old.Name, types.StrategicMergePatchType, patchBytes,
+		metav1.PatchOptions{}, "status"); err != nil {
+		klog.Errorf("Unable to patch status of node %s: %v", old.Name, err)
+		return err
+	}
+
+	return nil
+}
+
 // UpdateEgressFirewall updates the EgressFirewall with the provided EgressFirewall data
 func (k *Kube) UpdateEgressFirewall(egressfirewall *egressfirewall.EgressFirewall) error {
 	klog.Infof("Updating status on EgressFirewall %s in namespace %s", egressfirewall.Name, egressfirewall.Namespace)
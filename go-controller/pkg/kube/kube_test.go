@@ -128,6 +128,28 @@ var _ = Describe("Kube", func() {
 		})
 	})
 
+	Describe("PatchNodeStatus", func() {
+		It("should patch the node conditions", func() {
+			kube := Kube{KClient: fake.NewSimpleClientset()}
+			node, err := kube.KClient.CoreV1().Nodes().Create(context.TODO(), &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "my-node"},
+				Status: v1.NodeStatus{
+					Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}},
+				},
+			}, metav1.CreateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+
+			newNode := node.DeepCopy()
+			condition := v1.NodeCondition{Type: "MyCondition", Status: v1.ConditionFalse, Reason: "MyReason"}
+			newNode.Status.Conditions = append(newNode.Status.Conditions, condition)
+			Expect(kube.PatchNodeStatus(node, newNode)).To(Succeed())
+
+			loadedNode, err := kube.KClient.CoreV1().Nodes().Get(context.TODO(), node.Name, metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(loadedNode.Status.Conditions).To(ConsistOf(node.Status.Conditions[0], condition))
+		})
+	})
+
 	Describe("SetAnnotationsOnPod", func() {
 		var kube Kube
 
@@ -309,6 +309,20 @@ func (_m *Interface) PatchNode(old *apicorev1.Node, new *apicorev1.Node) error {
 	return r0
 }
 
+// PatchNodeStatus provides a mock function with given fields: old, new
+func (_m *Interface) PatchNodeStatus(old *apicorev1.Node, new *apicorev1.Node) error {
+	ret := _m.Called(old, new)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*apicorev1.Node, *apicorev1.Node) error); ok {
+		r0 = rf(old, new)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // RemoveTaintFromNode provides a mock function with given fields: nodeName, taint
 func (_m *Interface) RemoveTaintFromNode(nodeName string, taint *apicorev1.Taint) error {
 	ret := _m.Called(nodeName, taint)
@@ -154,6 +154,17 @@ func DeleteIPsFromAddressSetOps(nbClient libovsdbclient.Client, ops []libovsdb.O
 
 // DeleteAddressSets deletes the provided address sets
 func DeleteAddressSets(nbClient libovsdbclient.Client, ass ...*nbdb.AddressSet) error {
+	m := newModelClient(nbClient)
+	return m.Delete(deleteAddressSetsOpModels(ass)...)
+}
+
+// DeleteAddressSetsOps returns the ops to delete the provided address sets
+func DeleteAddressSetsOps(nbClient libovsdbclient.Client, ops []libovsdb.Operation, ass ...*nbdb.AddressSet) ([]libovsdb.Operation, error) {
+	m := newModelClient(nbClient)
+	return m.DeleteOps(ops, deleteAddressSetsOpModels(ass)...)
+}
+
+func deleteAddressSetsOpModels(ass []*nbdb.AddressSet) []operationModel {
 	opModels := make([]operationModel, 0, len(ass))
 	for i := range ass {
 		as := ass[i]
@@ -164,9 +175,7 @@ func DeleteAddressSets(nbClient libovsdbclient.Client, ass ...*nbdb.AddressSet)
 		}
 		opModels = append(opModels, opModel)
 	}
-
-	m := newModelClient(nbClient)
-	return m.Delete(opModels...)
+	return opModels
 }
 
 // DeleteAddressSetsWithPredicate looks up address sets from the cache based on
@@ -1,14 +1,26 @@
 package libovsdbops
 
 import (
+	"context"
+
 	libovsdbclient "github.com/ovn-org/libovsdb/client"
 	"github.com/ovn-org/libovsdb/ovsdb"
 
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/nbdb"
+	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/types"
 )
 
 type coppPredicate func(*nbdb.Copp) bool
 
+// FindCOPPsWithPredicate looks up COPPs from the cache based on a given predicate
+func FindCOPPsWithPredicate(nbClient libovsdbclient.Client, p coppPredicate) ([]*nbdb.Copp, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), types.OVSDBTimeout)
+	defer cancel()
+	found := []*nbdb.Copp{}
+	err := nbClient.WhereCache(p).List(ctx, &found)
+	return found, err
+}
+
 // CreateOrUpdateCOPPsOps creates or updates the provided COPP returning the
 // corresponding ops
 func CreateOrUpdateCOPPsOps(nbClient libovsdbclient.Client, ops []ovsdb.Operation, copps ...*nbdb.Copp) ([]ovsdb.Operation, error) {
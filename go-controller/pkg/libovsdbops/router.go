@@ -74,21 +74,43 @@ func UpdateLogicalRouterSetExternalIDs(nbClient libovsdbclient.Client, router *n
 		return err
 	}
 
-	if router.ExternalIDs == nil {
-		router.ExternalIDs = map[string]string{}
+	router.ExternalIDs = mergeRouterColumn(router.ExternalIDs, externalIds)
+
+	opModel := operationModel{
+		Model:          router,
+		OnModelUpdates: []interface{}{&router.ExternalIDs},
+		ErrNotFound:    true,
+		BulkOp:         false,
 	}
 
-	for k, v := range externalIds {
-		if v == "" {
-			delete(router.ExternalIDs, k)
-		} else {
-			router.ExternalIDs[k] = v
-		}
+	m := newModelClient(nbClient)
+	_, err = m.CreateOrUpdate(opModel)
+	return err
+}
+
+// UpdateLogicalRouterSetExternalIDsAndOptions sets external IDs and options on the
+// provided logical router in a single transaction. Both are merged like in
+// UpdateLogicalRouterSetExternalIDs: missing keys are added, the ones set to an empty
+// value removed and existing ones updated. The options column is left alone if no
+// option is provided.
+func UpdateLogicalRouterSetExternalIDsAndOptions(nbClient libovsdbclient.Client, router *nbdb.LogicalRouter) error {
+	externalIDs := router.ExternalIDs
+	options := router.Options
+	router, err := GetLogicalRouter(nbClient, router)
+	if err != nil {
+		return err
+	}
+
+	router.ExternalIDs = mergeRouterColumn(router.ExternalIDs, externalIDs)
+	fields := []interface{}{&router.ExternalIDs}
+	if len(options) > 0 {
+		router.Options = mergeRouterColumn(router.Options, options)
+		fields = append(fields, &router.Options)
 	}
 
 	opModel := operationModel{
 		Model:          router,
-		OnModelUpdates: []interface{}{&router.ExternalIDs},
+		OnModelUpdates: fields,
 		ErrNotFound:    true,
 		BulkOp:         false,
 	}
@@ -98,6 +120,22 @@ func UpdateLogicalRouterSetExternalIDs(nbClient libovsdbclient.Client, router *n
 	return err
 }
 
+// mergeRouterColumn merges updates into the existing values of a router map column,
+// removing the keys updated to an empty value
+func mergeRouterColumn(existing, updates map[string]string) map[string]string {
+	if existing == nil {
+		existing = map[string]string{}
+	}
+	for k, v := range updates {
+		if v == "" {
+			delete(existing, k)
+		} else {
+			existing[k] = v
+		}
+	}
+	return existing
+}
+
 // DeleteLogicalRouter deletes the provided logical router
 func DeleteLogicalRouter(nbClient libovsdbclient.Client, router *nbdb.LogicalRouter) error {
 	opModel := operationModel{
@@ -111,6 +149,28 @@ func DeleteLogicalRouter(nbClient libovsdbclient.Client, router *nbdb.LogicalRou
 	return m.Delete(opModel)
 }
 
+// ReplaceLogicalRouter deletes the provided existing logical router and creates
+// the provided new one in a single transaction. Rows referenced by the existing
+// router, like its ports, are kept as long as the new router references them.
+func ReplaceLogicalRouter(nbClient libovsdbclient.Client, existing, router *nbdb.LogicalRouter) error {
+	m := newModelClient(nbClient)
+	ops, err := m.DeleteOps(nil, operationModel{
+		Model:       existing,
+		ErrNotFound: true,
+		BulkOp:      false,
+	})
+	if err != nil {
+		return err
+	}
+	createOps, err := m.create(&operationModel{Model: router})
+	if err != nil {
+		return err
+	}
+	ops = append(ops, createOps...)
+	_, err = TransactAndCheckAndSetUUIDs(nbClient, router, ops)
+	return err
+}
+
 // LOGICAL ROUTER PORT OPs
 
 // GetLogicalRouterPort looks up a logical router port from the cache
@@ -132,23 +192,51 @@ func GetLogicalRouterPort(nbClient libovsdbclient.Client, lrp *nbdb.LogicalRoute
 	return found[0], nil
 }
 
+type logicalRouterPortPredicate func(*nbdb.LogicalRouterPort) bool
+
+// FindLogicalRouterPortsWithPredicate looks up logical router ports from the
+// cache based on a given predicate
+func FindLogicalRouterPortsWithPredicate(nbClient libovsdbclient.Client, p logicalRouterPortPredicate) ([]*nbdb.LogicalRouterPort, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), types.OVSDBTimeout)
+	defer cancel()
+	found := []*nbdb.LogicalRouterPort{}
+	err := nbClient.WhereCache(p).List(ctx, &found)
+	return found, err
+}
+
 // CreateOrUpdateLogicalRouterPort creates or updates the provided logical
 // router port together with the gateway chassis (if not nil), and adds it to the provided logical router
 func CreateOrUpdateLogicalRouterPort(nbClient libovsdbclient.Client, router *nbdb.LogicalRouter,
 	lrp *nbdb.LogicalRouterPort, chassis *nbdb.GatewayChassis, fields ...interface{}) error {
-	opModels := []operationModel{}
+	var gatewayChassis []*nbdb.GatewayChassis
 	if chassis != nil {
+		gatewayChassis = []*nbdb.GatewayChassis{chassis}
+	}
+	return CreateOrUpdateLogicalRouterPortWithGatewayChassis(nbClient, router, lrp, gatewayChassis, fields...)
+}
+
+// CreateOrUpdateLogicalRouterPortWithGatewayChassis creates or updates the provided logical
+// router port together with the provided gateway chassis, which replace the gateway chassis
+// of the port unless none is provided, and adds it to the provided logical router
+func CreateOrUpdateLogicalRouterPortWithGatewayChassis(nbClient libovsdbclient.Client, router *nbdb.LogicalRouter,
+	lrp *nbdb.LogicalRouterPort, chassis []*nbdb.GatewayChassis, fields ...interface{}) error {
+	opModels := []operationModel{}
+	if len(chassis) > 0 {
+		lrp.GatewayChassis = make([]string, 0, len(chassis))
+	}
+	for i := range chassis {
+		gatewayChassis := chassis[i]
 		opModels = append(opModels, operationModel{
-			Model:          chassis,
+			Model:          gatewayChassis,
 			OnModelUpdates: onModelUpdatesAllNonDefault(),
-			DoAfter:        func() { lrp.GatewayChassis = []string{chassis.UUID} },
+			DoAfter:        func() { lrp.GatewayChassis = append(lrp.GatewayChassis, gatewayChassis.UUID) },
 			ErrNotFound:    false,
 			BulkOp:         false,
 		})
 	}
 	if len(fields) == 0 {
 		fields = onModelUpdatesAllNonDefault()
-	} else if chassis != nil {
+	} else if len(chassis) > 0 {
 		fields = append(fields, &lrp.GatewayChassis)
 	}
 	originalPorts := router.Ports
@@ -176,6 +264,18 @@ func CreateOrUpdateLogicalRouterPort(nbClient libovsdbclient.Client, router *nbd
 // DeleteLogicalRouterPorts deletes the provided logical router ports and
 // removes them from the provided logical router
 func DeleteLogicalRouterPorts(nbClient libovsdbclient.Client, router *nbdb.LogicalRouter, lrps ...*nbdb.LogicalRouterPort) error {
+	ops, err := DeleteLogicalRouterPortsOps(nbClient, nil, router, lrps...)
+	if err != nil {
+		return err
+	}
+	_, err = TransactAndCheck(nbClient, ops)
+	return err
+}
+
+// DeleteLogicalRouterPortsOps returns the ops to delete the provided logical router
+// ports and remove them from the provided logical router. Ports that don't exist
+// are ignored.
+func DeleteLogicalRouterPortsOps(nbClient libovsdbclient.Client, ops []libovsdb.Operation, router *nbdb.LogicalRouter, lrps ...*nbdb.LogicalRouterPort) ([]libovsdb.Operation, error) {
 	originalPorts := router.Ports
 	router.Ports = make([]string, 0, len(lrps))
 	opModels := make([]operationModel, 0, len(lrps)+1)
@@ -203,9 +303,9 @@ func DeleteLogicalRouterPorts(nbClient libovsdbclient.Client, router *nbdb.Logic
 	opModels = append(opModels, opModel)
 
 	m := newModelClient(nbClient)
-	err := m.Delete(opModels...)
+	ops, err := m.DeleteOps(ops, opModels...)
 	router.Ports = originalPorts
-	return err
+	return ops, err
 }
 
 // LOGICAL ROUTER POLICY OPs
@@ -1021,6 +1121,53 @@ func DeleteNATsWithPredicateOps(nbClient libovsdbclient.Client, ops []libovsdb.O
 
 // GATEWAY CHASSIS OPs
 
+// GetGatewayChassis looks up a gateway chassis from the cache
+func GetGatewayChassis(nbClient libovsdbclient.Client, chassis *nbdb.GatewayChassis) (*nbdb.GatewayChassis, error) {
+	found := []*nbdb.GatewayChassis{}
+	opModel := operationModel{
+		Model:          chassis,
+		ExistingResult: &found,
+		ErrNotFound:    true,
+		BulkOp:         false,
+	}
+
+	m := newModelClient(nbClient)
+	err := m.Lookup(opModel)
+	if err != nil {
+		return nil, err
+	}
+
+	return found[0], nil
+}
+
+type gatewayChassisPredicate func(*nbdb.GatewayChassis) bool
+
+// FindGatewayChassisWithPredicate looks up gateway chassis from the cache based
+// on a given predicate
+func FindGatewayChassisWithPredicate(nbClient libovsdbclient.Client, p gatewayChassisPredicate) ([]*nbdb.GatewayChassis, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), types.OVSDBTimeout)
+	defer cancel()
+	found := []*nbdb.GatewayChassis{}
+	err := nbClient.WhereCache(p).List(ctx, &found)
+	return found, err
+}
+
+// DeleteGatewayChassis deletes the provided gateway chassis
+func DeleteGatewayChassis(nbClient libovsdbclient.Client, chassis ...*nbdb.GatewayChassis) error {
+	opModels := make([]operationModel, 0, len(chassis))
+	for i := range chassis {
+		opModel := operationModel{
+			Model:       chassis[i],
+			ErrNotFound: false,
+			BulkOp:      false,
+		}
+		opModels = append(opModels, opModel)
+	}
+
+	m := newModelClient(nbClient)
+	return m.Delete(opModels...)
+}
+
 // CreateOrUpdateGatewayChassis creates or updates the provided gateway chassis
 // and sets it to the provided logical router port
 func CreateOrUpdateGatewayChassis(nbClient libovsdbclient.Client, port *nbdb.LogicalRouterPort, chassis *nbdb.GatewayChassis, fields ...interface{}) error {
@@ -1,9 +1,13 @@
 package libovsdbops
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
+	libovsdbclient "github.com/ovn-org/libovsdb/client"
+	"github.com/ovn-org/libovsdb/ovsdb"
+
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/nbdb"
 	libovsdbtest "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/testing/libovsdb"
 )
@@ -221,3 +225,90 @@ func TestDeleteNATsFromRouter(t *testing.T) {
 	}
 
 }
+
+// transactRecorder records the transactions made through a client
+type transactRecorder struct {
+	libovsdbclient.Client
+	transactions [][]ovsdb.Operation
+}
+
+func (r *transactRecorder) Transact(ctx context.Context, ops ...ovsdb.Operation) ([]ovsdb.OperationResult, error) {
+	r.transactions = append(r.transactions, ops)
+	return r.Client.Transact(ctx, ops...)
+}
+
+func TestUpdateLogicalRouterSetExternalIDsAndOptions(t *testing.T) {
+	fakeRouter := &nbdb.LogicalRouter{
+		Name:        "rtr1",
+		UUID:        buildNamedUUID(),
+		ExternalIDs: map[string]string{"k8s-cluster-router": "yes", "k8s-ovn-topo-version": "1"},
+		Options:     map[string]string{"mcast_relay": "true", "always_learn_from_arp_request": "false"},
+	}
+
+	tests := []struct {
+		desc                string
+		externalIDs         map[string]string
+		options             map[string]string
+		expectedExternalIDs map[string]string
+		expectedOptions     map[string]string
+	}{
+		{
+			desc:                "merges external IDs and options",
+			externalIDs:         map[string]string{"k8s-ovn-topo-version": "2"},
+			options:             map[string]string{"always_learn_from_arp_request": "true", "dynamic_neigh_routers": "true"},
+			expectedExternalIDs: map[string]string{"k8s-cluster-router": "yes", "k8s-ovn-topo-version": "2"},
+			expectedOptions: map[string]string{"mcast_relay": "true", "always_learn_from_arp_request": "true",
+				"dynamic_neigh_routers": "true"},
+		},
+		{
+			desc:                "removes the options set to an empty value",
+			externalIDs:         map[string]string{"k8s-ovn-topo-version": "2"},
+			options:             map[string]string{"mcast_relay": ""},
+			expectedExternalIDs: map[string]string{"k8s-cluster-router": "yes", "k8s-ovn-topo-version": "2"},
+			expectedOptions:     map[string]string{"always_learn_from_arp_request": "false"},
+		},
+		{
+			desc:                "keeps the options if none is provided",
+			externalIDs:         map[string]string{"k8s-ovn-topo-version": "2"},
+			expectedExternalIDs: map[string]string{"k8s-cluster-router": "yes", "k8s-ovn-topo-version": "2"},
+			expectedOptions:     fakeRouter.Options,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			nbClient, cleanup, err := libovsdbtest.NewNBTestHarness(libovsdbtest.TestSetup{
+				NBData: []libovsdbtest.TestData{fakeRouter.DeepCopy()},
+			}, nil)
+			if err != nil {
+				t.Fatalf("test: \"%s\" failed to set up test harness: %v", tt.desc, err)
+			}
+			t.Cleanup(cleanup.Cleanup)
+			recorder := &transactRecorder{Client: nbClient}
+
+			logicalRouter := nbdb.LogicalRouter{
+				Name:        fakeRouter.Name,
+				ExternalIDs: tt.externalIDs,
+				Options:     tt.options,
+			}
+			if err = UpdateLogicalRouterSetExternalIDsAndOptions(recorder, &logicalRouter); err != nil {
+				t.Fatalf("test: \"%s\" UpdateLogicalRouterSetExternalIDsAndOptions() error = %v", tt.desc, err)
+			}
+			if len(recorder.transactions) != 1 || len(recorder.transactions[0]) != 1 {
+				t.Fatalf("test: \"%s\" expected a single transaction updating the router, got %v", tt.desc, recorder.transactions)
+			}
+
+			expected := fakeRouter.DeepCopy()
+			expected.ExternalIDs = tt.expectedExternalIDs
+			expected.Options = tt.expectedOptions
+			matcher := libovsdbtest.HaveData([]libovsdbtest.TestData{expected})
+			success, err := matcher.Match(nbClient)
+			if !success {
+				t.Fatal(fmt.Errorf("test: \"%s\" didn't match expected with actual, err: %v", tt.desc, matcher.FailureMessage(nbClient)))
+			}
+			if err != nil {
+				t.Fatal(fmt.Errorf("test: \"%s\" encountered error: %v", tt.desc, err))
+			}
+		})
+	}
+}
@@ -80,6 +80,26 @@ func DeleteLogicalSwitch(nbClient libovsdbclient.Client, swName string) error {
 	return m.Delete(opModel)
 }
 
+// DeleteLogicalSwitchesOps returns the ops to delete the logical switches with the
+// provided names. Switches that don't exist are ignored.
+func DeleteLogicalSwitchesOps(nbClient libovsdbclient.Client, ops []libovsdb.Operation, swNames ...string) ([]libovsdb.Operation, error) {
+	opModels := make([]operationModel, 0, len(swNames))
+	for _, swName := range swNames {
+		sw := nbdb.LogicalSwitch{
+			Name: swName,
+		}
+		opModels = append(opModels, operationModel{
+			Model:          &sw,
+			ModelPredicate: func(item *nbdb.LogicalSwitch) bool { return item.Name == sw.Name },
+			ErrNotFound:    false,
+			BulkOp:         false,
+		})
+	}
+
+	m := newModelClient(nbClient)
+	return m.DeleteOps(ops, opModels...)
+}
+
 // LB ops
 
 // AddLoadBalancersToLogicalSwitchOps adds the provided load balancers to the
@@ -213,6 +233,21 @@ func UpdateLogicalSwitchSetOtherConfig(nbClient libovsdbclient.Client, sw *nbdb.
 	return err
 }
 
+// UpdateLogicalSwitchSetLoadBalancerGroup sets the load balancer groups of the provided
+// logical switch, which must exist
+func UpdateLogicalSwitchSetLoadBalancerGroup(nbClient libovsdbclient.Client, sw *nbdb.LogicalSwitch) error {
+	opModel := operationModel{
+		Model:          sw,
+		OnModelUpdates: []interface{}{&sw.LoadBalancerGroup},
+		ErrNotFound:    true,
+		BulkOp:         false,
+	}
+
+	m := newModelClient(nbClient)
+	_, err := m.CreateOrUpdate(opModel)
+	return err
+}
+
 // LOGICAL SWITCH PORT OPs
 
 // GetLogicalSwitchPort looks up a logical switch port from the cache
@@ -343,6 +378,16 @@ func DeleteLogicalSwitchPorts(nbClient libovsdbclient.Client, sw *nbdb.LogicalSw
 
 type logicalSwitchPortPredicate func(*nbdb.LogicalSwitchPort) bool
 
+// FindLogicalSwitchPortsWithPredicate looks up logical switch ports from the
+// cache based on a given predicate
+func FindLogicalSwitchPortsWithPredicate(nbClient libovsdbclient.Client, p logicalSwitchPortPredicate) ([]*nbdb.LogicalSwitchPort, error) {
+	found := []*nbdb.LogicalSwitchPort{}
+	ctx, cancel := context.WithTimeout(context.Background(), types.OVSDBTimeout)
+	defer cancel()
+	err := nbClient.WhereCache(p).List(ctx, &found)
+	return found, err
+}
+
 // DeleteLogicalSwitchPortsWithPredicateOps looks up logical switch ports from
 // the cache based on a given predicate and removes from them the provided
 // logical switch
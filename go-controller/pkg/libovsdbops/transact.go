@@ -33,6 +33,24 @@ func TransactWithRetry(ctx context.Context, c client.Client, ops []ovsdb.Operati
 	return results, resultErr
 }
 
+// transactTimeoutClient is a client whose transactions time out after a given time
+type transactTimeoutClient struct {
+	client.Client
+	timeout time.Duration
+}
+
+func (c *transactTimeoutClient) Transact(ctx context.Context, ops ...ovsdb.Operation) ([]ovsdb.OperationResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.Client.Transact(ctx, ops...)
+}
+
+// WithTransactTimeout returns a client that cancels the transactions made through it
+// after timeout, or after the timeout of the context they are made with if sooner
+func WithTransactTimeout(c client.Client, timeout time.Duration) client.Client {
+	return &transactTimeoutClient{Client: c, timeout: timeout}
+}
+
 func TransactAndCheck(c client.Client, ops []ovsdb.Operation) ([]ovsdb.OperationResult, error) {
 	if len(ops) <= 0 {
 		return []ovsdb.OperationResult{{}}, nil
@@ -45,7 +63,7 @@ func TransactAndCheck(c client.Client, ops []ovsdb.Operation) ([]ovsdb.Operation
 
 	results, err := TransactWithRetry(ctx, c, ops)
 	if err != nil {
-		return nil, fmt.Errorf("error in transact with ops %+v: %v", ops, err)
+		return nil, fmt.Errorf("error in transact with ops %+v: %w", ops, err)
 	}
 
 	opErrors, err := ovsdb.CheckOperationResults(results, ops)
@@ -167,6 +167,19 @@ var metricV6HostSubnetCount = prometheus.NewGauge(prometheus.GaugeOpts{
 	Help:      "The total number of v6 host subnets possible",
 })
 
+// MetricClusterSubnetMaxNodes is the configured maximum number of nodes allocated host
+// subnets from each cluster subnet with a cap
+var MetricClusterSubnetMaxNodes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: MetricOvnkubeNamespace,
+	Subsystem: MetricOvnkubeSubsystemMaster,
+	Name:      "cluster_subnet_max_nodes",
+	Help:      "The maximum number of nodes allocated host subnets from the cluster subnet",
+},
+	[]string{
+		"cidr",
+	},
+)
+
 var metricV4AllocatedHostSubnetCount = prometheus.NewGauge(prometheus.GaugeOpts{
 	Namespace: MetricOvnkubeNamespace,
 	Subsystem: MetricOvnkubeSubsystemMaster,
@@ -218,6 +231,104 @@ var metricEgressIPRebalanceCount = prometheus.NewCounter(prometheus.CounterOpts{
 	Help:      "The total number of times assigned egress IP(s) needed to be moved to a different node"},
 )
 
+// MetricClusterRouterOptionsOverwriteCount is the number of updates of the cluster router
+// that dropped options the router had, instead of merging them
+var MetricClusterRouterOptionsOverwriteCount = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: MetricOvnkubeNamespace,
+	Subsystem: MetricOvnkubeSubsystemMaster,
+	Name:      "cluster_router_options_overwrites_total",
+	Help:      "The total number of cluster router updates replacing, rather than merging, the router options"},
+)
+
+// MetricManagedObjectCount is the number of OVN objects of each type a network
+// controller manages, as last refreshed
+var MetricManagedObjectCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: MetricOvnkubeNamespace,
+	Subsystem: MetricOvnkubeSubsystemMaster,
+	Name:      "num_managed_objects",
+	Help:      "The number of OVN objects of each type managed for a network"},
+	[]string{
+		"network",
+		"type",
+	},
+)
+
+// MetricNodeReconcileTimestamp is the UNIX timestamp of the last full reconcile of the
+// nodes of a network, either the initial sync of the node watcher or a periodic sync
+var MetricNodeReconcileTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: MetricOvnkubeNamespace,
+	Subsystem: MetricOvnkubeSubsystemMaster,
+	Name:      "node_reconcile_timestamp_seconds",
+	Help:      "The UNIX timestamp of the last completed full reconcile of the nodes of a network"},
+	[]string{
+		"network",
+	},
+)
+
+// MetricNodeHandlerStallCount is the number of times the node handler went longer than the
+// configured stall timeout without completing any of the node events it was handling
+var MetricNodeHandlerStallCount = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: MetricOvnkubeNamespace,
+	Subsystem: MetricOvnkubeSubsystemMaster,
+	Name:      "node_handler_stalls_total",
+	Help:      "The number of times the node handler was detected as stalled",
+})
+
+// MetricNodeSubnetFamilyExhaustedCount is the number of node subnet allocations of a
+// dual-stack cluster that found the node subnets of one IP family exhausted while the
+// other family still had free subnets
+var MetricNodeSubnetFamilyExhaustedCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: MetricOvnkubeNamespace,
+	Subsystem: MetricOvnkubeSubsystemMaster,
+	Name:      "node_subnet_family_exhausted_total",
+	Help: "The number of dual-stack node subnet allocations that found the node subnets of one IP " +
+		"family exhausted while the other family had free subnets, by exhausted family and by " +
+		"whether the node got the subnet of the other family only"},
+	[]string{
+		"family",
+		"single_family",
+	},
+)
+
+// MetricNodeSubnetAllocationCount is the number of node subnets newly allocated from the
+// cluster subnets of a network, by IP family
+var MetricNodeSubnetAllocationCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: MetricOvnkubeNamespace,
+	Subsystem: MetricOvnkubeSubsystemMaster,
+	Name:      "node_subnet_allocations_total",
+	Help:      "The number of node subnets allocated from the cluster subnets of a network, by IP family"},
+	[]string{
+		"network",
+		"family",
+	},
+)
+
+// MetricNodeSubnetReleaseCount is the number of node subnets released back to the cluster
+// subnets of a network, by IP family
+var MetricNodeSubnetReleaseCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: MetricOvnkubeNamespace,
+	Subsystem: MetricOvnkubeSubsystemMaster,
+	Name:      "node_subnet_releases_total",
+	Help:      "The number of node subnets released back to the cluster subnets of a network, by IP family"},
+	[]string{
+		"network",
+		"family",
+	},
+)
+
+// MetricTopologyUpgradeCount is the number of upgrades of the OVN topology run at
+// startup, by the topology version upgraded from and to
+var MetricTopologyUpgradeCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: MetricOvnkubeNamespace,
+	Subsystem: MetricOvnkubeSubsystemMaster,
+	Name:      "topology_upgrades_total",
+	Help:      "The total number of OVN topology upgrades started, by topology version"},
+	[]string{
+		"from_version",
+		"to_version",
+	},
+)
+
 var metricEgressFirewallRuleCount = prometheus.NewGauge(prometheus.GaugeOpts{
 	Namespace: MetricOvnkubeNamespace,
 	Subsystem: MetricOvnkubeSubsystemMaster,
@@ -370,6 +481,7 @@ func RegisterMasterFunctional() {
 	// No need to unregister because process exits when leadership is lost.
 	prometheus.MustRegister(metricV4HostSubnetCount)
 	prometheus.MustRegister(metricV6HostSubnetCount)
+	prometheus.MustRegister(MetricClusterSubnetMaxNodes)
 	prometheus.MustRegister(metricV4AllocatedHostSubnetCount)
 	prometheus.MustRegister(metricV6AllocatedHostSubnetCount)
 	prometheus.MustRegister(metricEgressIPCount)
@@ -379,6 +491,14 @@ func RegisterMasterFunctional() {
 	}
 	prometheus.MustRegister(metricEgressIPNodeUnreacheableCount)
 	prometheus.MustRegister(metricEgressIPRebalanceCount)
+	prometheus.MustRegister(MetricClusterRouterOptionsOverwriteCount)
+	prometheus.MustRegister(MetricManagedObjectCount)
+	prometheus.MustRegister(MetricNodeReconcileTimestamp)
+	prometheus.MustRegister(MetricNodeSubnetFamilyExhaustedCount)
+	prometheus.MustRegister(MetricNodeSubnetAllocationCount)
+	prometheus.MustRegister(MetricNodeSubnetReleaseCount)
+	prometheus.MustRegister(MetricNodeHandlerStallCount)
+	prometheus.MustRegister(MetricTopologyUpgradeCount)
 	prometheus.MustRegister(metricEgressFirewallRuleCount)
 	prometheus.MustRegister(metricEgressFirewallCount)
 	prometheus.MustRegister(metricEgressRoutingViaHost)
@@ -462,6 +582,16 @@ func RecordSubnetCount(v4SubnetCount, v6SubnetCount float64) {
 	metricV6HostSubnetCount.Set(v6SubnetCount)
 }
 
+// RecordClusterSubnetMaxNodes records the maximum number of nodes allocated host subnets
+// from the given cluster subnet, 0 for no maximum
+func RecordClusterSubnetMaxNodes(cidr string, maxNodes int) {
+	if maxNodes == 0 {
+		MetricClusterSubnetMaxNodes.DeleteLabelValues(cidr)
+		return
+	}
+	MetricClusterSubnetMaxNodes.WithLabelValues(cidr).Set(float64(maxNodes))
+}
+
 // RecordEgressIPCount records the total number of Egress IPs.
 // This total may include multiple Egress IPs per EgressIP CR.
 func RecordEgressIPCount(count float64) {
@@ -488,6 +618,52 @@ func RecordEgressIPRebalance(count int) {
 	metricEgressIPRebalanceCount.Add(float64(count))
 }
 
+// RecordClusterRouterOptionsOverwrite records an update of the cluster router dropping some of its options.
+func RecordClusterRouterOptionsOverwrite() {
+	MetricClusterRouterOptionsOverwriteCount.Inc()
+}
+
+// RecordManagedObjectCounts records the number of logical switches, router ports and
+// gateway chassis managed for a network.
+func RecordManagedObjectCounts(network string, logicalSwitches, routerPorts, gatewayChassis int) {
+	MetricManagedObjectCount.WithLabelValues(network, "logical_switch").Set(float64(logicalSwitches))
+	MetricManagedObjectCount.WithLabelValues(network, "logical_router_port").Set(float64(routerPorts))
+	MetricManagedObjectCount.WithLabelValues(network, "gateway_chassis").Set(float64(gatewayChassis))
+}
+
+// RecordNodeReconcile records that a full reconcile of the nodes of a network just completed.
+func RecordNodeReconcile(network string) {
+	MetricNodeReconcileTimestamp.WithLabelValues(network).SetToCurrentTime()
+}
+
+// RecordNodeSubnetFamilyExhausted records a dual-stack node subnet allocation that found the
+// node subnets of the given family exhausted, and whether the node got single-family subnets.
+func RecordNodeSubnetFamilyExhausted(family string, singleFamily bool) {
+	MetricNodeSubnetFamilyExhaustedCount.WithLabelValues(family, strconv.FormatBool(singleFamily)).Inc()
+}
+
+// RecordNodeSubnetAllocation records the allocation of a node subnet of the given IP family
+// from the cluster subnets of the network.
+func RecordNodeSubnetAllocation(network, family string) {
+	MetricNodeSubnetAllocationCount.WithLabelValues(network, family).Inc()
+}
+
+// RecordNodeSubnetRelease records the release of a node subnet of the given IP family back
+// to the cluster subnets of the network.
+func RecordNodeSubnetRelease(network, family string) {
+	MetricNodeSubnetReleaseCount.WithLabelValues(network, family).Inc()
+}
+
+// RecordNodeHandlerStall records a stall of the node handler.
+func RecordNodeHandlerStall() {
+	MetricNodeHandlerStallCount.Inc()
+}
+
+// RecordTopologyUpgrade records the start of an upgrade of the OVN topology between the given versions.
+func RecordTopologyUpgrade(fromVersion, toVersion int) {
+	MetricTopologyUpgradeCount.WithLabelValues(strconv.Itoa(fromVersion), strconv.Itoa(toVersion)).Inc()
+}
+
 // UpdateEgressFirewallRuleCount records the number of Egress firewall rules.
 func UpdateEgressFirewallRuleCount(count float64) {
 	metricEgressFirewallRuleCount.Add(count)
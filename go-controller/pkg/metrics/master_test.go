@@ -19,6 +19,7 @@ import (
 
 	"github.com/onsi/ginkgo"
 	"github.com/onsi/gomega"
+	dto "github.com/prometheus/client_model/go"
 )
 
 func setupOvn(nbData libovsdbtest.TestSetup) (client.Client, client.Client, *libovsdbtest.Cleanup) {
@@ -239,3 +240,16 @@ var _ = ginkgo.Describe("Config Duration Operations", func() {
 		})
 	})
 })
+
+var _ = ginkgo.Describe("Cluster router options overwrites", func() {
+	ginkgo.It("records each overwrite", func() {
+		count := func() float64 {
+			m := &dto.Metric{}
+			gomega.Expect(MetricClusterRouterOptionsOverwriteCount.Write(m)).To(gomega.Succeed())
+			return m.GetCounter().GetValue()
+		}
+		before := count()
+		RecordClusterRouterOptionsOverwrite()
+		gomega.Expect(count()).To(gomega.Equal(before + 1))
+	})
+})
@@ -191,12 +191,12 @@ func NewNetworkControllerManager(ovnClient *util.OVNClientset, identity string,
 func (cm *NetworkControllerManager) Init() error {
 	cm.configureMetrics(cm.stopChan)
 
-	err := cm.configureSCTPSupport()
+	capabilities, err := util.DetectOVNCapabilities()
 	if err != nil {
 		return err
 	}
-
-	cm.configureMulticastSupport()
+	cm.SCTPSupport = capabilities.SCTP
+	cm.multicastSupport = capabilities.Multicast
 
 	err = cm.enableOVNLogicalDataPathGroups()
 	if err != nil {
@@ -207,32 +207,6 @@ func (cm *NetworkControllerManager) Init() error {
 	return nil
 }
 
-func (cm *NetworkControllerManager) configureSCTPSupport() error {
-	hasSCTPSupport, err := util.DetectSCTPSupport()
-	if err != nil {
-		return err
-	}
-
-	if !hasSCTPSupport {
-		klog.Warningf("SCTP unsupported by this version of OVN. Kubernetes service creation with SCTP will not work ")
-	} else {
-		klog.Info("SCTP support detected in OVN")
-	}
-	cm.SCTPSupport = hasSCTPSupport
-	return nil
-}
-
-func (cm *NetworkControllerManager) configureMulticastSupport() {
-	cm.multicastSupport = config.EnableMulticast
-	if cm.multicastSupport {
-		if _, _, err := util.RunOVNSbctl("--columns=_uuid", "list", "IGMP_Group"); err != nil {
-			klog.Warningf("Multicast support enabled, however version of OVN in use does not support IGMP Group. " +
-				"Disabling Multicast Support")
-			cm.multicastSupport = false
-		}
-	}
-}
-
 // enableOVNLogicalDataPathGroups sets an OVN flag to enable logical datapath
 // groups on OVN 20.12 and later. The option is ignored if OVN doesn't
 // understand it. Logical datapath groups reduce the size of the southbound
@@ -63,6 +63,8 @@ type AddressSet interface {
 	// DeleteIPsReturnOps returns the ops needed to delete the array of IPs from the address set
 	DeleteIPsReturnOps(ip []net.IP) ([]ovsdb.Operation, error)
 	Destroy() error
+	// DestroyReturnOps returns the ops needed to destroy the address set
+	DestroyReturnOps() ([]ovsdb.Operation, error)
 }
 
 type ovnAddressSetFactory struct {
@@ -451,6 +453,22 @@ func (as *ovnAddressSets) Destroy() error {
 	return nil
 }
 
+func (as *ovnAddressSets) DestroyReturnOps() ([]ovsdb.Operation, error) {
+	var ops []ovsdb.Operation
+	var err error
+	if as.ipv4 != nil {
+		if ops, err = as.ipv4.destroyOps(ops); err != nil {
+			return nil, err
+		}
+	}
+	if as.ipv6 != nil {
+		if ops, err = as.ipv6.destroyOps(ops); err != nil {
+			return nil, err
+		}
+	}
+	return ops, nil
+}
+
 // setIP updates the given address set in OVN to be only the given IPs, disregarding
 // existing state.
 func (as *ovnAddressSet) setIPs(ips []net.IP) error {
@@ -558,6 +576,20 @@ func (as *ovnAddressSet) destroy() error {
 	return nil
 }
 
+func (as *ovnAddressSet) destroyOps(ops []ovsdb.Operation) ([]ovsdb.Operation, error) {
+	klog.V(5).Infof("Destroy(%s) ops", asDetail(as))
+	addrset := nbdb.AddressSet{
+		UUID: as.uuid,
+		Name: as.hashName,
+	}
+	ops, err := libovsdbops.DeleteAddressSetsOps(as.nbClient, ops, &addrset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ops to delete address set %+v: %v", addrset, err)
+	}
+
+	return ops, nil
+}
+
 func MakeAddressSetName(name string) (string, string) {
 	return name + ipv4AddressSetSuffix, name + ipv6AddressSetSuffix
 }
@@ -198,6 +198,11 @@ func (f *FakeAddressSetFactory) EventuallyExpectAddressSet(name string) {
 	}).Should(gomega.BeTrue())
 }
 
+// ExpectNoAddressSet ensures the named address set does not exist
+func (f *FakeAddressSetFactory) ExpectNoAddressSet(name string) {
+	gomega.Expect(f.addressSetExists(name)).To(gomega.BeFalse())
+}
+
 // EventuallyExpectNoAddressSet ensures the named address set eventually does not exist
 func (f *FakeAddressSetFactory) EventuallyExpectNoAddressSet(name string) {
 	gomega.Eventually(func() bool {
@@ -383,6 +388,10 @@ func (as *fakeAddressSets) Destroy() error {
 	return nil
 }
 
+func (as *fakeAddressSets) DestroyReturnOps() ([]ovsdb.Operation, error) {
+	return nil, as.Destroy()
+}
+
 func (as *fakeAddressSet) getHashName() string {
 	gomega.Expect(atomic.LoadUint32(&as.destroyed)).To(gomega.Equal(uint32(0)))
 	return as.hashName
@@ -103,6 +103,29 @@ func (_m *AddressSet) Destroy() error {
 	return r0
 }
 
+// DestroyReturnOps provides a mock function with given fields:
+func (_m *AddressSet) DestroyReturnOps() ([]ovsdb.Operation, error) {
+	ret := _m.Called()
+
+	var r0 []ovsdb.Operation
+	if rf, ok := ret.Get(0).(func() []ovsdb.Operation); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]ovsdb.Operation)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetASHashNames provides a mock function with given fields:
 func (_m *AddressSet) GetASHashNames() (string, string) {
 	ret := _m.Called()
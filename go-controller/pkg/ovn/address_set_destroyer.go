@@ -0,0 +1,82 @@
+package ovn
+
+import (
+	"sync"
+
+	addressset "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/ovn/address_set"
+)
+
+const (
+	// addressSetDestroyWorkers is the maximum number of batches of deferred address
+	// set destroys run at the same time
+	addressSetDestroyWorkers = 4
+	// addressSetDestroyBatchSize is the maximum number of address sets destroyed in
+	// a single transaction
+	addressSetDestroyBatchSize = 64
+)
+
+// deferredAddressSetDestroy is the destroy of the address set of a deleted namespace,
+// ready to run once its deferral delay has passed
+type deferredAddressSetDestroy struct {
+	namespace  string
+	addressSet addressset.AddressSet
+	// token of the pending destroy of the namespace, that a later delete of the
+	// namespace replaces to supersede this destroy
+	token chan struct{}
+	// generation of the namespace when it was deleted, that a re-creation of the
+	// namespace bumps
+	generation uint64
+}
+
+// addressSetDestroyer runs the deferred address set destroys that are ready. Destroys
+// queued while the workers are busy are grouped into batches, so that a mass delete of
+// namespaces takes a transaction per batch rather than per address set.
+type addressSetDestroyer struct {
+	sync.Mutex
+	queue      []*deferredAddressSetDestroy
+	workers    int
+	maxWorkers int
+	batchSize  int
+	// destroyBatch destroys a batch of address sets
+	destroyBatch func([]*deferredAddressSetDestroy)
+}
+
+func newAddressSetDestroyer(destroyBatch func([]*deferredAddressSetDestroy)) *addressSetDestroyer {
+	return &addressSetDestroyer{
+		maxWorkers:   addressSetDestroyWorkers,
+		batchSize:    addressSetDestroyBatchSize,
+		destroyBatch: destroyBatch,
+	}
+}
+
+// enqueue queues the destroy, starting a worker unless the maximum number of them is
+// already running. Workers exit once the queue is empty.
+func (d *addressSetDestroyer) enqueue(destroy *deferredAddressSetDestroy) {
+	d.Lock()
+	defer d.Unlock()
+	d.queue = append(d.queue, destroy)
+	if d.workers < d.maxWorkers {
+		d.workers++
+		go d.run()
+	}
+}
+
+func (d *addressSetDestroyer) run() {
+	for {
+		d.Lock()
+		if len(d.queue) == 0 {
+			d.workers--
+			d.Unlock()
+			return
+		}
+		n := len(d.queue)
+		if n > d.batchSize {
+			n = d.batchSize
+		}
+		batch := d.queue[:n:n]
+		d.queue = d.queue[n:]
+		d.Unlock()
+
+		d.destroyBatch(batch)
+	}
+}
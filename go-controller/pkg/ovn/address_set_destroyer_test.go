@@ -0,0 +1,141 @@
+package ovn
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	addressset "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/ovn/address_set"
+	libovsdbtest "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/testing/libovsdb"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Address set destroyer", func() {
+	newDestroy := func(i int) *deferredAddressSetDestroy {
+		return &deferredAddressSetDestroy{namespace: fmt.Sprintf("namespace%d", i), token: make(chan struct{})}
+	}
+
+	ginkgo.It("groups the destroys queued while the workers are busy into batches", func() {
+		started := make(chan struct{})
+		release := make(chan struct{})
+		batches := make(chan []*deferredAddressSetDestroy, 10)
+		var calls int32
+		destroyer := newAddressSetDestroyer(func(destroys []*deferredAddressSetDestroy) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				close(started)
+				<-release
+			}
+			batches <- destroys
+		})
+		destroyer.maxWorkers = 1
+		destroyer.batchSize = 4
+
+		// the other destroys are queued while the first one runs
+		destroyer.enqueue(newDestroy(0))
+		gomega.Eventually(started).Should(gomega.BeClosed())
+		for i := 1; i < 10; i++ {
+			destroyer.enqueue(newDestroy(i))
+		}
+		close(release)
+
+		sizes := []int{}
+		namespaces := []string{}
+		for len(namespaces) < 10 {
+			var batch []*deferredAddressSetDestroy
+			gomega.Eventually(batches).Should(gomega.Receive(&batch))
+			sizes = append(sizes, len(batch))
+			for _, destroy := range batch {
+				namespaces = append(namespaces, destroy.namespace)
+			}
+		}
+		gomega.Expect(sizes).To(gomega.Equal([]int{1, 4, 4, 1}))
+		for i, namespace := range namespaces {
+			gomega.Expect(namespace).To(gomega.Equal(fmt.Sprintf("namespace%d", i)))
+		}
+		gomega.Eventually(func() int {
+			destroyer.Lock()
+			defer destroyer.Unlock()
+			return destroyer.workers
+		}).Should(gomega.BeZero())
+	})
+
+	ginkgo.It("runs at most the maximum number of batches at the same time", func() {
+		release := make(chan struct{})
+		var running, maxRunning, destroyed int32
+		destroyer := newAddressSetDestroyer(func(destroys []*deferredAddressSetDestroy) {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&maxRunning)
+				if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+					break
+				}
+			}
+			<-release
+			atomic.AddInt32(&running, -1)
+			atomic.AddInt32(&destroyed, int32(len(destroys)))
+		})
+		destroyer.maxWorkers = 2
+		destroyer.batchSize = 1
+
+		for i := 0; i < 6; i++ {
+			destroyer.enqueue(newDestroy(i))
+		}
+		gomega.Eventually(func() int32 { return atomic.LoadInt32(&running) }).Should(gomega.Equal(int32(2)))
+		close(release)
+
+		gomega.Eventually(func() int32 { return atomic.LoadInt32(&destroyed) }).Should(gomega.Equal(int32(6)))
+		gomega.Expect(atomic.LoadInt32(&maxRunning)).To(gomega.Equal(int32(2)))
+	})
+})
+
+// BenchmarkDeferredAddressSetDestroy destroys the address sets of many deleted
+// namespaces at once, one address set per transaction or in batches
+func BenchmarkDeferredAddressSetDestroy(b *testing.B) {
+	const namespaces = 256
+	for _, batchSize := range []int{1, addressSetDestroyBatchSize} {
+		b.Run(fmt.Sprintf("batch-%d", batchSize), func(b *testing.B) {
+			nbClient, cleanup, err := libovsdbtest.NewNBTestHarness(libovsdbtest.TestSetup{}, nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer cleanup.Cleanup()
+			bnc := &BaseNetworkController{
+				CommonNetworkControllerInfo: CommonNetworkControllerInfo{nbClient: nbClient},
+				namespaces:                  map[string]*namespaceInfo{},
+				pendingAddressSetDestroys:   map[string]chan struct{}{},
+			}
+			asf := addressset.NewOvnAddressSetFactory(nbClient)
+
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				destroys := make([]*deferredAddressSetDestroy, 0, namespaces)
+				for j := 0; j < namespaces; j++ {
+					ns := fmt.Sprintf("namespace%d", j)
+					as, err := asf.EnsureAddressSet(ns)
+					if err != nil {
+						b.Fatal(err)
+					}
+					token := make(chan struct{})
+					bnc.pendingAddressSetDestroys[ns] = token
+					destroys = append(destroys, &deferredAddressSetDestroy{namespace: ns, addressSet: as, token: token})
+				}
+				wg := &sync.WaitGroup{}
+				wg.Add(namespaces)
+				destroyer := newAddressSetDestroyer(func(destroys []*deferredAddressSetDestroy) {
+					bnc.destroyDeferredAddressSets(destroys)
+					wg.Add(-len(destroys))
+				})
+				destroyer.batchSize = batchSize
+				b.StartTimer()
+
+				for _, destroy := range destroys {
+					destroyer.enqueue(destroy)
+				}
+				wg.Wait()
+			}
+		})
+	}
+}
@@ -10,6 +10,7 @@ import (
 
 	"k8s.io/klog/v2"
 
+	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/config"
 	egressfirewall "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/crd/egressfirewall/v1"
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/factory"
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/util"
@@ -71,6 +72,9 @@ func (h *baseNetworkControllerEventHandler) areResourcesEqual(objType reflect.Ty
 		if err != nil {
 			klog.Errorf(err.Error())
 		}
+		if shouldUpdate && config.Kubernetes.FilterNodeUpdates && !nodeUpdateRelevant(node1, node2) {
+			return true, nil
+		}
 		return !shouldUpdate, nil
 
 	case factory.PodType,
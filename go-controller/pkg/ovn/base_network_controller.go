@@ -1,15 +1,22 @@
 package ovn
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"math"
+	"math/big"
 	"net"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	libovsdbclient "github.com/ovn-org/libovsdb/client"
+	"github.com/ovn-org/libovsdb/ovsdb"
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/config"
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/factory"
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/kube"
@@ -17,25 +24,145 @@ import (
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/metrics"
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/nbdb"
 	addressset "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/ovn/address_set"
+	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/ovn/ipallocator"
 	ovnlb "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/ovn/loadbalancer"
 	lsm "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/ovn/logical_switch_manager"
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/ovn/subnetallocator"
 	ovnretry "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/retry"
+	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/sbdb"
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/types"
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/util"
 
+	"golang.org/x/time/rate"
 	kapi "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
 	clientset "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
 	utilnet "k8s.io/utils/net"
 )
 
+// NamespaceAddressSetClassLabel is the namespace label selecting which registered address set
+// factory is used for the namespace's pod address set, see RegisterNamespaceAddressSetFactory.
+// Namespaces without the label use the controller's default address set factory. The class of
+// a namespace can't be changed once its address set is created.
+const NamespaceAddressSetClassLabel = "k8s.ovn.org/address-set-class"
+
+// clusterRouterConfiguredExternalIDsKey is the external ID of the cluster router holding the
+// comma separated keys of the configured cluster router external IDs it is tagged with
+const clusterRouterConfiguredExternalIDsKey = "k8s-cluster-router-external-ids"
+
+// deferredAddressSetDestroyDelay is how long the address set of a deleted namespace is
+// kept, empty, before being destroyed
+var deferredAddressSetDestroyDelay = 20 * time.Second
+
+// nodeSwitchDatapathCheckInterval is how often the southbound database is polled for the
+// datapath of a new node switch, see checkNodeSwitchDatapath
+var nodeSwitchDatapathCheckInterval = 100 * time.Millisecond
+
+// errNodeChassisNotFound is used to inform that the node has not been annotated with its chassis ID yet
+var errNodeChassisNotFound = errors.New("node chassis ID not found")
+
+// errNodeSubnetReserved is returned when a node is refused subnets kept for critical nodes
+var errNodeSubnetReserved = errors.New("node subnets reserved for critical nodes")
+
+// ErrNodeSubnetConflict is wrapped by the error returned when writing subnets allocated to
+// another node to the host subnet annotation of a node
+var ErrNodeSubnetConflict = errors.New("node subnet allocated to another node")
+
+// nodeSwitchOtherConfigManaged are the logical switch other_config keys set by
+// createNodeLogicalSwitch, which the node switch other-config annotation can't override
+var nodeSwitchOtherConfigManaged = sets.NewString("subnet", "exclude_ips", "ipv6_prefix",
+	"mcast_snoop", "mcast_querier", "mcast_eth_src", "mcast_ip4_src", "mcast_ip6_src")
+
+// nodeSwitchOtherConfigAllowed are the logical switch other_config keys that can be set
+// with the node switch other-config annotation
+var nodeSwitchOtherConfigAllowed = sets.NewString("mcast_flood_unregistered", "mcast_table_size",
+	"mcast_idle_timeout", "mcast_query_interval", "mcast_query_max_response", "vlan-passthru",
+	"broadcast-arps-to-all-routers", "fdb_age_threshold")
+
+// ErrNodeLogicalNetworkNotReady is wrapped by the errors describing what is missing from
+// the logical network of a node that is not fully provisioned
+var ErrNodeLogicalNetworkNotReady = errors.New("node logical network not ready")
+
+// NodeAddErrorCategory classifies why a node could not be added to the logical network
+type NodeAddErrorCategory string
+
+const (
+	// NodeAddErrorChassisNotReady is used when the node has not been annotated with its chassis ID yet
+	NodeAddErrorChassisNotReady NodeAddErrorCategory = "ChassisNotReady"
+	// NodeAddErrorSubnetExhausted is used when no host subnet is left for the node
+	NodeAddErrorSubnetExhausted NodeAddErrorCategory = "SubnetExhausted"
+	// NodeAddErrorSubnetNotConfigured is used when no cluster subnet covers an IP family of the node
+	NodeAddErrorSubnetNotConfigured NodeAddErrorCategory = "SubnetNotConfigured"
+	// NodeAddErrorDatabaseUnavailable is used when the OVN database could not be reached in time
+	NodeAddErrorDatabaseUnavailable NodeAddErrorCategory = "DatabaseUnavailable"
+	// NodeAddErrorUnknown is used for any other failure
+	NodeAddErrorUnknown NodeAddErrorCategory = "Unknown"
+)
+
+// nodeAddErrorHints are the remediation hints given to the user for each category
+var nodeAddErrorHints = map[NodeAddErrorCategory]string{
+	NodeAddErrorChassisNotReady: "check that ovnkube-node is running on the node and has set the " +
+		"k8s.ovn.org/node-chassis-id annotation",
+	NodeAddErrorSubnetExhausted: "all host subnets of the cluster network are in use, add a cluster " +
+		"subnet or remove unused nodes",
+	NodeAddErrorSubnetNotConfigured: "the cluster subnets do not cover all the IP families of the node, " +
+		"check the cluster-subnets configuration",
+	NodeAddErrorDatabaseUnavailable: "check the health of the OVN northbound database and the connectivity to it",
+	NodeAddErrorUnknown:             "check the ovnkube-master logs for details",
+}
+
+// NodeAddError is returned when setting up the logical network of a node fails. It carries
+// a category and a remediation hint, which are also part of its message.
+type NodeAddError struct {
+	Category NodeAddErrorCategory
+	Hint     string
+	Err      error
+}
+
+func (e *NodeAddError) Error() string {
+	return fmt.Sprintf("%v (%s: %s)", e.Err, e.Category, e.Hint)
+}
+
+func (e *NodeAddError) Unwrap() error {
+	return e.Err
+}
+
+// newNodeAddError wraps err in a NodeAddError categorized after the error it wraps
+func newNodeAddError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var nodeAddErr *NodeAddError
+	if errors.As(err, &nodeAddErr) {
+		return err
+	}
+	category := NodeAddErrorUnknown
+	switch {
+	case errors.Is(err, errNodeChassisNotFound):
+		category = NodeAddErrorChassisNotReady
+	case errors.Is(err, subnetallocator.ErrSubnetAllocatorFull):
+		category = NodeAddErrorSubnetExhausted
+	case errors.Is(err, subnetallocator.ErrSubnetRangeNotConfigured):
+		category = NodeAddErrorSubnetNotConfigured
+	case errors.Is(err, libovsdbclient.ErrNotConnected), errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, wait.ErrWaitTimeout):
+		category = NodeAddErrorDatabaseUnavailable
+	}
+	return &NodeAddError{Category: category, Hint: nodeAddErrorHints[category], Err: err}
+}
+
 // CommonNetworkControllerInfo structure is place holder for all fields shared among controllers.
 type CommonNetworkControllerInfo struct {
 	client       clientset.Interface
@@ -65,6 +192,36 @@ type CommonNetworkControllerInfo struct {
 type BaseNetworkController struct {
 	CommonNetworkControllerInfo
 
+	// name of the network managed by the controller, which keys its subnets in
+	// the node host subnet annotation. Read through getNetworkName.
+	netName string
+
+	// nodeSwitchName, if set, returns the name of the logical switch of a node, for
+	// example to add a network prefix to it. Node switches are named after their
+	// node otherwise.
+	nodeSwitchName func(nodeName string) string
+
+	// managementPortOnly is set for networks that only need a management port on each
+	// node: node switches only hold the management port and are not connected to the
+	// cluster router
+	managementPortOnly bool
+
+	// subnetAnnotationFallbackKey, if set, is the annotation key the host subnets of a
+	// node are read from when it has none in its host subnet annotation. Once allocated,
+	// they are written to the host subnet annotation, migrating the node to it.
+	subnetAnnotationFallbackKey string
+
+	// subnetOwner, if set, returns the node a host subnet is allocated to. Host subnet
+	// annotations are checked against it before being written, so that a subnet
+	// allocated to another node is never written to the annotation of a node.
+	subnetOwner func(subnet *net.IPNet) (string, bool)
+
+	// nodePodFieldSelector and nodePodLabelSelector, if set, further select the pods of a
+	// node listed by addAllPodsOnNode, eg to the pods attached to the network, so that
+	// pods the controller doesn't handle are not queued for retry when a node is added
+	nodePodFieldSelector fields.Selector
+	nodePodLabelSelector labels.Selector
+
 	// retry framework for pods
 	retryPods *ovnretry.RetryFramework
 	// retry framework for nodes
@@ -87,14 +244,142 @@ type BaseNetworkController struct {
 	// from inside those functions.
 	namespaces      map[string]*namespaceInfo
 	namespacesMutex sync.Mutex
+	// Channels closing the deferred address set destroy pending for a deleted
+	// namespace, keyed by namespace name. Protected by namespacesMutex.
+	pendingAddressSetDestroys map[string]chan struct{}
+	// Generation of each namespace, keyed by namespace name and taken from
+	// namespaceGeneration when the namespace is created. A deferred address set destroy
+	// only proceeds if the namespace is still of the generation it was scheduled for.
+	// Both are protected by namespacesMutex.
+	namespaceGenerations map[string]uint64
+	namespaceGeneration  uint64
+	// runs the deferred address set destroys once their delay has passed
+	addressSetDestroyer *addressSetDestroyer
+
+	// nodeStartupSyncWait, if set, is called before each node add of the initial
+	// node sync to rate limit it. Protected by nodeStartupSyncLock.
+	nodeStartupSyncWait func() error
+	nodeStartupSyncLock sync.RWMutex
 
 	// An address set factory that creates address sets
 	addressSetFactory addressset.AddressSetFactory
+	// Address set factories used for the pod address sets of namespaces labeled with
+	// NamespaceAddressSetClassLabel, keyed by class. Protected by namespaceAddressSetFactoriesLock.
+	namespaceAddressSetFactories     map[string]addressset.AddressSetFactory
+	namespaceAddressSetFactoriesLock sync.RWMutex
+
+	// Namespaces that have multicast enabled. The cluster router only relays
+	// multicast while there is at least one. Protected by multicastNamespacesLock.
+	multicastNamespaces     sets.String
+	multicastNamespacesLock sync.Mutex
+
+	// Serializes the creation and updates of the cluster router
+	clusterRouterLock sync.Mutex
+
+	// Subnets allocated to nodes that don't exist yet, keyed by node name. They
+	// are used by the node once it is added, or released once they expire.
+	// Protected by nodeSubnetPreallocationsLock.
+	nodeSubnetPreallocations     map[string]*nodeSubnetPreallocation
+	nodeSubnetPreallocationsLock sync.Mutex
+
+	// Start times of the node events being handled, keyed by node name, and the last
+	// time the node handler completed one, watched for stalls. Protected by
+	// nodeHandlerProgressLock.
+	nodeHandlerInFlight     map[string]time.Time
+	nodeHandlerLastProgress time.Time
+	nodeHandlerStalled      bool
+	nodeHandlerProgressLock sync.Mutex
+
+	// clock drives the periodic tasks of the controller; replaced by a fake
+	// clock in tests
+	clock clock.WithTicker
 
 	// stopChan per controller
 	stopChan chan struct{}
 }
 
+// getNetworkName returns the name of the network managed by the controller
+func (bnc *BaseNetworkController) getNetworkName() string {
+	if bnc.netName == "" {
+		return types.DefaultNetworkName
+	}
+	return bnc.netName
+}
+
+// EffectiveConfig holds the settings a network controller resolved at startup from
+// its config and the features supported by OVN
+type EffectiveConfig struct {
+	NetworkName                string   `json:"networkName"`
+	SCTPSupport                bool     `json:"sctpSupport"`
+	MulticastSupport           bool     `json:"multicastSupport"`
+	IPv4Mode                   bool     `json:"ipv4Mode"`
+	IPv6Mode                   bool     `json:"ipv6Mode"`
+	ClusterSubnets             []string `json:"clusterSubnets"`
+	HostSubnetAlignmentBits    int      `json:"hostSubnetAlignmentBits"`
+	AllowSingleFamilyNodes     bool     `json:"allowSingleFamilyNodes"`
+	HybridOverlay              bool     `json:"hybridOverlay"`
+	GatewayMode                string   `json:"gatewayMode"`
+	NodePortSecurity           bool     `json:"nodePortSecurity"`
+	DeferredAddressSetDestroy  bool     `json:"deferredAddressSetDestroy"`
+	EgressIP                   bool     `json:"egressIP"`
+	EgressFirewall             bool     `json:"egressFirewall"`
+	EgressQoS                  bool     `json:"egressQoS"`
+	SubnetUsageRefreshInterval int      `json:"subnetUsageRefreshInterval"`
+}
+
+// EffectiveConfig returns the settings the controller runs with
+func (bnc *BaseNetworkController) EffectiveConfig() EffectiveConfig {
+	clusterSubnets := make([]string, 0, len(config.Default.ClusterSubnets))
+	for _, entry := range config.Default.ClusterSubnets {
+		clusterSubnets = append(clusterSubnets, fmt.Sprintf("%s/%d", entry.CIDR, entry.HostSubnetLength))
+	}
+	return EffectiveConfig{
+		NetworkName:                bnc.getNetworkName(),
+		SCTPSupport:                bnc.SCTPSupport,
+		MulticastSupport:           bnc.multicastSupport,
+		IPv4Mode:                   config.IPv4Mode,
+		IPv6Mode:                   config.IPv6Mode,
+		ClusterSubnets:             clusterSubnets,
+		HostSubnetAlignmentBits:    config.Default.HostSubnetAlignmentBits,
+		AllowSingleFamilyNodes:     config.Default.AllowSingleFamilyNodes,
+		HybridOverlay:              config.HybridOverlay.Enabled,
+		GatewayMode:                string(config.Gateway.Mode),
+		NodePortSecurity:           config.Default.EnableNodePortSecurity,
+		DeferredAddressSetDestroy:  !config.Default.DisableDeferredAddressSetDestroy,
+		EgressIP:                   config.OVNKubernetesFeature.EnableEgressIP,
+		EgressFirewall:             config.OVNKubernetesFeature.EnableEgressFirewall,
+		EgressQoS:                  config.OVNKubernetesFeature.EnableEgressQoS,
+		SubnetUsageRefreshInterval: config.Metrics.SubnetUsageRefreshInterval,
+	}
+}
+
+// getNodeSwitchName returns the name of the logical switch of a node
+func (bnc *BaseNetworkController) getNodeSwitchName(nodeName string) string {
+	if bnc.nodeSwitchName == nil {
+		return nodeName
+	}
+	return bnc.nodeSwitchName(nodeName)
+}
+
+// getNodeManagementPortName returns the name of the management port on the logical
+// switch of a node
+func (bnc *BaseNetworkController) getNodeManagementPortName(nodeName string) string {
+	return types.K8sPrefix + bnc.getNodeSwitchName(nodeName)
+}
+
+// getSwitchNodeName returns the name of the node of a node logical switch. Switches
+// named by a custom naming function are tagged with their node, others are named
+// after it. It returns false for a switch with a custom name but no node tag.
+func (bnc *BaseNetworkController) getSwitchNodeName(ls *nbdb.LogicalSwitch) (string, bool) {
+	if nodeName, ok := ls.ExternalIDs[types.OvnNodeExternalID]; ok {
+		return nodeName, true
+	}
+	if bnc.nodeSwitchName == nil {
+		return ls.Name, true
+	}
+	return "", false
+}
+
 // NewCommonNetworkControllerInfo creates CommonNetworkControllerInfo shared by controllers
 func NewCommonNetworkControllerInfo(client clientset.Interface, kube kube.Interface, wf *factory.WatchFactory,
 	recorder record.EventRecorder, nbClient libovsdbclient.Client, sbClient libovsdbclient.Client,
@@ -112,39 +397,418 @@ func NewCommonNetworkControllerInfo(client clientset.Interface, kube kube.Interf
 	}
 }
 
-// createOvnClusterRouter creates the central router for the network
+// RegisterNamespaceAddressSetFactory registers the address set factory used for namespaces whose
+// NamespaceAddressSetClassLabel label is set to class. It must be called before namespaces are
+// handled; namespaces keep the factory their address set was created with.
+func (bnc *BaseNetworkController) RegisterNamespaceAddressSetFactory(class string, factory addressset.AddressSetFactory) error {
+	if factory == nil {
+		return fmt.Errorf("cannot register a nil address set factory for namespace class %q", class)
+	}
+	if errs := validation.IsValidLabelValue(class); class == "" || len(errs) > 0 {
+		return fmt.Errorf("invalid namespace address set class %q: %v", class, errs)
+	}
+
+	bnc.namespaceAddressSetFactoriesLock.Lock()
+	defer bnc.namespaceAddressSetFactoriesLock.Unlock()
+	if _, ok := bnc.namespaceAddressSetFactories[class]; ok {
+		return fmt.Errorf("an address set factory is already registered for namespace class %q", class)
+	}
+	if bnc.namespaceAddressSetFactories == nil {
+		bnc.namespaceAddressSetFactories = map[string]addressset.AddressSetFactory{}
+	}
+	bnc.namespaceAddressSetFactories[class] = factory
+	return nil
+}
+
+// getNamespaceAddressSetFactory returns the address set factory of the pod address set of
+// namespace ns and its class, given by the NamespaceAddressSetClassLabel label of the namespace,
+// or the default factory for unlabeled namespaces. The namespace is looked up in the informer
+// cache, then in the API server, if not provided. Namespaces that don't exist yet, e.g. when
+// their pods are handled first, are unlabeled.
+func (bnc *BaseNetworkController) getNamespaceAddressSetFactory(ns string,
+	namespace *kapi.Namespace) (addressset.AddressSetFactory, string, error) {
+	if namespace == nil {
+		var err error
+		namespace, err = bnc.watchFactory.GetNamespace(ns)
+		if err != nil {
+			namespace, err = bnc.client.CoreV1().Namespaces().Get(context.TODO(), ns, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				return bnc.addressSetFactory, "", nil
+			}
+			if err != nil {
+				return nil, "", fmt.Errorf("failed to get namespace %s for its address set class: %w", ns, err)
+			}
+		}
+	}
+	class, ok := namespace.Labels[NamespaceAddressSetClassLabel]
+	if !ok {
+		return bnc.addressSetFactory, "", nil
+	}
+	bnc.namespaceAddressSetFactoriesLock.RLock()
+	defer bnc.namespaceAddressSetFactoriesLock.RUnlock()
+	factory, ok := bnc.namespaceAddressSetFactories[class]
+	if !ok {
+		return nil, "", fmt.Errorf("no address set factory registered for class %q of namespace %s", class, ns)
+	}
+	return factory, class, nil
+}
+
+// getAddressSetFactories returns the default address set factory and the distinct factories
+// registered for namespace classes.
+func (bnc *BaseNetworkController) getAddressSetFactories() []addressset.AddressSetFactory {
+	factories := []addressset.AddressSetFactory{bnc.addressSetFactory}
+	bnc.namespaceAddressSetFactoriesLock.RLock()
+	defer bnc.namespaceAddressSetFactoriesLock.RUnlock()
+	for _, factory := range bnc.namespaceAddressSetFactories {
+		found := false
+		for _, f := range factories {
+			if f == factory {
+				found = true
+				break
+			}
+		}
+		if !found {
+			factories = append(factories, factory)
+		}
+	}
+	return factories
+}
+
+// createOvnClusterRouter creates the central router for the network, or updates it
+// with the current configuration if it exists. Concurrent calls are serialized.
 func (bnc *BaseNetworkController) createOvnClusterRouter() (*nbdb.LogicalRouter, error) {
+	bnc.clusterRouterLock.Lock()
+	defer bnc.clusterRouterLock.Unlock()
+
+	logicalRouter, err := bnc.buildOvnClusterRouter()
+	if err != nil {
+		return nil, err
+	}
+	// all the router fields are updated, so keep the options set on an existing router,
+	// but the ones explicitly removed
+	existing, err := libovsdbops.GetLogicalRouter(bnc.nbClient, &nbdb.LogicalRouter{Name: logicalRouter.Name})
+	if err != nil && !errors.Is(err, libovsdbclient.ErrNotFound) {
+		return nil, fmt.Errorf("failed to get distributed router %s: %v", logicalRouter.Name, err)
+	}
+	if existing != nil {
+		removed := bnc.clusterRouterOptionsToRemove()
+		for k, v := range existing.Options {
+			if _, ok := logicalRouter.Options[k]; !ok && !removed.Has(k) {
+				logicalRouter.Options[k] = v
+			}
+		}
+		// nor its external IDs, like the topology version, but the ones no longer configured
+		removedExternalIDs := clusterRouterExternalIDsToRemove(existing)
+		for k, v := range existing.ExternalIDs {
+			if _, ok := logicalRouter.ExternalIDs[k]; !ok && !removedExternalIDs.Has(k) {
+				logicalRouter.ExternalIDs[k] = v
+			}
+		}
+	}
+	err = bnc.createOrUpdateClusterRouter(existing, logicalRouter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create distributed router %s, error: %v",
+			logicalRouter.Name, err)
+	}
+
+	return logicalRouter, nil
+}
+
+// recreateClusterRouter replaces the cluster router with a new one built with the current
+// options, for topology upgrades that need the router recreated. The external IDs of the
+// existing router, like its topology version, are kept. Its ports, static routes, policies,
+// NATs and load balancers are attached to the new router in the same transaction that
+// deletes the existing one, so traffic is only disrupted while OVN recomputes the router.
+func (bnc *BaseNetworkController) recreateClusterRouter() (*nbdb.LogicalRouter, error) {
+	bnc.clusterRouterLock.Lock()
+	defer bnc.clusterRouterLock.Unlock()
+
+	logicalRouter, err := bnc.buildOvnClusterRouter()
+	if err != nil {
+		return nil, err
+	}
+	existing, err := libovsdbops.GetLogicalRouter(bnc.nbClient, &nbdb.LogicalRouter{Name: logicalRouter.Name})
+	if err != nil && !errors.Is(err, libovsdbclient.ErrNotFound) {
+		return nil, fmt.Errorf("failed to get distributed router %s: %v", logicalRouter.Name, err)
+	}
+	if existing == nil {
+		// nothing to keep from the existing router
+		if err := libovsdbops.CreateOrUpdateLogicalRouter(bnc.nbClient, logicalRouter); err != nil {
+			return nil, fmt.Errorf("failed to create distributed router %s, error: %v",
+				logicalRouter.Name, err)
+		}
+		return logicalRouter, nil
+	}
+
+	removedExternalIDs := clusterRouterExternalIDsToRemove(existing)
+	for k, v := range existing.ExternalIDs {
+		if _, ok := logicalRouter.ExternalIDs[k]; !ok && !removedExternalIDs.Has(k) {
+			logicalRouter.ExternalIDs[k] = v
+		}
+	}
+	logicalRouter.Ports = existing.Ports
+	logicalRouter.StaticRoutes = existing.StaticRoutes
+	logicalRouter.Policies = existing.Policies
+	logicalRouter.Nat = existing.Nat
+	logicalRouter.LoadBalancer = existing.LoadBalancer
+	logicalRouter.LoadBalancerGroup = existing.LoadBalancerGroup
+
+	if err := libovsdbops.ReplaceLogicalRouter(bnc.nbClient, existing, logicalRouter); err != nil {
+		return nil, fmt.Errorf("failed to recreate distributed router %s: %v", logicalRouter.Name, err)
+	}
+	klog.Infof("Recreated distributed router %s with %d ports", logicalRouter.Name, len(logicalRouter.Ports))
+
+	return logicalRouter, nil
+}
+
+// buildOvnClusterRouter returns the cluster router as configured now, ensuring the
+// control plane protection entry it references exists.
+func (bnc *BaseNetworkController) buildOvnClusterRouter() (*nbdb.LogicalRouter, error) {
 	// Create default Control Plane Protection (COPP) entry for routers
 	defaultCOPPUUID, err := EnsureDefaultCOPP(bnc.nbClient)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create router control plane protection: %w", err)
 	}
 
-	// Create a single common distributed router for the cluster.
-	logicalRouterName := types.OVNClusterRouter
-	logicalRouter := nbdb.LogicalRouter{
-		Name: logicalRouterName,
-		ExternalIDs: map[string]string{
-			"k8s-cluster-router": "yes",
-		},
+	// Create a single common distributed router for the cluster, tagged with the
+	// configured external IDs, and with their keys so that the ones no longer
+	// configured can be removed.
+	externalIDs := map[string]string{}
+	configuredKeys := make([]string, 0, len(config.Default.ClusterRouterExternalIDs))
+	for k, v := range config.Default.ClusterRouterExternalIDs {
+		externalIDs[k] = v
+		configuredKeys = append(configuredKeys, k)
+	}
+	if len(configuredKeys) > 0 {
+		sort.Strings(configuredKeys)
+		externalIDs[clusterRouterConfiguredExternalIDsKey] = strings.Join(configuredKeys, ",")
+	}
+	externalIDs["k8s-cluster-router"] = "yes"
+	logicalRouter := &nbdb.LogicalRouter{
+		Name:        types.OVNClusterRouter,
+		ExternalIDs: externalIDs,
 		Options: map[string]string{
 			"always_learn_from_arp_request": "false",
 		},
 		Copp: &defaultCOPPUUID,
 	}
 	if bnc.multicastSupport {
-		logicalRouter.Options = map[string]string{
-			"mcast_relay": "true",
+		relay, err := bnc.isMulticastRelayNeeded()
+		if err != nil {
+			return nil, err
 		}
+		logicalRouter.Options["mcast_relay"] = strconv.FormatBool(relay)
 	}
+	return logicalRouter, nil
+}
 
-	err = libovsdbops.CreateOrUpdateLogicalRouter(bnc.nbClient, &logicalRouter)
+// isMulticastRelayNeeded returns whether any namespace has multicast enabled. Until
+// namespaces have been added, the namespace annotations are checked instead so that
+// relay is not turned off on the cluster router while the controller is starting.
+func (bnc *BaseNetworkController) isMulticastRelayNeeded() (bool, error) {
+	bnc.multicastNamespacesLock.Lock()
+	defer bnc.multicastNamespacesLock.Unlock()
+	if bnc.multicastNamespaces.Len() > 0 {
+		return true, nil
+	}
+	namespaces, err := bnc.watchFactory.GetNamespaces()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create distributed router %s, error: %v",
-			logicalRouterName, err)
+		return false, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+	for _, ns := range namespaces {
+		if isNamespaceMulticastEnabled(ns.Annotations) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// setNamespaceMulticast records whether multicast is enabled in namespace ns and
+// enables or disables multicast relay on the cluster router accordingly.
+func (bnc *BaseNetworkController) setNamespaceMulticast(ns string, enabled bool) error {
+	bnc.multicastNamespacesLock.Lock()
+	defer bnc.multicastNamespacesLock.Unlock()
+	if bnc.multicastNamespaces == nil {
+		bnc.multicastNamespaces = sets.NewString()
+	}
+	wasEnabled := bnc.multicastNamespaces.Has(ns)
+	if enabled {
+		bnc.multicastNamespaces.Insert(ns)
+	} else {
+		bnc.multicastNamespaces.Delete(ns)
+	}
+	if err := bnc.setClusterRouterMulticastRelay(bnc.multicastNamespaces.Len() > 0); err != nil {
+		if wasEnabled {
+			bnc.multicastNamespaces.Insert(ns)
+		} else {
+			bnc.multicastNamespaces.Delete(ns)
+		}
+		return err
+	}
+	return nil
+}
+
+// setClusterRouterMulticastRelay updates the mcast_relay option of the cluster
+// router, leaving its other options untouched. If the router does not exist yet,
+// createOvnClusterRouter will set the option when creating it.
+func (bnc *BaseNetworkController) setClusterRouterMulticastRelay(enabled bool) error {
+	logicalRouter, err := libovsdbops.GetLogicalRouter(bnc.nbClient, &nbdb.LogicalRouter{Name: types.OVNClusterRouter})
+	if errors.Is(err, libovsdbclient.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get distributed router %s: %w", types.OVNClusterRouter, err)
+	}
+	relay := strconv.FormatBool(enabled)
+	if logicalRouter.Options["mcast_relay"] == relay {
+		return nil
+	}
+	updated := &nbdb.LogicalRouter{UUID: logicalRouter.UUID, Name: logicalRouter.Name, Options: map[string]string{}}
+	for k, v := range logicalRouter.Options {
+		updated.Options[k] = v
+	}
+	updated.Options["mcast_relay"] = relay
+	if err := bnc.createOrUpdateClusterRouter(logicalRouter, updated, &updated.Options); err != nil {
+		return fmt.Errorf("failed to set mcast_relay=%s on distributed router %s: %w", relay, types.OVNClusterRouter, err)
+	}
+	klog.Infof("Multicast relay on distributed router %s set to %s", types.OVNClusterRouter, relay)
+	return nil
+}
+
+// clusterRouterOptionsToRemove returns the options of an existing cluster router that are
+// removed when it is updated, rather than kept along with the options it is built with:
+// the multicast relay is only managed while multicast is supported.
+func (bnc *BaseNetworkController) clusterRouterOptionsToRemove() sets.String {
+	removed := sets.NewString()
+	if !bnc.multicastSupport {
+		removed.Insert("mcast_relay")
+	}
+	return removed
+}
+
+// clusterRouterExternalIDsToRemove returns the external IDs of an existing cluster router that
+// are removed when it is updated, rather than kept along with the external IDs it is built
+// with: the ones that were configured when it was last updated, but are no longer.
+func clusterRouterExternalIDsToRemove(existing *nbdb.LogicalRouter) sets.String {
+	removed := sets.NewString()
+	configuredKeys, ok := existing.ExternalIDs[clusterRouterConfiguredExternalIDsKey]
+	if !ok {
+		return removed
+	}
+	for _, k := range strings.Split(configuredKeys, ",") {
+		if _, ok := config.Default.ClusterRouterExternalIDs[k]; !ok {
+			removed.Insert(k)
+		}
+	}
+	if len(config.Default.ClusterRouterExternalIDs) == 0 {
+		removed.Insert(clusterRouterConfiguredExternalIDsKey)
+	}
+	return removed
+}
+
+// createOrUpdateClusterRouter writes the cluster router, with the fields given or all of
+// them, replacing the options of existing, the router as it is in nbdb if it exists. Its
+// options must have been merged into the options written, but the ones removed on purpose:
+// a write dropping any other option is recorded as an overwrite of the router options.
+func (bnc *BaseNetworkController) createOrUpdateClusterRouter(existing, logicalRouter *nbdb.LogicalRouter,
+	fields ...interface{}) error {
+	if existing != nil {
+		removed := bnc.clusterRouterOptionsToRemove()
+		for k := range existing.Options {
+			if _, ok := logicalRouter.Options[k]; !ok && !removed.Has(k) {
+				klog.Warningf("Update of distributed router %s drops its %s option, options must be merged",
+					logicalRouter.Name, k)
+				metrics.RecordClusterRouterOptionsOverwrite()
+				break
+			}
+		}
+	}
+	return libovsdbops.CreateOrUpdateLogicalRouter(bnc.nbClient, logicalRouter, fields...)
+}
+
+// nodeAddSteps are the steps setting up the logical network of a node, in the order
+// they run. Steps the controller mode doesn't need are nil.
+type nodeAddSteps struct {
+	// ensureSwitch creates the node switch
+	ensureSwitch func(node *kapi.Node, hostSubnets []*net.IPNet) error
+	// syncRouterPort connects the node switch to the cluster router
+	syncRouterPort func(node *kapi.Node, hostSubnets []*net.IPNet) error
+	// syncMgmtPort creates the management port of the node on its switch
+	syncMgmtPort func(node *kapi.Node, hostSubnets []*net.IPNet) error
+}
+
+// getNodeAddSteps returns the steps setting up the logical network of a node in the
+// mode of the controller. In management port only mode, the node switch only gets the
+// management port. Otherwise the node switch is connected to the cluster router, and
+// the management port is left to the controller as it depends on the network.
+func (bnc *BaseNetworkController) getNodeAddSteps(loadBalancerGroupUUID string) nodeAddSteps {
+	if bnc.managementPortOnly {
+		return nodeAddSteps{
+			ensureSwitch: bnc.createNodeManagementSwitch,
+			syncMgmtPort: bnc.syncNodeManagementSwitchPort,
+		}
+	}
+	return nodeAddSteps{
+		ensureSwitch: func(node *kapi.Node, hostSubnets []*net.IPNet) error {
+			_, err := bnc.createNodeLogicalSwitch(node.Name, hostSubnets, loadBalancerGroupUUID)
+			return err
+		},
+		syncRouterPort: bnc.syncNodeClusterRouterPort,
+	}
+}
+
+// createNodeManagementSwitch creates the switch of a node in management port only mode.
+// It only holds the management port, so it doesn't get the subnet, multicast or load
+// balancer config of the switches created by createNodeLogicalSwitch.
+func (bnc *BaseNetworkController) createNodeManagementSwitch(node *kapi.Node, hostSubnets []*net.IPNet) error {
+	logicalSwitch := nbdb.LogicalSwitch{
+		Name: bnc.getNodeSwitchName(node.Name),
+		ExternalIDs: map[string]string{
+			types.OvnNodeExternalID: node.Name,
+		},
+	}
+	if err := libovsdbops.CreateOrUpdateLogicalSwitch(bnc.nbClient, &logicalSwitch); err != nil {
+		return fmt.Errorf("failed to add logical switch %+v: %w", logicalSwitch, err)
+	}
+	return bnc.lsManager.AddSwitch(logicalSwitch.Name, logicalSwitch.UUID, hostSubnets)
+}
+
+// syncNodeManagementSwitchPort creates the management port of a node on its switch in
+// management port only mode, addressed with the node management port MAC and the
+// management IPs of its host subnets. The port is named after the switch, so that the
+// management ports of several networks don't clash.
+func (bnc *BaseNetworkController) syncNodeManagementSwitchPort(node *kapi.Node, hostSubnets []*net.IPNet) error {
+	macAddress, err := util.ParseNodeManagementPortMACAddress(node)
+	if err != nil {
+		return err
+	}
+	if len(hostSubnets) == 0 {
+		hostSubnets, err = util.ParseNodeHostSubnetAnnotation(node, bnc.getNetworkName())
+		if err != nil {
+			return err
+		}
 	}
 
-	return &logicalRouter, nil
+	addresses := macAddress.String()
+	for _, hostSubnet := range hostSubnets {
+		addresses += " " + util.GetNodeManagementIfAddr(hostSubnet).IP.String()
+	}
+	switchName := bnc.getNodeSwitchName(node.Name)
+	logicalSwitchPort := nbdb.LogicalSwitchPort{
+		Name:      bnc.getNodeManagementPortName(node.Name),
+		Addresses: []string{addresses},
+	}
+	if config.Default.EnableNodePortSecurity {
+		logicalSwitchPort.PortSecurity, err = getNodePortSecurity(logicalSwitchPort.Addresses)
+		if err != nil {
+			return fmt.Errorf("failed to set port security on logical port %s: %v", logicalSwitchPort.Name, err)
+		}
+	}
+	sw := nbdb.LogicalSwitch{Name: switchName}
+	if err := libovsdbops.CreateOrUpdateLogicalSwitchPortsOnSwitch(bnc.nbClient, &sw, &logicalSwitchPort); err != nil {
+		return fmt.Errorf("failed to add management port %s to switch %s: %w", logicalSwitchPort.Name, switchName, err)
+	}
+	return nil
 }
 
 // syncNodeClusterRouterPort ensures a node's LS to the cluster router's LRP is created.
@@ -153,30 +817,32 @@ func (bnc *BaseNetworkController) createOvnClusterRouter() (*nbdb.LogicalRouter,
 // gateway-chassis, which in effect pins the logical switch to the current node in OVN.
 // Otherwise, ovn-controller will flood-fill unrelated datapaths unnecessarily, causing scale
 // problems.
+// If the node has not been annotated with its chassis ID yet, an error wrapping
+// errNodeChassisNotFound is returned so that callers can retry this step alone later.
 func (bnc *BaseNetworkController) syncNodeClusterRouterPort(node *kapi.Node, hostSubnets []*net.IPNet) error {
+	if util.IsNodeOVNFrozen(node) {
+		klog.Infof("Node %s is frozen, not syncing its cluster router port", node.Name)
+		return nil
+	}
+
 	chassisID, err := util.ParseNodeChassisIDAnnotation(node)
 	if err != nil {
+		if util.IsAnnotationNotSetError(err) {
+			return fmt.Errorf("%w: %v", errNodeChassisNotFound, err)
+		}
 		return err
 	}
 
 	if len(hostSubnets) == 0 {
-		hostSubnets, err = util.ParseNodeHostSubnetAnnotation(node, types.DefaultNetworkName)
+		hostSubnets, err = util.ParseNodeHostSubnetAnnotation(node, bnc.getNetworkName())
 		if err != nil {
 			return err
 		}
 	}
 
-	// logical router port MAC is based on IPv4 subnet if there is one, else IPv6
-	var nodeLRPMAC net.HardwareAddr
-	for _, hostSubnet := range hostSubnets {
-		gwIfAddr := util.GetNodeGatewayIfAddr(hostSubnet)
-		nodeLRPMAC = util.IPAddrToHWAddr(gwIfAddr.IP)
-		if !utilnet.IsIPv6CIDR(hostSubnet) {
-			break
-		}
-	}
+	nodeLRPMAC := nodeRouterPortMAC(hostSubnets)
 
-	switchName := node.Name
+	switchName := bnc.getNodeSwitchName(node.Name)
 	logicalRouterName := types.OVNClusterRouter
 	lrpName := types.RouterToSwitchPrefix + switchName
 	lrpNetworks := []string{}
@@ -184,233 +850,2117 @@ func (bnc *BaseNetworkController) syncNodeClusterRouterPort(node *kapi.Node, hos
 		gwIfAddr := util.GetNodeGatewayIfAddr(hostSubnet)
 		lrpNetworks = append(lrpNetworks, gwIfAddr.String())
 	}
+	// The cluster router doesn't learn from ARP requests that don't target it, nodes
+	// bridging to legacy L2 segments opt in on their own router port instead. Other
+	// options of the port are kept.
+	lrpOptions := map[string]string{}
+	existingLRP, err := libovsdbops.GetLogicalRouterPort(bnc.nbClient, &nbdb.LogicalRouterPort{Name: lrpName})
+	if err != nil && !errors.Is(err, libovsdbclient.ErrNotFound) {
+		return fmt.Errorf("failed to get logical router port %s: %v", lrpName, err)
+	}
+	if existingLRP != nil {
+		for k, v := range existingLRP.Options {
+			lrpOptions[k] = v
+		}
+	}
+	if util.NodeAlwaysLearnsFromARPRequest(node) {
+		lrpOptions["always_learn_from_arp_request"] = "true"
+	} else {
+		delete(lrpOptions, "always_learn_from_arp_request")
+	}
 	logicalRouterPort := nbdb.LogicalRouterPort{
 		Name:     lrpName,
 		MAC:      nodeLRPMAC.String(),
 		Networks: lrpNetworks,
+		Options:  lrpOptions,
+		ExternalIDs: map[string]string{
+			types.OvnNodeExternalID: node.Name,
+		},
 	}
 	logicalRouter := nbdb.LogicalRouter{Name: logicalRouterName}
-	gatewayChassis := nbdb.GatewayChassis{
-		Name:        lrpName + "-" + chassisID,
-		ChassisName: chassisID,
-		Priority:    1,
-	}
+	gatewayChassis := nodeGatewayChassis(node, lrpName, chassisID)
 
-	err = libovsdbops.CreateOrUpdateLogicalRouterPort(bnc.nbClient, &logicalRouter, &logicalRouterPort,
-		&gatewayChassis, &logicalRouterPort.MAC, &logicalRouterPort.Networks)
+	err = libovsdbops.CreateOrUpdateLogicalRouterPortWithGatewayChassis(bnc.nbClient, &logicalRouter, &logicalRouterPort,
+		gatewayChassis, &logicalRouterPort.MAC, &logicalRouterPort.Networks, &logicalRouterPort.Options,
+		&logicalRouterPort.ExternalIDs)
 	if err != nil {
 		klog.Errorf("Failed to add gateway chassis %s to logical router port %s, error: %v", chassisID, lrpName, err)
 		return err
 	}
+	// prune the gateway chassis the port no longer has, eg backups removed from the annotation
+	if existingLRP != nil {
+		current := sets.NewString(logicalRouterPort.GatewayChassis...)
+		stale := []*nbdb.GatewayChassis{}
+		for _, uuid := range existingLRP.GatewayChassis {
+			if !current.Has(uuid) {
+				stale = append(stale, &nbdb.GatewayChassis{UUID: uuid})
+			}
+		}
+		if err = libovsdbops.DeleteGatewayChassis(bnc.nbClient, stale...); err != nil {
+			return fmt.Errorf("failed to delete the stale gateway chassis of logical router port %s: %w", lrpName, err)
+		}
+	}
+	bnc.checkGatewayChassisConflicts(node, gatewayChassis[0])
+	bnc.checkRouterPortMACConflicts(node, &logicalRouterPort)
+
+	return bnc.annotateNodeLRPMAC(node, nodeLRPMAC)
+}
 
+// annotateNodeLRPMAC publishes the MAC address of the cluster router port of the node on
+// the node, for host agents and debugging tools. Only the default network annotates it.
+func (bnc *BaseNetworkController) annotateNodeLRPMAC(node *kapi.Node, mac net.HardwareAddr) error {
+	if bnc.getNetworkName() != types.DefaultNetworkName {
+		return nil
+	}
+	if annotated, err := util.ParseNodeLRPMACAnnotation(node); err == nil && bytes.Equal(annotated, mac) {
+		return nil
+	}
+	if err := bnc.UpdateNodeAnnotationWithRetry(node.Name, nil, util.CreateNodeLRPMACAnnotation(nil, mac)); err != nil {
+		return fmt.Errorf("failed to annotate node %s with its router port MAC %s: %w", node.Name, mac, err)
+	}
 	return nil
 }
 
-func (bnc *BaseNetworkController) createNodeLogicalSwitch(nodeName string, hostSubnets []*net.IPNet,
-	loadBalancerGroupUUID string) error {
-	// logical router port MAC is based on IPv4 subnet if there is one, else IPv6
-	var nodeLRPMAC net.HardwareAddr
-	switchName := nodeName
-	for _, hostSubnet := range hostSubnets {
-		gwIfAddr := util.GetNodeGatewayIfAddr(hostSubnet)
-		nodeLRPMAC = util.IPAddrToHWAddr(gwIfAddr.IP)
-		if !utilnet.IsIPv6CIDR(hostSubnet) {
+// nodeGatewayChassis returns the gateway chassis of the cluster router port of a node: its
+// own chassis followed by the chassis it is annotated to be backed up by, up to
+// config.Default.MaxNodeGatewayChassis. Priorities descend from the node's own chassis, so
+// that it hosts the port as long as it is up.
+func nodeGatewayChassis(node *kapi.Node, lrpName, chassisID string) []*nbdb.GatewayChassis {
+	maxChassis := config.Default.MaxNodeGatewayChassis
+	if maxChassis < 1 {
+		maxChassis = 1
+	}
+	chassisIDs := []string{chassisID}
+	seen := sets.NewString(chassisID)
+	// nodes without the annotation have no backups
+	backupChassisIDs, _ := util.ParseNodeBackupChassisAnnotation(node)
+	for _, backupChassisID := range backupChassisIDs {
+		if seen.Has(backupChassisID) {
+			continue
+		}
+		if len(chassisIDs) == maxChassis {
+			klog.V(5).Infof("Node %s has more backup chassis than the %d gateway chassis allowed, ignoring the lowest ones",
+				node.Name, maxChassis)
 			break
 		}
+		seen.Insert(backupChassisID)
+		chassisIDs = append(chassisIDs, backupChassisID)
+	}
+
+	gatewayChassis := make([]*nbdb.GatewayChassis, 0, len(chassisIDs))
+	for i, id := range chassisIDs {
+		gatewayChassis = append(gatewayChassis, &nbdb.GatewayChassis{
+			Name:        lrpName + "-" + id,
+			ChassisName: id,
+			Priority:    maxChassis - i,
+		})
+	}
+	return gatewayChassis
+}
+
+// checkRouterPortMACConflicts posts a warning event for the node if the MAC of its cluster
+// router port is also the MAC of the router port of another node. As the MAC is derived
+// from the gateway IP, this happens when nodes are given overlapping subnets, and the
+// cluster router then can't tell the two node switches apart at L2.
+func (bnc *BaseNetworkController) checkRouterPortMACConflicts(node *kapi.Node, logicalRouterPort *nbdb.LogicalRouterPort) {
+	ports, err := libovsdbops.FindLogicalRouterPortsWithPredicate(bnc.nbClient, func(item *nbdb.LogicalRouterPort) bool {
+		return item.MAC == logicalRouterPort.MAC && item.Name != logicalRouterPort.Name
+	})
+	if err != nil {
+		klog.Warningf("Failed to look up the router ports with the MAC of %s: %v", logicalRouterPort.Name, err)
+		return
+	}
+	for _, port := range ports {
+		otherNode, ok := port.ExternalIDs[types.OvnNodeExternalID]
+		if !ok {
+			// not a node router port, eg the port of the cluster router to the join switch
+			continue
+		}
+		if otherNode == node.Name {
+			continue
+		}
+		klog.Warningf("Nodes %s and %s both have MAC %s on their cluster router port",
+			node.Name, otherNode, logicalRouterPort.MAC)
+		bnc.recorder.Eventf(node, kapi.EventTypeWarning, "RouterPortMACConflict",
+			"Nodes %s and %s both have MAC %s on their cluster router port, their subnets likely overlap",
+			node.Name, otherNode, logicalRouterPort.MAC)
+	}
+}
+
+// checkGatewayChassisConflicts posts a warning event for the node if the chassis its
+// cluster router port is pinned to is also the gateway chassis, at the same priority,
+// of the router port of another node. This happens when a chassis ID is reused, and
+// blackholes the traffic of one of the nodes.
+func (bnc *BaseNetworkController) checkGatewayChassisConflicts(node *kapi.Node, gatewayChassis *nbdb.GatewayChassis) {
+	conflicting, err := libovsdbops.FindGatewayChassisWithPredicate(bnc.nbClient, func(item *nbdb.GatewayChassis) bool {
+		return item.ChassisName == gatewayChassis.ChassisName && item.Priority == gatewayChassis.Priority &&
+			item.Name != gatewayChassis.Name
+	})
+	if err != nil {
+		klog.Warningf("Failed to look up the gateway chassis conflicting with %s: %v", gatewayChassis.Name, err)
+		return
+	}
+	if len(conflicting) == 0 {
+		return
+	}
+	conflictingUUIDs := sets.NewString()
+	for _, chassis := range conflicting {
+		conflictingUUIDs.Insert(chassis.UUID)
+	}
+	ports, err := libovsdbops.FindLogicalRouterPortsWithPredicate(bnc.nbClient, func(item *nbdb.LogicalRouterPort) bool {
+		return conflictingUUIDs.HasAny(item.GatewayChassis...)
+	})
+	if err != nil {
+		klog.Warningf("Failed to look up the router ports conflicting with %s: %v", gatewayChassis.Name, err)
+		return
+	}
+	for _, port := range ports {
+		otherNode, ok := port.ExternalIDs[types.OvnNodeExternalID]
+		if !ok {
+			otherNode = strings.TrimPrefix(port.Name, types.RouterToSwitchPrefix)
+		}
+		if otherNode == node.Name {
+			continue
+		}
+		klog.Warningf("Nodes %s and %s both have chassis %s as gateway chassis at priority %d",
+			node.Name, otherNode, gatewayChassis.ChassisName, gatewayChassis.Priority)
+		bnc.recorder.Eventf(node, kapi.EventTypeWarning, "GatewayChassisConflict",
+			"Nodes %s and %s both have chassis %s as gateway chassis at priority %d, the traffic of one of them may be dropped",
+			node.Name, otherNode, gatewayChassis.ChassisName, gatewayChassis.Priority)
+	}
+}
+
+// createNodeLogicalSwitch creates or updates the logical switch of node nodeName, connects
+// it to the cluster router and starts tracking it in lsManager. It returns the switch as
+// configured in nbdb, UUID included, so that callers need not look it up again.
+func (bnc *BaseNetworkController) createNodeLogicalSwitch(nodeName string, hostSubnets []*net.IPNet,
+	loadBalancerGroupUUID string) (*nbdb.LogicalSwitch, error) {
+	// a single-family node only gets the subnets of its families on its switch
+	node, nodeErr := bnc.watchFactory.GetNode(nodeName)
+	if nodeErr == nil {
+		ipv4Mode, ipv6Mode := bnc.getNodeIPFamilies(node)
+		if filtered := filterHostSubnetsByFamily(hostSubnets, ipv4Mode, ipv6Mode); len(filtered) != len(hostSubnets) {
+			klog.Warningf("Ignoring the subnets of node %s for IP families it does not support: %v",
+				nodeName, hostSubnets)
+			hostSubnets = filtered
+		}
+	}
+
+	switchName := bnc.getNodeSwitchName(nodeName)
+	if nodeErr == nil && util.IsNodeOVNFrozen(node) {
+		// leave the switch as it is, but keep tracking it so that its pods get addresses
+		ls, err := libovsdbops.GetLogicalSwitch(bnc.nbClient, &nbdb.LogicalSwitch{Name: switchName})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get logical switch %s of frozen node %s: %w", switchName, nodeName, err)
+		}
+		klog.Infof("Node %s is frozen, not updating its logical switch %s", nodeName, switchName)
+		if err := bnc.lsManager.AddSwitch(switchName, ls.UUID, hostSubnets); err != nil {
+			return nil, err
+		}
+		return ls, nil
 	}
 
+	nodeLRPMAC := nodeRouterPortMAC(hostSubnets)
+
 	logicalSwitch := nbdb.LogicalSwitch{
 		Name: switchName,
 	}
+	if bnc.nodeSwitchName != nil {
+		// the node can't be told from the switch name, eg to clean up the switch of a
+		// node deleted while the controller was down
+		logicalSwitch.ExternalIDs = map[string]string{types.OvnNodeExternalID: nodeName}
+	}
+
+	var exclusions []*net.IPNet
+	if nodeErr == nil {
+		exclusions = bnc.getNodeSubnetExclusions(node)
+	}
 
 	var v4Gateway, v6Gateway net.IP
+	var hybridOverlayV6IfAddrs, reservedExcludeIPs []*net.IPNet
 	logicalSwitch.OtherConfig = map[string]string{}
-	for _, hostSubnet := range hostSubnets {
+	mgmtIPs := NodeManagementIPs(hostSubnets)
+	for i, hostSubnet := range hostSubnets {
 		gwIfAddr := util.GetNodeGatewayIfAddr(hostSubnet)
-		mgmtIfAddr := util.GetNodeManagementIfAddr(hostSubnet)
 
 		if utilnet.IsIPv6CIDR(hostSubnet) {
 			v6Gateway = gwIfAddr.IP
 
 			logicalSwitch.OtherConfig["ipv6_prefix"] =
 				hostSubnet.IP.String()
+			if config.HybridOverlay.Enabled {
+				hybridOverlayV6IfAddrs = append(hybridOverlayV6IfAddrs, util.GetNodeHybridOverlayIfAddr(hostSubnet))
+			}
+			reservedExcludeIPs = append(reservedExcludeIPs, bnc.getNodeExcludeIPv6IPs(node, hostSubnet, exclusions)...)
 		} else {
 			v4Gateway = gwIfAddr.IP
-			excludeIPs := mgmtIfAddr.IP.String()
+			excludeIPs := mgmtIPs[i].String()
 			if config.HybridOverlay.Enabled {
 				hybridOverlayIfAddr := util.GetNodeHybridOverlayIfAddr(hostSubnet)
 				excludeIPs += ".." + hybridOverlayIfAddr.IP.String()
 			}
+			for _, excludeRange := range bnc.getNodeExcludeIPRanges(node, hostSubnet, exclusions) {
+				excludeIPs += " " + excludeRange
+			}
+			// the invalid exclusions were reported along with the exclude_ips ranges
+			v4ExcludeIPs, _ := subnetExclusionIPs(hostSubnet, exclusions)
+			reservedExcludeIPs = append(reservedExcludeIPs, v4ExcludeIPs...)
 			logicalSwitch.OtherConfig["subnet"] = hostSubnet.String()
 			logicalSwitch.OtherConfig["exclude_ips"] = excludeIPs
 		}
 	}
 
-	if loadBalancerGroupUUID != "" {
-		logicalSwitch.LoadBalancerGroup = []string{loadBalancerGroupUUID}
+	if loadBalancerGroupUUID != "" {
+		// the group is detached from the switch of a node annotated after it was created
+		if nodeErr == nil && util.IsNodeExcludedFromLoadBalancerGroup(node) {
+			klog.V(5).Infof("Node %s is excluded from the load balancer group, not attaching it to switch %s",
+				nodeName, switchName)
+		} else {
+			logicalSwitch.LoadBalancerGroup = []string{loadBalancerGroupUUID}
+		}
+	}
+
+	// If supported, enable IGMP/MLD snooping and querier on the node.
+	if bnc.multicastSupport {
+		logicalSwitch.OtherConfig["mcast_snoop"] = "true"
+		if config.Default.MulticastFloodUnregistered {
+			logicalSwitch.OtherConfig["mcast_flood_unregistered"] = "true"
+		}
+
+		// Configure IGMP/MLD querier if the gateway IP address is known.
+		// Otherwise disable it.
+		if v4Gateway != nil || v6Gateway != nil {
+			logicalSwitch.OtherConfig["mcast_querier"] = "true"
+			logicalSwitch.OtherConfig["mcast_eth_src"] = nodeLRPMAC.String()
+			if v4Gateway != nil {
+				logicalSwitch.OtherConfig["mcast_ip4_src"] = v4Gateway.String()
+			}
+			if v6Gateway != nil {
+				logicalSwitch.OtherConfig["mcast_ip6_src"] = util.HWAddrToIPv6LLA(nodeLRPMAC).String()
+			}
+		} else {
+			logicalSwitch.OtherConfig["mcast_querier"] = "false"
+		}
+	}
+
+	if nodeErr == nil {
+		for key, value := range bnc.getNodeSwitchOtherConfig(node) {
+			logicalSwitch.OtherConfig[key] = value
+		}
+	}
+
+	// the switch is only reported created the first time, not each time it is reconciled
+	_, err := libovsdbops.GetLogicalSwitch(bnc.nbClient, &nbdb.LogicalSwitch{Name: switchName})
+	created := errors.Is(err, libovsdbclient.ErrNotFound)
+
+	// each transaction is idempotent, so a node whose switch only got partially
+	// configured before timing out is simply retried
+	nbClient := bnc.nodeSwitchClient()
+	err = libovsdbops.CreateOrUpdateLogicalSwitch(nbClient, &logicalSwitch, &logicalSwitch.OtherConfig,
+		&logicalSwitch.LoadBalancerGroup)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add logical switch %+v: %w", logicalSwitch, err)
+	}
+
+	// Connect the switch to the router.
+	logicalSwitchPort, err := nodeSwitchToRouterPort(switchName, hostSubnets)
+	if err != nil {
+		return nil, err
+	}
+	sw := nbdb.LogicalSwitch{Name: switchName}
+	err = libovsdbops.CreateOrUpdateLogicalSwitchPortsOnSwitch(nbClient, &sw, logicalSwitchPort)
+	if err != nil {
+		klog.Errorf("Failed to add logical port %+v to switch %s: %v", logicalSwitchPort, switchName, err)
+		return nil, err
+	}
+
+	// multicast is only supported in default network for now
+	if bnc.multicastSupport {
+		err = libovsdbops.AddPortsToPortGroup(nbClient, types.ClusterRtrPortGroupName, logicalSwitchPort.UUID)
+		if err != nil {
+			klog.Errorf(err.Error())
+			return nil, err
+		}
+	}
+
+	// Add the switch to the logical switch cache
+	if err := bnc.lsManager.AddSwitch(logicalSwitch.Name, logicalSwitch.UUID, hostSubnets); err != nil {
+		return nil, err
+	}
+
+	// OVN only honours exclude_ips for IPv4, so the IPv6 hybrid overlay
+	// interface address is reserved in the switch IPAM instead to keep it
+	// from being handed out to pods. The IPv4 one is allocated later on as
+	// the hybrid overlay distributed router IP.
+	if len(hybridOverlayV6IfAddrs) > 0 {
+		err = bnc.lsManager.AllocateIPs(switchName, hybridOverlayV6IfAddrs)
+		if err != nil && err != ipallocator.ErrAllocated {
+			return nil, fmt.Errorf("failed to reserve the hybrid overlay interface addresses %s on switch %s: %w",
+				util.JoinIPNets(hybridOverlayV6IfAddrs, ","), switchName, err)
+		}
+	}
+
+	// exclude_ips only applies to the dynamic addresses OVN assigns, and OVN has no
+	// exclude_ips at all for the ipv6_prefix ones it derives from the port MACs (SLAAC
+	// style), but pods get static addresses from the switch IPAM, which already holds
+	// the gateway and management port IPs. The subnet exclusions of the node are
+	// reserved there as well. An address already in use, e.g. by a pod started before
+	// the node was annotated, is left as it is.
+	for _, excludeIP := range reservedExcludeIPs {
+		err = bnc.lsManager.AllocateIPs(switchName, []*net.IPNet{excludeIP})
+		if err != nil && err != ipallocator.ErrAllocated {
+			return nil, fmt.Errorf("failed to reserve the excluded IP %s on switch %s: %w",
+				excludeIP.IP, switchName, err)
+		}
+	}
+
+	if created {
+		bnc.recorder.Eventf(&kapi.ObjectReference{Kind: "Node", Name: nodeName}, kapi.EventTypeNormal,
+			"NodeLogicalSwitchCreated", "Logical switch %s of node %s created with subnets %s",
+			switchName, nodeName, util.JoinIPNets(hostSubnets, ","))
+		if config.Default.NodeSwitchDatapathCheckTimeout > 0 && bnc.sbClient != nil {
+			go bnc.checkNodeSwitchDatapath(nodeName, switchName, logicalSwitch.UUID,
+				time.Duration(config.Default.NodeSwitchDatapathCheckTimeout)*time.Millisecond)
+		}
+	}
+	return &logicalSwitch, nil
+}
+
+// nodeRouterPortMAC returns the MAC of the cluster router port of a node switch with the
+// given host subnets, derived from the gateway IP of the IPv4 subnet if there is one so that
+// it doesn't change when a single-stack IPv4 node becomes dual-stack. An IPv6-only node has
+// it derived from the gateway IP of its IPv6 subnet, which is just as deterministic as both
+// derivations give a locally administered unicast MAC.
+func nodeRouterPortMAC(hostSubnets []*net.IPNet) net.HardwareAddr {
+	var macSubnet *net.IPNet
+	for _, hostSubnet := range hostSubnets {
+		if !utilnet.IsIPv6CIDR(hostSubnet) {
+			macSubnet = hostSubnet
+			break
+		}
+		if macSubnet == nil {
+			macSubnet = hostSubnet
+		}
+	}
+	if macSubnet == nil {
+		return nil
+	}
+	return util.IPAddrToHWAddr(util.GetNodeGatewayIfAddr(macSubnet).IP)
+}
+
+// nodeSwitchToRouterPort returns the port connecting the node switch switchName, with the
+// given host subnets, to the cluster router
+func nodeSwitchToRouterPort(switchName string, hostSubnets []*net.IPNet) (*nbdb.LogicalSwitchPort, error) {
+	logicalSwitchPort := nbdb.LogicalSwitchPort{
+		Name:      types.SwitchToRouterPrefix + switchName,
+		Type:      "router",
+		Addresses: []string{"router"},
+		Options:   map[string]string{"router-port": types.RouterToSwitchPrefix + switchName},
+	}
+	if config.Default.EnableNodePortSecurity {
+		// port security needs the actual addresses of the router port, the addresses of
+		// the switch port are kept to "router" for OVN to take them from the router port
+		addresses := nodeRouterPortMAC(hostSubnets).String()
+		for _, hostSubnet := range hostSubnets {
+			addresses += " " + util.GetNodeGatewayIfAddr(hostSubnet).IP.String()
+		}
+		var err error
+		logicalSwitchPort.PortSecurity, err = getNodePortSecurity([]string{addresses})
+		if err != nil {
+			return nil, fmt.Errorf("failed to set port security on logical port %s: %v", logicalSwitchPort.Name, err)
+		}
+	}
+	return &logicalSwitchPort, nil
+}
+
+// nodeSwitchToRouterPortStale tells whether the switch-to-router port lsp of switch ls is
+// missing from it, or no longer a router port peered with the switch's cluster router port
+func nodeSwitchToRouterPortStale(ls *nbdb.LogicalSwitch, lsp *nbdb.LogicalSwitchPort) bool {
+	if lsp == nil || lsp.Type != "router" || lsp.Options["router-port"] != types.RouterToSwitchPrefix+ls.Name {
+		return true
+	}
+	for _, port := range ls.Ports {
+		if port == lsp.UUID {
+			return false
+		}
+	}
+	return true
+}
+
+// reconcileNodeSwitchRouterPorts recreates the switch-to-router port of the node switches
+// in lsManager when it was deleted or altered out-of-band, which silently disconnects the
+// node from the cluster router. Only the port is recreated, the switch and the other ports
+// on it are left alone. It returns the names of the switches whose port was recreated.
+func (bnc *BaseNetworkController) reconcileNodeSwitchRouterPorts(nodes []*kapi.Node) ([]string, error) {
+	var repaired []string
+	var errs []error
+	for _, node := range nodes {
+		switchName := bnc.getNodeSwitchName(node.Name)
+		if bnc.lsManager.IsNonHostSubnetSwitch(switchName) {
+			continue
+		}
+		hostSubnets := bnc.lsManager.GetSwitchSubnets(switchName)
+		if len(hostSubnets) == 0 || util.IsNodeOVNFrozen(node) {
+			continue
+		}
+		ls, err := libovsdbops.GetLogicalSwitch(bnc.nbClient, &nbdb.LogicalSwitch{Name: switchName})
+		if err != nil {
+			// the switch itself is recreated by the node add retries
+			if !errors.Is(err, libovsdbclient.ErrNotFound) {
+				errs = append(errs, fmt.Errorf("failed to get logical switch %s: %w", switchName, err))
+			}
+			continue
+		}
+		lsp, err := libovsdbops.GetLogicalSwitchPort(bnc.nbClient,
+			&nbdb.LogicalSwitchPort{Name: types.SwitchToRouterPrefix + switchName})
+		if err != nil && !errors.Is(err, libovsdbclient.ErrNotFound) {
+			errs = append(errs, fmt.Errorf("failed to get the router port of logical switch %s: %w", switchName, err))
+			continue
+		}
+		if !nodeSwitchToRouterPortStale(ls, lsp) {
+			continue
+		}
+
+		klog.Warningf("Switch-to-router port of logical switch %s is missing or misconfigured, recreating it",
+			switchName)
+		lsp, err = nodeSwitchToRouterPort(switchName, hostSubnets)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err = libovsdbops.CreateOrUpdateLogicalSwitchPortsOnSwitch(bnc.nbClient, ls, lsp); err != nil {
+			errs = append(errs, fmt.Errorf("failed to recreate port %s on logical switch %s: %w",
+				lsp.Name, switchName, err))
+			continue
+		}
+		if bnc.multicastSupport {
+			if err = libovsdbops.AddPortsToPortGroup(bnc.nbClient, types.ClusterRtrPortGroupName, lsp.UUID); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		repaired = append(repaired, switchName)
+		bnc.recorder.Eventf(node, kapi.EventTypeWarning, "NodeSwitchRouterPortRepaired",
+			"Port %s connecting logical switch %s to the cluster router was recreated", lsp.Name, switchName)
+	}
+	return repaired, kerrors.NewAggregate(errs)
+}
+
+// reconcileNodeClusterRouterPortNetworks resyncs the cluster router port of the node switches
+// in lsManager whose networks no longer are the gateway addresses of the switch subnets, eg
+// when the node subnets changed without the port being synced, which breaks routing to the
+// node. Ports that don't exist are left to the node add retries. It returns the names of
+// the router ports that were repaired.
+func (bnc *BaseNetworkController) reconcileNodeClusterRouterPortNetworks(nodes []*kapi.Node) ([]string, error) {
+	var repaired []string
+	var errs []error
+	for _, node := range nodes {
+		switchName := bnc.getNodeSwitchName(node.Name)
+		if bnc.lsManager.IsNonHostSubnetSwitch(switchName) {
+			continue
+		}
+		hostSubnets := bnc.lsManager.GetSwitchSubnets(switchName)
+		if len(hostSubnets) == 0 || util.IsNodeOVNFrozen(node) {
+			continue
+		}
+		lrpName := types.RouterToSwitchPrefix + switchName
+		lrp, err := libovsdbops.GetLogicalRouterPort(bnc.nbClient, &nbdb.LogicalRouterPort{Name: lrpName})
+		if err != nil {
+			if !errors.Is(err, libovsdbclient.ErrNotFound) {
+				errs = append(errs, fmt.Errorf("failed to get logical router port %s: %w", lrpName, err))
+			}
+			continue
+		}
+		expected := sets.NewString()
+		for _, hostSubnet := range hostSubnets {
+			expected.Insert(util.GetNodeGatewayIfAddr(hostSubnet).String())
+		}
+		if expected.Equal(sets.NewString(lrp.Networks...)) {
+			continue
+		}
+
+		klog.Warningf("Logical router port %s networks %v do not match the node %s subnets %s, repairing",
+			lrpName, lrp.Networks, node.Name, util.JoinIPNets(hostSubnets, ","))
+		if err = bnc.syncNodeClusterRouterPort(node, hostSubnets); err != nil {
+			errs = append(errs, fmt.Errorf("failed to repair logical router port %s: %w", lrpName, err))
+			continue
+		}
+		repaired = append(repaired, lrpName)
+		bnc.recorder.Eventf(node, kapi.EventTypeWarning, "NodeClusterRouterPortRepaired",
+			"Networks of cluster router port %s were stale and were reset to %s", lrpName,
+			strings.Join(expected.List(), ","))
+	}
+	return repaired, kerrors.NewAggregate(errs)
+}
+
+// nodeSwitchClient returns the client to create and update node switches with, which
+// cancels its transactions after the configured node switch transaction timeout
+func (bnc *BaseNetworkController) nodeSwitchClient() libovsdbclient.Client {
+	if config.Default.NodeSwitchTransactTimeout <= 0 {
+		return bnc.nbClient
+	}
+	return libovsdbops.WithTransactTimeout(bnc.nbClient,
+		time.Duration(config.Default.NodeSwitchTransactTimeout)*time.Millisecond)
+}
+
+// checkNodeSwitchDatapath waits up to timeout for northd to create the southbound datapath
+// of the logical switch switchUUID of node nodeName, and posts a warning event for the node
+// if it doesn't show up, as pods can't be wired on the node until it does. Returns whether
+// the datapath was found.
+func (bnc *BaseNetworkController) checkNodeSwitchDatapath(nodeName, switchName, switchUUID string,
+	timeout time.Duration) bool {
+	p := func(item *sbdb.DatapathBinding) bool {
+		return item.ExternalIDs["logical-switch"] == switchUUID
+	}
+	err := wait.PollImmediate(nodeSwitchDatapathCheckInterval, timeout, func() (bool, error) {
+		_, err := libovsdbops.GetDatapathBindingWithPredicate(bnc.sbClient, p)
+		return err == nil, nil
+	})
+	if err != nil {
+		klog.Warningf("Southbound datapath of logical switch %s of node %s not found after %v",
+			switchName, nodeName, timeout)
+		bnc.recorder.Eventf(&kapi.ObjectReference{Kind: "Node", Name: nodeName}, kapi.EventTypeWarning,
+			"NodeSwitchDatapathMissing", "Logical switch %s of node %s has no southbound datapath after %v",
+			switchName, nodeName, timeout)
+		return false
+	}
+	return true
+}
+
+// reconcileClusterRouterPortGroup makes the cluster router port group hold the router
+// ports of all the node switches when multicast is supported, and no port otherwise.
+// Node switch router ports are only added to the group when created, so membership
+// drifts when multicast support changes or ports are removed from the group out-of-band.
+func (bnc *BaseNetworkController) reconcileClusterRouterPortGroup() error {
+	pg, err := libovsdbops.GetPortGroup(bnc.nbClient, &nbdb.PortGroup{Name: types.ClusterRtrPortGroupName})
+	if err != nil {
+		return fmt.Errorf("failed to get port group %s: %w", types.ClusterRtrPortGroupName, err)
+	}
+	expected := sets.NewString()
+	if bnc.multicastSupport {
+		ports, err := libovsdbops.FindLogicalSwitchPortsWithPredicate(bnc.nbClient, func(item *nbdb.LogicalSwitchPort) bool {
+			return item.Type == "router" && strings.HasPrefix(item.Name, types.SwitchToRouterPrefix)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to find the node switch router ports: %w", err)
+		}
+		for _, port := range ports {
+			expected.Insert(port.UUID)
+		}
+	}
+
+	members := sets.NewString(pg.Ports...)
+	missing := expected.Difference(members).List()
+	stale := members.Difference(expected).List()
+	if len(missing) == 0 && len(stale) == 0 {
+		return nil
+	}
+	klog.Infof("Reconciling port group %s membership: adding ports %v, removing ports %v",
+		types.ClusterRtrPortGroupName, missing, stale)
+	ops, err := libovsdbops.AddPortsToPortGroupOps(bnc.nbClient, nil, types.ClusterRtrPortGroupName, missing...)
+	if err != nil {
+		return err
+	}
+	ops, err = libovsdbops.DeletePortsFromPortGroupOps(bnc.nbClient, ops, types.ClusterRtrPortGroupName, stale...)
+	if err != nil {
+		return err
+	}
+	_, err = libovsdbops.TransactAndCheck(bnc.nbClient, ops)
+	return err
+}
+
+// getNodeSwitchOtherConfig returns the entries of the node switch other-config annotation
+// that can be set on the node logical switch. Entries with keys that are managed by
+// createNodeLogicalSwitch or not in nodeSwitchOtherConfigAllowed are left out, and a
+// warning event is posted for the node.
+func (bnc *BaseNetworkController) getNodeSwitchOtherConfig(node *kapi.Node) map[string]string {
+	otherConfig, err := util.ParseNodeSwitchOtherConfigAnnotation(node)
+	if err != nil {
+		if !util.IsAnnotationNotSetError(err) {
+			klog.Warningf("Ignoring the logical switch other-config of node %s: %v", node.Name, err)
+			bnc.recorder.Eventf(node, kapi.EventTypeWarning, "InvalidSwitchOtherConfig",
+				"Ignoring the logical switch other-config of node %s: %v", node.Name, err)
+		}
+		return nil
+	}
+	var rejected []string
+	for key := range otherConfig {
+		switch {
+		case nodeSwitchOtherConfigManaged.Has(key):
+			rejected = append(rejected, key+" (managed by ovn-kubernetes)")
+		case !nodeSwitchOtherConfigAllowed.Has(key):
+			rejected = append(rejected, key+" (not allowed)")
+		default:
+			continue
+		}
+		delete(otherConfig, key)
+	}
+	if len(rejected) > 0 {
+		sort.Strings(rejected)
+		klog.Warningf("Ignoring logical switch other-config keys of node %s: %s", node.Name, strings.Join(rejected, ", "))
+		bnc.recorder.Eventf(node, kapi.EventTypeWarning, "InvalidSwitchOtherConfig",
+			"Ignoring logical switch other-config keys of node %s: %s", node.Name, strings.Join(rejected, ", "))
+	}
+	return otherConfig
+}
+
+// getNodeSubnetExclusions returns the CIDRs in the subnet exclusion annotation of the node.
+// An unparsable annotation is ignored, and a warning event is posted for the node.
+func (bnc *BaseNetworkController) getNodeSubnetExclusions(node *kapi.Node) []*net.IPNet {
+	exclusions, err := util.ParseNodeExcludeSubnetsAnnotation(node)
+	if err != nil {
+		if !util.IsAnnotationNotSetError(err) {
+			klog.Warningf("Ignoring the subnet exclusions of node %s: %v", node.Name, err)
+			bnc.recorder.Eventf(node, kapi.EventTypeWarning, "InvalidSubnetExclusion",
+				"Ignoring the subnet exclusions of node %s: %v", node.Name, err)
+		}
+		return nil
+	}
+	return exclusions
+}
+
+// getNodeExcludeIPRanges returns the exclude_ips ranges of the subnet exclusions of the node,
+// for the switch with the IPv4 host subnet hostSubnet. Exclusions that are not valid for the
+// host subnet are left out, and a warning event is posted for the node.
+func (bnc *BaseNetworkController) getNodeExcludeIPRanges(node *kapi.Node, hostSubnet *net.IPNet,
+	exclusions []*net.IPNet) []string {
+	excludeRanges, errs := subnetExclusionRanges(hostSubnet, exclusions)
+	if len(errs) > 0 {
+		err := kerrors.NewAggregate(errs)
+		klog.Warningf("Ignoring subnet exclusions of node %s: %v", node.Name, err)
+		bnc.recorder.Eventf(node, kapi.EventTypeWarning, "InvalidSubnetExclusion",
+			"Ignoring subnet exclusions of node %s: %v", node.Name, err)
+	}
+	return excludeRanges
+}
+
+// getNodeExcludeIPv6IPs is the IPv6 counterpart of getNodeExcludeIPRanges: it returns each
+// IP of the subnet exclusions of the node within the IPv6 host subnet hostSubnet.
+func (bnc *BaseNetworkController) getNodeExcludeIPv6IPs(node *kapi.Node, hostSubnet *net.IPNet,
+	exclusions []*net.IPNet) []*net.IPNet {
+	excludeIPs, errs := subnetExclusionIPs(hostSubnet, exclusions)
+	if len(errs) > 0 {
+		err := kerrors.NewAggregate(errs)
+		klog.Warningf("Ignoring IPv6 subnet exclusions of node %s: %v", node.Name, err)
+		bnc.recorder.Eventf(node, kapi.EventTypeWarning, "InvalidSubnetExclusion",
+			"Ignoring IPv6 subnet exclusions of node %s: %v", node.Name, err)
+	}
+	return excludeIPs
+}
+
+// subnetExclusionRanges converts CIDR exclusions to the first..last ranges of the exclude_ips
+// option of a switch with the IPv4 host subnet hostSubnet, or to a single IP for a /32.
+// OVN only honours exclude_ips for IPv4, so IPv6 exclusions are ignored. An error is returned
+// for each IPv4 exclusion that is not within the host subnet or that covers its gateway IP.
+func subnetExclusionRanges(hostSubnet *net.IPNet, exclusions []*net.IPNet) ([]string, []error) {
+	hostPrefixLen, _ := hostSubnet.Mask.Size()
+	gwIP := util.GetNodeGatewayIfAddr(hostSubnet).IP
+	var excludeRanges []string
+	var errs []error
+	for _, exclusion := range exclusions {
+		if utilnet.IsIPv6CIDR(exclusion) {
+			continue
+		}
+		prefixLen, _ := exclusion.Mask.Size()
+		if prefixLen < hostPrefixLen || !hostSubnet.Contains(exclusion.IP) {
+			errs = append(errs, fmt.Errorf("exclusion %s is not within host subnet %s", exclusion, hostSubnet))
+			continue
+		}
+		if exclusion.Contains(gwIP) {
+			errs = append(errs, fmt.Errorf("exclusion %s covers gateway IP %s", exclusion, gwIP))
+			continue
+		}
+		first := exclusion.IP.Mask(exclusion.Mask)
+		size := utilnet.RangeSize(exclusion)
+		if size == 1 {
+			excludeRanges = append(excludeRanges, first.String())
+			continue
+		}
+		last, err := utilnet.GetIndexedIP(exclusion, int(size-1))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to get the last IP of exclusion %s: %v", exclusion, err))
+			continue
+		}
+		excludeRanges = append(excludeRanges, first.String()+".."+last.String())
+	}
+	return excludeRanges, errs
+}
+
+// maxIPv6ExclusionSize is the largest IPv6 subnet exclusion, in addresses, that is reserved
+// in the IPAM of a node switch. IPv6 exclusions are reserved address by address, so this
+// keeps a short prefix length from reserving a whole /64.
+const maxIPv6ExclusionSize = 256
+
+// subnetExclusionIPs returns, as host routes, the IPs of the exclusions within the host
+// subnet hostSubnet. Exclusions of the other IP family are ignored. An error is returned
+// for each exclusion that is not within the host subnet, that covers its gateway IP or,
+// for IPv6, that has more than maxIPv6ExclusionSize addresses.
+func subnetExclusionIPs(hostSubnet *net.IPNet, exclusions []*net.IPNet) ([]*net.IPNet, []error) {
+	isIPv6 := utilnet.IsIPv6CIDR(hostSubnet)
+	hostPrefixLen, bits := hostSubnet.Mask.Size()
+	gwIP := util.GetNodeGatewayIfAddr(hostSubnet).IP
+	var excludeIPs []*net.IPNet
+	var errs []error
+	for _, exclusion := range exclusions {
+		if utilnet.IsIPv6CIDR(exclusion) != isIPv6 {
+			continue
+		}
+		prefixLen, _ := exclusion.Mask.Size()
+		if prefixLen < hostPrefixLen || !hostSubnet.Contains(exclusion.IP) {
+			errs = append(errs, fmt.Errorf("exclusion %s is not within host subnet %s", exclusion, hostSubnet))
+			continue
+		}
+		if exclusion.Contains(gwIP) {
+			errs = append(errs, fmt.Errorf("exclusion %s covers gateway IP %s", exclusion, gwIP))
+			continue
+		}
+		size := utilnet.RangeSize(exclusion)
+		if isIPv6 && size > maxIPv6ExclusionSize {
+			errs = append(errs, fmt.Errorf("exclusion %s has more than %d addresses", exclusion, maxIPv6ExclusionSize))
+			continue
+		}
+		for i := int64(0); i < size; i++ {
+			ip, err := utilnet.GetIndexedIP(exclusion, int(i))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to get IP %d of exclusion %s: %v", i, exclusion, err))
+				break
+			}
+			if !isIPv6 {
+				ip = ip.To4()
+			}
+			excludeIPs = append(excludeIPs, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		}
+	}
+	return excludeIPs, errs
+}
+
+// NodeManagementIPs returns the IP of the management port of a node in each of its
+// host subnets, in the same order.
+func NodeManagementIPs(hostSubnets []*net.IPNet) []net.IP {
+	mgmtIPs := make([]net.IP, 0, len(hostSubnets))
+	for _, hostSubnet := range hostSubnets {
+		mgmtIPs = append(mgmtIPs, util.GetNodeManagementIfAddr(hostSubnet).IP)
+	}
+	return mgmtIPs
+}
+
+// GetNodeManagementIPs returns the management port IPs of a node from the subnets
+// of its logical switch, or an error if the node has no switch with subnets.
+func (bnc *BaseNetworkController) GetNodeManagementIPs(nodeName string) ([]net.IP, error) {
+	hostSubnets := bnc.lsManager.GetSwitchSubnets(bnc.getNodeSwitchName(nodeName))
+	if len(hostSubnets) == 0 {
+		return nil, fmt.Errorf("node %s has no logical switch with host subnets", nodeName)
+	}
+	return NodeManagementIPs(hostSubnets), nil
+}
+
+// ChassisToNode returns the names of the nodes keyed by the chassis ID they are
+// annotated with, the chassis their cluster router port is pinned to. It is read from
+// the node informer cache, so it follows node updates. Nodes without a chassis ID
+// annotation are left out. If nodes share a chassis ID, the first one by name is
+// returned.
+func (bnc *BaseNetworkController) ChassisToNode() map[string]string {
+	nodes, err := bnc.watchFactory.GetNodes()
+	if err != nil {
+		klog.Errorf("Failed to list nodes for their chassis: %v", err)
+		return nil
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	chassisToNode := make(map[string]string, len(nodes))
+	for _, node := range nodes {
+		chassisID, err := util.ParseNodeChassisIDAnnotation(node)
+		if err != nil {
+			continue
+		}
+		if existing, ok := chassisToNode[chassisID]; ok {
+			klog.Warningf("Nodes %s and %s are both annotated with chassis %s", existing, node.Name, chassisID)
+			continue
+		}
+		chassisToNode[chassisID] = node.Name
+	}
+	return chassisToNode
+}
+
+// NodeLogicalNetworkReady returns whether the logical network of a node is fully
+// provisioned: its logical switch exists with the node host subnets, and its cluster
+// router port exists with the node gateway addresses and is pinned to the node chassis.
+// When it is not, the returned error wraps ErrNodeLogicalNetworkNotReady and tells
+// what is missing. Any other error means readiness could not be checked.
+func (bnc *BaseNetworkController) NodeLogicalNetworkReady(nodeName string) (bool, error) {
+	notReady := func(format string, args ...interface{}) (bool, error) {
+		return false, fmt.Errorf("%w: node %s: %s", ErrNodeLogicalNetworkNotReady, nodeName, fmt.Sprintf(format, args...))
+	}
+
+	node, err := bnc.watchFactory.GetNode(nodeName)
+	if err != nil {
+		return false, fmt.Errorf("failed to get node %s: %w", nodeName, err)
+	}
+	hostSubnets, err := util.ParseNodeHostSubnetAnnotation(node, bnc.getNetworkName())
+	if err != nil {
+		return notReady("no host subnets: %v", err)
+	}
+	chassisID, err := util.ParseNodeChassisIDAnnotation(node)
+	if err != nil {
+		return notReady("no chassis ID: %v", err)
+	}
+
+	switchName := bnc.getNodeSwitchName(nodeName)
+	logicalSwitch, err := libovsdbops.GetLogicalSwitch(bnc.nbClient, &nbdb.LogicalSwitch{Name: switchName})
+	if errors.Is(err, libovsdbclient.ErrNotFound) {
+		return notReady("logical switch %s not found", switchName)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get logical switch %s: %w", switchName, err)
+	}
+	for _, hostSubnet := range hostSubnets {
+		key, value := "subnet", hostSubnet.String()
+		if utilnet.IsIPv6CIDR(hostSubnet) {
+			key, value = "ipv6_prefix", hostSubnet.IP.String()
+		}
+		if logicalSwitch.OtherConfig[key] != value {
+			return notReady("logical switch %s has %s %q instead of %q", switchName, key, logicalSwitch.OtherConfig[key], value)
+		}
+	}
+
+	lrpName := types.RouterToSwitchPrefix + switchName
+	lrp, err := libovsdbops.GetLogicalRouterPort(bnc.nbClient, &nbdb.LogicalRouterPort{Name: lrpName})
+	if errors.Is(err, libovsdbclient.ErrNotFound) {
+		return notReady("logical router port %s not found", lrpName)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get logical router port %s: %w", lrpName, err)
+	}
+	networks := sets.NewString(lrp.Networks...)
+	for _, hostSubnet := range hostSubnets {
+		gwIfAddr := util.GetNodeGatewayIfAddr(hostSubnet).String()
+		if !networks.Has(gwIfAddr) {
+			return notReady("logical router port %s does not have network %s", lrpName, gwIfAddr)
+		}
+	}
+
+	gatewayChassisName := lrpName + "-" + chassisID
+	gatewayChassis, err := libovsdbops.GetGatewayChassis(bnc.nbClient, &nbdb.GatewayChassis{Name: gatewayChassisName})
+	if err != nil && !errors.Is(err, libovsdbclient.ErrNotFound) {
+		return false, fmt.Errorf("failed to get gateway chassis %s: %w", gatewayChassisName, err)
+	}
+	if err != nil || gatewayChassis.ChassisName != chassisID || !sets.NewString(lrp.GatewayChassis...).Has(gatewayChassis.UUID) {
+		return notReady("logical router port %s is not pinned to chassis %s", lrpName, chassisID)
+	}
+
+	return true, nil
+}
+
+// ClusterRouterExists returns whether the cluster router exists in nbdb. An error is only
+// returned if that could not be checked.
+func (bnc *BaseNetworkController) ClusterRouterExists() (bool, error) {
+	_, err := libovsdbops.GetLogicalRouter(bnc.nbClient, &nbdb.LogicalRouter{Name: types.OVNClusterRouter})
+	if errors.Is(err, libovsdbclient.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get cluster router %s: %w", types.OVNClusterRouter, err)
+	}
+	return true, nil
+}
+
+// NodeExcludedIPs returns the IPs excluded from dynamic allocation on the switch of the
+// node, as set in its exclude_ips option: single IPs as host routes and ranges as the
+// CIDRs that exactly cover them.
+func (bnc *BaseNetworkController) NodeExcludedIPs(nodeName string) ([]net.IPNet, error) {
+	switchName := bnc.getNodeSwitchName(nodeName)
+	ls, err := libovsdbops.GetLogicalSwitch(bnc.nbClient, &nbdb.LogicalSwitch{Name: switchName})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node %s logical switch %s: %w", nodeName, switchName, err)
+	}
+	excludedIPs, err := parseExcludeIPs(ls.OtherConfig["exclude_ips"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid exclude_ips of logical switch %s: %w", switchName, err)
+	}
+	return excludedIPs, nil
+}
+
+// parseExcludeIPs parses the space separated IPs and first..last IP ranges of the
+// exclude_ips option of a switch
+func parseExcludeIPs(excludeIPs string) ([]net.IPNet, error) {
+	var excludedIPs []net.IPNet
+	for _, entry := range strings.Fields(excludeIPs) {
+		firstIP, lastIP := entry, entry
+		if i := strings.Index(entry, ".."); i >= 0 {
+			firstIP, lastIP = entry[:i], entry[i+2:]
+		}
+		first, last := net.ParseIP(firstIP), net.ParseIP(lastIP)
+		if first == nil || last == nil {
+			return nil, fmt.Errorf("%q is not an IP or IP range", entry)
+		}
+		if utilnet.IsIPv6(first) != utilnet.IsIPv6(last) {
+			return nil, fmt.Errorf("range %q mixes IP families", entry)
+		}
+		cidrs := ipRangeCIDRs(first, last)
+		if len(cidrs) == 0 {
+			return nil, fmt.Errorf("range %q ends before it starts", entry)
+		}
+		excludedIPs = append(excludedIPs, cidrs...)
+	}
+	return excludedIPs, nil
+}
+
+// ipRangeCIDRs returns the fewest CIDRs that exactly cover the IPs from first to last of
+// the same family, or none if last comes before first
+func ipRangeCIDRs(first, last net.IP) []net.IPNet {
+	bits := 128
+	if !utilnet.IsIPv6(first) {
+		bits = 32
+	}
+	start, end := utilnet.BigForIP(first), utilnet.BigForIP(last)
+	var cidrs []net.IPNet
+	for start.Cmp(end) <= 0 {
+		// the largest block aligned on start that doesn't go past end
+		hostBits := int(start.TrailingZeroBits())
+		if hostBits > bits || start.Sign() == 0 {
+			hostBits = bits
+		}
+		for ; hostBits > 0; hostBits-- {
+			blockEnd := new(big.Int).Add(start, new(big.Int).Lsh(big.NewInt(1), uint(hostBits)))
+			if blockEnd.Sub(blockEnd, big.NewInt(1)).Cmp(end) <= 0 {
+				break
+			}
+		}
+		ip := utilnet.AddIPOffset(start, 0)
+		if bits == 32 {
+			ip = ip.To4()
+		}
+		cidrs = append(cidrs, net.IPNet{IP: ip, Mask: net.CIDRMask(bits-hostBits, bits)})
+		start.Add(start, new(big.Int).Lsh(big.NewInt(1), uint(hostBits)))
+	}
+	return cidrs
+}
+
+// getNodePortSecurity returns the port security of a node switch port with the
+// given addresses. Each address must be a MAC address followed by the IP
+// addresses the port is allowed to use.
+func getNodePortSecurity(addresses []string) ([]string, error) {
+	portSecurity := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		fields := strings.Fields(address)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("address %q does not have both a MAC and an IP address", address)
+		}
+		if _, err := net.ParseMAC(fields[0]); err != nil {
+			return nil, fmt.Errorf("address %q has an invalid MAC: %v", address, err)
+		}
+		for _, ip := range fields[1:] {
+			if net.ParseIP(ip) == nil {
+				return nil, fmt.Errorf("address %q has an invalid IP %q", address, ip)
+			}
+		}
+		portSecurity = append(portSecurity, address)
+	}
+	return portSecurity, nil
+}
+
+// nodeSubnetPreallocation holds the subnets allocated to a node that doesn't exist,
+// either before it is added or for a while after it was deleted
+type nodeSubnetPreallocation struct {
+	subnets []*net.IPNet
+	expires time.Time
+}
+
+// nodeSubnetPreallocationTimeout is how long subnets preallocated to a node are kept
+// for the node to be added before they are released
+const nodeSubnetPreallocationTimeout = 10 * time.Minute
+
+// preallocateNodeSubnets allocates subnets to a node that doesn't exist yet, so
+// that they are ready when the node is added. A node that already has subnets
+// preallocated keeps them and gets their expiry extended.
+func (bnc *BaseNetworkController) preallocateNodeSubnets(nodeName string,
+	masterSubnetAllocator *subnetallocator.HostSubnetAllocator) ([]*net.IPNet, error) {
+	if _, err := bnc.watchFactory.GetNode(nodeName); err == nil {
+		return nil, fmt.Errorf("cannot preallocate subnets for node %s: the node already exists", nodeName)
+	} else if !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("cannot preallocate subnets for node %s: %v", nodeName, err)
+	}
+
+	bnc.nodeSubnetPreallocationsLock.Lock()
+	defer bnc.nodeSubnetPreallocationsLock.Unlock()
+	expires := bnc.clock.Now().Add(nodeSubnetPreallocationTimeout)
+	if preallocation, ok := bnc.nodeSubnetPreallocations[nodeName]; ok {
+		preallocation.expires = expires
+		return preallocation.subnets, nil
+	}
+	subnets, allocatedSubnets, err := masterSubnetAllocator.AllocateNodeSubnets(nodeName, nil, config.IPv4Mode, config.IPv6Mode)
+	if err != nil {
+		return nil, err
+	}
+	bnc.recordNodeSubnetAllocations(allocatedSubnets)
+	if bnc.nodeSubnetPreallocations == nil {
+		bnc.nodeSubnetPreallocations = map[string]*nodeSubnetPreallocation{}
+	}
+	bnc.nodeSubnetPreallocations[nodeName] = &nodeSubnetPreallocation{subnets: subnets, expires: expires}
+	klog.Infof("Preallocated subnets %v for node %s until %v", subnets, nodeName, expires)
+	return subnets, nil
+}
+
+// holdDeletedNodeSubnets keeps the subnets of a deleted node allocated for the given
+// delay, so that the node gets them back if it is re-added in the meantime. They are
+// then handled like subnets preallocated to the node, which replace any subnets still
+// preallocated to it, releasing those the node didn't end up with.
+func (bnc *BaseNetworkController) holdDeletedNodeSubnets(nodeName string, subnets []*net.IPNet, delay time.Duration,
+	masterSubnetAllocator *subnetallocator.HostSubnetAllocator) {
+	bnc.nodeSubnetPreallocationsLock.Lock()
+	defer bnc.nodeSubnetPreallocationsLock.Unlock()
+	expires := bnc.clock.Now().Add(delay)
+	if bnc.nodeSubnetPreallocations == nil {
+		bnc.nodeSubnetPreallocations = map[string]*nodeSubnetPreallocation{}
+	}
+	if preallocation, ok := bnc.nodeSubnetPreallocations[nodeName]; ok {
+		bnc.releaseUnusedPreallocatedSubnets(nodeName, preallocation.subnets, subnets, masterSubnetAllocator)
+	}
+	bnc.nodeSubnetPreallocations[nodeName] = &nodeSubnetPreallocation{subnets: subnets, expires: expires}
+	klog.Infof("Holding subnets %v of deleted node %s until %v", subnets, nodeName, expires)
+}
+
+// getPreallocatedNodeSubnets returns the subnets preallocated to a node, if any
+func (bnc *BaseNetworkController) getPreallocatedNodeSubnets(nodeName string) []*net.IPNet {
+	bnc.nodeSubnetPreallocationsLock.Lock()
+	defer bnc.nodeSubnetPreallocationsLock.Unlock()
+	if preallocation, ok := bnc.nodeSubnetPreallocations[nodeName]; ok {
+		return preallocation.subnets
+	}
+	return nil
+}
+
+// releaseNodeSubnetPreallocation forgets the subnets preallocated to a node that was
+// added, releasing those the node didn't end up with
+func (bnc *BaseNetworkController) releaseNodeSubnetPreallocation(nodeName string, hostSubnets []*net.IPNet,
+	masterSubnetAllocator *subnetallocator.HostSubnetAllocator) {
+	bnc.nodeSubnetPreallocationsLock.Lock()
+	defer bnc.nodeSubnetPreallocationsLock.Unlock()
+	preallocation, ok := bnc.nodeSubnetPreallocations[nodeName]
+	if !ok {
+		return
+	}
+	delete(bnc.nodeSubnetPreallocations, nodeName)
+	bnc.releaseUnusedPreallocatedSubnets(nodeName, preallocation.subnets, hostSubnets, masterSubnetAllocator)
+}
+
+// releaseUnusedPreallocatedSubnets releases the subnets preallocated to a node that are not
+// among the subnets it uses. nodeSubnetPreallocationsLock must be held.
+func (bnc *BaseNetworkController) releaseUnusedPreallocatedSubnets(nodeName string, preallocated, hostSubnets []*net.IPNet,
+	masterSubnetAllocator *subnetallocator.HostSubnetAllocator) {
+	used := sets.NewString()
+	for _, subnet := range hostSubnets {
+		used.Insert(subnet.String())
+	}
+	for _, subnet := range preallocated {
+		if used.Has(subnet.String()) {
+			continue
+		}
+		if err := masterSubnetAllocator.ReleaseNodeSubnets(nodeName, subnet); err != nil {
+			klog.Warningf("Failed to release subnet %v preallocated for node %s: %v", subnet, nodeName, err)
+			continue
+		}
+		bnc.recordNodeSubnetReleases([]*net.IPNet{subnet})
+	}
+}
+
+// recordNodeSubnetAllocations records the allocation of the given node subnets of the network
+func (bnc *BaseNetworkController) recordNodeSubnetAllocations(subnets []*net.IPNet) {
+	for _, subnet := range subnets {
+		metrics.RecordNodeSubnetAllocation(bnc.getNetworkName(), subnetFamilyName(subnet))
+	}
+}
+
+// recordNodeSubnetReleases records the release of the given node subnets of the network
+func (bnc *BaseNetworkController) recordNodeSubnetReleases(subnets []*net.IPNet) {
+	for _, subnet := range subnets {
+		metrics.RecordNodeSubnetRelease(bnc.getNetworkName(), subnetFamilyName(subnet))
+	}
+}
+
+// subnetFamilyName returns "ipv4" or "ipv6" after the IP family of the subnet
+func subnetFamilyName(subnet *net.IPNet) string {
+	return strings.ToLower(util.IPFamilyName(utilnet.IsIPv6CIDR(subnet)))
+}
+
+// peekNextNodeSubnets returns the subnets of the cluster IP families the allocator would
+// give to the next node without subnets, leaving them free
+func (bnc *BaseNetworkController) peekNextNodeSubnets(
+	masterSubnetAllocator *subnetallocator.HostSubnetAllocator) ([]*net.IPNet, error) {
+	subnets, err := masterSubnetAllocator.PeekNextSubnet(config.IPv4Mode, config.IPv6Mode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to peek at the next %s network node subnets: %w", bnc.getNetworkName(), err)
+	}
+	return subnets, nil
+}
+
+// planNodeSubnetDefragmentation returns and logs the node subnet moves that would
+// compact the cluster subnets of the allocator, without moving any subnet
+func (bnc *BaseNetworkController) planNodeSubnetDefragmentation(
+	masterSubnetAllocator *subnetallocator.HostSubnetAllocator) []subnetallocator.SubnetMove {
+	moves := masterSubnetAllocator.DefragmentSubnets()
+	klog.Infof("Defragmenting the %s network node subnets takes %d moves", bnc.getNetworkName(), len(moves))
+	for _, move := range moves {
+		klog.Infof("Node %s subnet %s can move to %s", move.Owner, move.From, move.To)
+	}
+	return moves
+}
+
+// reconfigureNodeSubnetRanges makes the allocator allocate node subnets from the given
+// cluster subnets, keeping the node subnets already allocated
+func (bnc *BaseNetworkController) reconfigureNodeSubnetRanges(masterSubnetAllocator *subnetallocator.HostSubnetAllocator,
+	clusterSubnets []config.CIDRNetworkEntry) error {
+	if err := masterSubnetAllocator.ReconfigureRanges(clusterSubnets, config.Default.HostSubnetAlignmentBits); err != nil {
+		return fmt.Errorf("failed to reconfigure the %s network cluster subnets: %w", bnc.getNetworkName(), err)
+	}
+	return nil
+}
+
+// reclaimExpiredNodeSubnetPreallocations releases the subnets preallocated to nodes
+// that were not added before the preallocation expired
+func (bnc *BaseNetworkController) reclaimExpiredNodeSubnetPreallocations(
+	masterSubnetAllocator *subnetallocator.HostSubnetAllocator) {
+	now := bnc.clock.Now()
+	bnc.nodeSubnetPreallocationsLock.Lock()
+	defer bnc.nodeSubnetPreallocationsLock.Unlock()
+	for nodeName, preallocation := range bnc.nodeSubnetPreallocations {
+		if now.Before(preallocation.expires) {
+			continue
+		}
+		klog.Infof("Releasing subnets %v held for node %s that was not added in time",
+			preallocation.subnets, nodeName)
+		if err := masterSubnetAllocator.ReleaseNodeSubnets(nodeName, preallocation.subnets...); err != nil {
+			klog.Warningf("Failed to release subnets preallocated for node %s: %v", nodeName, err)
+		} else {
+			bnc.recordNodeSubnetReleases(preallocation.subnets)
+		}
+		delete(bnc.nodeSubnetPreallocations, nodeName)
+	}
+}
+
+// allocateNodeSubnets returns the host subnets of the node, keeping those it is annotated
+// with and allocating the missing ones, and the subset of them that was newly allocated
+func (bnc *BaseNetworkController) allocateNodeSubnets(node *kapi.Node,
+	masterSubnetAllocator *subnetallocator.HostSubnetAllocator) ([]*net.IPNet, []*net.IPNet, error) {
+	existingSubnets, err := bnc.parseNodeHostSubnets(node)
+	if err != nil && !util.IsAnnotationNotSetError(err) {
+		// Log the error and try to allocate new subnets
+		klog.Infof("Failed to get node %s host subnets annotations: %v", node.Name, err)
+	}
+	if preallocated := bnc.getPreallocatedNodeSubnets(node.Name); len(existingSubnets) == 0 && len(preallocated) > 0 {
+		klog.Infof("Using subnets %v preallocated for node %s", preallocated, node.Name)
+		existingSubnets = append([]*net.IPNet{}, preallocated...)
+	}
+
+	// A node annotated with subnets for only some of the configured IP families, for
+	// example after a single to dual-stack upgrade, keeps the subnets it already has
+	// and only gets subnets allocated for the missing families.
+	ipv4Mode, ipv6Mode := bnc.getNodeIPFamilies(node)
+	singleFamily := ipv4Mode != config.IPv4Mode || ipv6Mode != config.IPv6Mode
+	partial := !singleFamily && isPartialHostSubnets(existingSubnets)
+
+	// the allocator filters existingSubnets in place, so keep a copy to retry with and
+	// to check the partial subnets were kept
+	requestedSubnets := append([]*net.IPNet{}, existingSubnets...)
+	hostSubnets, allocatedSubnets, err := masterSubnetAllocator.AllocateNodeSubnets(node.Name, existingSubnets, ipv4Mode, ipv6Mode)
+	if err != nil {
+		hostSubnets, allocatedSubnets, err = bnc.allocateNodeSubnetsOfFreeFamily(node, requestedSubnets, err,
+			masterSubnetAllocator)
+		if err != nil {
+			return nil, nil, err
+		}
+		// the node only gets the subnets of a single family, which is reported instead
+		singleFamily, partial = true, false
+	}
+	bnc.recordNodeSubnetAllocations(allocatedSubnets)
+	bnc.releaseNodeSubnetPreallocation(node.Name, hostSubnets, masterSubnetAllocator)
+	if partial {
+		if sameSubnets(append(append([]*net.IPNet{}, requestedSubnets...), allocatedSubnets...), hostSubnets) {
+			klog.Infof("Node %s had subnets %v for only some of the configured IP families, added %v",
+				node.Name, requestedSubnets, allocatedSubnets)
+		} else {
+			klog.Warningf("Node %s subnets %v could not be kept, replaced by %v", node.Name, requestedSubnets, hostSubnets)
+		}
+	}
+	// Release the allocation on error
+	defer func() {
+		if err != nil {
+			if errR := masterSubnetAllocator.ReleaseNodeSubnets(node.Name, allocatedSubnets...); errR != nil {
+				klog.Warningf("Error releasing node %s subnets: %v", node.Name, errR)
+			} else {
+				bnc.recordNodeSubnetReleases(allocatedSubnets)
+			}
+		}
+	}()
+
+	if err = checkNodeSubnetReserve(node, allocatedSubnets, masterSubnetAllocator); err != nil {
+		return nil, nil, err
+	}
+
+	if singleFamily {
+		klog.Infof("Node %s is single-stack in a dual-stack cluster, it only has subnets %v", node.Name, hostSubnets)
+	}
+	return hostSubnets, allocatedSubnets, nil
+}
+
+// allocateNodeSubnetsOfFreeFamily handles the failure allocErr to allocate the subnets of a
+// dual-stack node. When the node subnets of one IP family are exhausted while the node can
+// still get or already has a subnet of the other family, the exhaustion is recorded and, if
+// config.Default.AllowSingleFamilyOnSubnetExhaustion is set, the node only gets the subnet
+// of the other family. allocErr is returned otherwise.
+func (bnc *BaseNetworkController) allocateNodeSubnetsOfFreeFamily(node *kapi.Node, existingSubnets []*net.IPNet,
+	allocErr error, masterSubnetAllocator *subnetallocator.HostSubnetAllocator) ([]*net.IPNet, []*net.IPNet, error) {
+	ipv4Mode, ipv6Mode := bnc.getNodeIPFamilies(node)
+	if !ipv4Mode || !ipv6Mode || !errors.Is(allocErr, subnetallocator.ErrSubnetAllocatorFull) {
+		return nil, nil, allocErr
+	}
+	v4Free, v6Free := masterSubnetAllocator.FreeSubnets()
+	hasV4, hasV6 := len(filterHostSubnetsByFamily(existingSubnets, true, false)) > 0,
+		len(filterHostSubnetsByFamily(existingSubnets, false, true)) > 0
+	var exhausted string
+	switch {
+	case v4Free == 0 && !hasV4 && (v6Free > 0 || hasV6):
+		exhausted, ipv4Mode = "ipv4", false
+	case v6Free == 0 && !hasV6 && (v4Free > 0 || hasV4):
+		exhausted, ipv6Mode = "ipv6", false
+	default:
+		return nil, nil, allocErr
+	}
+	allowed := config.Default.AllowSingleFamilyOnSubnetExhaustion
+	metrics.RecordNodeSubnetFamilyExhausted(exhausted, allowed)
+	if !allowed {
+		return nil, nil, allocErr
+	}
+
+	hostSubnets, allocatedSubnets, err := masterSubnetAllocator.AllocateNodeSubnets(node.Name, existingSubnets,
+		ipv4Mode, ipv6Mode)
+	if err != nil {
+		return nil, nil, err
+	}
+	klog.Warningf("The %s node subnets are exhausted, node %s only gets subnets %v", exhausted, node.Name, hostSubnets)
+	bnc.recorder.Eventf(node, kapi.EventTypeWarning, "NodeSubnetFamilyExhausted",
+		"The %s node subnets are exhausted, node %s only got subnets %s", exhausted, node.Name,
+		util.JoinIPNets(hostSubnets, ","))
+	return hostSubnets, allocatedSubnets, nil
+}
+
+// nodeAnnotationsUpToDate returns whether the node is already annotated with the given
+// host subnets and other annotations, so that patching it can be skipped
+func (bnc *BaseNetworkController) nodeAnnotationsUpToDate(node *kapi.Node, hostSubnets []*net.IPNet,
+	otherNodeAnnotation map[string]string) bool {
+	for k, v := range otherNodeAnnotation {
+		if value, ok := node.Annotations[k]; !ok || value != v {
+			return false
+		}
+	}
+	existingSubnets, err := util.ParseNodeHostSubnetAnnotation(node, bnc.getNetworkName())
+	return err == nil && sameSubnets(existingSubnets, hostSubnets)
+}
+
+// parseNodeHostSubnets returns the host subnets of the node for the network, read from the
+// fallback annotation key if the node has none in its host subnet annotation
+func (bnc *BaseNetworkController) parseNodeHostSubnets(node *kapi.Node) ([]*net.IPNet, error) {
+	hostSubnets, err := util.ParseNodeHostSubnetAnnotation(node, bnc.getNetworkName())
+	if err == nil || !util.IsAnnotationNotSetError(err) || bnc.subnetAnnotationFallbackKey == "" {
+		return hostSubnets, err
+	}
+	fallbackSubnets, fallbackErr := util.ParseNodeHostSubnetAnnotationFromKey(node,
+		bnc.subnetAnnotationFallbackKey, bnc.getNetworkName())
+	if fallbackErr != nil {
+		if util.IsAnnotationNotSetError(fallbackErr) {
+			return nil, err
+		}
+		return nil, fallbackErr
+	}
+	klog.Infof("Read subnets %v of node %s from the %s annotation", fallbackSubnets, node.Name,
+		bnc.subnetAnnotationFallbackKey)
+	return fallbackSubnets, nil
+}
+
+// checkNodeSubnetReserve returns an error if the subnets newly allocated to a node that
+// is not critical leave fewer free subnets of their IP family than the configured reserve
+func checkNodeSubnetReserve(node *kapi.Node, allocatedSubnets []*net.IPNet,
+	masterSubnetAllocator *subnetallocator.HostSubnetAllocator) error {
+	if config.Default.NodeSubnetReserve == 0 || len(allocatedSubnets) == 0 || isCriticalNode(node) {
+		return nil
+	}
+	reserve := uint64(config.Default.NodeSubnetReserve)
+	v4free, v6free := masterSubnetAllocator.FreeSubnets()
+	for _, subnet := range allocatedSubnets {
+		free := v4free
+		if utilnet.IsIPv6CIDR(subnet) {
+			free = v6free
+		}
+		if free < reserve {
+			return fmt.Errorf("%w: node %s is not critical and allocating %s would leave %d free subnets, %d are reserved",
+				errNodeSubnetReserved, node.Name, subnet, free, reserve)
+		}
+	}
+	return nil
+}
+
+// isCriticalNode returns whether the node matches the critical nodes selector
+func isCriticalNode(node *kapi.Node) bool {
+	if config.Default.CriticalNodes == nil {
+		return false
+	}
+	nodeSelector, err := metav1.LabelSelectorAsSelector(config.Default.CriticalNodes)
+	if err != nil {
+		klog.Warningf("Invalid critical nodes selector %v: %v", config.Default.CriticalNodes, err)
+		return false
+	}
+	return nodeSelector.Matches(labels.Set(node.Labels))
+}
+
+// getNodeIPFamilies returns the IP families the node gets host subnets for. These are
+// the cluster IP families, unless single-family nodes are allowed in a dual-stack
+// cluster and the node is annotated with the families it supports.
+func (bnc *BaseNetworkController) getNodeIPFamilies(node *kapi.Node) (ipv4Mode, ipv6Mode bool) {
+	if !config.Default.AllowSingleFamilyNodes || !config.IPv4Mode || !config.IPv6Mode {
+		return config.IPv4Mode, config.IPv6Mode
+	}
+	ipv4, ipv6, err := util.ParseNodeIPFamiliesAnnotation(node)
+	if err != nil {
+		if !util.IsAnnotationNotSetError(err) {
+			klog.Warningf("Ignoring the IP families of node %s: %v", node.Name, err)
+		}
+		return config.IPv4Mode, config.IPv6Mode
+	}
+	return ipv4, ipv6
+}
+
+// filterHostSubnetsByFamily returns the host subnets of the given IP families
+func filterHostSubnetsByFamily(hostSubnets []*net.IPNet, ipv4Mode, ipv6Mode bool) []*net.IPNet {
+	filtered := make([]*net.IPNet, 0, len(hostSubnets))
+	for _, hostSubnet := range hostSubnets {
+		if (utilnet.IsIPv6CIDR(hostSubnet) && ipv6Mode) || (!utilnet.IsIPv6CIDR(hostSubnet) && ipv4Mode) {
+			filtered = append(filtered, hostSubnet)
+		}
+	}
+	return filtered
+}
+
+// UpdateNodeAnnotationWithRetry update node's hostSubnet annotation (possibly for multiple networks) and the
+// other given node annotations
+func (bnc *BaseNetworkController) UpdateNodeAnnotationWithRetry(nodeName string, hostSubnetsMap map[string][]*net.IPNet,
+	otherUpdatedNodeAnnotation map[string]string) error {
+	if err := bnc.checkNodeSubnetsOwner(nodeName, hostSubnetsMap); err != nil {
+		return err
+	}
+	// Retry if it fails because of potential conflict which is transient. Return error in the
+	// case of other errors (say temporary API server down), and it will be taken care of by the
+	// retry mechanism.
+	resultErr := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		// Informer cache should not be mutated, so get a copy of the object
+		node, err := bnc.watchFactory.GetNode(nodeName)
+		if err != nil {
+			return err
+		}
+
+		cnode := node.DeepCopy()
+		if cnode.Annotations == nil {
+			cnode.Annotations = map[string]string{}
+		}
+		for netName, hostSubnets := range hostSubnetsMap {
+			cnode.Annotations, err = util.UpdateNodeHostSubnetAnnotation(cnode.Annotations, hostSubnets, netName)
+			if err != nil {
+				return fmt.Errorf("failed to update node %q annotation subnet %s",
+					node.Name, util.JoinIPNets(hostSubnets, ","))
+			}
+		}
+		for k, v := range otherUpdatedNodeAnnotation {
+			cnode.Annotations[k] = v
+		}
+		return bnc.kube.PatchNode(node, cnode)
+	})
+	if resultErr != nil {
+		return fmt.Errorf("failed to update node %s annotation", nodeName)
+	}
+	return nil
+}
+
+// checkNodeSubnetsOwner returns an error wrapping ErrNodeSubnetConflict if any of the host
+// subnets about to be written to the annotation of node nodeName is allocated to another
+// node. Subnets that are not allocated are accepted. Nothing is checked if the controller
+// has no subnetOwner.
+func (bnc *BaseNetworkController) checkNodeSubnetsOwner(nodeName string, hostSubnetsMap map[string][]*net.IPNet) error {
+	if bnc.subnetOwner == nil {
+		return nil
+	}
+	for _, hostSubnets := range hostSubnetsMap {
+		for _, hostSubnet := range hostSubnets {
+			if owner, ok := bnc.subnetOwner(hostSubnet); ok && owner != nodeName {
+				return fmt.Errorf("refusing to annotate node %s with subnet %s allocated to node %s: %w",
+					nodeName, hostSubnet, owner, ErrNodeSubnetConflict)
+			}
+		}
+	}
+	return nil
+}
+
+// NodeSubnetAllocatedCondition is the type of the node condition reflecting whether the
+// node got its host subnets allocated, alongside its host subnet annotation
+const NodeSubnetAllocatedCondition kapi.NodeConditionType = "OVNSubnetAllocated"
+
+// UpdateNodeSubnetAllocatedConditionWithRetry sets the OVNSubnetAllocated condition of the node
+// to reflect the given allocated host subnets, or the error their allocation failed with
+func (bnc *BaseNetworkController) UpdateNodeSubnetAllocatedConditionWithRetry(nodeName string,
+	hostSubnets []*net.IPNet, allocErr error) error {
+	condition := kapi.NodeCondition{
+		Type:    NodeSubnetAllocatedCondition,
+		Status:  kapi.ConditionTrue,
+		Reason:  "SubnetsAllocated",
+		Message: fmt.Sprintf("Host subnets %s allocated", util.JoinIPNets(hostSubnets, ",")),
+	}
+	if allocErr != nil {
+		condition.Status = kapi.ConditionFalse
+		condition.Reason = "SubnetAllocationFailed"
+		condition.Message = allocErr.Error()
+	}
+	// Retry if it fails because of potential conflict which is transient, like for the
+	// host subnet annotation.
+	resultErr := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		// Informer cache should not be mutated, so get a copy of the object
+		node, err := bnc.watchFactory.GetNode(nodeName)
+		if err != nil {
+			return err
+		}
+
+		cnode := node.DeepCopy()
+		if !setNodeCondition(&cnode.Status, condition, metav1.NewTime(bnc.clock.Now())) {
+			return nil
+		}
+		return bnc.kube.PatchNodeStatus(node, cnode)
+	})
+	if resultErr != nil {
+		return fmt.Errorf("failed to update node %s %s condition: %w", nodeName, NodeSubnetAllocatedCondition, resultErr)
+	}
+	return nil
+}
+
+// setNodeCondition sets the given condition in the node status and returns whether it
+// changed. The transition time only moves when the status of the condition changes.
+func setNodeCondition(status *kapi.NodeStatus, condition kapi.NodeCondition, now metav1.Time) bool {
+	condition.LastHeartbeatTime = now
+	condition.LastTransitionTime = now
+	for i := range status.Conditions {
+		existing := &status.Conditions[i]
+		if existing.Type != condition.Type {
+			continue
+		}
+		if existing.Status == condition.Status && existing.Reason == condition.Reason &&
+			existing.Message == condition.Message {
+			return false
+		}
+		if existing.Status == condition.Status {
+			condition.LastTransitionTime = existing.LastTransitionTime
+		}
+		*existing = condition
+		return true
+	}
+	status.Conditions = append(status.Conditions, condition)
+	return true
+}
+
+// ForceReleaseNodeSubnets clears the subnet annotation of a node that still exists and
+// releases its subnets. It is an administrative action for incident recovery, only allowed
+// if enabled in the configuration, and refused while the node switch or its cluster router
+// port still use the subnets, as they could otherwise be allocated to another node.
+func (bnc *BaseNetworkController) ForceReleaseNodeSubnets(nodeName string,
+	masterSubnetAllocator *subnetallocator.HostSubnetAllocator) error {
+	if !config.Kubernetes.AllowForceReleaseNodeSubnets {
+		return fmt.Errorf("cannot release subnets of node %s: forcibly releasing node subnets is not enabled", nodeName)
+	}
+
+	switchName := bnc.getNodeSwitchName(nodeName)
+	if bnc.lsManager.GetSwitchSubnets(switchName) != nil {
+		return fmt.Errorf("cannot release subnets of node %s: they are still in use by logical switch %s",
+			nodeName, switchName)
+	}
+	_, err := libovsdbops.GetLogicalSwitch(bnc.nbClient, &nbdb.LogicalSwitch{Name: switchName})
+	if err == nil {
+		return fmt.Errorf("cannot release subnets of node %s: logical switch %s still exists", nodeName, switchName)
+	} else if !errors.Is(err, libovsdbclient.ErrNotFound) {
+		return fmt.Errorf("failed to get logical switch %s: %v", switchName, err)
+	}
+	lrpName := types.RouterToSwitchPrefix + switchName
+	_, err = libovsdbops.GetLogicalRouterPort(bnc.nbClient, &nbdb.LogicalRouterPort{Name: lrpName})
+	if err == nil {
+		return fmt.Errorf("cannot release subnets of node %s: router port %s still exists", nodeName, lrpName)
+	} else if !errors.Is(err, libovsdbclient.ErrNotFound) {
+		return fmt.Errorf("failed to get router port %s: %v", lrpName, err)
+	}
+
+	// clear the annotation first, so that the node is never left annotated with subnets
+	// that are no longer allocated to it
+	klog.Warningf("Forcibly releasing subnets of node %s", nodeName)
+	nodeRef := &kapi.ObjectReference{Kind: "Node", Name: nodeName}
+	hostSubnetsMap := map[string][]*net.IPNet{bnc.getNetworkName(): nil}
+	if err := bnc.UpdateNodeAnnotationWithRetry(nodeName, hostSubnetsMap, nil); err != nil {
+		return fmt.Errorf("failed to clear the subnet annotation of node %s: %v", nodeName, err)
+	}
+	bnc.recordNodeSubnetReleases(masterSubnetAllocator.ReleaseAllNodeSubnets(nodeName))
+	bnc.recorder.Eventf(nodeRef, kapi.EventTypeWarning, "NodeSubnetsForceReleased",
+		"Subnets of node %s released and its subnet annotation cleared", nodeName)
+	return nil
+}
+
+// deleteNodeLogicalNetwork removes the logical switch and logical router port associated with the node
+func (bnc *BaseNetworkController) deleteNodeLogicalNetwork(nodeName string) error {
+	switchName := bnc.getNodeSwitchName(nodeName)
+	// Remove switch to lb associations from the LBCache before removing the switch
+	lbCache, err := ovnlb.GetLBCache(bnc.nbClient)
+	if err != nil {
+		return fmt.Errorf("failed to get load_balancer cache for node %s: %v", nodeName, err)
+	}
+	lbCache.RemoveSwitch(switchName)
+
+	// Remove the logical switch associated with the node, only reporting it deleted
+	// when it still existed, not on retries
+	_, err = libovsdbops.GetLogicalSwitch(bnc.nbClient, &nbdb.LogicalSwitch{Name: switchName})
+	existed := err == nil
+	err = libovsdbops.DeleteLogicalSwitch(bnc.nbClient, switchName)
+	if err != nil {
+		return fmt.Errorf("failed to delete logical switch %s: %v", switchName, err)
+	}
+	if existed {
+		bnc.recorder.Eventf(&kapi.ObjectReference{Kind: "Node", Name: nodeName}, kapi.EventTypeNormal,
+			"NodeLogicalSwitchDeleted", "Logical switch %s of node %s deleted", switchName, nodeName)
+	}
+
+	logicalRouterName := types.OVNClusterRouter
+	logicalRouter := nbdb.LogicalRouter{Name: logicalRouterName}
+	logicalRouterPort := nbdb.LogicalRouterPort{
+		Name: types.RouterToSwitchPrefix + switchName,
+	}
+	err = libovsdbops.DeleteLogicalRouterPorts(bnc.nbClient, &logicalRouter, &logicalRouterPort)
+	if err != nil {
+		return fmt.Errorf("failed to delete router port %s: %v", logicalRouterPort.Name, err)
+	}
+
+	return nil
+}
+
+// reconcileLoadBalancerCacheSwitches removes the associations of the load balancer cache
+// with logical switches that no longer exist in nbdb, eg left behind by a crash between
+// deleting a node switch and updating the cache
+func (bnc *BaseNetworkController) reconcileLoadBalancerCacheSwitches() error {
+	lbCache, err := ovnlb.GetLBCache(bnc.nbClient)
+	if err != nil {
+		return fmt.Errorf("failed to get load_balancer cache: %v", err)
+	}
+	switches, err := libovsdbops.FindLogicalSwitchesWithPredicate(bnc.nbClient,
+		func(item *nbdb.LogicalSwitch) bool { return true })
+	if err != nil {
+		return fmt.Errorf("failed to list logical switches: %v", err)
+	}
+	existing := sets.NewString()
+	for _, ls := range switches {
+		existing.Insert(ls.Name)
+	}
+	if stale := lbCache.RemoveStaleSwitches(existing); stale.Len() > 0 {
+		klog.Infof("Removed load balancer associations of deleted logical switches %v", stale.List())
+	}
+	return nil
+}
+
+// nodeLogicalNetworkDeleteBatchSize is the maximum number of nodes whose logical switches
+// and cluster router ports are deleted in a single transaction
+const nodeLogicalNetworkDeleteBatchSize = 64
+
+// deleteNodeLogicalNetworks is the bulk version of deleteNodeLogicalNetwork for cluster
+// teardown or large scale-downs: the logical switches and cluster router ports of the nodes
+// are deleted in batched transactions. Objects already deleted are ignored. A batch that
+// fails is retried node by node, and the errors of the nodes that still fail are returned
+// by node name.
+func (bnc *BaseNetworkController) deleteNodeLogicalNetworks(nodeNames []string) map[string]error {
+	nodeErrs := map[string]error{}
+	lbCache, err := ovnlb.GetLBCache(bnc.nbClient)
+	if err != nil {
+		for _, nodeName := range nodeNames {
+			nodeErrs[nodeName] = fmt.Errorf("failed to get load_balancer cache for node %s: %v", nodeName, err)
+		}
+		return nodeErrs
+	}
+
+	for start := 0; start < len(nodeNames); start += nodeLogicalNetworkDeleteBatchSize {
+		end := start + nodeLogicalNetworkDeleteBatchSize
+		if end > len(nodeNames) {
+			end = len(nodeNames)
+		}
+		batch := nodeNames[start:end]
+
+		switchNames := make([]string, 0, len(batch))
+		lrps := make([]*nbdb.LogicalRouterPort, 0, len(batch))
+		var existing []string
+		for _, nodeName := range batch {
+			switchName := bnc.getNodeSwitchName(nodeName)
+			lbCache.RemoveSwitch(switchName)
+			if _, err := libovsdbops.GetLogicalSwitch(bnc.nbClient, &nbdb.LogicalSwitch{Name: switchName}); err == nil {
+				existing = append(existing, nodeName)
+			}
+			switchNames = append(switchNames, switchName)
+			lrps = append(lrps, &nbdb.LogicalRouterPort{Name: types.RouterToSwitchPrefix + switchName})
+		}
+		ops, err := libovsdbops.DeleteLogicalSwitchesOps(bnc.nbClient, nil, switchNames...)
+		if err == nil {
+			ops, err = libovsdbops.DeleteLogicalRouterPortsOps(bnc.nbClient, ops,
+				&nbdb.LogicalRouter{Name: types.OVNClusterRouter}, lrps...)
+		}
+		if err == nil {
+			_, err = libovsdbops.TransactAndCheck(bnc.nbClient, ops)
+		}
+		if err != nil {
+			klog.Warningf("Failed to delete the logical networks of nodes %v at once, deleting them one by one: %v",
+				batch, err)
+			for _, nodeName := range batch {
+				if err := bnc.deleteNodeLogicalNetwork(nodeName); err != nil {
+					nodeErrs[nodeName] = err
+				}
+			}
+			continue
+		}
+		for _, nodeName := range existing {
+			bnc.recorder.Eventf(&kapi.ObjectReference{Kind: "Node", Name: nodeName}, kapi.EventTypeNormal,
+				"NodeLogicalSwitchDeleted", "Logical switch %s of node %s deleted", bnc.getNodeSwitchName(nodeName), nodeName)
+		}
+	}
+	return nodeErrs
+}
+
+// deleteNoHostSubnetNodeLogicalNetwork removes the logical network of a node that now
+// manages its own host subnet, and releases the subnets it was assigned. The gateway chassis
+// of its router port are garbage collected along with it.
+func (bnc *BaseNetworkController) deleteNoHostSubnetNodeLogicalNetwork(nodeName string,
+	masterSubnetAllocator *subnetallocator.HostSubnetAllocator) error {
+	klog.Infof("Node %s no longer gets a host subnet assigned, removing its logical network", nodeName)
+	if err := bnc.deleteNodeLogicalNetwork(nodeName); err != nil {
+		return fmt.Errorf("error deleting no-host-subnet node %s logical network: %v", nodeName, err)
+	}
+	bnc.recordNodeSubnetReleases(masterSubnetAllocator.ReleaseAllNodeSubnets(nodeName))
+	bnc.lsManager.DeleteSwitch(bnc.getNodeSwitchName(nodeName))
+	return nil
+}
+
+// runPeriodically calls f every interval until stopChan is closed
+func (bnc *BaseNetworkController) runPeriodically(f func(), interval time.Duration) {
+	ticker := bnc.clock.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			f()
+		case <-bnc.stopChan:
+			return
+		}
+	}
+}
+
+// trackNodeHandler records the start of the handling of an event of the given node and
+// returns the function to call once it completes, so that the node handler watchdog
+// knows whether the handler still makes progress
+func (bnc *BaseNetworkController) trackNodeHandler(nodeName string) func() {
+	bnc.nodeHandlerProgressLock.Lock()
+	defer bnc.nodeHandlerProgressLock.Unlock()
+	if bnc.nodeHandlerInFlight == nil {
+		bnc.nodeHandlerInFlight = map[string]time.Time{}
+	}
+	now := bnc.clock.Now()
+	if len(bnc.nodeHandlerInFlight) == 0 {
+		// an idle handler isn't stalled: measure from the time it got work
+		bnc.nodeHandlerLastProgress = now
+	}
+	bnc.nodeHandlerInFlight[nodeName] = now
+	return func() {
+		bnc.nodeHandlerProgressLock.Lock()
+		defer bnc.nodeHandlerProgressLock.Unlock()
+		delete(bnc.nodeHandlerInFlight, nodeName)
+		bnc.nodeHandlerLastProgress = bnc.clock.Now()
+		if bnc.nodeHandlerStalled {
+			klog.Infof("Node handler of network %s resumed after handling node %s", bnc.getNetworkName(), nodeName)
+			bnc.nodeHandlerStalled = false
+		}
+	}
+}
+
+// isNodeHandlerInFlight returns whether an event of the given node is being handled
+func (bnc *BaseNetworkController) isNodeHandlerInFlight(nodeName string) bool {
+	bnc.nodeHandlerProgressLock.Lock()
+	defer bnc.nodeHandlerProgressLock.Unlock()
+	_, ok := bnc.nodeHandlerInFlight[nodeName]
+	return ok
+}
+
+// checkNodeHandlerProgress reports the node handler as stalled when it has node events
+// in flight but completed none of them for longer than timeout. A stall is reported
+// once, until the handler makes progress again. Returns the nodes whose events have
+// been in flight for longer than timeout when a stall is reported.
+func (bnc *BaseNetworkController) checkNodeHandlerProgress(timeout time.Duration) []string {
+	bnc.nodeHandlerProgressLock.Lock()
+	defer bnc.nodeHandlerProgressLock.Unlock()
+	now := bnc.clock.Now()
+	if bnc.nodeHandlerStalled || len(bnc.nodeHandlerInFlight) == 0 ||
+		now.Sub(bnc.nodeHandlerLastProgress) <= timeout {
+		return nil
+	}
+	var stalledNodes []string
+	for nodeName, started := range bnc.nodeHandlerInFlight {
+		if now.Sub(started) > timeout {
+			stalledNodes = append(stalledNodes, nodeName)
+		}
+	}
+	sort.Strings(stalledNodes)
+	bnc.nodeHandlerStalled = true
+
+	klog.Errorf("Node handler of network %s completed no node event for %v, %d in flight; stuck on nodes %v",
+		bnc.getNetworkName(), now.Sub(bnc.nodeHandlerLastProgress).Round(time.Second),
+		len(bnc.nodeHandlerInFlight), stalledNodes)
+	metrics.RecordNodeHandlerStall()
+	for _, nodeName := range stalledNodes {
+		bnc.recorder.Eventf(&kapi.ObjectReference{Kind: "Node", Name: nodeName}, kapi.EventTypeWarning,
+			"NodeHandlerStalled", "Handling of node %s by network %s in progress for %v",
+			nodeName, bnc.getNetworkName(), now.Sub(bnc.nodeHandlerInFlight[nodeName]).Round(time.Second))
+	}
+	return stalledNodes
+}
+
+// ManagedObjectCounts holds the number of OVN objects of each type a network
+// controller manages
+type ManagedObjectCounts struct {
+	LogicalSwitches int
+	RouterPorts     int
+	GatewayChassis  int
+}
+
+// ObjectCounts returns the number of node logical switches the controller tracks, and
+// of the cluster router ports and gateway chassis connecting them, and records them
+// in the managed object count metrics of the network.
+func (bnc *BaseNetworkController) ObjectCounts() (ManagedObjectCounts, error) {
+	switchNames := sets.NewString(bnc.lsManager.GetSwitchNames()...)
+	lrps, err := libovsdbops.FindLogicalRouterPortsWithPredicate(bnc.nbClient, func(item *nbdb.LogicalRouterPort) bool {
+		return strings.HasPrefix(item.Name, types.RouterToSwitchPrefix) &&
+			switchNames.Has(strings.TrimPrefix(item.Name, types.RouterToSwitchPrefix))
+	})
+	if err != nil {
+		return ManagedObjectCounts{}, fmt.Errorf("failed to find the router ports of the node switches: %w", err)
+	}
+	counts := ManagedObjectCounts{
+		LogicalSwitches: switchNames.Len(),
+		RouterPorts:     len(lrps),
+	}
+	for _, lrp := range lrps {
+		counts.GatewayChassis += len(lrp.GatewayChassis)
+	}
+	metrics.RecordManagedObjectCounts(bnc.getNetworkName(), counts.LogicalSwitches, counts.RouterPorts,
+		counts.GatewayChassis)
+	return counts, nil
+}
+
+// recordObjectCounts refreshes the managed object count metrics
+func (bnc *BaseNetworkController) recordObjectCounts() {
+	if _, err := bnc.ObjectCounts(); err != nil {
+		klog.Warningf("Failed to refresh the object counts of network %s: %v", bnc.getNetworkName(), err)
+	}
+}
+
+// FailingNodes returns the nodes whose add, update or delete failed at least once and
+// is still pending retry, with their number of failed attempts and last error.
+func (bnc *BaseNetworkController) FailingNodes() []ovnretry.FailedObj {
+	return bnc.retryNodes.GetFailedObjs()
+}
+
+// DeadLetterPods returns the pods that were given up on after exhausting their failed
+// attempts, and that have not had an event since
+func (bnc *BaseNetworkController) DeadLetterPods() []ovnretry.FailedObj {
+	return bnc.retryPods.GetDeadLetterObjs()
+}
+
+// RetryBackoffStates returns the backoff state of the pods and of the nodes pending retry,
+// to tell the objects retried soon from the ones backed off for minutes
+func (bnc *BaseNetworkController) RetryBackoffStates() (pods, nodes []ovnretry.BackoffState) {
+	return bnc.retryPods.GetBackoffStates(), bnc.retryNodes.GetBackoffStates()
+}
+
+// NodeSwitchLoadBalancerGroups returns the sorted names of the load balancer groups the
+// logical switch of the given node belongs to
+func (bnc *BaseNetworkController) NodeSwitchLoadBalancerGroups(nodeName string) ([]string, error) {
+	switchName := bnc.getNodeSwitchName(nodeName)
+	logicalSwitch, err := libovsdbops.GetLogicalSwitch(bnc.nbClient, &nbdb.LogicalSwitch{Name: switchName})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get logical switch %s of node %s: %w", switchName, nodeName, err)
+	}
+	if len(logicalSwitch.LoadBalancerGroup) == 0 {
+		return []string{}, nil
+	}
+
+	groupUUIDs := sets.NewString(logicalSwitch.LoadBalancerGroup...)
+	groups, err := libovsdbops.FindLoadBalancerGroupsWithPredicate(bnc.nbClient, func(group *nbdb.LoadBalancerGroup) bool {
+		return groupUUIDs.Has(group.UUID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the load balancer groups of logical switch %s: %w", switchName, err)
+	}
+	names := make([]string, 0, len(groups))
+	for _, group := range groups {
+		names = append(names, group.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// enableRetryPersistence makes the given retry framework persist the keys of the objects
+// pending retry to the configured retry cache directory, if any
+func (bnc *BaseNetworkController) enableRetryPersistence(r *ovnretry.RetryFramework, resource string) {
+	if config.Default.RetryCacheDir == "" {
+		return
+	}
+	// persistence is enabled even if the keys saved before can't be loaded, they are only
+	// retried sooner and the objects are added again on startup anyway
+	if err := r.EnablePersistence(filepath.Join(config.Default.RetryCacheDir, resource+".json")); err != nil {
+		klog.Warningf("Failed to load the persisted %s retry keys: %v", resource, err)
+	}
+}
+
+// updates the list of nodes if the given node manages its hostSubnets; returns its hostSubnets if any
+func (bnc *BaseNetworkController) updateNodesManageHostSubnets(node *kapi.Node,
+	masterSubnetAllocator *subnetallocator.HostSubnetAllocator, foundNodes sets.String) []*net.IPNet {
+	if noHostSubnet(node) {
+		return []*net.IPNet{}
+	}
+	foundNodes.Insert(node.Name)
+	hostSubnets, err := bnc.parseNodeHostSubnets(node)
+	if err != nil {
+		if !util.IsAnnotationNotSetError(err) {
+			// Don't mark anything allocated for a corrupt annotation, so that its subnets
+			// are not silently handed out to the node with nothing reserved for them.
+			klog.Errorf("Failed to parse node %s host subnet annotation: %v", node.Name, err)
+			bnc.recorder.Eventf(node, kapi.EventTypeWarning, "InvalidNodeSubnetAnnotation",
+				"Host subnet annotation of node %s could not be parsed: %v", node.Name, err)
+		}
+		return nil
+	}
+
+	// a subnet that is not part of the cluster subnets, eg copied from the annotation of
+	// a node of another cluster, must not be marked allocated nor handed back to the node
+	n := 0
+	for _, hostSubnet := range hostSubnets {
+		if !masterSubnetAllocator.IsClusterSubnet(hostSubnet) {
+			klog.Warningf("Ignoring subnet %s of node %s that is not within the %s network cluster subnets",
+				hostSubnet, node.Name, bnc.getNetworkName())
+			bnc.recorder.Eventf(node, kapi.EventTypeWarning, "ForeignNodeSubnet",
+				"Host subnet %s of node %s is not part of the cluster subnets and is ignored", hostSubnet, node.Name)
+			continue
+		}
+		hostSubnets[n] = hostSubnet
+		n++
 	}
+	hostSubnets = hostSubnets[:n]
 
-	// If supported, enable IGMP/MLD snooping and querier on the node.
-	if bnc.multicastSupport {
-		logicalSwitch.OtherConfig["mcast_snoop"] = "true"
+	klog.V(5).Infof("Node %s contains subnets: %v", node.Name, hostSubnets)
+	if err := masterSubnetAllocator.MarkSubnetsAllocated(node.Name, hostSubnets...); err != nil {
+		utilruntime.HandleError(err)
+	}
+	return hostSubnets
+}
 
-		// Configure IGMP/MLD querier if the gateway IP address is known.
-		// Otherwise disable it.
-		if v4Gateway != nil || v6Gateway != nil {
-			logicalSwitch.OtherConfig["mcast_querier"] = "true"
-			logicalSwitch.OtherConfig["mcast_eth_src"] = nodeLRPMAC.String()
-			if v4Gateway != nil {
-				logicalSwitch.OtherConfig["mcast_ip4_src"] = v4Gateway.String()
-			}
-			if v6Gateway != nil {
-				logicalSwitch.OtherConfig["mcast_ip6_src"] = util.HWAddrToIPv6LLA(nodeLRPMAC).String()
-			}
+// isPartialHostSubnets returns true if subnets only cover some of the configured IP
+// families, and no family that is not configured.
+func isPartialHostSubnets(subnets []*net.IPNet) bool {
+	hasIPv4, hasIPv6 := false, false
+	for _, subnet := range subnets {
+		if utilnet.IsIPv6CIDR(subnet) {
+			hasIPv6 = true
 		} else {
-			logicalSwitch.OtherConfig["mcast_querier"] = "false"
+			hasIPv4 = true
 		}
 	}
-
-	err := libovsdbops.CreateOrUpdateLogicalSwitch(bnc.nbClient, &logicalSwitch, &logicalSwitch.OtherConfig,
-		&logicalSwitch.LoadBalancerGroup)
-	if err != nil {
-		return fmt.Errorf("failed to add logical switch %+v: %v", logicalSwitch, err)
+	if (hasIPv4 && !config.IPv4Mode) || (hasIPv6 && !config.IPv6Mode) {
+		return false
 	}
+	return (hasIPv4 || hasIPv6) && (hasIPv4 != config.IPv4Mode || hasIPv6 != config.IPv6Mode)
+}
 
-	// Connect the switch to the router.
-	logicalSwitchPort := nbdb.LogicalSwitchPort{
-		Name:      types.SwitchToRouterPrefix + switchName,
-		Type:      "router",
-		Addresses: []string{"router"},
-		Options:   map[string]string{"router-port": types.RouterToSwitchPrefix + switchName},
+// sameSubnets returns true if a and b contain the same subnets, regardless of order
+func sameSubnets(a, b []*net.IPNet) bool {
+	if len(a) != len(b) {
+		return false
 	}
-	sw := nbdb.LogicalSwitch{Name: switchName}
-	err = libovsdbops.CreateOrUpdateLogicalSwitchPortsOnSwitch(bnc.nbClient, &sw, &logicalSwitchPort)
-	if err != nil {
-		klog.Errorf("Failed to add logical port %+v to switch %s: %v", logicalSwitchPort, switchName, err)
-		return err
+	subnets := sets.NewString()
+	for _, subnet := range a {
+		subnets.Insert(subnet.String())
 	}
-
-	// multicast is only supported in default network for now
-	if bnc.multicastSupport {
-		err = libovsdbops.AddPortsToPortGroup(bnc.nbClient, types.ClusterRtrPortGroupName, logicalSwitchPort.UUID)
-		if err != nil {
-			klog.Errorf(err.Error())
-			return err
+	for _, subnet := range b {
+		if !subnets.Has(subnet.String()) {
+			return false
 		}
 	}
+	return true
+}
 
-	// Add the switch to the logical switch cache
-	return bnc.lsManager.AddSwitch(logicalSwitch.Name, logicalSwitch.UUID, hostSubnets)
+// ReconcileNode rebuilds the logical switch of node nodeName and its cluster router port
+// from the current annotations of the node, bypassing the node watch and its retries, for
+// targeted remediation of a single node. The load balancer group of an existing switch is
+// kept, and so are the IPs allocated on it, which lsManager would otherwise forget when
+// tracking the rebuilt switch. The steps are idempotent so it is safe to call any time.
+func (bnc *BaseNetworkController) ReconcileNode(nodeName string) error {
+	var err error
+	// node events are handled under the same lock, so they don't interleave with the reconcile
+	bnc.retryNodes.DoWithLock(nodeName, func(nodeName string) {
+		err = bnc.reconcileNodeLocked(nodeName)
+	})
+	return err
 }
 
-func (bnc *BaseNetworkController) allocateNodeSubnets(node *kapi.Node,
-	masterSubnetAllocator *subnetallocator.HostSubnetAllocator) ([]*net.IPNet, error) {
-	existingSubnets, err := util.ParseNodeHostSubnetAnnotation(node, types.DefaultNetworkName)
-	if err != nil && !util.IsAnnotationNotSetError(err) {
-		// Log the error and try to allocate new subnets
-		klog.Infof("Failed to get node %s host subnets annotations: %v", node.Name, err)
+func (bnc *BaseNetworkController) reconcileNodeLocked(nodeName string) error {
+	node, err := bnc.watchFactory.GetNode(nodeName)
+	if err != nil {
+		return fmt.Errorf("failed to get node %s: %w", nodeName, err)
 	}
-
-	hostSubnets, allocatedSubnets, err := masterSubnetAllocator.AllocateNodeSubnets(node.Name, existingSubnets, config.IPv4Mode, config.IPv6Mode)
+	hostSubnets, err := util.ParseNodeHostSubnetAnnotation(node, bnc.getNetworkName())
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to get the host subnets of node %s: %w", nodeName, err)
 	}
-	// Release the allocation on error
-	defer func() {
-		if err != nil {
-			if errR := masterSubnetAllocator.ReleaseNodeSubnets(node.Name, allocatedSubnets...); errR != nil {
-				klog.Warningf("Error releasing node %s subnets: %v", node.Name, errR)
-			}
-		}
-	}()
-
-	return hostSubnets, nil
-}
 
-// UpdateNodeAnnotationWithRetry update node's hostSubnet annotation (possibly for multiple networks) and the
-// other given node annotations
-func (bnc *BaseNetworkController) UpdateNodeAnnotationWithRetry(nodeName string, hostSubnetsMap map[string][]*net.IPNet,
-	otherUpdatedNodeAnnotation map[string]string) error {
-	// Retry if it fails because of potential conflict which is transient. Return error in the
-	// case of other errors (say temporary API server down), and it will be taken care of by the
-	// retry mechanism.
-	resultErr := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
-		// Informer cache should not be mutated, so get a copy of the object
-		node, err := bnc.watchFactory.GetNode(nodeName)
-		if err != nil {
+	switchName := bnc.getNodeSwitchName(nodeName)
+	var loadBalancerGroupUUID string
+	ls, err := libovsdbops.GetLogicalSwitch(bnc.nbClient, &nbdb.LogicalSwitch{Name: switchName})
+	if err != nil && !errors.Is(err, libovsdbclient.ErrNotFound) {
+		return fmt.Errorf("failed to get logical switch %s: %w", switchName, err)
+	}
+	if ls != nil && len(ls.LoadBalancerGroup) > 0 {
+		loadBalancerGroupUUID = ls.LoadBalancerGroup[0]
+	}
+	var allocatedIPs []net.IP
+	if sameSubnets(bnc.lsManager.GetSwitchSubnets(switchName), hostSubnets) {
+		if allocatedIPs, err = bnc.lsManager.GetAllocatedIPs(switchName); err != nil {
 			return err
 		}
+	}
 
-		cnode := node.DeepCopy()
-		for netName, hostSubnets := range hostSubnetsMap {
-			cnode.Annotations, err = util.UpdateNodeHostSubnetAnnotation(cnode.Annotations, hostSubnets, netName)
-			if err != nil {
-				return fmt.Errorf("failed to update node %q annotation subnet %s",
-					node.Name, util.JoinIPNets(hostSubnets, ","))
-			}
+	klog.Infof("Reconciling the logical network of node %s", nodeName)
+	steps := bnc.getNodeAddSteps(loadBalancerGroupUUID)
+	if err = steps.ensureSwitch(node, hostSubnets); err != nil {
+		return fmt.Errorf("failed to rebuild the logical switch of node %s: %w", nodeName, err)
+	}
+	if err = bnc.reallocateSwitchIPs(switchName, allocatedIPs); err != nil {
+		return err
+	}
+	if steps.syncRouterPort != nil {
+		if err = steps.syncRouterPort(node, hostSubnets); err != nil {
+			return fmt.Errorf("failed to rebuild the cluster router port of node %s: %w", nodeName, err)
 		}
-		for k, v := range otherUpdatedNodeAnnotation {
-			cnode.Annotations[k] = v
+	}
+	if steps.syncMgmtPort != nil {
+		if err = steps.syncMgmtPort(node, hostSubnets); err != nil {
+			return fmt.Errorf("failed to rebuild the management port of node %s: %w", nodeName, err)
 		}
-		return bnc.kube.PatchNode(node, cnode)
-	})
-	if resultErr != nil {
-		return fmt.Errorf("failed to update node %s annotation", nodeName)
 	}
 	return nil
 }
 
-// deleteNodeLogicalNetwork removes the logical switch and logical router port associated with the node
-func (bnc *BaseNetworkController) deleteNodeLogicalNetwork(nodeName string) error {
-	switchName := nodeName
-	// Remove switch to lb associations from the LBCache before removing the switch
-	lbCache, err := ovnlb.GetLBCache(bnc.nbClient)
-	if err != nil {
-		return fmt.Errorf("failed to get load_balancer cache for node %s: %v", nodeName, err)
+// reallocateSwitchIPs marks the given IPs allocated again on the logical switch after its
+// IPAM was rebuilt, so that the IPs held by pods are not handed out twice. IPs outside of
+// the switch subnets are skipped.
+func (bnc *BaseNetworkController) reallocateSwitchIPs(switchName string, ips []net.IP) error {
+	for _, ip := range ips {
+		ipNet := &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}
+		err := bnc.lsManager.AllocateIPs(switchName, []*net.IPNet{ipNet})
+		if err != nil && err != ipallocator.ErrAllocated {
+			return fmt.Errorf("failed to keep IP %s allocated on logical switch %s: %w", ip, switchName, err)
+		}
 	}
-	lbCache.RemoveSwitch(switchName)
+	return nil
+}
 
-	// Remove the logical switch associated with the node
-	err = libovsdbops.DeleteLogicalSwitch(bnc.nbClient, switchName)
-	if err != nil {
-		return fmt.Errorf("failed to delete logical switch %s: %v", switchName, err)
+// reconcileNodeSwitchSubnets compares the subnets cached in lsManager for each node's logical
+// switch with the node's host subnet annotation. The cache reflects what was allocated and
+// configured in OVN, so when the annotation was changed out-of-band, and the subnet allocator
+// confirms the cached subnets are the ones allocated to the node, it is restored from the
+// cache and an event is posted for the node. Nodes without a switch in the cache, and nodes
+// without a host subnet annotation, which is up to the node add to handle, are skipped.
+// Each node is reconciled under its node event lock, against its latest version.
+// Only networks whose controller sets subnetOwner, the default network, are repaired: the
+// cache alone can't tell a stale switch from an annotation edited out-of-band.
+func (bnc *BaseNetworkController) reconcileNodeSwitchSubnets(nodes []*kapi.Node) error {
+	var errs []error
+	for _, node := range nodes {
+		bnc.retryNodes.DoWithLock(node.Name, func(nodeName string) {
+			if err := bnc.reconcileNodeSwitchSubnetsLocked(nodeName); err != nil {
+				errs = append(errs, err)
+			}
+		})
 	}
+	return kerrors.NewAggregate(errs)
+}
 
-	logicalRouterName := types.OVNClusterRouter
-	logicalRouter := nbdb.LogicalRouter{Name: logicalRouterName}
-	logicalRouterPort := nbdb.LogicalRouterPort{
-		Name: types.RouterToSwitchPrefix + switchName,
+func (bnc *BaseNetworkController) reconcileNodeSwitchSubnetsLocked(nodeName string) error {
+	switchName := bnc.getNodeSwitchName(nodeName)
+	if bnc.lsManager.IsNonHostSubnetSwitch(switchName) {
+		return nil
 	}
-	err = libovsdbops.DeleteLogicalRouterPorts(bnc.nbClient, &logicalRouter, &logicalRouterPort)
+	cachedSubnets := bnc.lsManager.GetSwitchSubnets(switchName)
+	if len(cachedSubnets) == 0 {
+		return nil
+	}
+	node, err := bnc.watchFactory.GetNode(nodeName)
 	if err != nil {
-		return fmt.Errorf("failed to delete router port %s: %v", logicalRouterPort.Name, err)
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to get node %s: %w", nodeName, err)
+	}
+	hostSubnets, err := util.ParseNodeHostSubnetAnnotation(node, bnc.getNetworkName())
+	if util.IsAnnotationNotSetError(err) {
+		return nil
+	}
+	if err == nil && sameSubnets(hostSubnets, cachedSubnets) {
+		return nil
+	}
+	if !bnc.nodeOwnsSubnets(nodeName, cachedSubnets) || (err == nil && bnc.nodeOwnsSubnets(nodeName, hostSubnets)) {
+		klog.V(5).Infof("Not repairing host subnet annotation %s of node %s: the subnet allocator does not "+
+			"confirm its logical switch subnets %s", util.JoinIPNets(hostSubnets, ","), nodeName,
+			util.JoinIPNets(cachedSubnets, ","))
+		return nil
 	}
 
+	klog.Warningf("Node %s host subnet annotation %s does not match logical switch subnets %s (%v), repairing",
+		nodeName, util.JoinIPNets(hostSubnets, ","), util.JoinIPNets(cachedSubnets, ","), err)
+	hostSubnetsMap := map[string][]*net.IPNet{bnc.getNetworkName(): cachedSubnets}
+	if err = bnc.UpdateNodeAnnotationWithRetry(nodeName, hostSubnetsMap, nil); err != nil {
+		return fmt.Errorf("failed to repair host subnet annotation of node %s: %w", nodeName, err)
+	}
+	bnc.recorder.Eventf(node, kapi.EventTypeWarning, "NodeSubnetAnnotationRepaired",
+		"Host subnet annotation of node %s was restored to its allocated subnets %s",
+		nodeName, util.JoinIPNets(cachedSubnets, ","))
 	return nil
 }
 
-// updates the list of nodes if the given node manages its hostSubnets; returns its hostSubnets if any
-func (bnc *BaseNetworkController) updateNodesManageHostSubnets(node *kapi.Node,
-	masterSubnetAllocator *subnetallocator.HostSubnetAllocator, foundNodes sets.String) []*net.IPNet {
-	if noHostSubnet(node) {
-		return []*net.IPNet{}
+// nodeOwnsSubnets returns whether the subnet allocator confirms all the subnets are
+// allocated to node nodeName. Nothing is confirmed if the controller has no subnetOwner.
+func (bnc *BaseNetworkController) nodeOwnsSubnets(nodeName string, subnets []*net.IPNet) bool {
+	if bnc.subnetOwner == nil {
+		return false
 	}
-	hostSubnets, _ := util.ParseNodeHostSubnetAnnotation(node, types.DefaultNetworkName)
-	foundNodes.Insert(node.Name)
-
-	klog.V(5).Infof("Node %s contains subnets: %v", node.Name, hostSubnets)
-	if err := masterSubnetAllocator.MarkSubnetsAllocated(node.Name, hostSubnets...); err != nil {
-		utilruntime.HandleError(err)
+	for _, subnet := range subnets {
+		if owner, ok := bnc.subnetOwner(subnet); !ok || owner != nodeName {
+			return false
+		}
 	}
-	return hostSubnets
+	return true
 }
 
 func (bnc *BaseNetworkController) addAllPodsOnNode(nodeName string) []error {
 	errs := []error{}
+	fieldSelector := fields.OneTermEqualSelector("spec.nodeName", nodeName)
+	if bnc.nodePodFieldSelector != nil {
+		fieldSelector = fields.AndSelectors(fieldSelector, bnc.nodePodFieldSelector)
+	}
 	options := metav1.ListOptions{
-		FieldSelector:   fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+		FieldSelector:   fieldSelector.String(),
 		ResourceVersion: "0",
 	}
+	if bnc.nodePodLabelSelector != nil {
+		options.LabelSelector = bnc.nodePodLabelSelector.String()
+	}
 	pods, err := bnc.client.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), options)
 	if err != nil {
 		errs = append(errs, err)
@@ -436,17 +2986,30 @@ func (bnc *BaseNetworkController) addAllPodsOnNode(nodeName string) []error {
 }
 
 func (bnc *BaseNetworkController) updateL3TopologyVersion() error {
+	return bnc.updateL3TopologyVersionAndRouterOptions(nil)
+}
+
+// updateL3TopologyVersionAndRouterOptions bumps the topology version of the cluster router
+// and merges options into its options in the same transaction, so that upgrades needing new
+// router options never leave the router with the new version but the old options, or the
+// other way around. Options set to an empty value are removed, the external IDs and the other
+// options of the router are kept.
+func (bnc *BaseNetworkController) updateL3TopologyVersionAndRouterOptions(options map[string]string) error {
 	currentTopologyVersion := strconv.Itoa(types.OvnCurrentTopologyVersion)
 	clusterRouterName := types.OVNClusterRouter
 	logicalRouter := nbdb.LogicalRouter{
 		Name:        clusterRouterName,
 		ExternalIDs: map[string]string{"k8s-ovn-topo-version": currentTopologyVersion},
+		Options:     options,
 	}
-	err := libovsdbops.UpdateLogicalRouterSetExternalIDs(bnc.nbClient, &logicalRouter)
+	err := libovsdbops.UpdateLogicalRouterSetExternalIDsAndOptions(bnc.nbClient, &logicalRouter)
 	if err != nil {
 		return fmt.Errorf("failed to generate set topology version, err: %v", err)
 	}
 	klog.Infof("Updated Logical_Router %s topology version to %s", clusterRouterName, currentTopologyVersion)
+	if len(options) > 0 {
+		klog.Infof("Updated Logical_Router %s options %v", clusterRouterName, options)
+	}
 	return nil
 }
 
@@ -508,6 +3071,64 @@ func (bnc *BaseNetworkController) getNamespaceLocked(ns string, readOnly bool) (
 	return nsInfo, unlockFunc
 }
 
+// NamespaceAddressSetNames returns the sorted nbdb names of the address sets owned
+// by the namespaces this controller currently knows about.
+func (bnc *BaseNetworkController) NamespaceAddressSetNames() []string {
+	// Take a snapshot of the namespace names rather than holding namespacesMutex
+	// while claiming each nsInfo, the same way getNamespaceLocked does.
+	bnc.namespacesMutex.Lock()
+	namespaces := make([]string, 0, len(bnc.namespaces))
+	for ns := range bnc.namespaces {
+		namespaces = append(namespaces, ns)
+	}
+	bnc.namespacesMutex.Unlock()
+
+	names := []string{}
+	for _, ns := range namespaces {
+		nsInfo, nsUnlock := bnc.getNamespaceLocked(ns, true)
+		if nsInfo == nil {
+			continue
+		}
+		if nsInfo.addressSet != nil {
+			v4Name, v6Name := nsInfo.addressSet.GetASHashNames()
+			for _, name := range []string{v4Name, v6Name} {
+				if name != "" {
+					names = append(names, name)
+				}
+			}
+		}
+		nsUnlock()
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NamespaceAddressSetIPs returns the sorted IPs currently in the address set of the
+// namespace, eg for audit. An error is returned if the namespace is not known or has no
+// address set.
+func (bnc *BaseNetworkController) NamespaceAddressSetIPs(ns string) ([]net.IP, error) {
+	nsInfo, nsUnlock := bnc.getNamespaceLocked(ns, true)
+	if nsInfo == nil {
+		return nil, fmt.Errorf("namespace %s not found", ns)
+	}
+	defer nsUnlock()
+	if nsInfo.addressSet == nil {
+		return nil, fmt.Errorf("namespace %s has no address set", ns)
+	}
+
+	v4IPs, v6IPs := nsInfo.addressSet.GetIPs()
+	ips := make([]net.IP, 0, len(v4IPs)+len(v6IPs))
+	for _, ipStr := range append(v4IPs, v6IPs...) {
+		ip := net.ParseIP(ipStr)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP %q in the address set of namespace %s", ipStr, ns)
+		}
+		ips = append(ips, ip)
+	}
+	sort.Slice(ips, func(i, j int) bool { return bytes.Compare(ips[i].To16(), ips[j].To16()) < 0 })
+	return ips, nil
+}
+
 // deleteNamespaceLocked locks namespacesMutex, finds and deletes ns, and returns the
 // namespace, locked.
 func (bnc *BaseNetworkController) deleteNamespaceLocked(ns string) *namespaceInfo {
@@ -528,7 +3149,17 @@ func (bnc *BaseNetworkController) deleteNamespaceLocked(ns string) *namespaceInf
 		nsInfo.Unlock()
 		return nil
 	}
-	if nsInfo.addressSet != nil {
+	if nsInfo.addressSet != nil && config.Default.DisableDeferredAddressSetDestroy {
+		if cancel, ok := bnc.pendingAddressSetDestroys[ns]; ok {
+			close(cancel)
+			delete(bnc.pendingAddressSetDestroys, ns)
+		}
+		delete(bnc.namespaceGenerations, ns)
+		klog.V(5).Infof("Deleting AddressSet for NS %s", ns)
+		if err := nsInfo.addressSet.Destroy(); err != nil {
+			klog.Errorf("Failed to delete AddressSet for NS %s: %v", ns, err)
+		}
+	} else if nsInfo.addressSet != nil {
 		// Empty the address set, then delete it after an interval.
 		if err := nsInfo.addressSet.SetIPs(nil); err != nil {
 			klog.Errorf("Warning: failed to empty address set for deleted NS %s: %v", ns, err)
@@ -536,27 +3167,30 @@ func (bnc *BaseNetworkController) deleteNamespaceLocked(ns string) *namespaceInf
 
 		// Delete the address set after a short delay.
 		// This is so NetworkPolicy handlers can converge and stop referencing it.
+		// Only the latest delete of a namespace keeps a deferred destroy pending,
+		// an earlier one for the same address set name is superseded.
 		addressSet := nsInfo.addressSet
+		if cancel, ok := bnc.pendingAddressSetDestroys[ns]; ok {
+			close(cancel)
+		}
+		cancel := make(chan struct{})
+		bnc.pendingAddressSetDestroys[ns] = cancel
+		generation := bnc.namespaceGenerations[ns]
+		delay := deferredAddressSetDestroyDelay
 		go func() {
 			select {
 			case <-bnc.stopChan:
 				return
-			case <-time.After(20 * time.Second):
-				// Check to see if the NS was re-added in the meanwhile. If so,
-				// only delete if the new NS's AddressSet shouldn't exist.
-				nsInfo, nsUnlock := bnc.getNamespaceLocked(ns, true)
-				if nsInfo != nil {
-					defer nsUnlock()
-					if nsInfo.addressSet != nil {
-						klog.V(5).Infof("Skipping deferred deletion of AddressSet for NS %s: re-created", ns)
-						return
-					}
-				}
-
-				klog.V(5).Infof("Finishing deferred deletion of AddressSet for NS %s", ns)
-				if err := addressSet.Destroy(); err != nil {
-					klog.Errorf("Failed to delete AddressSet for NS %s: %v", ns, err.Error())
-				}
+			case <-cancel:
+				klog.V(5).Infof("Deferred deletion of AddressSet for NS %s superseded", ns)
+				return
+			case <-time.After(delay):
+				bnc.addressSetDestroyer.enqueue(&deferredAddressSetDestroy{
+					namespace:  ns,
+					addressSet: addressSet,
+					token:      cancel,
+					generation: generation,
+				})
 			}
 		}()
 	}
@@ -565,15 +3199,250 @@ func (bnc *BaseNetworkController) deleteNamespaceLocked(ns string) *namespaceInf
 	return nsInfo
 }
 
+// destroyDeferredAddressSets destroys, in a single transaction, the address sets of the
+// given deferred destroys that were neither superseded nor had their namespace re-created.
+// If the transaction fails, the address sets are destroyed one by one.
+func (bnc *BaseNetworkController) destroyDeferredAddressSets(destroys []*deferredAddressSetDestroy) {
+	// Hold namespacesMutex until the address sets are destroyed, so a namespace can't
+	// be re-created (and its address set re-ensured under the same name) between the
+	// checks below and the destroy. nsInfo locks must not be taken here, they are
+	// always acquired before namespacesMutex.
+	bnc.namespacesMutex.Lock()
+	defer bnc.namespacesMutex.Unlock()
+
+	var ops []ovsdb.Operation
+	namespaces := make([]string, 0, len(destroys))
+	addressSets := make([]addressset.AddressSet, 0, len(destroys))
+	for _, destroy := range destroys {
+		ns := destroy.namespace
+		if bnc.pendingAddressSetDestroys[ns] != destroy.token {
+			klog.V(5).Infof("Deferred deletion of AddressSet for NS %s superseded", ns)
+			continue
+		}
+		delete(bnc.pendingAddressSetDestroys, ns)
+
+		// Check to see if the NS was re-added in the meanwhile. If so, its
+		// address set has the same name and must be kept.
+		if bnc.namespaces[ns] != nil || bnc.namespaceGenerations[ns] != destroy.generation {
+			klog.V(5).Infof("Skipping deferred deletion of AddressSet for NS %s: re-created", ns)
+			continue
+		}
+		delete(bnc.namespaceGenerations, ns)
+
+		destroyOps, err := destroy.addressSet.DestroyReturnOps()
+		if err != nil {
+			klog.Errorf("Failed to delete AddressSet for NS %s: %v", ns, err)
+			continue
+		}
+		ops = append(ops, destroyOps...)
+		namespaces = append(namespaces, ns)
+		addressSets = append(addressSets, destroy.addressSet)
+	}
+	if len(namespaces) == 0 {
+		return
+	}
+
+	klog.V(5).Infof("Finishing deferred deletion of AddressSets for NSs %v", namespaces)
+	if _, err := libovsdbops.TransactAndCheck(bnc.nbClient, ops); err != nil {
+		// the pending destroys are already forgotten, so the address sets would leak if
+		// a single bad one failed the whole batch
+		klog.Warningf("Failed to delete AddressSets for NSs %v, deleting them one by one: %v", namespaces, err)
+		for i, addressSet := range addressSets {
+			if err := addressSet.Destroy(); err != nil {
+				klog.Errorf("Failed to delete AddressSet for NS %s: %v", namespaces[i], err)
+			}
+		}
+	}
+}
+
 // WatchNodes starts the watching of the nodes resource and calls back the appropriate handler logic
 func (bnc *BaseNetworkController) WatchNodes() error {
 	if bnc.nodeHandler != nil {
 		return nil
 	}
 
+	// existing nodes are all added while the node handler is set up, so rate limit
+	// node adds until that initial sync is done; stopChan aborts the wait.
+	if config.Kubernetes.NodeStartupSyncRate > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			select {
+			case <-bnc.stopChan:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		limiter := rate.NewLimiter(rate.Limit(config.Kubernetes.NodeStartupSyncRate), 1)
+		bnc.setNodeStartupSyncWait(func() error {
+			return limiter.Wait(ctx)
+		})
+		defer bnc.setNodeStartupSyncWait(nil)
+	}
+
 	handler, err := bnc.retryNodes.WatchResource()
 	if err == nil {
 		bnc.nodeHandler = handler
+		// all existing nodes have been handled once the watch is set up
+		metrics.RecordNodeReconcile(bnc.getNetworkName())
 	}
 	return err
 }
+
+func (bnc *BaseNetworkController) setNodeStartupSyncWait(wait func() error) {
+	bnc.nodeStartupSyncLock.Lock()
+	defer bnc.nodeStartupSyncLock.Unlock()
+	bnc.nodeStartupSyncWait = wait
+}
+
+// waitForNodeStartupSync blocks until the next node add of the initial node sync is allowed
+// by the startup rate limit. It returns right away outside of the initial node sync.
+func (bnc *BaseNetworkController) waitForNodeStartupSync() error {
+	bnc.nodeStartupSyncLock.RLock()
+	wait := bnc.nodeStartupSyncWait
+	bnc.nodeStartupSyncLock.RUnlock()
+	if wait == nil {
+		return nil
+	}
+	if err := wait(); err != nil {
+		return fmt.Errorf("initial node sync aborted: %w", err)
+	}
+	return nil
+}
+
+// Kinds of the nodes of a TopologyGraph
+const (
+	TopologyNodeRouter         = "router"
+	TopologyNodeRouterPort     = "router-port"
+	TopologyNodeSwitch         = "switch"
+	TopologyNodeGatewayChassis = "gateway-chassis"
+)
+
+// TopologyGraph is a snapshot of the logical topology of a network: the cluster
+// router, its ports, the switches they connect to and the chassis they are
+// pinned to.
+type TopologyGraph struct {
+	Nodes []TopologyNode `json:"nodes"`
+	Edges []TopologyEdge `json:"edges"`
+}
+
+// TopologyNode is a logical entity of a TopologyGraph, identified by its kind
+// and name.
+type TopologyNode struct {
+	ID         string            `json:"id"`
+	Kind       string            `json:"kind"`
+	Name       string            `json:"name"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// TopologyEdge connects two nodes of a TopologyGraph by their IDs.
+type TopologyEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func (g *TopologyGraph) addNode(kind, name string, attributes map[string]string) string {
+	id := kind + "/" + name
+	g.Nodes = append(g.Nodes, TopologyNode{ID: id, Kind: kind, Name: name, Attributes: attributes})
+	return id
+}
+
+func (g *TopologyGraph) addEdge(from, to string) {
+	g.Edges = append(g.Edges, TopologyEdge{From: from, To: to})
+}
+
+// ExportTopologyGraph builds the logical topology graph of the network from nbdb:
+// the cluster router is connected to each of its ports, and each port to the
+// switch it is peered with and to its gateway chassis. It only reads from the
+// nbdb cache.
+func (bnc *BaseNetworkController) ExportTopologyGraph() (*TopologyGraph, error) {
+	logicalRouter, err := libovsdbops.GetLogicalRouter(bnc.nbClient, &nbdb.LogicalRouter{Name: types.OVNClusterRouter})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get distributed router %s: %w", types.OVNClusterRouter, err)
+	}
+
+	graph := &TopologyGraph{Nodes: []TopologyNode{}, Edges: []TopologyEdge{}}
+	routerID := graph.addNode(TopologyNodeRouter, logicalRouter.Name, nil)
+
+	lrps := map[string]*nbdb.LogicalRouterPort{}
+	for _, uuid := range logicalRouter.Ports {
+		lrp, err := libovsdbops.GetLogicalRouterPort(bnc.nbClient, &nbdb.LogicalRouterPort{UUID: uuid})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get logical router port %s of %s: %w", uuid, logicalRouter.Name, err)
+		}
+		lrps[lrp.Name] = lrp
+	}
+
+	// find the switches on the other end of the router ports
+	lsps, err := libovsdbops.FindLogicalSwitchPortsWithPredicate(bnc.nbClient, func(item *nbdb.LogicalSwitchPort) bool {
+		return item.Type == "router" && lrps[item.Options["router-port"]] != nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find logical switch ports peered with %s: %w", logicalRouter.Name, err)
+	}
+	peerLRPs := map[string]string{}
+	for _, lsp := range lsps {
+		peerLRPs[lsp.UUID] = lsp.Options["router-port"]
+	}
+	switches, err := libovsdbops.FindLogicalSwitchesWithPredicate(bnc.nbClient, func(item *nbdb.LogicalSwitch) bool {
+		for _, port := range item.Ports {
+			if peerLRPs[port] != "" {
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find logical switches connected to %s: %w", logicalRouter.Name, err)
+	}
+	lrpSwitches := map[string]*nbdb.LogicalSwitch{}
+	for _, sw := range switches {
+		for _, port := range sw.Ports {
+			if lrpName := peerLRPs[port]; lrpName != "" {
+				lrpSwitches[lrpName] = sw
+			}
+		}
+	}
+
+	lrpNames := make([]string, 0, len(lrps))
+	for name := range lrps {
+		lrpNames = append(lrpNames, name)
+	}
+	sort.Strings(lrpNames)
+	for _, name := range lrpNames {
+		lrp := lrps[name]
+		attributes := map[string]string{"mac": lrp.MAC}
+		if len(lrp.Networks) > 0 {
+			networks := append([]string{}, lrp.Networks...)
+			sort.Strings(networks)
+			attributes["networks"] = strings.Join(networks, ",")
+		}
+		lrpID := graph.addNode(TopologyNodeRouterPort, lrp.Name, attributes)
+		graph.addEdge(routerID, lrpID)
+
+		if sw := lrpSwitches[lrp.Name]; sw != nil {
+			attributes := map[string]string{}
+			for _, key := range []string{"subnet", "ipv6_prefix"} {
+				if value := sw.OtherConfig[key]; value != "" {
+					attributes[key] = value
+				}
+			}
+			swID := graph.addNode(TopologyNodeSwitch, sw.Name, attributes)
+			graph.addEdge(lrpID, swID)
+		}
+
+		for _, uuid := range lrp.GatewayChassis {
+			chassis, err := libovsdbops.GetGatewayChassis(bnc.nbClient, &nbdb.GatewayChassis{UUID: uuid})
+			if err != nil {
+				return nil, fmt.Errorf("failed to get gateway chassis %s of %s: %w", uuid, lrp.Name, err)
+			}
+			chassisID := graph.addNode(TopologyNodeGatewayChassis, chassis.Name, map[string]string{
+				"chassis":  chassis.ChassisName,
+				"priority": strconv.Itoa(chassis.Priority),
+			})
+			graph.addEdge(lrpID, chassisID)
+		}
+	}
+
+	return graph, nil
+}
@@ -28,7 +28,7 @@ import (
 
 func (bnc *BaseNetworkController) allocatePodIPs(pod *kapi.Pod,
 	annotations *util.PodAnnotation) (expectedLogicalPortName string, err error) {
-	switchName := pod.Spec.NodeName
+	switchName := bnc.getNodeSwitchName(pod.Spec.NodeName)
 	if !util.PodScheduled(pod) || !util.PodWantsNetwork(pod) || util.PodCompleted(pod) {
 		return "", nil
 	}
@@ -81,7 +81,7 @@ func (bnc *BaseNetworkController) deleteStaleLogicalSwitchPorts(expectedLogicalP
 	var ops []ovsdb.Operation
 	for _, n := range nodes {
 		// skip nodes that are not running ovnk (inferred from host subnets)
-		switchName := n.Name
+		switchName := bnc.getNodeSwitchName(n.Name)
 		if bnc.lsManager.IsNonHostSubnetSwitch(switchName) {
 			continue
 		}
@@ -138,7 +138,7 @@ func (bnc *BaseNetworkController) deletePodLogicalPort(pod *kapi.Pod, portInfo *
 	var err error
 
 	// get the logical switch name that the pod's logical port is expected to be on
-	expectedSwitchName := pod.Spec.NodeName
+	expectedSwitchName := bnc.getNodeSwitchName(pod.Spec.NodeName)
 	podDesc := fmt.Sprintf("pod %s/%s", pod.Namespace, pod.Name)
 	logicalPort := util.GetLogicalPortName(pod.Namespace, pod.Name)
 	if portInfo == nil {
@@ -220,10 +220,11 @@ func (bnc *BaseNetworkController) deletePodLogicalPort(pod *kapi.Pod, portInfo *
 	}
 
 	var allOps, ops []ovsdb.Operation
+	var deletedIPs []net.IP
 
 	// if the ip is in use by another pod we should not try to remove it from the address set
 	if shouldRelease {
-		if ops, err = bnc.deletePodFromNamespace(pod.Namespace,
+		if ops, deletedIPs, err = bnc.deletePodFromNamespace(pod.Namespace,
 			podIfAddrs, portUUID); err != nil {
 			return nil, fmt.Errorf("unable to delete pod %s from namespace: %w", podDesc, err)
 		}
@@ -248,6 +249,7 @@ func (bnc *BaseNetworkController) deletePodLogicalPort(pod *kapi.Pod, portInfo *
 		return nil, fmt.Errorf("cannot delete logical switch port %s, %v", logicalPort, err)
 	}
 	txOkCallBack()
+	bnc.forgetPodNamespaceAddressSetIPs(pod.Namespace, deletedIPs)
 
 	// do not remove SNATs/GW routes/IPAM for an IP address unless we have validated no other pod is using it
 	if !shouldRelease {
@@ -273,18 +275,23 @@ func (bnc *BaseNetworkController) releasePodIPs(pInfo *lpInfo) error {
 	return nil
 }
 
-func (bnc *BaseNetworkController) waitForNodeLogicalSwitch(switchName string) (*nbdb.LogicalSwitch, error) {
+func (bnc *BaseNetworkController) waitForNodeLogicalSwitch(nodeName, switchName string) (*nbdb.LogicalSwitch, error) {
 	// Wait for the node logical switch to be created by the ClusterController and be present
 	// in libovsdb's cache. The node switch will be created when the node's logical network infrastructure
-	// is created by the node watch
+	// is created by the node watch. Pods only wait for it, up to the configured timeout, while
+	// the node is being handled, as its switch is then about to be created. Otherwise they fail
+	// fast rather than blocking a worker, and are retried by the retry framework once the node is added.
 	ls := &nbdb.LogicalSwitch{Name: switchName}
-	if err := wait.PollImmediate(30*time.Millisecond, 30*time.Second, func() (bool, error) {
-		if lsUUID, ok := bnc.lsManager.GetUUID(switchName); !ok {
-			return false, fmt.Errorf("error getting logical switch %s: %s", switchName, "switch not in logical switch cache")
-		} else {
+	timeout := time.Duration(config.Kubernetes.PodNodeSwitchWaitTimeout) * time.Second
+	if err := wait.PollImmediate(30*time.Millisecond, timeout, func() (bool, error) {
+		if lsUUID, ok := bnc.lsManager.GetUUID(switchName); ok {
 			ls.UUID = lsUUID
 			return true, nil
 		}
+		if timeout > 0 && bnc.isNodeHandlerInFlight(nodeName) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error getting logical switch %s: %s", switchName, "switch not in logical switch cache")
 	}); err != nil {
 		return nil, fmt.Errorf("timed out waiting for logical switch in logical switch cache %q subnet: %v", switchName, err)
 	}
@@ -392,7 +399,7 @@ func (bnc *BaseNetworkController) addRoutesGatewayIP(pod *kapi.Pod, podAnnotatio
 // For some pods, like hostNetwork pods, overlay node pods, or completed pods waiting for them to be added
 // to oc.logicalPortCache will never succeed.
 func (bnc *BaseNetworkController) podExpectedInLogicalCache(pod *kapi.Pod) bool {
-	switchName := pod.Spec.NodeName
+	switchName := bnc.getNodeSwitchName(pod.Spec.NodeName)
 	return util.PodWantsNetwork(pod) && !bnc.lsManager.IsNonHostSubnetSwitch(switchName) && !util.PodCompleted(pod)
 }
 
@@ -405,7 +412,7 @@ func (bnc *DefaultNetworkController) addLogicalPortToNetwork(pod *kapi.Pod,
 	var ls *nbdb.LogicalSwitch
 
 	podDesc := fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)
-	switchName := pod.Spec.NodeName
+	switchName := bnc.getNodeSwitchName(pod.Spec.NodeName)
 
 	// it is possible to try to add a pod here that has no node. For example if a pod was deleted with
 	// a finalizer, and then the node was removed. In this case the pod will still exist in a running state.
@@ -421,10 +428,13 @@ func (bnc *DefaultNetworkController) addLogicalPortToNetwork(pod *kapi.Pod,
 			pod.Namespace, pod.Name, pod.Spec.NodeName, podState)
 	}
 
-	ls, err = bnc.waitForNodeLogicalSwitch(switchName)
+	ls, err = bnc.waitForNodeLogicalSwitch(pod.Spec.NodeName, switchName)
 	if err != nil {
 		return nil, nil, nil, false, nil, nil, err
 	}
+	if err = bnc.verifyNodeSwitchSubnets(pod.Spec.NodeName, switchName); err != nil {
+		return nil, nil, nil, false, nil, nil, err
+	}
 
 	portName := util.GetLogicalPortName(pod.Namespace, pod.Name)
 	klog.Infof("[%s] creating logical port %s for pod on switch %s", podDesc, portName, switchName)
@@ -715,29 +725,49 @@ func (bnc *BaseNetworkController) delLSPOps(logicalPort, switchName,
 	return ops, nil
 }
 
-func (bnc *BaseNetworkController) deletePodFromNamespace(ns string, podIfAddrs []*net.IPNet, portUUID string) ([]ovsdb.Operation, error) {
+// deletePodFromNamespace returns the ops deleting the pod IPs from the address set of
+// namespace ns, and the IPs deleted, to be forgotten with forgetPodNamespaceAddressSetIPs
+// once the ops are transacted.
+func (bnc *BaseNetworkController) deletePodFromNamespace(ns string, podIfAddrs []*net.IPNet,
+	portUUID string) ([]ovsdb.Operation, []net.IP, error) {
 	// for secondary network, namespace may be not managed
 	nsInfo, nsUnlock := bnc.getNamespaceLocked(ns, true)
 	if nsInfo == nil {
-		return nil, nil
+		return nil, nil, nil
 	}
 	defer nsUnlock()
 	var ops []ovsdb.Operation
+	var ipAddrs []net.IP
 	var err error
 	if nsInfo.addressSet != nil {
-		if ops, err = nsInfo.addressSet.DeleteIPsReturnOps(createIPAddressSlice(podIfAddrs)); err != nil {
-			return nil, err
+		ipAddrs = createIPAddressSlice(podIfAddrs)
+		if ops, err = nsInfo.addressSet.DeleteIPsReturnOps(ipAddrs); err != nil {
+			return nil, nil, err
 		}
 	}
 
 	// Remove the port from the multicast allow policy.
 	if bnc.multicastSupport && nsInfo.multicastEnabled && len(portUUID) > 0 {
 		if err = podDeleteAllowMulticastPolicy(bnc.nbClient, ns, portUUID); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
 
-	return ops, nil
+	return ops, ipAddrs, nil
+}
+
+// forgetPodNamespaceAddressSetIPs stops tracking the pod IPs deleted from the address set
+// of namespace ns by the ops of deletePodFromNamespace, once they are transacted.
+func (bnc *BaseNetworkController) forgetPodNamespaceAddressSetIPs(ns string, ips []net.IP) {
+	if len(ips) == 0 {
+		return
+	}
+	nsInfo, nsUnlock := bnc.getNamespaceLocked(ns, true)
+	if nsInfo == nil {
+		return
+	}
+	defer nsUnlock()
+	forgetNamespaceAddressSetIPs(nsInfo, ips)
 }
 
 func (bnc *BaseNetworkController) getPortInfo(pod *kapi.Pod) *lpInfo {
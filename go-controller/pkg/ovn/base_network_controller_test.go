@@ -0,0 +1,4878 @@
+package ovn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	"github.com/onsi/gomega"
+	libovsdbclient "github.com/ovn-org/libovsdb/client"
+	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/config"
+	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/factory"
+	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/libovsdbops"
+	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/metrics"
+	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/nbdb"
+	addressset "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/ovn/address_set"
+	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/ovn/ipallocator"
+	ovnlb "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/ovn/loadbalancer"
+	lsm "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/ovn/logical_switch_manager"
+	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/ovn/subnetallocator"
+	ovnretry "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/retry"
+	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/sbdb"
+	ovntest "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/testing"
+	libovsdbtest "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/testing/libovsdb"
+	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/types"
+	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/util"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+	clocktesting "k8s.io/utils/clock/testing"
+	utilnet "k8s.io/utils/net"
+)
+
+// failingDeleteAddressSet is an address set whose IPs can't be deleted
+type failingDeleteAddressSet struct {
+	addressset.AddressSet
+}
+
+func (as *failingDeleteAddressSet) DeleteIPs(ips []net.IP) error {
+	return fmt.Errorf("failed to delete IPs %v", ips)
+}
+
+var _ = ginkgo.Describe("Base Network Controller Operations", func() {
+	const (
+		nodeName   = "node1"
+		nodeSubnet = "10.1.1.0/24"
+		chassisID  = "cb9ec8fa-b409-4ef3-9f42-d9283c47aac6"
+	)
+
+	var (
+		fakeOvn *FakeOVN
+		dbSetup libovsdbtest.TestSetup
+	)
+
+	newNode := func(annotations map[string]string) *v1.Node {
+		return &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        nodeName,
+				Annotations: annotations,
+			},
+		}
+	}
+
+	startController := func(nodes ...*v1.Node) {
+		nodeList := &v1.NodeList{}
+		for _, node := range nodes {
+			nodeList.Items = append(nodeList.Items, *node)
+		}
+		fakeOvn.startWithDBSetup(dbSetup, nodeList)
+
+		clusterSubnets, err := config.ParseClusterSubnetEntries("10.1.0.0/16")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(fakeOvn.controller.masterSubnetAllocator.InitRanges(clusterSubnets)).To(gomega.Succeed())
+		fakeOvn.controller.joinSwIPManager, err = lsm.NewJoinLogicalSwitchIPManager(fakeOvn.nbClient,
+			types.OVNJoinSwitch+"-UUID", []string{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	}
+
+	ginkgo.BeforeEach(func() {
+		// Restore global default values before each testcase
+		gomega.Expect(config.PrepareTestConfig()).To(gomega.Succeed())
+		fakeOvn = NewFakeOVN()
+		dbSetup = libovsdbtest.TestSetup{
+			NBData: []libovsdbtest.TestData{
+				newClusterJoinSwitch(),
+				newOVNClusterRouter(),
+				newRouterPortGroup(),
+				newClusterPortGroup(),
+				newLoadBalancerGroup(),
+			},
+		}
+	})
+
+	ginkgo.AfterEach(func() {
+		fakeOvn.shutdown()
+	})
+
+	ginkgo.Context("on a node whose chassis annotation arrives late", func() {
+		ginkgo.It("creates the node switch and defers only the cluster router port", func() {
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets": `{"default":"` + nodeSubnet + `"}`,
+			})
+			startController(node)
+
+			err := fakeOvn.controller.addUpdateNodeEvent(node, &nodeSyncs{syncNode: true, syncClusterRouterPort: true})
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			gomega.Expect(errors.Is(err, errNodeChassisNotFound)).To(gomega.BeTrue())
+
+			// the node switch has been created, but not its router port
+			ls, err := libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(ls.OtherConfig).To(gomega.HaveKeyWithValue("subnet", nodeSubnet))
+			_, err = libovsdbops.GetLogicalRouterPort(fakeOvn.nbClient,
+				&nbdb.LogicalRouterPort{Name: types.RouterToSwitchPrefix + nodeName})
+			gomega.Expect(err).To(gomega.HaveOccurred())
+
+			// only the router port step is left to be retried, and the node is not reported as failed
+			_, addFailed := fakeOvn.controller.addNodeFailed.Load(nodeName)
+			gomega.Expect(addFailed).To(gomega.BeFalse())
+			_, rtrPortFailed := fakeOvn.controller.nodeClusterRouterPortFailed.Load(nodeName)
+			gomega.Expect(rtrPortFailed).To(gomega.BeTrue())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.ContainSubstring("NodeLogicalSwitchCreated")))
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.BeEmpty())
+
+			// the retry only runs the pending router port step
+			node.Annotations["k8s.ovn.org/node-chassis-id"] = chassisID
+			err = fakeOvn.controller.addUpdateNodeEvent(node, &nodeSyncs{syncClusterRouterPort: true})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			_, rtrPortFailed = fakeOvn.controller.nodeClusterRouterPortFailed.Load(nodeName)
+			gomega.Expect(rtrPortFailed).To(gomega.BeFalse())
+
+			lrp, err := libovsdbops.GetLogicalRouterPort(fakeOvn.nbClient,
+				&nbdb.LogicalRouterPort{Name: types.RouterToSwitchPrefix + nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(lrp.Networks).To(gomega.ConsistOf("10.1.1.1/24"))
+			gomega.Expect(lrp.GatewayChassis).To(gomega.HaveLen(1))
+		})
+
+		ginkgo.It("reports any other router port failure as a node error", func() {
+			// no subnet annotation to build the router port from
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-chassis-id": chassisID,
+			})
+			startController(node)
+
+			err := fakeOvn.controller.syncNodeClusterRouterPort(node, nil)
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			gomega.Expect(errors.Is(err, errNodeChassisNotFound)).To(gomega.BeFalse())
+
+			err = fakeOvn.controller.addUpdateNodeEvent(node, &nodeSyncs{syncClusterRouterPort: true})
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			gomega.Expect(errors.Is(err, errNodeChassisNotFound)).To(gomega.BeFalse())
+			gomega.Eventually(fakeOvn.fakeRecorder.Events).Should(gomega.Receive(gomega.ContainSubstring("ErrorReconcilingNode")))
+		})
+	})
+
+	ginkgo.Context("when a node is updated", func() {
+		var node *v1.Node
+
+		ginkgo.BeforeEach(func() {
+			node = newNode(map[string]string{
+				"k8s.ovn.org/node-subnets":    `{"default":"` + nodeSubnet + `"}`,
+				"k8s.ovn.org/node-chassis-id": chassisID,
+			})
+			startController(node)
+			gomega.Expect(fakeOvn.controller.addUpdateNodeEvent(node,
+				&nodeSyncs{syncNode: true, syncClusterRouterPort: true})).To(gomega.Succeed())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.ContainSubstring("NodeLogicalSwitchCreated")))
+
+			// tamper with the switch to tell whether an update reconciles it
+			ls, err := libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			ls.OtherConfig["exclude_ips"] = "10.1.1.200"
+			gomega.Expect(libovsdbops.CreateOrUpdateLogicalSwitch(fakeOvn.nbClient, ls, &ls.OtherConfig)).To(gomega.Succeed())
+		})
+
+		var excludeIPs = func() string {
+			ls, err := libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			return ls.OtherConfig["exclude_ips"]
+		}
+
+		ginkgo.It("only syncs the cluster router port on a chassis change", func() {
+			newNode := node.DeepCopy()
+			newNode.Annotations["k8s.ovn.org/node-chassis-id"] = "2f9a1c4e-6b3d-4e8a-9c7f-1d2e3f4a5b6c"
+			syncs := fakeOvn.controller.nodeUpdateSyncs(node, newNode)
+			gomega.Expect(*syncs).To(gomega.Equal(nodeSyncs{syncClusterRouterPort: true}))
+
+			gomega.Expect(fakeOvn.controller.addUpdateNodeEvent(newNode, syncs)).To(gomega.Succeed())
+			gomega.Expect(excludeIPs()).To(gomega.Equal("10.1.1.200"))
+		})
+
+		ginkgo.It("only syncs the switch on a subnet exclusion change", func() {
+			podIPs, err := fakeOvn.controller.lsManager.AllocateNextIPs(nodeName)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			newNode := node.DeepCopy()
+			newNode.Annotations["k8s.ovn.org/node-exclude-subnets"] = "10.1.1.16/28"
+			syncs := fakeOvn.controller.nodeUpdateSyncs(node, newNode)
+			gomega.Expect(*syncs).To(gomega.Equal(nodeSyncs{syncSwitch: true}))
+
+			// the switch is built from the cached node
+			_, err = fakeOvn.fakeClient.KubeClient.CoreV1().Nodes().Update(context.TODO(), newNode, metav1.UpdateOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Eventually(func() (map[string]string, error) {
+				cached, err := fakeOvn.controller.watchFactory.GetNode(nodeName)
+				if err != nil {
+					return nil, err
+				}
+				return cached.Annotations, nil
+			}).Should(gomega.Equal(newNode.Annotations))
+
+			gomega.Expect(fakeOvn.controller.addUpdateNodeEvent(newNode, syncs)).To(gomega.Succeed())
+			gomega.Expect(excludeIPs()).To(gomega.Equal("10.1.1.2 10.1.1.16..10.1.1.31"))
+			gomega.Expect(fakeOvn.controller.lsManager.AllocateIPs(nodeName,
+				ovntest.MustParseIPNets("10.1.1.16/32"))).To(gomega.Equal(ipallocator.ErrAllocated))
+			// the pod IPs stay allocated
+			gomega.Expect(fakeOvn.controller.lsManager.AllocateIPs(nodeName, podIPs)).To(gomega.Equal(ipallocator.ErrAllocated))
+		})
+
+		ginkgo.It("only syncs the switch on a load balancer group exclusion change", func() {
+			newNode := node.DeepCopy()
+			newNode.Annotations["k8s.ovn.org/exclude-load-balancer-group"] = "true"
+			syncs := fakeOvn.controller.nodeUpdateSyncs(node, newNode)
+			gomega.Expect(*syncs).To(gomega.Equal(nodeSyncs{syncSwitch: true}))
+
+			gomega.Expect(fakeOvn.controller.addUpdateNodeEvent(newNode, syncs)).To(gomega.Succeed())
+			gomega.Expect(excludeIPs()).To(gomega.Equal("10.1.1.2"))
+		})
+
+		table.DescribeTable("syncs the node, its switch and its cluster router port on a freeze change", func(oldFrozen, frozen string) {
+			oldNode := node.DeepCopy()
+			oldNode.Annotations["k8s.ovn.org/freeze-ovn"] = oldFrozen
+			newNode := node.DeepCopy()
+			newNode.Annotations["k8s.ovn.org/freeze-ovn"] = frozen
+			syncs := fakeOvn.controller.nodeUpdateSyncs(oldNode, newNode)
+			gomega.Expect(*syncs).To(gomega.Equal(nodeSyncs{syncNode: true, syncSwitch: true, syncClusterRouterPort: true}))
+		},
+			table.Entry("when frozen", "false", "true"),
+			table.Entry("when unfrozen", "true", "false"),
+		)
+
+		ginkgo.It("does not sync the switch when it already has the annotated subnets", func() {
+			oldNode := node.DeepCopy()
+			delete(oldNode.Annotations, "k8s.ovn.org/node-subnets")
+			syncs := fakeOvn.controller.nodeUpdateSyncs(oldNode, node)
+			gomega.Expect(syncs.syncSwitch).To(gomega.BeFalse())
+			gomega.Expect(syncs.syncNode).To(gomega.BeFalse())
+			gomega.Expect(syncs.syncClusterRouterPort).To(gomega.BeTrue())
+		})
+
+		ginkgo.It("adds the node again when the annotated subnets are not allocated to it", func() {
+			newNode := node.DeepCopy()
+			newNode.Annotations["k8s.ovn.org/node-subnets"] = `{"default":"10.1.2.0/24"}`
+			syncs := fakeOvn.controller.nodeUpdateSyncs(node, newNode)
+			gomega.Expect(syncs.syncSwitch).To(gomega.BeTrue())
+
+			hostSubnets, err := fakeOvn.controller.syncNodeSwitch(newNode)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			owner, ok := fakeOvn.controller.masterSubnetAllocator.SubnetOwner(hostSubnets[0])
+			gomega.Expect(ok).To(gomega.BeTrue())
+			gomega.Expect(owner).To(gomega.Equal(nodeName))
+		})
+	})
+
+	ginkgo.Context("when a node fails to be added", func() {
+		var nodeAddErrorCategory = func(err error) NodeAddErrorCategory {
+			var nodeAddErr *NodeAddError
+			gomega.Expect(errors.As(err, &nodeAddErr)).To(gomega.BeTrue())
+			return nodeAddErr.Category
+		}
+
+		ginkgo.It("categorizes a missing chassis annotation", func() {
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets": `{"default":"` + nodeSubnet + `"}`,
+			})
+			startController(node)
+
+			err := fakeOvn.controller.addUpdateNodeEvent(node, &nodeSyncs{syncNode: true, syncClusterRouterPort: true})
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			gomega.Expect(errors.Is(err, errNodeChassisNotFound)).To(gomega.BeTrue())
+			gomega.Expect(nodeAddErrorCategory(err)).To(gomega.Equal(NodeAddErrorChassisNotReady))
+			gomega.Expect(err.Error()).To(gomega.ContainSubstring(nodeAddErrorHints[NodeAddErrorChassisNotReady]))
+		})
+
+		ginkgo.It("categorizes an exhausted cluster network and reports the hint in the event", func() {
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-chassis-id": chassisID,
+			})
+			startController(node)
+
+			// a cluster network with room for two nodes, both already taken
+			fakeOvn.controller.masterSubnetAllocator = subnetallocator.NewHostSubnetAllocator()
+			clusterSubnets, err := config.ParseClusterSubnetEntries("10.1.0.0/23/24")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(fakeOvn.controller.masterSubnetAllocator.InitRanges(clusterSubnets)).To(gomega.Succeed())
+			for _, otherNode := range []string{"node2", "node3"} {
+				_, _, err = fakeOvn.controller.masterSubnetAllocator.AllocateNodeSubnets(otherNode, nil, true, false)
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			}
+
+			err = fakeOvn.controller.addUpdateNodeEvent(node, &nodeSyncs{syncNode: true})
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			gomega.Expect(errors.Is(err, subnetallocator.ErrSubnetAllocatorFull)).To(gomega.BeTrue())
+			gomega.Expect(nodeAddErrorCategory(err)).To(gomega.Equal(NodeAddErrorSubnetExhausted))
+			gomega.Eventually(fakeOvn.fakeRecorder.Events).Should(gomega.Receive(gomega.And(
+				gomega.ContainSubstring("ErrorReconcilingNode"),
+				gomega.ContainSubstring(string(NodeAddErrorSubnetExhausted)),
+				gomega.ContainSubstring(nodeAddErrorHints[NodeAddErrorSubnetExhausted]),
+			)))
+		})
+
+		ginkgo.It("categorizes any other router port failure as unknown", func() {
+			// no subnet annotation to build the router port from
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-chassis-id": chassisID,
+			})
+			startController(node)
+
+			// the router port error is aggregated with the errors of the other node steps
+			err := fakeOvn.controller.addUpdateNodeEvent(node, &nodeSyncs{syncClusterRouterPort: true})
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			gomega.Expect(err.Error()).To(gomega.ContainSubstring(fmt.Sprintf("(%s: %s)",
+				NodeAddErrorUnknown, nodeAddErrorHints[NodeAddErrorUnknown])))
+		})
+
+		table.DescribeTable("categorizes database failures", func(dbErr error) {
+			fakeOvn.start()
+			err := newNodeAddError(fmt.Errorf("failed to add logical switch: %w",
+				fmt.Errorf("error in transact with ops: %w", dbErr)))
+			gomega.Expect(nodeAddErrorCategory(err)).To(gomega.Equal(NodeAddErrorDatabaseUnavailable))
+			gomega.Expect(errors.Is(err, dbErr)).To(gomega.BeTrue())
+		},
+			table.Entry("when disconnected", libovsdbclient.ErrNotConnected),
+			table.Entry("when timing out", context.DeadlineExceeded),
+		)
+
+		ginkgo.It("does not wrap an already categorized error again", func() {
+			fakeOvn.start()
+			err := newNodeAddError(errNodeChassisNotFound)
+			gomega.Expect(newNodeAddError(fmt.Errorf("retrying: %w", err))).To(gomega.MatchError(gomega.ContainSubstring(
+				"retrying: node chassis ID not found (ChassisNotReady")))
+			gomega.Expect(newNodeAddError(nil)).To(gomega.BeNil())
+		})
+	})
+
+	ginkgo.Context("when reporting the subnet allocation condition", func() {
+		getCondition := func() *v1.NodeCondition {
+			node, err := fakeOvn.fakeClient.KubeClient.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			for i := range node.Status.Conditions {
+				if node.Status.Conditions[i].Type == NodeSubnetAllocatedCondition {
+					return &node.Status.Conditions[i]
+				}
+			}
+			return nil
+		}
+
+		ginkgo.It("sets the condition once the node subnets are allocated", func() {
+			node := newNode(map[string]string{})
+			startController(node)
+
+			hostSubnets, err := fakeOvn.controller.addNode(node)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			condition := getCondition()
+			gomega.Expect(condition).NotTo(gomega.BeNil())
+			gomega.Expect(condition.Status).To(gomega.Equal(v1.ConditionTrue))
+			gomega.Expect(condition.Reason).To(gomega.Equal("SubnetsAllocated"))
+			gomega.Expect(condition.Message).To(gomega.ContainSubstring(hostSubnets[0].String()))
+		})
+
+		ginkgo.It("reports the allocation failure in the condition until the node gets subnets", func() {
+			node := newNode(map[string]string{})
+			startController(node)
+
+			// a cluster network with room for two nodes, both already taken
+			fakeOvn.controller.masterSubnetAllocator = subnetallocator.NewHostSubnetAllocator()
+			clusterSubnets, err := config.ParseClusterSubnetEntries("10.1.0.0/23/24")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(fakeOvn.controller.masterSubnetAllocator.InitRanges(clusterSubnets)).To(gomega.Succeed())
+			for _, otherNode := range []string{"node2", "node3"} {
+				_, _, err = fakeOvn.controller.masterSubnetAllocator.AllocateNodeSubnets(otherNode, nil, true, false)
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			}
+
+			_, err = fakeOvn.controller.addNode(node)
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			condition := getCondition()
+			gomega.Expect(condition).NotTo(gomega.BeNil())
+			gomega.Expect(condition.Status).To(gomega.Equal(v1.ConditionFalse))
+			gomega.Expect(condition.Reason).To(gomega.Equal("SubnetAllocationFailed"))
+			gomega.Expect(condition.Message).To(gomega.ContainSubstring(subnetallocator.ErrSubnetAllocatorFull.Error()))
+
+			fakeOvn.controller.masterSubnetAllocator.ReleaseAllNodeSubnets("node2")
+			_, err = fakeOvn.controller.addNode(node)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			condition = getCondition()
+			gomega.Expect(condition).NotTo(gomega.BeNil())
+			gomega.Expect(condition.Status).To(gomega.Equal(v1.ConditionTrue))
+		})
+
+		ginkgo.It("adds the node even if the condition cannot be set", func() {
+			node := newNode(map[string]string{})
+			startController(node)
+			fakeOvn.fakeClient.KubeClient.(*fake.Clientset).PrependReactor("patch", "nodes",
+				func(action k8stesting.Action) (bool, runtime.Object, error) {
+					if action.GetSubresource() == "status" {
+						return true, nil, fmt.Errorf("failed to patch node status")
+					}
+					return false, nil, nil
+				})
+
+			hostSubnets, err := fakeOvn.controller.addNode(node)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(hostSubnets).To(gomega.HaveLen(1))
+			gomega.Expect(getCondition()).To(gomega.BeNil())
+			_, err = libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+
+		table.DescribeTable("only moves the transition time when the status changes", func(status v1.ConditionStatus, moves bool) {
+			fakeOvn.start()
+			before := metav1.NewTime(time.Unix(1000, 0))
+			now := metav1.NewTime(time.Unix(2000, 0))
+			nodeStatus := &v1.NodeStatus{Conditions: []v1.NodeCondition{
+				{Type: v1.NodeReady, Status: v1.ConditionTrue},
+				{Type: NodeSubnetAllocatedCondition, Status: v1.ConditionFalse, Reason: "SubnetAllocationFailed",
+					LastHeartbeatTime: before, LastTransitionTime: before},
+			}}
+			changed := setNodeCondition(nodeStatus, v1.NodeCondition{Type: NodeSubnetAllocatedCondition,
+				Status: status, Reason: "SubnetsAllocated"}, now)
+			gomega.Expect(changed).To(gomega.BeTrue())
+			gomega.Expect(nodeStatus.Conditions).To(gomega.HaveLen(2))
+			condition := nodeStatus.Conditions[1]
+			gomega.Expect(condition.Reason).To(gomega.Equal("SubnetsAllocated"))
+			gomega.Expect(condition.LastHeartbeatTime).To(gomega.Equal(now))
+			if moves {
+				gomega.Expect(condition.LastTransitionTime).To(gomega.Equal(now))
+			} else {
+				gomega.Expect(condition.LastTransitionTime).To(gomega.Equal(before))
+			}
+
+			// setting the same condition again changes nothing
+			gomega.Expect(setNodeCondition(nodeStatus, condition, now)).To(gomega.BeFalse())
+		},
+			table.Entry("status changed", v1.ConditionTrue, true),
+			table.Entry("same status", v1.ConditionFalse, false),
+		)
+	})
+
+	ginkgo.Context("with a node subnet reserve", func() {
+		// startReserved starts the controller with a cluster network with room for two
+		// node subnets, one of them taken by node2, and one subnet reserved
+		startReserved := func(node *v1.Node) {
+			startController(node)
+			fakeOvn.controller.masterSubnetAllocator = subnetallocator.NewHostSubnetAllocator()
+			clusterSubnets, err := config.ParseClusterSubnetEntries("10.1.0.0/23/24")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(fakeOvn.controller.masterSubnetAllocator.InitRanges(clusterSubnets)).To(gomega.Succeed())
+			_, _, err = fakeOvn.controller.masterSubnetAllocator.AllocateNodeSubnets("node2", nil, true, false)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			config.Default.NodeSubnetReserve = 1
+			config.Default.CriticalNodes = &metav1.LabelSelector{
+				MatchLabels: map[string]string{"node-role.kubernetes.io/critical": ""},
+			}
+		}
+		freeSubnets := func() uint64 {
+			v4free, _ := fakeOvn.controller.masterSubnetAllocator.FreeSubnets()
+			return v4free
+		}
+
+		ginkgo.It("refuses a node that is not critical the reserved subnets", func() {
+			node := newNode(map[string]string{})
+			startReserved(node)
+
+			_, _, err := fakeOvn.controller.allocateNodeSubnets(node, fakeOvn.controller.masterSubnetAllocator)
+			gomega.Expect(err).To(gomega.MatchError(errNodeSubnetReserved))
+			gomega.Expect(freeSubnets()).To(gomega.Equal(uint64(1)))
+
+			// the node gets a subnet once the reserve allows it
+			config.Default.NodeSubnetReserve = 0
+			hostSubnets, _, err := fakeOvn.controller.allocateNodeSubnets(node, fakeOvn.controller.masterSubnetAllocator)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(hostSubnets).To(gomega.HaveLen(1))
+			gomega.Expect(freeSubnets()).To(gomega.BeZero())
+		})
+
+		ginkgo.It("lets a critical node get a reserved subnet", func() {
+			node := newNode(map[string]string{})
+			node.Labels = map[string]string{"node-role.kubernetes.io/critical": ""}
+			startReserved(node)
+
+			hostSubnets, _, err := fakeOvn.controller.allocateNodeSubnets(node, fakeOvn.controller.masterSubnetAllocator)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(hostSubnets).To(gomega.HaveLen(1))
+			gomega.Expect(freeSubnets()).To(gomega.BeZero())
+		})
+
+		ginkgo.It("keeps the existing subnet of a node that is not critical", func() {
+			node := newNode(map[string]string{"k8s.ovn.org/node-subnets": `{"default":"10.1.1.0/24"}`})
+			startReserved(node)
+
+			hostSubnets, _, err := fakeOvn.controller.allocateNodeSubnets(node, fakeOvn.controller.masterSubnetAllocator)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(hostSubnets).To(gomega.Equal([]*net.IPNet{ovntest.MustParseIPNet("10.1.1.0/24")}))
+		})
+	})
+
+	ginkgo.Context("when allocating the host subnets of a node", func() {
+		ginkgo.It("returns the subnets newly allocated to a node without subnets", func() {
+			node := newNode(map[string]string{})
+			startController(node)
+
+			hostSubnets, allocatedSubnets, err := fakeOvn.controller.allocateNodeSubnets(node,
+				fakeOvn.controller.masterSubnetAllocator)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(hostSubnets).To(gomega.HaveLen(1))
+			gomega.Expect(allocatedSubnets).To(gomega.Equal(hostSubnets))
+		})
+
+		ginkgo.It("allocates nothing to a node keeping its annotated subnets", func() {
+			node := newNode(map[string]string{"k8s.ovn.org/node-subnets": `{"default":"` + nodeSubnet + `"}`})
+			startController(node)
+
+			hostSubnets, allocatedSubnets, err := fakeOvn.controller.allocateNodeSubnets(node,
+				fakeOvn.controller.masterSubnetAllocator)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(hostSubnets).To(gomega.Equal(ovntest.MustParseIPNets(nodeSubnet)))
+			gomega.Expect(allocatedSubnets).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("only patches the annotations of a node when they change", func() {
+			node := newNode(map[string]string{})
+			startController(node)
+			var patches int32
+			fakeOvn.fakeClient.KubeClient.(*fake.Clientset).PrependReactor("patch", "nodes",
+				func(action k8stesting.Action) (bool, runtime.Object, error) {
+					if action.GetSubresource() == "" {
+						atomic.AddInt32(&patches, 1)
+					}
+					return false, nil, nil
+				})
+
+			_, err := fakeOvn.controller.addNode(node)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(atomic.LoadInt32(&patches)).To(gomega.Equal(int32(1)))
+
+			// adding the node again, as annotated, leaves it alone
+			node, err = fakeOvn.fakeClient.KubeClient.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Eventually(func() (map[string]string, error) {
+				cached, err := fakeOvn.controller.watchFactory.GetNode(nodeName)
+				if err != nil {
+					return nil, err
+				}
+				return cached.Annotations, nil
+			}).Should(gomega.Equal(node.Annotations))
+			_, err = fakeOvn.controller.addNode(node)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(atomic.LoadInt32(&patches)).To(gomega.Equal(int32(1)))
+		})
+	})
+
+	ginkgo.Context("when migrating a node subnet", func() {
+		newSubnet := ovntest.MustParseIPNet("10.1.5.0/24")
+
+		getSwitchSubnet := func() string {
+			ls, err := libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			return ls.OtherConfig["subnet"]
+		}
+		getNodeSubnets := func() []*net.IPNet {
+			node, err := fakeOvn.fakeClient.KubeClient.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			hostSubnets, err := util.ParseNodeHostSubnetAnnotation(node, types.DefaultNetworkName)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			return hostSubnets
+		}
+		// isAllocated returns whether the subnet is allocated, to a node other than node2
+		isAllocated := func(subnet *net.IPNet) bool {
+			err := fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated("node2", subnet)
+			if err != nil {
+				return true
+			}
+			gomega.Expect(fakeOvn.controller.masterSubnetAllocator.ReleaseNodeSubnets("node2", subnet)).To(gomega.Succeed())
+			return false
+		}
+		// isReserved returns whether the IP is allocated on the node switch
+		isReserved := func(ipNet *net.IPNet) bool {
+			err := fakeOvn.controller.lsManager.AllocateIPs(nodeName, []*net.IPNet{ipNet})
+			if err != nil {
+				return true
+			}
+			gomega.Expect(fakeOvn.controller.lsManager.ReleaseIPs(nodeName, []*net.IPNet{ipNet})).To(gomega.Succeed())
+			return false
+		}
+
+		ginkgo.It("moves the node switch, router port and annotation to the new subnet", func() {
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets":    `{"default":"` + nodeSubnet + `"}`,
+				"k8s.ovn.org/node-chassis-id": chassisID,
+			})
+			startController(node)
+			_, err := fakeOvn.controller.addNode(node)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(getSwitchSubnet()).To(gomega.Equal(nodeSubnet))
+
+			gomega.Expect(fakeOvn.controller.migrateNodeSubnet(nodeName, newSubnet)).To(gomega.Succeed())
+			gomega.Expect(getSwitchSubnet()).To(gomega.Equal(newSubnet.String()))
+			lrp, err := libovsdbops.GetLogicalRouterPort(fakeOvn.nbClient,
+				&nbdb.LogicalRouterPort{Name: types.RouterToSwitchPrefix + nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(lrp.Networks).To(gomega.Equal([]string{"10.1.5.1/24"}))
+			gomega.Expect(getNodeSubnets()).To(gomega.Equal([]*net.IPNet{newSubnet}))
+			gomega.Expect(isAllocated(newSubnet)).To(gomega.BeTrue())
+			gomega.Expect(isAllocated(ovntest.MustParseIPNet(nodeSubnet))).To(gomega.BeFalse())
+
+			// pods get addresses from the new subnet
+			ips, err := fakeOvn.controller.lsManager.AllocateNextIPs(nodeName)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(newSubnet.Contains(ips[0].IP)).To(gomega.BeTrue())
+		})
+
+		ginkgo.It("keeps the pod IPs of the other IP family reserved", func() {
+			const nodeIPv6Subnet = "fd00:10:244:1::/64"
+			config.IPv6Mode = true
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets":    `{"default":["` + nodeSubnet + `","` + nodeIPv6Subnet + `"]}`,
+				"k8s.ovn.org/node-chassis-id": chassisID,
+			})
+			startController(node)
+			v6ClusterSubnets, err := config.ParseClusterSubnetEntries("fd00:10:244::/48/64")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(fakeOvn.controller.masterSubnetAllocator.InitRanges(v6ClusterSubnets)).To(gomega.Succeed())
+			_, err = fakeOvn.controller.addNode(node)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			podIPs, err := fakeOvn.controller.lsManager.AllocateNextIPs(nodeName)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(podIPs).To(gomega.HaveLen(2))
+
+			gomega.Expect(fakeOvn.controller.migrateNodeSubnet(nodeName, newSubnet)).To(gomega.Succeed())
+			for _, podIP := range podIPs {
+				if utilnet.IsIPv6CIDR(podIP) {
+					gomega.Expect(isReserved(podIP)).To(gomega.BeTrue())
+				}
+			}
+		})
+
+		ginkgo.It("rolls the migration back if a step fails", func() {
+			// without a chassis ID, the router port can't be moved
+			node := newNode(map[string]string{"k8s.ovn.org/node-subnets": `{"default":"` + nodeSubnet + `"}`})
+			startController(node)
+			_, err := fakeOvn.controller.addNode(node)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			podIPs, err := fakeOvn.controller.lsManager.AllocateNextIPs(nodeName)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			err = fakeOvn.controller.migrateNodeSubnet(nodeName, newSubnet)
+			gomega.Expect(err).To(gomega.MatchError(errNodeChassisNotFound))
+			gomega.Expect(getSwitchSubnet()).To(gomega.Equal(nodeSubnet))
+			gomega.Expect(getNodeSubnets()).To(gomega.Equal([]*net.IPNet{ovntest.MustParseIPNet(nodeSubnet)}))
+			gomega.Expect(isAllocated(newSubnet)).To(gomega.BeFalse())
+			gomega.Expect(isAllocated(ovntest.MustParseIPNet(nodeSubnet))).To(gomega.BeTrue())
+			// the pod IPs allocated before the migration are still reserved
+			for _, podIP := range podIPs {
+				gomega.Expect(isReserved(podIP)).To(gomega.BeTrue())
+			}
+		})
+
+		ginkgo.It("refuses a subnet allocated to another node", func() {
+			node := newNode(map[string]string{"k8s.ovn.org/node-subnets": `{"default":"` + nodeSubnet + `"}`})
+			startController(node)
+			_, err := fakeOvn.controller.addNode(node)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated("node3", newSubnet)).To(gomega.Succeed())
+
+			gomega.Expect(fakeOvn.controller.migrateNodeSubnet(nodeName, newSubnet)).NotTo(gomega.Succeed())
+			gomega.Expect(getSwitchSubnet()).To(gomega.Equal(nodeSubnet))
+			gomega.Expect(getNodeSubnets()).To(gomega.Equal([]*net.IPNet{ovntest.MustParseIPNet(nodeSubnet)}))
+		})
+	})
+
+	ginkgo.Context("when syncing the node cluster router port", func() {
+		ginkgo.It("tags the router port with the node name", func() {
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets":    `{"default":"` + nodeSubnet + `"}`,
+				"k8s.ovn.org/node-chassis-id": chassisID,
+			})
+			startController(node)
+			lrpName := types.RouterToSwitchPrefix + nodeName
+
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, nil)).To(gomega.Succeed())
+			lrp, err := libovsdbops.GetLogicalRouterPort(fakeOvn.nbClient, &nbdb.LogicalRouterPort{Name: lrpName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(lrp.ExternalIDs).To(gomega.HaveKeyWithValue(types.OvnNodeExternalID, nodeName))
+
+			ginkgo.By("removing the external ID out-of-band")
+			lrp.ExternalIDs = map[string]string{}
+			err = libovsdbops.CreateOrUpdateLogicalRouterPort(fakeOvn.nbClient,
+				&nbdb.LogicalRouter{Name: types.OVNClusterRouter}, lrp, nil, &lrp.ExternalIDs)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			lrp, err = libovsdbops.GetLogicalRouterPort(fakeOvn.nbClient, &nbdb.LogicalRouterPort{Name: lrpName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(lrp.ExternalIDs).To(gomega.BeEmpty())
+
+			// the next sync restores it
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, nil)).To(gomega.Succeed())
+			lrp, err = libovsdbops.GetLogicalRouterPort(fakeOvn.nbClient, &nbdb.LogicalRouterPort{Name: lrpName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(lrp.ExternalIDs).To(gomega.HaveKeyWithValue(types.OvnNodeExternalID, nodeName))
+		})
+
+		ginkgo.It("lets a node opt in to learning from every ARP request on its router port", func() {
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets":                  `{"default":"` + nodeSubnet + `"}`,
+				"k8s.ovn.org/node-chassis-id":               chassisID,
+				"k8s.ovn.org/always-learn-from-arp-request": "true",
+			})
+			startController(node)
+			lrpName := types.RouterToSwitchPrefix + nodeName
+			getOptions := func() map[string]string {
+				lrp, err := libovsdbops.GetLogicalRouterPort(fakeOvn.nbClient, &nbdb.LogicalRouterPort{Name: lrpName})
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				return lrp.Options
+			}
+
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, nil)).To(gomega.Succeed())
+			gomega.Expect(getOptions()).To(gomega.HaveKeyWithValue("always_learn_from_arp_request", "true"))
+
+			ginkgo.By("setting another option of the router port out-of-band")
+			lrp := &nbdb.LogicalRouterPort{Name: lrpName, Options: map[string]string{
+				"always_learn_from_arp_request": "true",
+				"gateway_mtu":                   "1400",
+			}}
+			err := libovsdbops.CreateOrUpdateLogicalRouterPort(fakeOvn.nbClient,
+				&nbdb.LogicalRouter{Name: types.OVNClusterRouter}, lrp, nil, &lrp.Options)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			ginkgo.By("opting the node out")
+			node.Annotations["k8s.ovn.org/always-learn-from-arp-request"] = "false"
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, nil)).To(gomega.Succeed())
+			gomega.Expect(getOptions()).To(gomega.Equal(map[string]string{"gateway_mtu": "1400"}))
+		})
+
+		ginkgo.It("annotates the node with the gateway IPs of the router port", func() {
+			node := newNode(map[string]string{"k8s.ovn.org/node-chassis-id": chassisID})
+			startController(node)
+
+			hostSubnets, err := fakeOvn.controller.addNode(node)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(hostSubnets).To(gomega.HaveLen(1))
+			node, err = fakeOvn.fakeClient.KubeClient.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gatewayIPs, err := util.ParseNodeGatewayIPs(node)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(gatewayIPs).To(gomega.HaveLen(1))
+			gomega.Expect(gatewayIPs[0].String()).To(gomega.Equal(util.GetNodeGatewayIfAddr(hostSubnets[0]).String()))
+
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, hostSubnets)).To(gomega.Succeed())
+			lrp, err := libovsdbops.GetLogicalRouterPort(fakeOvn.nbClient,
+				&nbdb.LogicalRouterPort{Name: types.RouterToSwitchPrefix + nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(lrp.Networks).To(gomega.Equal([]string{gatewayIPs[0].String()}))
+		})
+	})
+
+	ginkgo.Context("with a frozen node", func() {
+		setFrozen := func(frozen bool) {
+			node, err := fakeOvn.fakeClient.KubeClient.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			node.Annotations["k8s.ovn.org/freeze-ovn"] = fmt.Sprintf("%t", frozen)
+			_, err = fakeOvn.fakeClient.KubeClient.CoreV1().Nodes().Update(context.TODO(), node, metav1.UpdateOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Eventually(func() bool {
+				node, err := fakeOvn.controller.watchFactory.GetNode(nodeName)
+				return err == nil && util.IsNodeOVNFrozen(node) == frozen
+			}).Should(gomega.BeTrue())
+		}
+
+		ginkgo.It("leaves its logical switch alone until unfrozen", func() {
+			startController(newNode(map[string]string{}))
+			hostSubnets := ovntest.MustParseIPNets(nodeSubnet)
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName, hostSubnets, "")).Error().To(gomega.Succeed())
+
+			ginkgo.By("tweaking the switch of the frozen node")
+			setFrozen(true)
+			ls, err := libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			ls.OtherConfig["exclude_ips"] = "10.1.1.2..10.1.1.9"
+			gomega.Expect(libovsdbops.CreateOrUpdateLogicalSwitch(fakeOvn.nbClient, ls, &ls.OtherConfig)).To(gomega.Succeed())
+			fakeOvn.controller.lsManager.DeleteSwitch(nodeName)
+
+			ls, err = fakeOvn.controller.createNodeLogicalSwitch(nodeName, hostSubnets, "")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(ls.OtherConfig).To(gomega.HaveKeyWithValue("exclude_ips", "10.1.1.2..10.1.1.9"))
+			// but the switch is still tracked
+			gomega.Expect(sameSubnets(fakeOvn.controller.lsManager.GetSwitchSubnets(nodeName), hostSubnets)).To(gomega.BeTrue())
+
+			ginkgo.By("unfreezing the node")
+			setFrozen(false)
+			ls, err = fakeOvn.controller.createNodeLogicalSwitch(nodeName, hostSubnets, "")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(ls.OtherConfig).To(gomega.HaveKeyWithValue("exclude_ips", "10.1.1.2"))
+		})
+
+		ginkgo.It("does not sync its cluster router port until unfrozen", func() {
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets":    `{"default":"` + nodeSubnet + `"}`,
+				"k8s.ovn.org/node-chassis-id": chassisID,
+				"k8s.ovn.org/freeze-ovn":      "true",
+			})
+			startController(node)
+			lrpName := types.RouterToSwitchPrefix + nodeName
+
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, nil)).To(gomega.Succeed())
+			_, err := libovsdbops.GetLogicalRouterPort(fakeOvn.nbClient, &nbdb.LogicalRouterPort{Name: lrpName})
+			gomega.Expect(err).To(gomega.MatchError(libovsdbclient.ErrNotFound))
+
+			node.Annotations["k8s.ovn.org/freeze-ovn"] = "false"
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, nil)).To(gomega.Succeed())
+			_, err = libovsdbops.GetLogicalRouterPort(fakeOvn.nbClient, &nbdb.LogicalRouterPort{Name: lrpName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+	})
+
+	ginkgo.Context("when the load balancer group is recreated", func() {
+		var nodes []*v1.Node
+		var staleGroupUUID string
+
+		switchLoadBalancerGroups := func(switchName string) []string {
+			ls, err := libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: switchName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			return ls.LoadBalancerGroup
+		}
+
+		ginkgo.BeforeEach(func() {
+			nodes = []*v1.Node{
+				{ObjectMeta: metav1.ObjectMeta{Name: "node1"}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "node2"}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "node3",
+					Annotations: map[string]string{"k8s.ovn.org/exclude-load-balancer-group": "true"}}},
+			}
+			startController(nodes...)
+
+			// the switches were set up with a group that has since been replaced
+			staleGroup := &nbdb.LoadBalancerGroup{Name: "stale-" + types.ClusterLBGroupName}
+			gomega.Expect(libovsdbops.CreateOrUpdateLoadBalancerGroup(fakeOvn.nbClient, staleGroup)).To(gomega.Succeed())
+			staleGroupUUID = staleGroup.UUID
+			fakeOvn.controller.loadBalancerGroupUUID = staleGroupUUID
+			for i, node := range nodes {
+				gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(node.Name,
+					ovntest.MustParseIPNets(fmt.Sprintf("10.1.%d.0/24", i+1)), staleGroup.UUID)).Error().To(gomega.Succeed())
+			}
+			gomega.Expect(switchLoadBalancerGroups("node1")).To(gomega.Equal([]string{staleGroup.UUID}))
+			gatewayRouter := &nbdb.LogicalRouter{
+				Name:              types.GWRouterPrefix + "node1",
+				LoadBalancerGroup: []string{staleGroup.UUID},
+			}
+			gomega.Expect(libovsdbops.CreateOrUpdateLogicalRouter(fakeOvn.nbClient, gatewayRouter,
+				&gatewayRouter.LoadBalancerGroup)).To(gomega.Succeed())
+		})
+
+		ginkgo.It("points every node switch at the current group", func() {
+			updated, err := fakeOvn.controller.reconcileNodeSwitchLoadBalancerGroup(nodes)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(updated).To(gomega.ConsistOf("node1", "node2"))
+
+			groups, err := libovsdbops.FindLoadBalancerGroupsWithPredicate(fakeOvn.nbClient,
+				func(item *nbdb.LoadBalancerGroup) bool { return item.Name == types.ClusterLBGroupName })
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(groups).To(gomega.HaveLen(1))
+			currentUUID := groups[0].UUID
+			gomega.Expect(fakeOvn.controller.getLoadBalancerGroupUUID()).To(gomega.Equal(currentUUID))
+			gomega.Expect(switchLoadBalancerGroups("node1")).To(gomega.Equal([]string{currentUUID}))
+			gomega.Expect(switchLoadBalancerGroups("node2")).To(gomega.Equal([]string{currentUUID}))
+			// excluded nodes are left without a group
+			gomega.Expect(switchLoadBalancerGroups("node3")).To(gomega.BeEmpty())
+			// the gateway routers are repointed too
+			gatewayRouter, err := libovsdbops.GetLogicalRouter(fakeOvn.nbClient,
+				&nbdb.LogicalRouter{Name: types.GWRouterPrefix + "node1"})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(gatewayRouter.LoadBalancerGroup).To(gomega.Equal([]string{currentUUID}))
+
+			// nothing is left to update
+			updated, err = fakeOvn.controller.reconcileNodeSwitchLoadBalancerGroup(nodes)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(updated).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("does nothing without load balancer group support", func() {
+			fakeOvn.controller.loadBalancerGroupUUID = ""
+			updated, err := fakeOvn.controller.reconcileNodeSwitchLoadBalancerGroup(nodes)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(updated).To(gomega.BeEmpty())
+			gomega.Expect(switchLoadBalancerGroups("node1")).To(gomega.Equal([]string{staleGroupUUID}))
+		})
+	})
+
+	ginkgo.Context("with a node excluded from the load balancer group", func() {
+		var lbGroupUUID string
+
+		setExcluded := func(excluded bool) {
+			node, err := fakeOvn.fakeClient.KubeClient.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			node.Annotations["k8s.ovn.org/exclude-load-balancer-group"] = fmt.Sprintf("%t", excluded)
+			_, err = fakeOvn.fakeClient.KubeClient.CoreV1().Nodes().Update(context.TODO(), node, metav1.UpdateOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Eventually(func() bool {
+				node, err := fakeOvn.controller.watchFactory.GetNode(nodeName)
+				return err == nil && util.IsNodeExcludedFromLoadBalancerGroup(node) == excluded
+			}).Should(gomega.BeTrue())
+		}
+
+		switchLoadBalancerGroups := func() []string {
+			ls, err := libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			return ls.LoadBalancerGroup
+		}
+
+		ginkgo.BeforeEach(func() {
+			startController(newNode(map[string]string{}))
+			groups, err := libovsdbops.FindLoadBalancerGroupsWithPredicate(fakeOvn.nbClient,
+				func(item *nbdb.LoadBalancerGroup) bool { return item.Name == types.ClusterLBGroupName })
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(groups).To(gomega.HaveLen(1))
+			lbGroupUUID = groups[0].UUID
+		})
+
+		ginkgo.It("does not attach the group to its switch", func() {
+			setExcluded(true)
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet), lbGroupUUID)).Error().To(gomega.Succeed())
+			gomega.Expect(switchLoadBalancerGroups()).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("detaches and reattaches the group when the exclusion is toggled", func() {
+			hostSubnets := ovntest.MustParseIPNets(nodeSubnet)
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName, hostSubnets, lbGroupUUID)).Error().To(gomega.Succeed())
+			gomega.Expect(switchLoadBalancerGroups()).To(gomega.Equal([]string{lbGroupUUID}))
+
+			setExcluded(true)
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName, hostSubnets, lbGroupUUID)).Error().To(gomega.Succeed())
+			gomega.Expect(switchLoadBalancerGroups()).To(gomega.BeEmpty())
+
+			setExcluded(false)
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName, hostSubnets, lbGroupUUID)).Error().To(gomega.Succeed())
+			gomega.Expect(switchLoadBalancerGroups()).To(gomega.Equal([]string{lbGroupUUID}))
+		})
+
+		ginkgo.It("syncs the node switch when the exclusion changes", func() {
+			oldNode := newNode(map[string]string{})
+			node := newNode(map[string]string{"k8s.ovn.org/exclude-load-balancer-group": "true"})
+			gomega.Expect(nodeLoadBalancerGroupExclusionChanged(oldNode, node)).To(gomega.BeTrue())
+			gomega.Expect(nodeLoadBalancerGroupExclusionChanged(node, oldNode)).To(gomega.BeTrue())
+			gomega.Expect(nodeLoadBalancerGroupExclusionChanged(node, node)).To(gomega.BeFalse())
+		})
+	})
+
+	ginkgo.Context("when two nodes share a gateway chassis", func() {
+		const otherNodeName = "node2"
+
+		newNodes := func(otherChassisID string) (*v1.Node, *v1.Node) {
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets":    `{"default":"` + nodeSubnet + `"}`,
+				"k8s.ovn.org/node-chassis-id": chassisID,
+			})
+			otherNode := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets":    `{"default":"10.1.2.0/24"}`,
+				"k8s.ovn.org/node-chassis-id": otherChassisID,
+			})
+			otherNode.Name = otherNodeName
+			return node, otherNode
+		}
+
+		ginkgo.It("warns about the conflict with both node names", func() {
+			node, otherNode := newNodes(chassisID)
+			startController(node, otherNode)
+
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(otherNode, nil)).To(gomega.Succeed())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.BeEmpty())
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, nil)).To(gomega.Succeed())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.And(
+				gomega.ContainSubstring("GatewayChassisConflict"),
+				gomega.ContainSubstring(nodeName),
+				gomega.ContainSubstring(otherNodeName),
+				gomega.ContainSubstring(chassisID),
+			)))
+		})
+
+		ginkgo.It("does not warn about nodes with different chassis", func() {
+			node, otherNode := newNodes("d3b6e9a4-7c51-4f0e-8a2b-5e1f3c9d7a60")
+			startController(node, otherNode)
+
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(otherNode, nil)).To(gomega.Succeed())
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, nil)).To(gomega.Succeed())
+			// syncing the same node again is not a conflict either
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, nil)).To(gomega.Succeed())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.Context("with backup gateway chassis", func() {
+		const lrpName = types.RouterToSwitchPrefix + nodeName
+
+		var node *v1.Node
+
+		ginkgo.BeforeEach(func() {
+			node = newNode(map[string]string{
+				"k8s.ovn.org/node-subnets":        `{"default":"` + nodeSubnet + `"}`,
+				"k8s.ovn.org/node-chassis-id":     chassisID,
+				"k8s.ovn.org/node-backup-chassis": "backup1, backup2,backup3",
+			})
+		})
+
+		// getGatewayChassis returns the priority of each gateway chassis of the node router
+		// port, and checks there are no other gateway chassis left
+		getGatewayChassis := func() map[string]int {
+			lrp, err := libovsdbops.GetLogicalRouterPort(fakeOvn.nbClient, &nbdb.LogicalRouterPort{Name: lrpName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			priorities := map[string]int{}
+			for _, uuid := range lrp.GatewayChassis {
+				chassis, err := libovsdbops.GetGatewayChassis(fakeOvn.nbClient, &nbdb.GatewayChassis{UUID: uuid})
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				gomega.Expect(chassis.Name).To(gomega.Equal(lrpName + "-" + chassis.ChassisName))
+				priorities[chassis.ChassisName] = chassis.Priority
+			}
+			all, err := libovsdbops.FindGatewayChassisWithPredicate(fakeOvn.nbClient,
+				func(*nbdb.GatewayChassis) bool { return true })
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(all).To(gomega.HaveLen(len(priorities)))
+			return priorities
+		}
+
+		ginkgo.It("only pins the router port to the node's own chassis by default", func() {
+			startController(node)
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, nil)).To(gomega.Succeed())
+			gomega.Expect(getGatewayChassis()).To(gomega.Equal(map[string]int{chassisID: 1}))
+		})
+
+		ginkgo.It("adds the backups by descending priority up to the maximum and prunes the extras", func() {
+			config.Default.MaxNodeGatewayChassis = 3
+			startController(node)
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, nil)).To(gomega.Succeed())
+			gomega.Expect(getGatewayChassis()).To(gomega.Equal(map[string]int{chassisID: 3, "backup1": 2, "backup2": 1}))
+
+			ginkgo.By("removing a backup from the annotation")
+			oldNode := node.DeepCopy()
+			node.Annotations["k8s.ovn.org/node-backup-chassis"] = "backup2," + chassisID
+			gomega.Expect(nodeBackupChassisChanged(oldNode, node)).To(gomega.BeTrue())
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, nil)).To(gomega.Succeed())
+			gomega.Expect(getGatewayChassis()).To(gomega.Equal(map[string]int{chassisID: 3, "backup2": 2}))
+
+			ginkgo.By("lowering the maximum back to a single chassis")
+			config.Default.MaxNodeGatewayChassis = 1
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, nil)).To(gomega.Succeed())
+			gomega.Expect(getGatewayChassis()).To(gomega.Equal(map[string]int{chassisID: 1}))
+		})
+	})
+
+	ginkgo.Context("when two nodes have overlapping subnets", func() {
+		const otherNodeName = "node2"
+
+		newNodes := func(otherSubnet string) (*v1.Node, *v1.Node) {
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets":    `{"default":"` + nodeSubnet + `"}`,
+				"k8s.ovn.org/node-chassis-id": chassisID,
+			})
+			otherNode := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets":    `{"default":"` + otherSubnet + `"}`,
+				"k8s.ovn.org/node-chassis-id": "d3b6e9a4-7c51-4f0e-8a2b-5e1f3c9d7a60",
+			})
+			otherNode.Name = otherNodeName
+			return node, otherNode
+		}
+
+		ginkgo.It("warns about the router port MAC collision with both node names", func() {
+			// both subnets have the same gateway IP, and so the same router port MAC
+			node, otherNode := newNodes("10.1.1.0/25")
+			startController(node, otherNode)
+
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(otherNode, nil)).To(gomega.Succeed())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.BeEmpty())
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, nil)).To(gomega.Succeed())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.And(
+				gomega.ContainSubstring("RouterPortMACConflict"),
+				gomega.ContainSubstring(nodeName),
+				gomega.ContainSubstring(otherNodeName),
+				gomega.ContainSubstring("0a:58:0a:01:01:01"),
+			)))
+		})
+
+		ginkgo.It("does not warn about nodes with distinct subnets", func() {
+			node, otherNode := newNodes("10.1.2.0/24")
+			startController(node, otherNode)
+
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(otherNode, nil)).To(gomega.Succeed())
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, nil)).To(gomega.Succeed())
+			// syncing the same node again is not a collision either
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, nil)).To(gomega.Succeed())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.Context("when mapping chassis to nodes", func() {
+		var newNamedNode = func(name, chassis string) *v1.Node {
+			node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: map[string]string{}}}
+			if chassis != "" {
+				node.Annotations["k8s.ovn.org/node-chassis-id"] = chassis
+			}
+			return node
+		}
+
+		ginkgo.It("maps the annotated chassis of every node and follows node updates", func() {
+			startController(
+				newNamedNode("node1", "chassis1"),
+				newNamedNode("node2", "chassis2"),
+				newNamedNode("node3", ""),
+			)
+			gomega.Expect(fakeOvn.controller.ChassisToNode()).To(gomega.Equal(map[string]string{
+				"chassis1": "node1",
+				"chassis2": "node2",
+			}))
+
+			_, err := fakeOvn.fakeClient.KubeClient.CoreV1().Nodes().Update(context.TODO(),
+				newNamedNode("node3", "chassis3"), metav1.UpdateOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			err = fakeOvn.fakeClient.KubeClient.CoreV1().Nodes().Delete(context.TODO(), "node1", metav1.DeleteOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Eventually(fakeOvn.controller.ChassisToNode).Should(gomega.Equal(map[string]string{
+				"chassis2": "node2",
+				"chassis3": "node3",
+			}))
+		})
+
+		ginkgo.It("maps a chassis shared by several nodes to the first one", func() {
+			startController(
+				newNamedNode("node2", "chassis1"),
+				newNamedNode("node1", "chassis1"),
+			)
+			gomega.Expect(fakeOvn.controller.ChassisToNode()).To(gomega.Equal(map[string]string{"chassis1": "node1"}))
+		})
+	})
+
+	ginkgo.Context("when checking whether the cluster router exists", func() {
+		ginkgo.It("reports a present cluster router", func() {
+			startController()
+			exists, err := fakeOvn.controller.ClusterRouterExists()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(exists).To(gomega.BeTrue())
+		})
+
+		ginkgo.It("reports an absent cluster router without an error", func() {
+			fakeOvn.startWithDBSetup(libovsdbtest.TestSetup{
+				NBData: []libovsdbtest.TestData{newClusterJoinSwitch()},
+			})
+			exists, err := fakeOvn.controller.ClusterRouterExists()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(exists).To(gomega.BeFalse())
+		})
+	})
+
+	ginkgo.Context("when querying the excluded IPs of a node switch", func() {
+		table.DescribeTable("parses exclude_ips", func(excludeIPs string, expCIDRs []string) {
+			fakeOvn.start()
+			excluded, err := parseExcludeIPs(excludeIPs)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(excluded).To(gomega.HaveLen(len(expCIDRs)))
+			for i, cidr := range expCIDRs {
+				gomega.Expect(excluded[i].String()).To(gomega.Equal(cidr))
+			}
+		},
+			table.Entry("without exclusions", "", []string{}),
+			table.Entry("for single IPs", "10.1.1.2 10.1.1.200", []string{"10.1.1.2/32", "10.1.1.200/32"}),
+			table.Entry("for an aligned range", "10.1.1.16..10.1.1.31", []string{"10.1.1.16/28"}),
+			table.Entry("for an unaligned range", "10.1.1.2..10.1.1.8",
+				[]string{"10.1.1.2/31", "10.1.1.4/30", "10.1.1.8/32"}),
+			table.Entry("for a single IP range", "10.1.1.3..10.1.1.3", []string{"10.1.1.3/32"}),
+			table.Entry("for IPv6", "fd00::2..fd00::3 fd00::10", []string{"fd00::2/127", "fd00::10/128"}),
+		)
+
+		table.DescribeTable("rejects invalid exclude_ips", func(excludeIPs string) {
+			fakeOvn.start()
+			_, err := parseExcludeIPs(excludeIPs)
+			gomega.Expect(err).To(gomega.HaveOccurred())
+		},
+			table.Entry("with an invalid IP", "10.1.1.2 10.1.1.300"),
+			table.Entry("with a reversed range", "10.1.1.8..10.1.1.2"),
+			table.Entry("with a range mixing IP families", "10.1.1.2..fd00::2"),
+		)
+
+		ginkgo.It("returns the excluded IPs of the node switch", func() {
+			startController(newNode(map[string]string{"k8s.ovn.org/node-exclude-subnets": "10.1.1.16/28"}))
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet), "")).Error().To(gomega.Succeed())
+
+			excluded, err := fakeOvn.controller.NodeExcludedIPs(nodeName)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(excluded).To(gomega.Equal([]net.IPNet{
+				*ovntest.MustParseIPNet("10.1.1.2/32"),
+				*ovntest.MustParseIPNet("10.1.1.16/28"),
+			}))
+		})
+
+		ginkgo.It("fails for a node without a switch", func() {
+			startController()
+			_, err := fakeOvn.controller.NodeExcludedIPs(nodeName)
+			gomega.Expect(errors.Is(err, libovsdbclient.ErrNotFound)).To(gomega.BeTrue())
+		})
+	})
+
+	ginkgo.Context("when checking whether a node logical network is ready", func() {
+		var node *v1.Node
+
+		ginkgo.BeforeEach(func() {
+			node = newNode(map[string]string{
+				"k8s.ovn.org/node-subnets":    `{"default":"` + nodeSubnet + `"}`,
+				"k8s.ovn.org/node-chassis-id": chassisID,
+			})
+		})
+
+		expectNotReady := func(detail string) {
+			ready, err := fakeOvn.controller.NodeLogicalNetworkReady(nodeName)
+			gomega.Expect(ready).To(gomega.BeFalse())
+			gomega.Expect(errors.Is(err, ErrNodeLogicalNetworkNotReady)).To(gomega.BeTrue())
+			gomega.Expect(err.Error()).To(gomega.ContainSubstring(detail))
+		}
+
+		ginkgo.It("reports a fully provisioned node ready", func() {
+			startController(node)
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet), "")).Error().To(gomega.Succeed())
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, nil)).To(gomega.Succeed())
+
+			ready, err := fakeOvn.controller.NodeLogicalNetworkReady(nodeName)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(ready).To(gomega.BeTrue())
+		})
+
+		ginkgo.It("reports a node without a logical switch not ready", func() {
+			startController(node)
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, nil)).To(gomega.Succeed())
+			expectNotReady("logical switch " + nodeName + " not found")
+		})
+
+		ginkgo.It("reports a node whose logical switch has other subnets not ready", func() {
+			startController(node)
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets("10.1.2.0/24"), "")).Error().To(gomega.Succeed())
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, nil)).To(gomega.Succeed())
+			expectNotReady(`has subnet "10.1.2.0/24" instead of "` + nodeSubnet + `"`)
+		})
+
+		ginkgo.It("reports a node without a router port not ready", func() {
+			startController(node)
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet), "")).Error().To(gomega.Succeed())
+			expectNotReady("logical router port " + types.RouterToSwitchPrefix + nodeName + " not found")
+		})
+
+		ginkgo.It("reports a node whose router port is pinned to another chassis not ready", func() {
+			startController(node)
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet), "")).Error().To(gomega.Succeed())
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, nil)).To(gomega.Succeed())
+
+			// the node moved to a new chassis that its router port was not synced to yet
+			const newChassisID = "d3b6e9a4-7c51-4f0e-8a2b-5e1f3c9d7a60"
+			node.Annotations["k8s.ovn.org/node-chassis-id"] = newChassisID
+			_, err := fakeOvn.fakeClient.KubeClient.CoreV1().Nodes().Update(context.TODO(), node, metav1.UpdateOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Eventually(func() (string, error) {
+				updated, err := fakeOvn.watcher.GetNode(nodeName)
+				if err != nil {
+					return "", err
+				}
+				return util.ParseNodeChassisIDAnnotation(updated)
+			}).Should(gomega.Equal(newChassisID))
+			expectNotReady("is not pinned to chassis " + newChassisID)
+		})
+	})
+
+	ginkgo.Context("when creating the node switch ports", func() {
+		const mgmtMAC = "0a:58:0a:01:01:02"
+
+		createNodePorts := func() (*nbdb.LogicalSwitchPort, *nbdb.LogicalSwitchPort) {
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets":               `{"default":"` + nodeSubnet + `"}`,
+				"k8s.ovn.org/node-mgmt-port-mac-address": mgmtMAC,
+			})
+			startController(node)
+			hostSubnets := ovntest.MustParseIPNets(nodeSubnet)
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName, hostSubnets, "")).Error().To(gomega.Succeed())
+			gomega.Expect(fakeOvn.controller.syncNodeManagementPort(node, hostSubnets)).To(gomega.Succeed())
+
+			rtrPort, err := libovsdbops.GetLogicalSwitchPort(fakeOvn.nbClient,
+				&nbdb.LogicalSwitchPort{Name: types.SwitchToRouterPrefix + nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			mgmtPort, err := libovsdbops.GetLogicalSwitchPort(fakeOvn.nbClient,
+				&nbdb.LogicalSwitchPort{Name: types.K8sPrefix + nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			return rtrPort, mgmtPort
+		}
+
+		ginkgo.It("sets port security when enabled", func() {
+			config.Default.EnableNodePortSecurity = true
+			rtrPort, mgmtPort := createNodePorts()
+
+			gomega.Expect(rtrPort.Addresses).To(gomega.Equal([]string{"router"}))
+			gomega.Expect(rtrPort.PortSecurity).To(gomega.Equal([]string{"0a:58:0a:01:01:01 10.1.1.1"}))
+			gomega.Expect(mgmtPort.Addresses).To(gomega.Equal([]string{mgmtMAC + " 10.1.1.2"}))
+			gomega.Expect(mgmtPort.PortSecurity).To(gomega.Equal(mgmtPort.Addresses))
+		})
+
+		ginkgo.It("does not set port security by default", func() {
+			rtrPort, mgmtPort := createNodePorts()
+
+			gomega.Expect(rtrPort.Addresses).To(gomega.Equal([]string{"router"}))
+			gomega.Expect(rtrPort.PortSecurity).To(gomega.BeEmpty())
+			gomega.Expect(mgmtPort.PortSecurity).To(gomega.BeEmpty())
+		})
+
+		table.DescribeTable("validates port security addresses", func(address string, valid bool) {
+			fakeOvn.start()
+			portSecurity, err := getNodePortSecurity([]string{address})
+			if valid {
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				gomega.Expect(portSecurity).To(gomega.Equal([]string{address}))
+			} else {
+				gomega.Expect(err).To(gomega.HaveOccurred())
+			}
+		},
+			table.Entry("MAC and IPs", "0a:58:0a:01:01:01 10.1.1.1 fd00::1", true),
+			table.Entry("router", "router", false),
+			table.Entry("MAC only", "0a:58:0a:01:01:01", false),
+			table.Entry("invalid MAC", "0a:58:0a:01:01 10.1.1.1", false),
+			table.Entry("invalid IP", "0a:58:0a:01:01:01 10.1.1", false),
+		)
+	})
+
+	ginkgo.Context("when deriving the node router port MAC", func() {
+		const nodeIPv6Subnet = "fd00:10:244:1::/64"
+
+		table.DescribeTable("prefers the IPv4 gateway IP", func(hostSubnets []string, expected string) {
+			fakeOvn.start()
+			gomega.Expect(nodeRouterPortMAC(ovntest.MustParseIPNets(hostSubnets...)).String()).To(gomega.Equal(expected))
+		},
+			table.Entry("IPv4", []string{nodeSubnet}, "0a:58:0a:01:01:01"),
+			table.Entry("dual-stack", []string{nodeSubnet, nodeIPv6Subnet}, "0a:58:0a:01:01:01"),
+			table.Entry("dual-stack listing IPv6 first", []string{nodeIPv6Subnet, nodeSubnet}, "0a:58:0a:01:01:01"),
+		)
+
+		ginkgo.It("derives a stable unicast MAC from the IPv6 gateway IP of an IPv6-only node", func() {
+			fakeOvn.start()
+			mac := nodeRouterPortMAC(ovntest.MustParseIPNets(nodeIPv6Subnet))
+			gomega.Expect(mac).To(gomega.HaveLen(6))
+			gomega.Expect(mac).To(gomega.Equal(util.IPAddrToHWAddr(ovntest.MustParseIP("fd00:10:244:1::1"))))
+			gomega.Expect(nodeRouterPortMAC(ovntest.MustParseIPNets(nodeIPv6Subnet))).To(gomega.Equal(mac))
+			// locally administered unicast
+			gomega.Expect(mac[0] & 0x01).To(gomega.BeZero())
+			gomega.Expect(mac[0] & 0x02).NotTo(gomega.BeZero())
+			gomega.Expect(nodeRouterPortMAC(nil)).To(gomega.BeNil())
+		})
+
+		ginkgo.It("uses the same MAC on the switch and the router port of an IPv6-only node", func() {
+			config.IPv4Mode = false
+			config.IPv6Mode = true
+			config.Default.EnableNodePortSecurity = true
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets":    `{"default":"` + nodeIPv6Subnet + `"}`,
+				"k8s.ovn.org/node-chassis-id": chassisID,
+			})
+			startController(node)
+			fakeOvn.controller.multicastSupport = true
+			hostSubnets := ovntest.MustParseIPNets(nodeIPv6Subnet)
+			ls, err := fakeOvn.controller.createNodeLogicalSwitch(nodeName, hostSubnets, "")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, hostSubnets)).To(gomega.Succeed())
+
+			mac := nodeRouterPortMAC(hostSubnets).String()
+			lrp, err := libovsdbops.GetLogicalRouterPort(fakeOvn.nbClient,
+				&nbdb.LogicalRouterPort{Name: types.RouterToSwitchPrefix + nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(lrp.MAC).To(gomega.Equal(mac))
+			gomega.Expect(lrp.Networks).To(gomega.ConsistOf("fd00:10:244:1::1/64"))
+			rtrPort, err := libovsdbops.GetLogicalSwitchPort(fakeOvn.nbClient,
+				&nbdb.LogicalSwitchPort{Name: types.SwitchToRouterPrefix + nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(rtrPort.Addresses).To(gomega.Equal([]string{"router"}))
+			gomega.Expect(rtrPort.PortSecurity).To(gomega.Equal([]string{mac + " fd00:10:244:1::1"}))
+			gomega.Expect(ls.OtherConfig).To(gomega.HaveKeyWithValue("mcast_eth_src", mac))
+		})
+		ginkgo.It("annotates the node with the MAC of its router port", func() {
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets":    `{"default":"` + nodeSubnet + `"}`,
+				"k8s.ovn.org/node-chassis-id": chassisID,
+			})
+			startController(node)
+			lrpMACAnnotation := func() string {
+				node, err := fakeOvn.fakeClient.KubeClient.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				mac, err := util.ParseNodeLRPMACAnnotation(node)
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				return mac.String()
+			}
+			lrpMAC := func() string {
+				lrp, err := libovsdbops.GetLogicalRouterPort(fakeOvn.nbClient,
+					&nbdb.LogicalRouterPort{Name: types.RouterToSwitchPrefix + nodeName})
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				return lrp.MAC
+			}
+
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, ovntest.MustParseIPNets(nodeSubnet))).To(gomega.Succeed())
+			gomega.Expect(lrpMACAnnotation()).To(gomega.Equal(lrpMAC()))
+			gomega.Expect(lrpMACAnnotation()).To(gomega.Equal(nodeRouterPortMAC(ovntest.MustParseIPNets(nodeSubnet)).String()))
+
+			// the annotation follows the router port when the node subnets change
+			newSubnets := ovntest.MustParseIPNets("10.1.2.0/24")
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, newSubnets)).To(gomega.Succeed())
+			gomega.Expect(lrpMACAnnotation()).To(gomega.Equal(lrpMAC()))
+			gomega.Expect(lrpMACAnnotation()).To(gomega.Equal(nodeRouterPortMAC(newSubnets).String()))
+		})
+
+		ginkgo.It("doesn't update a node already annotated with the MAC of its router port", func() {
+			hostSubnets := ovntest.MustParseIPNets(nodeSubnet)
+			startController()
+			// the node isn't known to the API server, so any update would fail
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-chassis-id": chassisID,
+				"k8s.ovn.org/node-lrp-mac":    nodeRouterPortMAC(hostSubnets).String(),
+			})
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, hostSubnets)).To(gomega.Succeed())
+
+			node.Annotations["k8s.ovn.org/node-lrp-mac"] = "0a:58:00:00:00:01"
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, hostSubnets)).
+				To(gomega.MatchError(gomega.ContainSubstring("router port MAC")))
+		})
+	})
+
+	ginkgo.Context("when computing the node management IPs", func() {
+		table.DescribeTable("derives them from the host subnets", func(hostSubnets []string, expected []string) {
+			fakeOvn.start()
+			mgmtIPs := NodeManagementIPs(ovntest.MustParseIPNets(hostSubnets...))
+			gomega.Expect(mgmtIPs).To(gomega.HaveLen(len(expected)))
+			for i := range expected {
+				gomega.Expect(mgmtIPs[i].String()).To(gomega.Equal(expected[i]))
+			}
+		},
+			table.Entry("IPv4", []string{nodeSubnet}, []string{"10.1.1.2"}),
+			table.Entry("IPv6", []string{"fd00:10:244:1::/64"}, []string{"fd00:10:244:1::2"}),
+			table.Entry("dual-stack", []string{nodeSubnet, "fd00:10:244:1::/64"}, []string{"10.1.1.2", "fd00:10:244:1::2"}),
+		)
+
+		ginkgo.It("derives them from the node switch subnets", func() {
+			startController()
+			_, err := fakeOvn.controller.GetNodeManagementIPs(nodeName)
+			gomega.Expect(err).To(gomega.HaveOccurred())
+
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet), "")).Error().To(gomega.Succeed())
+			mgmtIPs, err := fakeOvn.controller.GetNodeManagementIPs(nodeName)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(mgmtIPs).To(gomega.HaveLen(1))
+			gomega.Expect(mgmtIPs[0].String()).To(gomega.Equal("10.1.1.2"))
+
+			// the management IP is excluded from the addresses of the switch
+			ls, err := libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(ls.OtherConfig).To(gomega.HaveKeyWithValue("exclude_ips", "10.1.1.2"))
+		})
+	})
+
+	ginkgo.Context("with hybrid overlay enabled", func() {
+		const nodeIPv6Subnet = "fd00:10:244:1::/64"
+
+		ginkgo.BeforeEach(func() {
+			config.HybridOverlay.Enabled = true
+		})
+
+		ginkgo.It("excludes the IPv4 hybrid overlay address from the switch", func() {
+			startController()
+
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet), "")).Error().To(gomega.Succeed())
+			ls, err := libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(ls.OtherConfig).To(gomega.HaveKeyWithValue("exclude_ips", "10.1.1.2..10.1.1.3"))
+
+			// the address is left for the hybrid overlay distributed router IP
+			gomega.Expect(fakeOvn.controller.lsManager.AllocateIPs(nodeName,
+				ovntest.MustParseIPNets("10.1.1.3/32"))).To(gomega.Succeed())
+		})
+
+		ginkgo.It("reserves the hybrid overlay addresses of both families in dual-stack", func() {
+			config.IPv4Mode = true
+			config.IPv6Mode = true
+			startController()
+
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet, nodeIPv6Subnet), "")).Error().To(gomega.Succeed())
+			ls, err := libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(ls.OtherConfig).To(gomega.HaveKeyWithValue("exclude_ips", "10.1.1.2..10.1.1.3"))
+			gomega.Expect(ls.OtherConfig).To(gomega.HaveKeyWithValue("ipv6_prefix", "fd00:10:244:1::"))
+
+			// OVN does not exclude IPv6 addresses, so the switch IPAM holds it instead
+			err = fakeOvn.controller.lsManager.AllocateIPs(nodeName, ovntest.MustParseIPNets("fd00:10:244:1::3/128"))
+			gomega.Expect(err).To(gomega.Equal(ipallocator.ErrAllocated))
+
+			// and keeps holding it when the switch is synced again
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet, nodeIPv6Subnet), "")).Error().To(gomega.Succeed())
+			err = fakeOvn.controller.lsManager.AllocateIPs(nodeName, ovntest.MustParseIPNets("fd00:10:244:1::3/128"))
+			gomega.Expect(err).To(gomega.Equal(ipallocator.ErrAllocated))
+		})
+
+		ginkgo.It("does not reserve anything when disabled", func() {
+			config.HybridOverlay.Enabled = false
+			config.IPv4Mode = true
+			config.IPv6Mode = true
+			startController()
+
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet, nodeIPv6Subnet), "")).Error().To(gomega.Succeed())
+			ls, err := libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(ls.OtherConfig).To(gomega.HaveKeyWithValue("exclude_ips", "10.1.1.2"))
+			gomega.Expect(fakeOvn.controller.lsManager.AllocateIPs(nodeName,
+				ovntest.MustParseIPNets("fd00:10:244:1::3/128"))).To(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Context("with a custom node switch naming function", func() {
+		const switchName = "net1_" + nodeName
+
+		ginkgo.It("names node switches after their node by default", func() {
+			fakeOvn.start()
+			gomega.Expect(fakeOvn.controller.getNodeSwitchName(nodeName)).To(gomega.Equal(nodeName))
+		})
+
+		ginkgo.It("uses the custom switch name across the node lifecycle", func() {
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets":    `{"default":"` + nodeSubnet + `"}`,
+				"k8s.ovn.org/node-chassis-id": chassisID,
+			})
+			startController(node)
+			fakeOvn.controller.nodeSwitchName = func(nodeName string) string {
+				return "net1_" + nodeName
+			}
+
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet), "")).Error().To(gomega.Succeed())
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, nil)).To(gomega.Succeed())
+
+			_, err := libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: switchName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			_, err = libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: nodeName})
+			gomega.Expect(errors.Is(err, libovsdbclient.ErrNotFound)).To(gomega.BeTrue())
+			_, err = libovsdbops.GetLogicalRouterPort(fakeOvn.nbClient,
+				&nbdb.LogicalRouterPort{Name: types.RouterToSwitchPrefix + switchName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(fakeOvn.controller.lsManager.GetSwitchSubnets(switchName)).To(gomega.HaveLen(1))
+			gomega.Expect(fakeOvn.controller.lsManager.GetSwitchSubnets(nodeName)).To(gomega.BeEmpty())
+
+			mgmtIPs, err := fakeOvn.controller.GetNodeManagementIPs(nodeName)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(mgmtIPs).To(gomega.HaveLen(1))
+			ready, err := fakeOvn.controller.NodeLogicalNetworkReady(nodeName)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(ready).To(gomega.BeTrue())
+
+			gomega.Expect(fakeOvn.controller.deleteNodeLogicalNetwork(nodeName)).To(gomega.Succeed())
+			_, err = libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: switchName})
+			gomega.Expect(errors.Is(err, libovsdbclient.ErrNotFound)).To(gomega.BeTrue())
+			_, err = libovsdbops.GetLogicalRouterPort(fakeOvn.nbClient,
+				&nbdb.LogicalRouterPort{Name: types.RouterToSwitchPrefix + switchName})
+			gomega.Expect(errors.Is(err, libovsdbclient.ErrNotFound)).To(gomega.BeTrue())
+		})
+		ginkgo.It("only deletes the switches of nodes that are gone at startup", func() {
+			const staleSubnet = "10.1.2.0/24"
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets":    `{"default":"` + nodeSubnet + `"}`,
+				"k8s.ovn.org/node-chassis-id": chassisID,
+			})
+			// the gateway router of the deleted node is cleaned up as well
+			dbSetup.NBData = append(dbSetup.NBData,
+				&nbdb.LogicalRouterPort{
+					UUID:     "rtoj-GR_node2-UUID",
+					Name:     types.GWRouterToJoinSwitchPrefix + types.GWRouterPrefix + "node2",
+					Networks: []string{"100.64.0.3/16"},
+				},
+				&nbdb.LogicalRouter{
+					UUID:  types.GWRouterPrefix + "node2-UUID",
+					Name:  types.GWRouterPrefix + "node2",
+					Ports: []string{"rtoj-GR_node2-UUID"},
+				},
+			)
+			startController(node)
+			fakeOvn.controller.nodeSwitchName = func(nodeName string) string {
+				return "net1_" + nodeName
+			}
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet), "")).Error().To(gomega.Succeed())
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch("node2",
+				ovntest.MustParseIPNets(staleSubnet), "")).Error().To(gomega.Succeed())
+			gomega.Expect(fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated("node2",
+				ovntest.MustParseIPNet(staleSubnet))).To(gomega.Succeed())
+			// a switch that can't be told to belong to a node is left alone
+			gomega.Expect(libovsdbops.CreateOrUpdateLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{
+				Name:        "other",
+				OtherConfig: map[string]string{"subnet": "10.1.3.0/24"},
+			})).To(gomega.Succeed())
+
+			gomega.Expect(fakeOvn.controller.syncNodes([]interface{}{node})).To(gomega.Succeed())
+
+			_, err := libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: switchName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			owner, ok := fakeOvn.controller.masterSubnetAllocator.SubnetOwner(ovntest.MustParseIPNet(nodeSubnet))
+			gomega.Expect(ok).To(gomega.BeTrue())
+			gomega.Expect(owner).To(gomega.Equal(nodeName))
+			_, err = libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: "net1_node2"})
+			gomega.Expect(errors.Is(err, libovsdbclient.ErrNotFound)).To(gomega.BeTrue())
+			_, ok = fakeOvn.controller.masterSubnetAllocator.SubnetOwner(ovntest.MustParseIPNet(staleSubnet))
+			gomega.Expect(ok).To(gomega.BeFalse())
+			_, err = libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: "other"})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+	})
+
+	ginkgo.Context("in management port only mode", func() {
+		const mgmtMAC = "0a:58:0a:01:01:02"
+
+		var expectManagementOnlySwitch = func(switchName string) {
+			ls, err := libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: switchName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(ls.OtherConfig).To(gomega.BeEmpty())
+			gomega.Expect(ls.LoadBalancerGroup).To(gomega.BeEmpty())
+			gomega.Expect(ls.Ports).To(gomega.HaveLen(1))
+			lsp, err := libovsdbops.GetLogicalSwitchPort(fakeOvn.nbClient, &nbdb.LogicalSwitchPort{UUID: ls.Ports[0]})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(lsp.Name).To(gomega.Equal(types.K8sPrefix + switchName))
+			gomega.Expect(lsp.Addresses).To(gomega.ConsistOf(mgmtMAC + " 10.1.1.2"))
+
+			// the switch is not connected to the cluster router
+			_, err = libovsdbops.GetLogicalRouterPort(fakeOvn.nbClient,
+				&nbdb.LogicalRouterPort{Name: types.RouterToSwitchPrefix + switchName})
+			gomega.Expect(errors.Is(err, libovsdbclient.ErrNotFound)).To(gomega.BeTrue())
+		}
+
+		ginkgo.It("only creates the node switch with its management port", func() {
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets":               `{"default":"` + nodeSubnet + `"}`,
+				"k8s.ovn.org/node-chassis-id":            chassisID,
+				"k8s.ovn.org/node-mgmt-port-mac-address": mgmtMAC,
+			})
+			config.Default.ManagementPortOnly = true
+			startController(node)
+			gomega.Expect(fakeOvn.controller.managementPortOnly).To(gomega.BeTrue())
+
+			// the node has no gateway config, its gateway is not synced
+			err := fakeOvn.controller.addUpdateNodeEvent(node,
+				&nodeSyncs{syncNode: true, syncClusterRouterPort: true, syncMgmtPort: true, syncGw: true})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			expectManagementOnlySwitch(nodeName)
+			gomega.Expect(fakeOvn.controller.lsManager.GetSwitchSubnets(nodeName)).To(gomega.HaveLen(1))
+			_, err = libovsdbops.GetLogicalRouter(fakeOvn.nbClient,
+				&nbdb.LogicalRouter{Name: types.GWRouterPrefix + nodeName})
+			gomega.Expect(errors.Is(err, libovsdbclient.ErrNotFound)).To(gomega.BeTrue())
+		})
+
+		ginkgo.It("names the management port after the node switch", func() {
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets":               `{"default":"` + nodeSubnet + `"}`,
+				"k8s.ovn.org/node-mgmt-port-mac-address": mgmtMAC,
+			})
+			startController(node)
+			fakeOvn.controller.managementPortOnly = true
+			fakeOvn.controller.nodeSwitchName = func(nodeName string) string {
+				return "net1_" + nodeName
+			}
+
+			steps := fakeOvn.controller.getNodeAddSteps("")
+			gomega.Expect(steps.syncRouterPort).To(gomega.BeNil())
+			hostSubnets := ovntest.MustParseIPNets(nodeSubnet)
+			gomega.Expect(steps.ensureSwitch(node, hostSubnets)).To(gomega.Succeed())
+			gomega.Expect(steps.syncMgmtPort(node, hostSubnets)).To(gomega.Succeed())
+			expectManagementOnlySwitch("net1_" + nodeName)
+		})
+
+		ginkgo.It("connects node switches to the cluster router otherwise", func() {
+			fakeOvn.start()
+			steps := fakeOvn.controller.getNodeAddSteps("")
+			gomega.Expect(steps.ensureSwitch).NotTo(gomega.BeNil())
+			gomega.Expect(steps.syncRouterPort).NotTo(gomega.BeNil())
+			gomega.Expect(steps.syncMgmtPort).To(gomega.BeNil())
+		})
+	})
+
+	ginkgo.Context("when pods look up their node logical switch", func() {
+		ginkgo.It("fails fast while the node switch does not exist", func() {
+			config.Kubernetes.PodNodeSwitchWaitTimeout = 30
+			startController(newNode(nil))
+
+			start := time.Now()
+			_, err := fakeOvn.controller.waitForNodeLogicalSwitch(nodeName, nodeName)
+			gomega.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("switch not in logical switch cache")))
+			// the pod is left to the retry framework instead of blocking a worker
+			gomega.Expect(time.Since(start)).To(gomega.BeNumerically("<", time.Second))
+		})
+
+		ginkgo.It("returns the node switch once it is created", func() {
+			startController(newNode(nil))
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet), "")).Error().To(gomega.Succeed())
+
+			ls, err := fakeOvn.controller.waitForNodeLogicalSwitch(nodeName, nodeName)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			nbLS, err := libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(ls.UUID).To(gomega.Equal(nbLS.UUID))
+		})
+
+		ginkgo.It("waits for the node switch while the node is being handled", func() {
+			config.Kubernetes.PodNodeSwitchWaitTimeout = 30
+			startController(newNode(nil))
+			done := fakeOvn.controller.trackNodeHandler(nodeName)
+			defer done()
+
+			type result struct {
+				ls  *nbdb.LogicalSwitch
+				err error
+			}
+			waited := make(chan result, 1)
+			go func() {
+				ls, err := fakeOvn.controller.waitForNodeLogicalSwitch(nodeName, nodeName)
+				waited <- result{ls, err}
+			}()
+			gomega.Consistently(waited, "200ms").ShouldNot(gomega.Receive())
+
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet), "")).Error().To(gomega.Succeed())
+			var r result
+			gomega.Eventually(waited).Should(gomega.Receive(&r))
+			gomega.Expect(r.err).NotTo(gomega.HaveOccurred())
+			nbLS, err := libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(r.ls.UUID).To(gomega.Equal(nbLS.UUID))
+		})
+
+		ginkgo.It("gives up waiting for the node switch once the timeout expires", func() {
+			config.Kubernetes.PodNodeSwitchWaitTimeout = 1
+			startController(newNode(nil))
+			done := fakeOvn.controller.trackNodeHandler(nodeName)
+			defer done()
+
+			start := time.Now()
+			_, err := fakeOvn.controller.waitForNodeLogicalSwitch(nodeName, nodeName)
+			gomega.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("timed out waiting for logical switch")))
+			gomega.Expect(time.Since(start)).To(gomega.BeNumerically(">=", time.Second))
+		})
+	})
+
+	ginkgo.Context("when queuing the pods of an added node", func() {
+		newPod := func(name string, labels map[string]string) *v1.Pod {
+			return &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "namespace1", Labels: labels},
+				Spec:       v1.PodSpec{NodeName: nodeName},
+			}
+		}
+
+		// addAllPods starts the controller with the given pods and returns the keys of
+		// the pods addAllPodsOnNode queued, and the field selector they were listed with
+		addAllPods := func(setup func(), pods ...*v1.Pod) ([]string, string) {
+			podList := &v1.PodList{}
+			for _, pod := range pods {
+				podList.Items = append(podList.Items, *pod)
+			}
+			fakeOvn.startWithDBSetup(dbSetup, &v1.NodeList{Items: []v1.Node{*newNode(nil)}}, podList)
+			setup()
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet), "")).Error().To(gomega.Succeed())
+
+			var fieldSelector string
+			fakeOvn.fakeClient.KubeClient.(*fake.Clientset).PrependReactor("list", "pods",
+				func(action k8stesting.Action) (bool, runtime.Object, error) {
+					fieldSelector = action.(k8stesting.ListAction).GetListRestrictions().Fields.String()
+					return false, nil, nil
+				})
+			gomega.Expect(fakeOvn.controller.addAllPodsOnNode(nodeName)).To(gomega.BeEmpty())
+
+			var keys []string
+			for _, state := range fakeOvn.controller.retryPods.GetBackoffStates() {
+				keys = append(keys, state.Key)
+			}
+			return keys, fieldSelector
+		}
+
+		ginkgo.It("queues all the pods of the node by default", func() {
+			keys, fieldSelector := addAllPods(func() {},
+				newPod("pod1", nil), newPod("pod2", map[string]string{"network": "blue"}))
+			gomega.Expect(keys).To(gomega.ConsistOf("namespace1/pod1", "namespace1/pod2"))
+			gomega.Expect(fieldSelector).To(gomega.Equal("spec.nodeName=" + nodeName))
+		})
+
+		ginkgo.It("only queues the pods matching the pod selectors of the controller", func() {
+			keys, fieldSelector := addAllPods(func() {
+				fakeOvn.controller.nodePodLabelSelector = labels.SelectorFromSet(labels.Set{"network": "blue"})
+				fakeOvn.controller.nodePodFieldSelector = fields.OneTermNotEqualSelector("status.phase", "Pending")
+			}, newPod("pod1", nil), newPod("pod2", map[string]string{"network": "blue"}),
+				newPod("pod3", map[string]string{"network": "red"}))
+			gomega.Expect(keys).To(gomega.ConsistOf("namespace1/pod2"))
+			gomega.Expect(fieldSelector).To(gomega.Equal("spec.nodeName=" + nodeName + ",status.phase!=Pending"))
+		})
+	})
+
+	ginkgo.Context("when reconciling the cluster router port group", func() {
+		const otherNodeName = "node2"
+
+		createNodeSwitches := func() []string {
+			var portUUIDs []string
+			for name, subnet := range map[string]string{nodeName: nodeSubnet, otherNodeName: "10.1.2.0/24"} {
+				gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(name,
+					ovntest.MustParseIPNets(subnet), "")).Error().To(gomega.Succeed())
+				lsp, err := libovsdbops.GetLogicalSwitchPort(fakeOvn.nbClient,
+					&nbdb.LogicalSwitchPort{Name: types.SwitchToRouterPrefix + name})
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				portUUIDs = append(portUUIDs, lsp.UUID)
+			}
+			return portUUIDs
+		}
+
+		getMembers := func() []string {
+			pg, err := libovsdbops.GetPortGroup(fakeOvn.nbClient, &nbdb.PortGroup{Name: types.ClusterRtrPortGroupName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			return pg.Ports
+		}
+
+		ginkgo.It("adds the node router ports once multicast is enabled", func() {
+			startController()
+			fakeOvn.controller.multicastSupport = false
+			portUUIDs := createNodeSwitches()
+			gomega.Expect(getMembers()).To(gomega.BeEmpty())
+
+			fakeOvn.controller.multicastSupport = true
+			gomega.Expect(fakeOvn.controller.reconcileClusterRouterPortGroup()).To(gomega.Succeed())
+			gomega.Expect(getMembers()).To(gomega.ConsistOf(portUUIDs))
+		})
+
+		ginkgo.It("removes the node router ports once multicast is disabled", func() {
+			startController()
+			fakeOvn.controller.multicastSupport = true
+			portUUIDs := createNodeSwitches()
+			gomega.Expect(getMembers()).To(gomega.ConsistOf(portUUIDs))
+
+			fakeOvn.controller.multicastSupport = false
+			gomega.Expect(fakeOvn.controller.reconcileClusterRouterPortGroup()).To(gomega.Succeed())
+			gomega.Expect(getMembers()).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("restores a node router port removed out-of-band", func() {
+			startController()
+			fakeOvn.controller.multicastSupport = true
+			portUUIDs := createNodeSwitches()
+			gomega.Expect(libovsdbops.DeletePortsFromPortGroup(fakeOvn.nbClient,
+				types.ClusterRtrPortGroupName, portUUIDs[0])).To(gomega.Succeed())
+
+			gomega.Expect(fakeOvn.controller.reconcileClusterRouterPortGroup()).To(gomega.Succeed())
+			gomega.Expect(getMembers()).To(gomega.ConsistOf(portUUIDs))
+
+			// nothing changes once the membership is right
+			recorder := libovsdbtest.NewChangeRecorder(fakeOvn.nbClient)
+			fakeOvn.controller.nbClient = recorder
+			gomega.Expect(fakeOvn.controller.reconcileClusterRouterPortGroup()).To(gomega.Succeed())
+			gomega.Expect(recorder.Changes()).To(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.Context("with a node subnet exclusion annotation", func() {
+		table.DescribeTable("converts CIDR exclusions to exclude_ips ranges", func(exclusions string, expRanges []string, expErrs int) {
+			fakeOvn.start()
+			excludeRanges, errs := subnetExclusionRanges(ovntest.MustParseIPNet(nodeSubnet),
+				ovntest.MustParseIPNets(strings.Split(exclusions, ",")...))
+			gomega.Expect(excludeRanges).To(gomega.Equal(expRanges))
+			gomega.Expect(errs).To(gomega.HaveLen(expErrs))
+		},
+			table.Entry("for a range", "10.1.1.16/28", []string{"10.1.1.16..10.1.1.31"}, 0),
+			table.Entry("for a single IP", "10.1.1.200/32", []string{"10.1.1.200"}, 0),
+			table.Entry("ignoring IPv6 exclusions", "10.1.1.16/28,fd00:10:244:2::/120", []string{"10.1.1.16..10.1.1.31"}, 0),
+			table.Entry("rejecting exclusions outside the host subnet", "10.1.2.0/28,10.1.0.0/16", nil, 2),
+			table.Entry("rejecting exclusions covering the gateway", "10.1.1.0/28,10.1.1.1/32,10.1.1.64/26",
+				[]string{"10.1.1.64..10.1.1.127"}, 2),
+		)
+
+		createSwitch := func(annotation string) string {
+			startController(newNode(map[string]string{"k8s.ovn.org/node-exclude-subnets": annotation}))
+			ls, err := fakeOvn.controller.createNodeLogicalSwitch(nodeName, ovntest.MustParseIPNets(nodeSubnet), "")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			return ls.OtherConfig["exclude_ips"]
+		}
+
+		ginkgo.It("merges the exclusions with the management port IP", func() {
+			gomega.Expect(createSwitch("10.1.1.16/28, 10.1.1.200/32")).To(
+				gomega.Equal("10.1.1.2 10.1.1.16..10.1.1.31 10.1.1.200"))
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.ContainSubstring("NodeLogicalSwitchCreated")))
+			gomega.Consistently(fakeOvn.fakeRecorder.Events).ShouldNot(gomega.Receive())
+		})
+
+		ginkgo.It("ignores invalid exclusions with an event", func() {
+			gomega.Expect(createSwitch("10.1.1.16/28,10.1.2.0/24")).To(gomega.Equal("10.1.1.2 10.1.1.16..10.1.1.31"))
+			gomega.Eventually(fakeOvn.fakeRecorder.Events).Should(gomega.Receive(gomega.And(
+				gomega.ContainSubstring("InvalidSubnetExclusion"), gomega.ContainSubstring("10.1.2.0/24"))))
+		})
+
+		ginkgo.It("ignores an unparsable annotation with an event", func() {
+			gomega.Expect(createSwitch("10.1.1.16/28,bogus")).To(gomega.Equal("10.1.1.2"))
+			gomega.Eventually(fakeOvn.fakeRecorder.Events).Should(gomega.Receive(
+				gomega.ContainSubstring("InvalidSubnetExclusion")))
+		})
+
+		table.DescribeTable("converts exclusions to the IPs to reserve", func(hostSubnet, exclusions string, expIPs []string, expErrs int) {
+			fakeOvn.start()
+			excludeIPs, errs := subnetExclusionIPs(ovntest.MustParseIPNet(hostSubnet),
+				ovntest.MustParseIPNets(strings.Split(exclusions, ",")...))
+			var ips []string
+			for _, excludeIP := range excludeIPs {
+				ips = append(ips, excludeIP.String())
+			}
+			gomega.Expect(ips).To(gomega.Equal(expIPs))
+			gomega.Expect(errs).To(gomega.HaveLen(expErrs))
+		},
+			table.Entry("for an IPv4 range", nodeSubnet, "10.1.1.16/30",
+				[]string{"10.1.1.16/32", "10.1.1.17/32", "10.1.1.18/32", "10.1.1.19/32"}, 0),
+			table.Entry("for an IPv6 range", "fd00:10:244:1::/64", "fd00:10:244:1::10/126",
+				[]string{"fd00:10:244:1::10/128", "fd00:10:244:1::11/128", "fd00:10:244:1::12/128", "fd00:10:244:1::13/128"}, 0),
+			table.Entry("for a single IP", "fd00:10:244:1::/64", "fd00:10:244:1::200/128", []string{"fd00:10:244:1::200/128"}, 0),
+			table.Entry("ignoring IPv4 exclusions", "fd00:10:244:1::/64", "10.1.1.16/28,fd00:10:244:1::200/128",
+				[]string{"fd00:10:244:1::200/128"}, 0),
+			table.Entry("ignoring IPv6 exclusions", nodeSubnet, "10.1.1.200/32,fd00:10:244:1::200/128", []string{"10.1.1.200/32"}, 0),
+			table.Entry("rejecting exclusions outside the host subnet", "fd00:10:244:1::/64",
+				"fd00:10:244:2::/120,fd00:10:244::/48", nil, 2),
+			table.Entry("rejecting exclusions covering the gateway", "fd00:10:244:1::/64",
+				"fd00:10:244:1::/120,fd00:10:244:1::1/128", nil, 2),
+			table.Entry("rejecting IPv6 exclusions that are too large", "fd00:10:244:1::/64", "fd00:10:244:1::1:0/112", nil, 1),
+		)
+
+		ginkgo.It("keeps the excluded IPv4 addresses from being assigned to pods", func() {
+			startController(newNode(map[string]string{"k8s.ovn.org/node-exclude-subnets": "10.1.1.16/28"}))
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet), "")).Error().To(gomega.Succeed())
+
+			for i := 16; i < 32; i++ {
+				gomega.Expect(fakeOvn.controller.lsManager.AllocateIPs(nodeName,
+					ovntest.MustParseIPNets(fmt.Sprintf("10.1.1.%d/32", i)))).To(gomega.Equal(ipallocator.ErrAllocated))
+			}
+			gomega.Expect(fakeOvn.controller.lsManager.AllocateIPs(nodeName,
+				ovntest.MustParseIPNets("10.1.1.32/32"))).To(gomega.Succeed())
+		})
+
+		ginkgo.It("keeps the reserved IPv6 addresses from being assigned to pods", func() {
+			config.IPv4Mode = false
+			config.IPv6Mode = true
+			startController(newNode(map[string]string{"k8s.ovn.org/node-exclude-subnets": "fd00:10:244:1::10/126"}))
+			ls, err := fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets("fd00:10:244:1::/120"), "")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(ls.OtherConfig).To(gomega.HaveKeyWithValue("ipv6_prefix", "fd00:10:244:1::"))
+			gomega.Expect(ls.OtherConfig).NotTo(gomega.HaveKey("exclude_ips"))
+
+			reserved := sets.NewString("fd00:10:244:1::1", "fd00:10:244:1::2", "fd00:10:244:1::10",
+				"fd00:10:244:1::11", "fd00:10:244:1::12", "fd00:10:244:1::13")
+			podIPs := sets.NewString()
+			for {
+				ips, err := fakeOvn.controller.lsManager.AllocateNextIPs(nodeName)
+				if err != nil {
+					break
+				}
+				gomega.Expect(ips).To(gomega.HaveLen(1))
+				podIPs.Insert(ips[0].IP.String())
+			}
+			gomega.Expect(podIPs.Len()).To(gomega.BeNumerically(">", 200))
+			gomega.Expect(podIPs.Intersection(reserved).List()).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("reserves the IPv6 exclusions next to the IPv4 exclude_ips in dual-stack", func() {
+			config.IPv4Mode = true
+			config.IPv6Mode = true
+			startController(newNode(map[string]string{
+				"k8s.ovn.org/node-exclude-subnets": "10.1.1.16/28,fd00:10:244:1::200/128"}))
+			ls, err := fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet, "fd00:10:244:1::/64"), "")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(ls.OtherConfig).To(gomega.HaveKeyWithValue("exclude_ips", "10.1.1.2 10.1.1.16..10.1.1.31"))
+			gomega.Expect(fakeOvn.controller.lsManager.AllocateIPs(nodeName,
+				ovntest.MustParseIPNets("fd00:10:244:1::200/128"))).To(gomega.Equal(ipallocator.ErrAllocated))
+
+			// and keeps them reserved when the switch is synced again
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet, "fd00:10:244:1::/64"), "")).Error().To(gomega.Succeed())
+			gomega.Expect(fakeOvn.controller.lsManager.AllocateIPs(nodeName,
+				ovntest.MustParseIPNets("fd00:10:244:1::200/128"))).To(gomega.Equal(ipallocator.ErrAllocated))
+			gomega.Expect(fakeOvn.controller.lsManager.AllocateIPs(nodeName,
+				ovntest.MustParseIPNets("fd00:10:244:1::201/128"))).To(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Context("when flooding unregistered multicast", func() {
+		createSwitch := func(multicastSupport bool) map[string]string {
+			startController(newNode(map[string]string{}))
+			fakeOvn.controller.multicastSupport = multicastSupport
+			ls, err := fakeOvn.controller.createNodeLogicalSwitch(nodeName, ovntest.MustParseIPNets(nodeSubnet), "")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			return ls.OtherConfig
+		}
+
+		ginkgo.BeforeEach(func() {
+			config.Default.MulticastFloodUnregistered = true
+		})
+
+		ginkgo.It("sets the flood option on the snooping node switches", func() {
+			otherConfig := createSwitch(true)
+			gomega.Expect(otherConfig).To(gomega.HaveKeyWithValue("mcast_snoop", "true"))
+			gomega.Expect(otherConfig).To(gomega.HaveKeyWithValue("mcast_flood_unregistered", "true"))
+		})
+
+		ginkgo.It("does not set the flood option without multicast support", func() {
+			otherConfig := createSwitch(false)
+			gomega.Expect(otherConfig).NotTo(gomega.HaveKey("mcast_snoop"))
+			gomega.Expect(otherConfig).NotTo(gomega.HaveKey("mcast_flood_unregistered"))
+		})
+
+		ginkgo.It("does not set the flood option when disabled", func() {
+			config.Default.MulticastFloodUnregistered = false
+			otherConfig := createSwitch(true)
+			gomega.Expect(otherConfig).To(gomega.HaveKeyWithValue("mcast_snoop", "true"))
+			gomega.Expect(otherConfig).NotTo(gomega.HaveKey("mcast_flood_unregistered"))
+		})
+	})
+
+	ginkgo.Context("with a node switch other-config annotation", func() {
+		createSwitch := func(annotation string) map[string]string {
+			startController(newNode(map[string]string{"k8s.ovn.org/node-switch-other-config": annotation}))
+			fakeOvn.controller.multicastSupport = false
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet), "")).Error().To(gomega.Succeed())
+			ls, err := libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			return ls.OtherConfig
+		}
+
+		ginkgo.It("merges the allowed entries into the switch config", func() {
+			otherConfig := createSwitch(`{"mcast_table_size":"4096","vlan-passthru":"true"}`)
+			gomega.Expect(otherConfig).To(gomega.Equal(map[string]string{
+				"subnet":           nodeSubnet,
+				"exclude_ips":      "10.1.1.2",
+				"mcast_table_size": "4096",
+				"vlan-passthru":    "true",
+			}))
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.ContainSubstring("NodeLogicalSwitchCreated")))
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("refuses to override managed keys or set keys that are not allowed", func() {
+			otherConfig := createSwitch(`{"subnet":"10.9.9.0/24","exclude_ips":"10.1.1.3","mcast_table_size":"4096","foo":"bar"}`)
+			gomega.Expect(otherConfig).To(gomega.Equal(map[string]string{
+				"subnet":           nodeSubnet,
+				"exclude_ips":      "10.1.1.2",
+				"mcast_table_size": "4096",
+			}))
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.And(
+				gomega.ContainSubstring("InvalidSwitchOtherConfig"),
+				gomega.ContainSubstring("exclude_ips (managed by ovn-kubernetes)"),
+				gomega.ContainSubstring("subnet (managed by ovn-kubernetes)"),
+				gomega.ContainSubstring("foo (not allowed)"),
+			)))
+		})
+
+		ginkgo.It("ignores an invalid annotation", func() {
+			otherConfig := createSwitch(`{"mcast_table_size":4096}`)
+			gomega.Expect(otherConfig).To(gomega.Equal(map[string]string{
+				"subnet":      nodeSubnet,
+				"exclude_ips": "10.1.1.2",
+			}))
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.ContainSubstring("InvalidSwitchOtherConfig")))
+		})
+	})
+
+	ginkgo.Context("when re-creating a node switch", func() {
+		table.DescribeTable("does not change the database", func(portSecurity, multicast, lbGroup bool) {
+			config.Default.EnableNodePortSecurity = portSecurity
+			startController()
+			fakeOvn.controller.multicastSupport = multicast
+			hostSubnets := ovntest.MustParseIPNets(nodeSubnet)
+			var lbGroupUUID string
+			if lbGroup {
+				group := &nbdb.LoadBalancerGroup{Name: types.ClusterLBGroupName}
+				gomega.Expect(libovsdbops.CreateOrUpdateLoadBalancerGroup(fakeOvn.nbClient, group)).To(gomega.Succeed())
+				lbGroupUUID = group.UUID
+			}
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName, hostSubnets, lbGroupUUID)).Error().To(gomega.Succeed())
+
+			recorder := libovsdbtest.NewChangeRecorder(fakeOvn.nbClient)
+			fakeOvn.controller.nbClient = recorder
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName, hostSubnets, lbGroupUUID)).Error().To(gomega.Succeed())
+			gomega.Expect(recorder.Changes()).To(gomega.BeEmpty())
+		},
+			table.Entry("by default", false, false, false),
+			table.Entry("with port security", true, false, false),
+			table.Entry("with multicast", false, true, false),
+			table.Entry("with a load balancer group", false, false, true),
+		)
+
+		ginkgo.It("detects a changed switch", func() {
+			startController()
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet), "")).Error().To(gomega.Succeed())
+
+			recorder := libovsdbtest.NewChangeRecorder(fakeOvn.nbClient)
+			fakeOvn.controller.nbClient = recorder
+			config.Default.EnableNodePortSecurity = true
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet), "")).Error().To(gomega.Succeed())
+			gomega.Expect(recorder.Changes()).To(gomega.HaveLen(1))
+		})
+	})
+
+	ginkgo.Context("with a node switch transaction timeout", func() {
+		var slowClient *libovsdbtest.SlowClient
+
+		ginkgo.BeforeEach(func() {
+			config.Default.NodeSwitchTransactTimeout = 100
+			startController()
+			// the switch gets created, but adding its router port hangs
+			slowClient = libovsdbtest.NewSlowClient(fakeOvn.nbClient, "Logical_Switch_Port")
+			fakeOvn.controller.nbClient = slowClient
+		})
+
+		ginkgo.AfterEach(func() {
+			slowClient.Release()
+		})
+
+		ginkgo.It("cancels a slow transaction and completes the switch when retried", func() {
+			hostSubnets := ovntest.MustParseIPNets(nodeSubnet)
+			_, err := fakeOvn.controller.createNodeLogicalSwitch(nodeName, hostSubnets, "")
+			gomega.Expect(errors.Is(err, context.DeadlineExceeded)).To(gomega.BeTrue())
+			var nodeAddErr *NodeAddError
+			gomega.Expect(errors.As(newNodeAddError(err), &nodeAddErr)).To(gomega.BeTrue())
+			gomega.Expect(nodeAddErr.Category).To(gomega.Equal(NodeAddErrorDatabaseUnavailable))
+
+			// the partially configured switch is not used for pods yet
+			_, err = libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(fakeOvn.controller.lsManager.GetSwitchSubnets(nodeName)).To(gomega.BeNil())
+
+			slowClient.Release()
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName, hostSubnets, "")).Error().To(gomega.Succeed())
+			switches, err := libovsdbops.FindLogicalSwitchesWithPredicate(fakeOvn.nbClient,
+				func(item *nbdb.LogicalSwitch) bool { return item.Name == nodeName })
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(switches).To(gomega.HaveLen(1))
+			rtrPort, err := libovsdbops.GetLogicalSwitchPort(fakeOvn.nbClient,
+				&nbdb.LogicalSwitchPort{Name: types.SwitchToRouterPrefix + nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(switches[0].Ports).To(gomega.Equal([]string{rtrPort.UUID}))
+			gomega.Expect(fakeOvn.controller.lsManager.GetSwitchSubnets(nodeName)).To(gomega.Equal(hostSubnets))
+		})
+
+		ginkgo.It("waits for a slow transaction without a timeout", func() {
+			config.Default.NodeSwitchTransactTimeout = 0
+			time.AfterFunc(300*time.Millisecond, slowClient.Release)
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet), "")).Error().To(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Context("when reconciling node switch pod IPs", func() {
+		newPod := func(name string, ips ...string) *v1.Pod {
+			pod := &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "namespace1"},
+				Spec:       v1.PodSpec{NodeName: nodeName},
+				Status:     v1.PodStatus{Phase: v1.PodRunning},
+			}
+			var err error
+			pod.Annotations, err = util.MarshalPodAnnotation(nil, &util.PodAnnotation{
+				IPs: ovntest.MustParseIPNets(ips...),
+				MAC: util.IPAddrToHWAddr(ovntest.MustParseIP(strings.Split(ips[0], "/")[0])),
+			}, types.DefaultNetworkName)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			return pod
+		}
+
+		allocatedIPs := func() []string {
+			ips, err := fakeOvn.controller.lsManager.GetAllocatedIPs(nodeName)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			ipStrings := []string{}
+			for _, ip := range ips {
+				ipStrings = append(ipStrings, ip.String())
+			}
+			return ipStrings
+		}
+
+		var node *v1.Node
+
+		ginkgo.BeforeEach(func() {
+			node = newNode(nil)
+			startController(node)
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet), "")).Error().To(gomega.Succeed())
+			gomega.Expect(fakeOvn.controller.lsManager.AllocateIPs(nodeName,
+				ovntest.MustParseIPNets("10.1.1.5/24"))).To(gomega.Succeed())
+			gomega.Expect(fakeOvn.controller.lsManager.AllocateIPs(nodeName,
+				ovntest.MustParseIPNets("10.1.1.7/24"))).To(gomega.Succeed())
+		})
+
+		ginkgo.It("reclaims a leaked IP once it is still unused at the next reconcile", func() {
+			pods := []*v1.Pod{newPod("pod1", "10.1.1.5/24")}
+			reclaimed, unaccounted, err := fakeOvn.controller.reconcileNodeSwitchPodIPs(node, pods)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(reclaimed).To(gomega.BeEmpty())
+			gomega.Expect(unaccounted).To(gomega.BeEmpty())
+			gomega.Expect(allocatedIPs()).To(gomega.ConsistOf("10.1.1.1", "10.1.1.2", "10.1.1.5", "10.1.1.7"))
+
+			reclaimed, _, err = fakeOvn.controller.reconcileNodeSwitchPodIPs(node, pods)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(reclaimed).To(gomega.Equal([]net.IP{ovntest.MustParseIP("10.1.1.7")}))
+			gomega.Expect(allocatedIPs()).To(gomega.ConsistOf("10.1.1.1", "10.1.1.2", "10.1.1.5"))
+		})
+
+		ginkgo.It("keeps an IP that got annotated on a pod since the previous reconcile", func() {
+			reclaimed, _, err := fakeOvn.controller.reconcileNodeSwitchPodIPs(node, []*v1.Pod{newPod("pod1", "10.1.1.5/24")})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(reclaimed).To(gomega.BeEmpty())
+
+			reclaimed, _, err = fakeOvn.controller.reconcileNodeSwitchPodIPs(node,
+				[]*v1.Pod{newPod("pod1", "10.1.1.5/24"), newPod("pod2", "10.1.1.7/24")})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(reclaimed).To(gomega.BeEmpty())
+			gomega.Expect(fakeOvn.controller.suspectedLeakedPodIPs[nodeName].List()).To(gomega.BeEmpty())
+			gomega.Expect(allocatedIPs()).To(gomega.ConsistOf("10.1.1.1", "10.1.1.2", "10.1.1.5", "10.1.1.7"))
+		})
+
+		ginkgo.It("keeps the IPs of pods being deleted", func() {
+			fakeOvn.controller.logicalPortCache.add(nodeName, "namespace1_pod2", "pod2-UUID", nil,
+				ovntest.MustParseIPNets("10.1.1.7/24"))
+			pods := []*v1.Pod{newPod("pod1", "10.1.1.5/24")}
+			for i := 0; i < 2; i++ {
+				reclaimed, _, err := fakeOvn.controller.reconcileNodeSwitchPodIPs(node, pods)
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				gomega.Expect(reclaimed).To(gomega.BeEmpty())
+			}
+			gomega.Expect(allocatedIPs()).To(gomega.ContainElement("10.1.1.7"))
+		})
+
+		ginkgo.It("flags pods with IPs that are not allocated and allocates them", func() {
+			pods := []*v1.Pod{newPod("pod1", "10.1.1.5/24"), newPod("pod2", "10.1.1.7/24"), newPod("pod3", "10.1.1.9/24")}
+			reclaimed, unaccounted, err := fakeOvn.controller.reconcileNodeSwitchPodIPs(node, pods)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(reclaimed).To(gomega.BeEmpty())
+			gomega.Expect(unaccounted).To(gomega.Equal([]net.IP{ovntest.MustParseIP("10.1.1.9")}))
+			gomega.Expect(allocatedIPs()).To(gomega.ContainElement("10.1.1.9"))
+			gomega.Eventually(fakeOvn.fakeRecorder.Events).Should(gomega.Receive(gomega.And(
+				gomega.ContainSubstring("PodIPNotAllocated"),
+				gomega.ContainSubstring("10.1.1.9"),
+			)))
+
+			// flagged only once
+			_, unaccounted, err = fakeOvn.controller.reconcileNodeSwitchPodIPs(node, pods)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(unaccounted).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("ignores the IPs of completed pods", func() {
+			completed := newPod("pod2", "10.1.1.7/24")
+			completed.Status.Phase = v1.PodSucceeded
+			pods := []*v1.Pod{newPod("pod1", "10.1.1.5/24"), completed}
+			for i := 0; i < 2; i++ {
+				_, _, err := fakeOvn.controller.reconcileNodeSwitchPodIPs(node, pods)
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			}
+			gomega.Expect(allocatedIPs()).NotTo(gomega.ContainElement("10.1.1.7"))
+		})
+
+		ginkgo.It("forgets the leaked IPs suspected on the switches of deleted nodes", func() {
+			fakeOvn.controller.suspectedLeakedPodIPs["node2"] = sets.NewString("10.1.2.7")
+			gomega.Expect(fakeOvn.controller.reconcileNodeSwitchesPodIPs([]*v1.Node{node})).To(gomega.Succeed())
+			gomega.Expect(fakeOvn.controller.suspectedLeakedPodIPs).To(gomega.HaveLen(1))
+			// no pod in the cluster holds the pod IPs allocated on the node switch
+			gomega.Expect(fakeOvn.controller.suspectedLeakedPodIPs[nodeName].List()).To(gomega.Equal(
+				[]string{"10.1.1.5", "10.1.1.7"}))
+		})
+	})
+
+	ginkgo.Context("when verifying the node switch subnets before adding a pod", func() {
+		var node *v1.Node
+
+		ginkgo.BeforeEach(func() {
+			node = newNode(map[string]string{
+				"k8s.ovn.org/node-subnets": `{"default":"` + nodeSubnet + `"}`,
+			})
+			startController(node)
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet), "")).Error().To(gomega.Succeed())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.ContainSubstring("NodeLogicalSwitchCreated")))
+		})
+
+		driftSwitchSubnet := func(subnet string) {
+			ls := &nbdb.LogicalSwitch{Name: nodeName, OtherConfig: map[string]string{"subnet": subnet}}
+			gomega.Expect(libovsdbops.CreateOrUpdateLogicalSwitch(fakeOvn.nbClient, ls, &ls.OtherConfig)).To(gomega.Succeed())
+		}
+
+		ginkgo.It("lets the pod through when the subnets agree", func() {
+			gomega.Expect(fakeOvn.controller.verifyNodeSwitchSubnets(nodeName, nodeName)).To(gomega.Succeed())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.BeEmpty())
+			gomega.Expect(fakeOvn.controller.retryNodes.GetBackoffStates()).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("queues the node for a switch reconcile when the subnets drifted", func() {
+			driftSwitchSubnet("10.1.2.0/24")
+
+			pod := &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: "namespace1"},
+				Spec:       v1.PodSpec{NodeName: nodeName},
+			}
+			err := fakeOvn.controller.addLogicalPort(pod)
+			gomega.Expect(err).To(gomega.MatchError(gomega.ContainSubstring(`has subnet "10.1.2.0/24"`)))
+			_, err = libovsdbops.GetLogicalSwitchPort(fakeOvn.nbClient,
+				&nbdb.LogicalSwitchPort{Name: util.GetLogicalPortName(pod.Namespace, pod.Name)})
+			gomega.Expect(err).To(gomega.MatchError(libovsdbclient.ErrNotFound))
+
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.ContainSubstring("NodeSwitchSubnetDrift")))
+			_, nodeSync := fakeOvn.controller.addNodeFailed.Load(nodeName)
+			gomega.Expect(nodeSync).To(gomega.BeTrue())
+			states := fakeOvn.controller.retryNodes.GetBackoffStates()
+			gomega.Expect(states).To(gomega.HaveLen(1))
+			gomega.Expect(states[0].Key).To(gomega.Equal(nodeName))
+
+			// the reconcile of the node switch settles the drift
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet), "")).Error().To(gomega.Succeed())
+			gomega.Expect(fakeOvn.controller.verifyNodeSwitchSubnets(nodeName, nodeName)).To(gomega.Succeed())
+		})
+
+		ginkgo.It("detects a switch that lost a subnet family", func() {
+			ls := &nbdb.LogicalSwitch{Name: nodeName, OtherConfig: map[string]string{
+				"subnet":      nodeSubnet,
+				"ipv6_prefix": "fd00:10:244:2::",
+			}}
+			gomega.Expect(nodeSwitchSubnetsDrifted(ls, ovntest.MustParseIPNets(nodeSubnet))).To(gomega.BeTrue())
+			gomega.Expect(nodeSwitchSubnetsDrifted(ls,
+				ovntest.MustParseIPNets(nodeSubnet, "fd00:10:244:2::/64"))).To(gomega.BeFalse())
+			gomega.Expect(nodeSwitchSubnetsDrifted(&nbdb.LogicalSwitch{Name: nodeName},
+				ovntest.MustParseIPNets(nodeSubnet))).To(gomega.BeFalse())
+		})
+	})
+
+	ginkgo.Context("when creating a node logical switch", func() {
+		ginkgo.It("returns the switch as configured in nbdb", func() {
+			startController(newNode(map[string]string{}))
+			ls, err := fakeOvn.controller.createNodeLogicalSwitch(nodeName, ovntest.MustParseIPNets(nodeSubnet), "")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(ls.UUID).NotTo(gomega.BeEmpty())
+			gomega.Expect(ls.OtherConfig).To(gomega.HaveKeyWithValue("subnet", nodeSubnet))
+
+			nbLS, err := libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(ls.UUID).To(gomega.Equal(nbLS.UUID))
+
+			// updating the switch returns the same one
+			updatedLS, err := fakeOvn.controller.createNodeLogicalSwitch(nodeName, ovntest.MustParseIPNets(nodeSubnet), "")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(updatedLS.UUID).To(gomega.Equal(ls.UUID))
+		})
+
+		ginkgo.It("reports the switch created and deleted once per transition", func() {
+			startController(newNode(map[string]string{}))
+			hostSubnets := ovntest.MustParseIPNets(nodeSubnet)
+
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName, hostSubnets, "")).Error().To(gomega.Succeed())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.And(
+				gomega.ContainSubstring("NodeLogicalSwitchCreated"), gomega.ContainSubstring(nodeSubnet))))
+			// reconciling the existing switch is not a creation
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName, hostSubnets, "")).Error().To(gomega.Succeed())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.BeEmpty())
+
+			gomega.Expect(fakeOvn.controller.deleteNodeLogicalNetwork(nodeName)).To(gomega.Succeed())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.ContainSubstring("NodeLogicalSwitchDeleted")))
+			// nor is retrying the deletion of a switch already gone
+			gomega.Expect(fakeOvn.controller.deleteNodeLogicalNetwork(nodeName)).To(gomega.Succeed())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.BeEmpty())
+
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName, hostSubnets, "")).Error().To(gomega.Succeed())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.ContainSubstring("NodeLogicalSwitchCreated")))
+		})
+	})
+
+	ginkgo.Context("when checking the southbound datapath of a node switch", func() {
+		var ls *nbdb.LogicalSwitch
+
+		createSwitch := func() {
+			startController(newNode(map[string]string{}))
+			var err error
+			ls, err = fakeOvn.controller.createNodeLogicalSwitch(nodeName, ovntest.MustParseIPNets(nodeSubnet), "")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.ContainSubstring("NodeLogicalSwitchCreated")))
+		}
+
+		ginkgo.It("finds the datapath created by northd", func() {
+			createSwitch()
+			ops, err := fakeOvn.sbClient.Create(&sbdb.DatapathBinding{
+				ExternalIDs: map[string]string{"logical-switch": ls.UUID, "name": nodeName},
+				TunnelKey:   1,
+			})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			_, err = libovsdbops.TransactAndCheck(fakeOvn.sbClient, ops)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			gomega.Expect(fakeOvn.controller.checkNodeSwitchDatapath(nodeName, nodeName, ls.UUID, time.Second)).To(gomega.BeTrue())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("warns when the datapath doesn't show up in time", func() {
+			createSwitch()
+			gomega.Expect(fakeOvn.controller.checkNodeSwitchDatapath(nodeName, nodeName, ls.UUID,
+				200*time.Millisecond)).To(gomega.BeFalse())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.And(
+				gomega.ContainSubstring("NodeSwitchDatapathMissing"), gomega.ContainSubstring(nodeName))))
+		})
+
+		ginkgo.It("checks new node switches when enabled", func() {
+			config.Default.NodeSwitchDatapathCheckTimeout = 200
+			createSwitch()
+			gomega.Eventually(fakeOvn.fakeRecorder.Events).Should(gomega.Receive(
+				gomega.ContainSubstring("NodeSwitchDatapathMissing")))
+		})
+
+		ginkgo.It("doesn't check the southbound database by default", func() {
+			createSwitch()
+			gomega.Consistently(fakeOvn.fakeRecorder.Events, 500*time.Millisecond).ShouldNot(gomega.Receive())
+		})
+	})
+
+	ginkgo.Context("when writing the host subnet annotation of a node", func() {
+		const otherSubnet = "10.1.2.0/24"
+
+		getNodeSubnets := func() []*net.IPNet {
+			node, err := fakeOvn.fakeClient.KubeClient.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			hostSubnets, err := util.ParseNodeHostSubnetAnnotation(node, types.DefaultNetworkName)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			return hostSubnets
+		}
+
+		ginkgo.BeforeEach(func() {
+			startController(newNode(map[string]string{"k8s.ovn.org/node-subnets": `{"default":"` + nodeSubnet + `"}`}))
+			fakeOvn.controller.masterSubnetAllocator = subnetallocator.NewHostSubnetAllocator()
+			clusterSubnets, err := config.ParseClusterSubnetEntries("10.1.0.0/16/24")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(fakeOvn.controller.masterSubnetAllocator.InitRanges(clusterSubnets)).To(gomega.Succeed())
+			gomega.Expect(fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated(nodeName,
+				ovntest.MustParseIPNet(nodeSubnet))).To(gomega.Succeed())
+			gomega.Expect(fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated("node2",
+				ovntest.MustParseIPNet(otherSubnet))).To(gomega.Succeed())
+		})
+
+		ginkgo.It("refuses subnets allocated to another node", func() {
+			err := fakeOvn.controller.UpdateNodeAnnotationWithRetry(nodeName,
+				map[string][]*net.IPNet{types.DefaultNetworkName: ovntest.MustParseIPNets(otherSubnet)}, nil)
+			gomega.Expect(errors.Is(err, ErrNodeSubnetConflict)).To(gomega.BeTrue())
+			gomega.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("allocated to node node2")))
+			gomega.Expect(getNodeSubnets()).To(gomega.Equal(ovntest.MustParseIPNets(nodeSubnet)))
+		})
+
+		ginkgo.It("writes subnets allocated to the node or not allocated", func() {
+			for _, subnet := range []string{nodeSubnet, "10.1.3.0/24"} {
+				gomega.Expect(fakeOvn.controller.UpdateNodeAnnotationWithRetry(nodeName,
+					map[string][]*net.IPNet{types.DefaultNetworkName: ovntest.MustParseIPNets(subnet)}, nil)).To(gomega.Succeed())
+				gomega.Eventually(getNodeSubnets).Should(gomega.Equal(ovntest.MustParseIPNets(subnet)))
+			}
+		})
+
+		ginkgo.It("does not check the subnets without a subnet owner", func() {
+			fakeOvn.controller.subnetOwner = nil
+			gomega.Expect(fakeOvn.controller.UpdateNodeAnnotationWithRetry(nodeName,
+				map[string][]*net.IPNet{types.DefaultNetworkName: ovntest.MustParseIPNets(otherSubnet)}, nil)).To(gomega.Succeed())
+			gomega.Eventually(getNodeSubnets).Should(gomega.Equal(ovntest.MustParseIPNets(otherSubnet)))
+		})
+	})
+
+	ginkgo.Context("when reconciling a single node", func() {
+		lrpName := types.RouterToSwitchPrefix + nodeName
+
+		var lbGroupUUID string
+
+		ginkgo.BeforeEach(func() {
+			startController(newNode(map[string]string{
+				"k8s.ovn.org/node-subnets":    `{"default":"` + nodeSubnet + `"}`,
+				"k8s.ovn.org/node-chassis-id": chassisID,
+			}))
+			groups, err := libovsdbops.FindLoadBalancerGroupsWithPredicate(fakeOvn.nbClient,
+				func(item *nbdb.LoadBalancerGroup) bool { return item.Name == types.ClusterLBGroupName })
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(groups).To(gomega.HaveLen(1))
+			lbGroupUUID = groups[0].UUID
+		})
+
+		ginkgo.It("builds the node switch and cluster router port from the node annotations", func() {
+			gomega.Expect(fakeOvn.controller.ReconcileNode(nodeName)).To(gomega.Succeed())
+
+			ls, err := libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(ls.OtherConfig).To(gomega.HaveKeyWithValue("subnet", nodeSubnet))
+			lrp, err := libovsdbops.GetLogicalRouterPort(fakeOvn.nbClient, &nbdb.LogicalRouterPort{Name: lrpName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(lrp.Networks).To(gomega.Equal([]string{"10.1.1.1/24"}))
+			gomega.Expect(sameSubnets(fakeOvn.controller.lsManager.GetSwitchSubnets(nodeName),
+				ovntest.MustParseIPNets(nodeSubnet))).To(gomega.BeTrue())
+		})
+
+		ginkgo.It("rebuilds objects deleted out-of-band and keeps the switch state", func() {
+			hostSubnets := ovntest.MustParseIPNets(nodeSubnet)
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName, hostSubnets, lbGroupUUID)).Error().To(gomega.Succeed())
+			gomega.Expect(fakeOvn.controller.ReconcileNode(nodeName)).To(gomega.Succeed())
+			podIPs := ovntest.MustParseIPNets("10.1.1.5/24")
+			gomega.Expect(fakeOvn.controller.lsManager.AllocateIPs(nodeName, podIPs)).To(gomega.Succeed())
+
+			ls, err := libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(libovsdbops.DeleteLogicalSwitchPorts(fakeOvn.nbClient, ls,
+				&nbdb.LogicalSwitchPort{Name: types.SwitchToRouterPrefix + nodeName})).To(gomega.Succeed())
+			gomega.Expect(libovsdbops.DeleteLogicalRouterPorts(fakeOvn.nbClient,
+				&nbdb.LogicalRouter{Name: types.OVNClusterRouter},
+				&nbdb.LogicalRouterPort{Name: lrpName})).To(gomega.Succeed())
+
+			gomega.Expect(fakeOvn.controller.ReconcileNode(nodeName)).To(gomega.Succeed())
+			_, err = libovsdbops.GetLogicalSwitchPort(fakeOvn.nbClient,
+				&nbdb.LogicalSwitchPort{Name: types.SwitchToRouterPrefix + nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			_, err = libovsdbops.GetLogicalRouterPort(fakeOvn.nbClient, &nbdb.LogicalRouterPort{Name: lrpName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			ls, err = libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(ls.LoadBalancerGroup).To(gomega.Equal([]string{lbGroupUUID}))
+			gomega.Expect(fakeOvn.controller.lsManager.AllocateIPs(nodeName, podIPs)).To(
+				gomega.MatchError(ipallocator.ErrAllocated))
+		})
+
+		ginkgo.It("does not interleave with the handling of a node event", func() {
+			locked := make(chan struct{})
+			release := make(chan struct{})
+			go fakeOvn.controller.retryNodes.DoWithLock(nodeName, func(string) {
+				close(locked)
+				<-release
+			})
+			<-locked
+
+			done := make(chan error, 1)
+			go func() {
+				done <- fakeOvn.controller.ReconcileNode(nodeName)
+			}()
+			gomega.Consistently(done, "200ms").ShouldNot(gomega.Receive())
+			close(release)
+			gomega.Eventually(done).Should(gomega.Receive(gomega.BeNil()))
+		})
+
+		ginkgo.It("fails for a node without host subnets", func() {
+			node, err := fakeOvn.fakeClient.KubeClient.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			delete(node.Annotations, "k8s.ovn.org/node-subnets")
+			_, err = fakeOvn.fakeClient.KubeClient.CoreV1().Nodes().Update(context.TODO(), node, metav1.UpdateOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Eventually(func() bool {
+				node, err := fakeOvn.controller.watchFactory.GetNode(nodeName)
+				return err == nil && node.Annotations["k8s.ovn.org/node-subnets"] == ""
+			}).Should(gomega.BeTrue())
+
+			gomega.Expect(fakeOvn.controller.ReconcileNode(nodeName)).NotTo(gomega.Succeed())
+			_, err = libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: nodeName})
+			gomega.Expect(err).To(gomega.MatchError(libovsdbclient.ErrNotFound))
+		})
+	})
+
+	ginkgo.Context("when reconciling the node switch router ports", func() {
+		switchName := nodeName
+		portName := types.SwitchToRouterPrefix + switchName
+
+		var node *v1.Node
+		var ls *nbdb.LogicalSwitch
+
+		ginkgo.BeforeEach(func() {
+			node = newNode(map[string]string{"k8s.ovn.org/node-subnets": `{"default":"` + nodeSubnet + `"}`})
+			startController(node)
+			var err error
+			ls, err = fakeOvn.controller.createNodeLogicalSwitch(nodeName, ovntest.MustParseIPNets(nodeSubnet), "")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.ContainSubstring("NodeLogicalSwitchCreated")))
+		})
+
+		ginkgo.It("recreates a deleted switch-to-router port without recreating the switch", func() {
+			gomega.Expect(libovsdbops.DeleteLogicalSwitchPorts(fakeOvn.nbClient, ls,
+				&nbdb.LogicalSwitchPort{Name: portName})).To(gomega.Succeed())
+
+			repaired, err := fakeOvn.controller.reconcileNodeSwitchRouterPorts([]*v1.Node{node})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(repaired).To(gomega.ConsistOf(switchName))
+			gomega.Eventually(fakeOvn.fakeRecorder.Events).Should(gomega.Receive(
+				gomega.ContainSubstring("NodeSwitchRouterPortRepaired")))
+
+			lsp, err := libovsdbops.GetLogicalSwitchPort(fakeOvn.nbClient, &nbdb.LogicalSwitchPort{Name: portName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(lsp.Type).To(gomega.Equal("router"))
+			gomega.Expect(lsp.Options).To(gomega.HaveKeyWithValue("router-port", types.RouterToSwitchPrefix+switchName))
+
+			repairedLS, err := libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: switchName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(repairedLS.UUID).To(gomega.Equal(ls.UUID))
+			gomega.Expect(repairedLS.Ports).To(gomega.ContainElement(lsp.UUID))
+		})
+
+		ginkgo.It("restores the options of a misconfigured switch-to-router port", func() {
+			gomega.Expect(libovsdbops.UpdateLogicalSwitchPortSetOptions(fakeOvn.nbClient, &nbdb.LogicalSwitchPort{
+				Name:    portName,
+				Options: map[string]string{"router-port": "rtos-other"},
+			})).To(gomega.Succeed())
+
+			repaired, err := fakeOvn.controller.reconcileNodeSwitchRouterPorts([]*v1.Node{node})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(repaired).To(gomega.ConsistOf(switchName))
+
+			lsp, err := libovsdbops.GetLogicalSwitchPort(fakeOvn.nbClient, &nbdb.LogicalSwitchPort{Name: portName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(lsp.Options).To(gomega.HaveKeyWithValue("router-port", types.RouterToSwitchPrefix+switchName))
+		})
+
+		ginkgo.It("leaves an intact switch-to-router port alone", func() {
+			repaired, err := fakeOvn.controller.reconcileNodeSwitchRouterPorts([]*v1.Node{node})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(repaired).To(gomega.BeEmpty())
+			gomega.Consistently(fakeOvn.fakeRecorder.Events).ShouldNot(gomega.Receive())
+		})
+	})
+
+	ginkgo.Context("when reconciling the node cluster router port networks", func() {
+		const newNodeSubnet = "10.1.2.0/24"
+		lrpName := types.RouterToSwitchPrefix + nodeName
+
+		var node *v1.Node
+
+		ginkgo.BeforeEach(func() {
+			node = newNode(map[string]string{
+				"k8s.ovn.org/node-subnets":    `{"default":"` + nodeSubnet + `"}`,
+				"k8s.ovn.org/node-chassis-id": chassisID,
+			})
+			startController(node)
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet), "")).Error().To(gomega.Succeed())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.ContainSubstring("NodeLogicalSwitchCreated")))
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, nil)).To(gomega.Succeed())
+		})
+
+		getNetworks := func() []string {
+			lrp, err := libovsdbops.GetLogicalRouterPort(fakeOvn.nbClient, &nbdb.LogicalRouterPort{Name: lrpName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			return lrp.Networks
+		}
+
+		ginkgo.It("repairs the networks left stale by a subnet change", func() {
+			// the switch moves to the new subnet without its router port being synced
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets(newNodeSubnet), "")).Error().To(gomega.Succeed())
+			gomega.Expect(getNetworks()).To(gomega.ConsistOf("10.1.1.1/24"))
+
+			repaired, err := fakeOvn.controller.reconcileNodeClusterRouterPortNetworks([]*v1.Node{node})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(repaired).To(gomega.ConsistOf(lrpName))
+			gomega.Expect(getNetworks()).To(gomega.ConsistOf("10.1.2.1/24"))
+			gomega.Eventually(fakeOvn.fakeRecorder.Events).Should(gomega.Receive(
+				gomega.ContainSubstring("NodeClusterRouterPortRepaired")))
+
+			repaired, err = fakeOvn.controller.reconcileNodeClusterRouterPortNetworks([]*v1.Node{node})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(repaired).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("leaves matching networks alone", func() {
+			repaired, err := fakeOvn.controller.reconcileNodeClusterRouterPortNetworks([]*v1.Node{node})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(repaired).To(gomega.BeEmpty())
+			gomega.Expect(getNetworks()).To(gomega.ConsistOf("10.1.1.1/24"))
+			gomega.Consistently(fakeOvn.fakeRecorder.Events).ShouldNot(gomega.Receive())
+		})
+
+		ginkgo.It("leaves a frozen node alone", func() {
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets(newNodeSubnet), "")).Error().To(gomega.Succeed())
+			frozen := node.DeepCopy()
+			frozen.Annotations["k8s.ovn.org/freeze-ovn"] = "true"
+
+			repaired, err := fakeOvn.controller.reconcileNodeClusterRouterPortNetworks([]*v1.Node{frozen})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(repaired).To(gomega.BeEmpty())
+			gomega.Expect(getNetworks()).To(gomega.ConsistOf("10.1.1.1/24"))
+		})
+	})
+
+	ginkgo.Context("when deleting the logical networks of several nodes", func() {
+		nodeNames := []string{"node1", "node2", "node3"}
+
+		getRouterPorts := func() []string {
+			router, err := libovsdbops.GetLogicalRouter(fakeOvn.nbClient, &nbdb.LogicalRouter{Name: types.OVNClusterRouter})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			return router.Ports
+		}
+
+		expectDeleted := func() {
+			for _, name := range nodeNames {
+				_, err := libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: name})
+				gomega.Expect(err).To(gomega.MatchError(libovsdbclient.ErrNotFound))
+				_, err = libovsdbops.GetLogicalRouterPort(fakeOvn.nbClient,
+					&nbdb.LogicalRouterPort{Name: types.RouterToSwitchPrefix + name})
+				gomega.Expect(err).To(gomega.MatchError(libovsdbclient.ErrNotFound))
+			}
+		}
+
+		ginkgo.It("deletes the switches and router ports of all the nodes", func() {
+			startController()
+			portsBefore := getRouterPorts()
+			gomega.Expect(createNodeLogicalNetworks(fakeOvn.nbClient, nodeNames)).To(gomega.Succeed())
+			gomega.Expect(getRouterPorts()).To(gomega.HaveLen(len(portsBefore) + len(nodeNames)))
+
+			// a node without a logical network is fine
+			nodeErrs := fakeOvn.controller.deleteNodeLogicalNetworks(append(nodeNames, "node4"))
+			gomega.Expect(nodeErrs).To(gomega.BeEmpty())
+			expectDeleted()
+			gomega.Expect(getRouterPorts()).To(gomega.ConsistOf(portsBefore))
+			for range nodeNames {
+				gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.ContainSubstring("NodeLogicalSwitchDeleted")))
+			}
+			gomega.Expect(fakeOvn.fakeRecorder.Events).NotTo(gomega.Receive())
+		})
+
+		ginkgo.It("does nothing for nodes already deleted", func() {
+			startController()
+			gomega.Expect(createNodeLogicalNetworks(fakeOvn.nbClient, nodeNames)).To(gomega.Succeed())
+			// one of them already deleted by itself
+			gomega.Expect(fakeOvn.controller.deleteNodeLogicalNetwork("node2")).To(gomega.Succeed())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.ContainSubstring("node2")))
+
+			gomega.Expect(fakeOvn.controller.deleteNodeLogicalNetworks(nodeNames)).To(gomega.BeEmpty())
+			expectDeleted()
+			gomega.Expect(fakeOvn.controller.deleteNodeLogicalNetworks(nodeNames)).To(gomega.BeEmpty())
+			events := []string{}
+			for len(fakeOvn.fakeRecorder.Events) > 0 {
+				events = append(events, <-fakeOvn.fakeRecorder.Events)
+			}
+			gomega.Expect(events).To(gomega.HaveLen(2))
+		})
+
+		ginkgo.It("returns the error of each node it fails to delete", func() {
+			fakeOvn.startWithDBSetup(libovsdbtest.TestSetup{
+				NBData: []libovsdbtest.TestData{newClusterJoinSwitch()},
+			})
+
+			nodeErrs := fakeOvn.controller.deleteNodeLogicalNetworks(nodeNames)
+			gomega.Expect(nodeErrs).To(gomega.HaveLen(len(nodeNames)))
+			for _, name := range nodeNames {
+				gomega.Expect(nodeErrs[name]).To(gomega.MatchError(gomega.ContainSubstring(types.RouterToSwitchPrefix + name)))
+			}
+		})
+	})
+
+	ginkgo.Context("when reconciling the load balancer cache", func() {
+		const lbUUID = "lb-UUID"
+
+		ginkgo.BeforeEach(func() {
+			dbSetup.NBData = append(dbSetup.NBData,
+				&nbdb.LoadBalancer{
+					UUID:        lbUUID,
+					Name:        "Service_default/svc_TCP_node_switch_node1",
+					ExternalIDs: map[string]string{"k8s.ovn.org/owner": "default/svc"},
+				},
+				&nbdb.LogicalSwitch{UUID: "node1-UUID", Name: "node1", LoadBalancer: []string{lbUUID}},
+				&nbdb.LogicalSwitch{UUID: "node2-UUID", Name: "node2", LoadBalancer: []string{lbUUID}},
+			)
+			ovnlb.TestOnlySetCache(nil)
+		})
+
+		ginkgo.AfterEach(func() {
+			ovnlb.TestOnlySetCache(nil)
+		})
+
+		getCachedSwitches := func() sets.String {
+			lbCache, err := ovnlb.GetLBCache(fakeOvn.nbClient)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			lbs := lbCache.Find(map[string]string{"k8s.ovn.org/owner": "default/svc"})
+			gomega.Expect(lbs).To(gomega.HaveLen(1))
+			for _, lb := range lbs {
+				return lb.Switches
+			}
+			return nil
+		}
+
+		ginkgo.It("prunes the associations with a switch that no longer exists", func() {
+			startController()
+			gomega.Expect(getCachedSwitches()).To(gomega.Equal(sets.NewString("node1", "node2")))
+			// the switch is gone but the cache was not updated, as after a crash
+			gomega.Expect(libovsdbops.DeleteLogicalSwitch(fakeOvn.nbClient, "node2")).To(gomega.Succeed())
+			gomega.Expect(getCachedSwitches()).To(gomega.Equal(sets.NewString("node1", "node2")))
+
+			gomega.Expect(fakeOvn.controller.reconcileLoadBalancerCacheSwitches()).To(gomega.Succeed())
+			gomega.Expect(getCachedSwitches()).To(gomega.Equal(sets.NewString("node1")))
+		})
+
+		ginkgo.It("keeps the associations with existing switches", func() {
+			startController()
+			gomega.Expect(fakeOvn.controller.reconcileLoadBalancerCacheSwitches()).To(gomega.Succeed())
+			gomega.Expect(getCachedSwitches()).To(gomega.Equal(sets.NewString("node1", "node2")))
+		})
+	})
+
+	ginkgo.Context("when deleting a node", func() {
+		const namespaceName = "namespace1"
+
+		addNamespaceIPs := func() {
+			for _, ip := range []string{"10.1.1.5/24", "10.1.2.5/24", "10.1.1.6/24"} {
+				_, _, _, _, err := fakeOvn.controller.addPodToNamespace(namespaceName, ovntest.MustParseIPNets(ip))
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			}
+		}
+
+		ginkgo.BeforeEach(func() {
+			gwRouter := types.GWRouterPrefix + nodeName
+			dbSetup.NBData = append(dbSetup.NBData,
+				&nbdb.LogicalRouterPort{
+					UUID:     "rtoj-gr1-UUID",
+					Name:     types.GWRouterToJoinSwitchPrefix + gwRouter,
+					Networks: []string{"100.64.0.2/16"},
+				},
+				&nbdb.LogicalRouter{UUID: "gr1-UUID", Name: gwRouter, Ports: []string{"rtoj-gr1-UUID"}},
+			)
+			node := newNode(map[string]string{"k8s.ovn.org/node-subnets": `{"default":"` + nodeSubnet + `"}`})
+			startController(node)
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet), "")).Error().To(gomega.Succeed())
+		})
+
+		ginkgo.It("removes the IPs of its subnets from the namespace address sets", func() {
+			addNamespaceIPs()
+			gomega.Expect(fakeOvn.controller.deleteNodeEvent(newNode(nil))).To(gomega.Succeed())
+			fakeOvn.asf.ExpectAddressSetWithIPs(namespaceName, []string{"10.1.2.5"})
+		})
+
+		ginkgo.It("keeps its subnets allocated until the namespace address sets are cleaned", func() {
+			subnet := ovntest.MustParseIPNet(nodeSubnet)
+			gomega.Expect(fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated(nodeName, subnet)).To(gomega.Succeed())
+			addNamespaceIPs()
+			nsInfo, nsUnlock := fakeOvn.controller.getNamespaceLocked(namespaceName, false)
+			gomega.Expect(nsInfo).NotTo(gomega.BeNil())
+			nsInfo.addressSet = &failingDeleteAddressSet{AddressSet: nsInfo.addressSet}
+			nsUnlock()
+
+			gomega.Expect(fakeOvn.controller.deleteNodeEvent(newNode(nil))).NotTo(gomega.Succeed())
+			// the subnet can't be handed to another node while its IPs are still in use
+			gomega.Expect(fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated("node2", subnet)).NotTo(gomega.Succeed())
+		})
+
+		ginkgo.It("leaves them to the pod deletes when the cleanup is disabled", func() {
+			config.Default.DisableNodeDeleteAddressSetCleanup = true
+			addNamespaceIPs()
+			gomega.Expect(fakeOvn.controller.deleteNodeEvent(newNode(nil))).To(gomega.Succeed())
+			fakeOvn.asf.ExpectAddressSetWithIPs(namespaceName, []string{"10.1.1.5", "10.1.2.5", "10.1.1.6"})
+		})
+	})
+
+	ginkgo.Context("when a node stops getting a host subnet assigned", func() {
+		var node *v1.Node
+
+		startWithNodeNetwork := func() {
+			config.Kubernetes.NoHostSubnetNodes = &metav1.LabelSelector{
+				MatchLabels: map[string]string{"nohostsubnet": "true"},
+			}
+			node = newNode(map[string]string{
+				"k8s.ovn.org/node-subnets":    `{"default":"` + nodeSubnet + `"}`,
+				"k8s.ovn.org/node-chassis-id": chassisID,
+			})
+			startController(node)
+			hostSubnets := ovntest.MustParseIPNets(nodeSubnet)
+			gomega.Expect(fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated(nodeName, hostSubnets...)).To(gomega.Succeed())
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName, hostSubnets, "")).Error().To(gomega.Succeed())
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, hostSubnets)).To(gomega.Succeed())
+			gwRouter := &nbdb.LogicalRouter{Name: types.GWRouterPrefix + nodeName}
+			gomega.Expect(libovsdbops.CreateOrUpdateLogicalRouter(fakeOvn.nbClient, gwRouter)).To(gomega.Succeed())
+			gomega.Expect(libovsdbops.CreateOrUpdateLogicalRouterPort(fakeOvn.nbClient, gwRouter,
+				&nbdb.LogicalRouterPort{
+					Name:     types.GWRouterToJoinSwitchPrefix + types.GWRouterPrefix + nodeName,
+					Networks: []string{"100.64.0.2/16"},
+				}, nil)).To(gomega.Succeed())
+		}
+
+		expectNodeNetworkCleanedUp := func() {
+			_, err := libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: nodeName})
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			_, err = libovsdbops.GetLogicalRouterPort(fakeOvn.nbClient,
+				&nbdb.LogicalRouterPort{Name: types.RouterToSwitchPrefix + nodeName})
+			// its gateway chassis are garbage collected by ovsdb-server, not by the test server
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			_, err = libovsdbops.GetLogicalRouter(fakeOvn.nbClient, &nbdb.LogicalRouter{Name: types.GWRouterPrefix + nodeName})
+			gomega.Expect(err).To(gomega.MatchError(libovsdbclient.ErrNotFound))
+			// the subnet can be assigned to another node
+			err = fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated("node2", ovntest.MustParseIPNets(nodeSubnet)...)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		}
+
+		ginkgo.It("cleans up its logical network when syncing nodes", func() {
+			startWithNodeNetwork()
+			node.Labels = map[string]string{"nohostsubnet": "true"}
+
+			gomega.Expect(fakeOvn.controller.syncNodes([]interface{}{node})).To(gomega.Succeed())
+			expectNodeNetworkCleanedUp()
+			gomega.Expect(fakeOvn.controller.lsManager.GetSwitchSubnets(nodeName)).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("leaves a node that is already cleaned up alone", func() {
+			startWithNodeNetwork()
+			node.Labels = map[string]string{"nohostsubnet": "true"}
+			gomega.Expect(fakeOvn.controller.cleanupNoHostSubnetNode(nodeName)).To(gomega.Succeed())
+
+			// the subnets allocated to the node since are not released by a later cleanup
+			gomega.Expect(fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet)...)).To(gomega.Succeed())
+			gomega.Expect(fakeOvn.controller.syncNodes([]interface{}{node})).To(gomega.Succeed())
+			owner, ok := fakeOvn.controller.masterSubnetAllocator.SubnetOwner(ovntest.MustParseIPNet(nodeSubnet))
+			gomega.Expect(ok).To(gomega.BeTrue())
+			gomega.Expect(owner).To(gomega.Equal(nodeName))
+		})
+
+		ginkgo.It("cleans up its logical network when the node is updated", func() {
+			startWithNodeNetwork()
+			labeledNode := node.DeepCopy()
+			labeledNode.Labels = map[string]string{"nohostsubnet": "true"}
+
+			shouldUpdate, err := shouldUpdateNode(labeledNode, node)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(shouldUpdate).To(gomega.BeTrue())
+
+			err = fakeOvn.controller.addUpdateNodeEvent(labeledNode, &nodeSyncs{syncNode: true})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			expectNodeNetworkCleanedUp()
+			gomega.Expect(fakeOvn.controller.lsManager.IsNonHostSubnetSwitch(nodeName)).To(gomega.BeTrue())
+
+			// a node can still not go back to getting a host subnet assigned
+			_, err = shouldUpdateNode(node, labeledNode)
+			gomega.Expect(err).To(gomega.HaveOccurred())
+		})
+	})
+
+	ginkgo.Context("when filtering node updates", func() {
+		oldNode := &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        nodeName,
+				Labels:      map[string]string{"kubernetes.io/os": "linux"},
+				Annotations: map[string]string{"k8s.ovn.org/node-subnets": `{"default":"` + nodeSubnet + `"}`},
+			},
+			Status: v1.NodeStatus{Conditions: []v1.NodeCondition{
+				{Type: v1.NodeReady, Status: v1.ConditionTrue, LastHeartbeatTime: metav1.NewTime(time.Unix(1000, 0))},
+			}},
+		}
+		heartbeat := func(node *v1.Node) {
+			node.Status.Conditions[0].LastHeartbeatTime = metav1.NewTime(time.Unix(2000, 0))
+		}
+
+		areNodesEqual := func(update func(node *v1.Node)) bool {
+			newNode := oldNode.DeepCopy()
+			update(newNode)
+			equal, err := (&baseNetworkControllerEventHandler{}).areResourcesEqual(factory.NodeType, oldNode, newNode)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			return equal
+		}
+
+		table.DescribeTable("only handles the updates of relevant fields", func(update func(node *v1.Node), relevant bool) {
+			fakeOvn.start()
+			config.Kubernetes.FilterNodeUpdates = true
+			gomega.Expect(areNodesEqual(update)).To(gomega.Equal(!relevant))
+		},
+			table.Entry("skipping heartbeats", heartbeat, false),
+			table.Entry("handling annotation changes", func(node *v1.Node) {
+				node.Annotations["k8s.ovn.org/node-chassis-id"] = chassisID
+			}, true),
+			table.Entry("handling label changes", func(node *v1.Node) {
+				node.Labels["nohostsubnet"] = "true"
+			}, true),
+			table.Entry("handling spec changes", func(node *v1.Node) {
+				node.Spec.ProviderID = "aws:///us-east-1a/i-0123"
+			}, true),
+			table.Entry("handling the kubelet setting the network unavailable", func(node *v1.Node) {
+				heartbeat(node)
+				node.Status.Conditions = append(node.Status.Conditions, v1.NodeCondition{
+					Type: v1.NodeNetworkUnavailable, Status: v1.ConditionTrue, Reason: "NoRouteCreated"})
+			}, true),
+		)
+
+		ginkgo.It("handles every update by default", func() {
+			fakeOvn.start()
+			gomega.Expect(areNodesEqual(heartbeat)).To(gomega.BeFalse())
+		})
+	})
+
+	ginkgo.Context("when reconciling node switch subnets", func() {
+		var node *v1.Node
+
+		editSubnetAnnotation := func(annotation string) {
+			updated := node.DeepCopy()
+			updated.Annotations["k8s.ovn.org/node-subnets"] = annotation
+			_, err := fakeOvn.fakeClient.KubeClient.CoreV1().Nodes().Update(context.TODO(), updated, metav1.UpdateOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Eventually(func() string {
+				cached, err := fakeOvn.watcher.GetNode(nodeName)
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				return cached.Annotations["k8s.ovn.org/node-subnets"]
+			}).Should(gomega.Equal(annotation))
+		}
+
+		annotatedSubnets := func() ([]*net.IPNet, error) {
+			updatedNode, err := fakeOvn.fakeClient.KubeClient.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			return util.ParseNodeHostSubnetAnnotation(updatedNode, types.DefaultNetworkName)
+		}
+
+		ginkgo.BeforeEach(func() {
+			node = newNode(map[string]string{
+				"k8s.ovn.org/node-subnets": `{"default":"` + nodeSubnet + `"}`,
+			})
+		})
+
+		ginkgo.It("restores a node subnet annotation edited after the switch was created", func() {
+			startController(node)
+			gomega.Expect(fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet)...)).To(gomega.Succeed())
+			err := fakeOvn.controller.lsManager.AddSwitch(nodeName, "node1-UUID", ovntest.MustParseIPNets(nodeSubnet))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			// an annotation in sync with the switch is left alone
+			gomega.Expect(fakeOvn.controller.reconcileNodeSwitchSubnets([]*v1.Node{node})).To(gomega.Succeed())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.BeEmpty())
+
+			ginkgo.By("editing the node subnet annotation out-of-band")
+			editSubnetAnnotation(`{"default":"10.1.2.0/24"}`)
+
+			// the node is read again, so the stale node given is not an issue
+			gomega.Expect(fakeOvn.controller.reconcileNodeSwitchSubnets([]*v1.Node{node})).To(gomega.Succeed())
+			gomega.Expect(annotatedSubnets()).To(gomega.Equal(ovntest.MustParseIPNets(nodeSubnet)))
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.ContainSubstring("NodeSubnetAnnotationRepaired")))
+		})
+
+		ginkgo.It("does not repair an annotation when the allocator does not confirm the switch subnets", func() {
+			startController(node)
+			err := fakeOvn.controller.lsManager.AddSwitch(nodeName, "node1-UUID", ovntest.MustParseIPNets(nodeSubnet))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			editSubnetAnnotation(`{"default":"10.1.2.0/24"}`)
+
+			gomega.Expect(fakeOvn.controller.reconcileNodeSwitchSubnets([]*v1.Node{node})).To(gomega.Succeed())
+			gomega.Expect(annotatedSubnets()).To(gomega.Equal(ovntest.MustParseIPNets("10.1.2.0/24")))
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("does not repair an annotation of a network without a subnet owner", func() {
+			startController(node)
+			gomega.Expect(fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet)...)).To(gomega.Succeed())
+			err := fakeOvn.controller.lsManager.AddSwitch(nodeName, "node1-UUID", ovntest.MustParseIPNets(nodeSubnet))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			fakeOvn.controller.subnetOwner = nil
+			editSubnetAnnotation(`{"default":"10.1.2.0/24"}`)
+
+			gomega.Expect(fakeOvn.controller.reconcileNodeSwitchSubnets([]*v1.Node{node})).To(gomega.Succeed())
+			gomega.Expect(annotatedSubnets()).To(gomega.Equal(ovntest.MustParseIPNets("10.1.2.0/24")))
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("does not repair an annotation with subnets allocated to the node", func() {
+			startController(node)
+			gomega.Expect(fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet, "10.1.2.0/24")...)).To(gomega.Succeed())
+			err := fakeOvn.controller.lsManager.AddSwitch(nodeName, "node1-UUID", ovntest.MustParseIPNets(nodeSubnet))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			editSubnetAnnotation(`{"default":"10.1.2.0/24"}`)
+
+			gomega.Expect(fakeOvn.controller.reconcileNodeSwitchSubnets([]*v1.Node{node})).To(gomega.Succeed())
+			gomega.Expect(annotatedSubnets()).To(gomega.Equal(ovntest.MustParseIPNets("10.1.2.0/24")))
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("does not restore a missing annotation", func() {
+			node = newNode(map[string]string{})
+			startController(node)
+			gomega.Expect(fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated(nodeName,
+				ovntest.MustParseIPNets(nodeSubnet)...)).To(gomega.Succeed())
+			err := fakeOvn.controller.lsManager.AddSwitch(nodeName, "node1-UUID", ovntest.MustParseIPNets(nodeSubnet))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			gomega.Expect(fakeOvn.controller.reconcileNodeSwitchSubnets([]*v1.Node{node})).To(gomega.Succeed())
+			_, err = annotatedSubnets()
+			gomega.Expect(util.IsAnnotationNotSetError(err)).To(gomega.BeTrue())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("skips nodes without a switch", func() {
+			startController(node)
+
+			gomega.Expect(fakeOvn.controller.reconcileNodeSwitchSubnets([]*v1.Node{node})).To(gomega.Succeed())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.Context("during the initial node sync", func() {
+		ginkgo.It("respects the node startup sync rate", func() {
+			config.Kubernetes.NodeStartupSyncRate = 10
+			config.Kubernetes.NoHostSubnetNodes = &metav1.LabelSelector{
+				MatchLabels: map[string]string{"nohostsubnet": "true"},
+			}
+			nodes := []*v1.Node{}
+			for i := 0; i < 6; i++ {
+				nodes = append(nodes, &v1.Node{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:   fmt.Sprintf("node%d", i),
+						Labels: map[string]string{"nohostsubnet": "true"},
+					},
+				})
+			}
+			startController(nodes...)
+
+			start := time.Now()
+			gomega.Expect(fakeOvn.controller.WatchNodes()).To(gomega.Succeed())
+			// the first node is let through right away, the other 5 at 10 per second
+			gomega.Expect(time.Since(start)).To(gomega.BeNumerically(">=", 450*time.Millisecond))
+			for _, node := range nodes {
+				gomega.Expect(fakeOvn.controller.lsManager.IsNonHostSubnetSwitch(node.Name)).To(gomega.BeTrue())
+			}
+
+			// normal processing resumes once the initial sync is done
+			start = time.Now()
+			for i := 0; i < 5; i++ {
+				gomega.Expect(fakeOvn.controller.waitForNodeStartupSync()).To(gomega.Succeed())
+			}
+			gomega.Expect(time.Since(start)).To(gomega.BeNumerically("<", 100*time.Millisecond))
+		})
+	})
+
+	ginkgo.Context("when listing failing nodes", func() {
+		ginkgo.It("returns only the nodes whose reconcile failed", func() {
+			config.Kubernetes.NoHostSubnetNodes = &metav1.LabelSelector{
+				MatchLabels: map[string]string{"nohostsubnet": "true"},
+			}
+			goodNode := &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "good-node",
+					Labels: map[string]string{"nohostsubnet": "true"},
+				},
+			}
+			// the corrupt subnet annotation can't be replaced with newly allocated subnets
+			badNode := &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "bad-node",
+					Annotations: map[string]string{"k8s.ovn.org/node-subnets": `{"default":"not-a-subnet"}`},
+				},
+			}
+			startController(goodNode, badNode)
+			gomega.Expect(fakeOvn.controller.FailingNodes()).To(gomega.BeEmpty())
+
+			gomega.Expect(fakeOvn.controller.WatchNodes()).To(gomega.Succeed())
+			gomega.Eventually(fakeOvn.controller.FailingNodes).Should(gomega.HaveLen(1))
+			failing := fakeOvn.controller.FailingNodes()[0]
+			gomega.Expect(failing.Key).To(gomega.Equal(badNode.Name))
+			gomega.Expect(failing.FailedAttempts).To(gomega.BeNumerically(">=", 1))
+			gomega.Expect(failing.LastError).To(gomega.MatchError(gomega.ContainSubstring("annotation")))
+		})
+
+		ginkgo.It("reports the retry backoff of the failing nodes", func() {
+			badNode := &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "bad-node",
+					Annotations: map[string]string{"k8s.ovn.org/node-subnets": `{"default":"not-a-subnet"}`},
+				},
+			}
+			startController(badNode)
+			start := time.Now()
+			gomega.Expect(fakeOvn.controller.WatchNodes()).To(gomega.Succeed())
+
+			var nodes []ovnretry.BackoffState
+			gomega.Eventually(func() int {
+				_, nodes = fakeOvn.controller.RetryBackoffStates()
+				return len(nodes)
+			}).Should(gomega.Equal(1))
+			pods, _ := fakeOvn.controller.RetryBackoffStates()
+			gomega.Expect(pods).To(gomega.BeEmpty())
+			gomega.Expect(nodes[0].Key).To(gomega.Equal(badNode.Name))
+			gomega.Expect(nodes[0].FailedAttempts).To(gomega.Equal(1))
+			// the first retry of the node add is a second after it failed
+			gomega.Expect(nodes[0].Backoff).To(gomega.Equal(time.Second))
+			gomega.Expect(nodes[0].NextRetry).To(gomega.BeTemporally(">=", start.Add(time.Second)))
+			gomega.Expect(nodes[0].NextRetry).To(gomega.BeTemporally("<=", time.Now().Add(time.Second)))
+		})
+	})
+
+	ginkgo.Context("when refreshing the subnet usage metrics", func() {
+		ginkgo.It("records the usage every interval until stopped", func() {
+			startController()
+			fakeClock := clocktesting.NewFakeClock(time.Now())
+			stopChan := make(chan struct{})
+			fakeOvn.controller.clock = fakeClock
+			fakeOvn.controller.stopChan = stopChan
+
+			recorded := make(chan struct{}, 1)
+			stopped := make(chan struct{})
+			go func() {
+				defer close(stopped)
+				fakeOvn.controller.runPeriodically(func() { recorded <- struct{}{} }, time.Minute)
+			}()
+			gomega.Eventually(fakeClock.HasWaiters).Should(gomega.BeTrue())
+
+			fakeClock.Step(30 * time.Second)
+			gomega.Consistently(recorded, "100ms").ShouldNot(gomega.Receive())
+			for i := 0; i < 3; i++ {
+				fakeClock.Step(time.Minute)
+				gomega.Eventually(recorded).Should(gomega.Receive())
+			}
+
+			close(stopChan)
+			gomega.Eventually(stopped).Should(gomega.BeClosed())
+		})
+	})
+
+	ginkgo.Context("when watching the node handler for stalls", func() {
+		const timeout = time.Minute
+		var fakeClock *clocktesting.FakeClock
+
+		stallCount := func() float64 {
+			metric := &dto.Metric{}
+			gomega.Expect(metrics.MetricNodeHandlerStallCount.Write(metric)).To(gomega.Succeed())
+			return metric.GetCounter().GetValue()
+		}
+
+		ginkgo.BeforeEach(func() {
+			startController()
+			fakeClock = clocktesting.NewFakeClock(time.Now())
+			fakeOvn.controller.clock = fakeClock
+			// drain the events of the node add
+			for len(fakeOvn.fakeRecorder.Events) > 0 {
+				<-fakeOvn.fakeRecorder.Events
+			}
+		})
+
+		ginkgo.It("reports a handler stuck on a node event once", func() {
+			stopChan := make(chan struct{})
+			fakeOvn.controller.stopChan = stopChan
+			stopped := make(chan struct{})
+			go func() {
+				defer close(stopped)
+				fakeOvn.controller.runPeriodically(func() { fakeOvn.controller.checkNodeHandlerProgress(timeout) }, timeout/2)
+			}()
+			defer func() {
+				close(stopChan)
+				gomega.Eventually(stopped).Should(gomega.BeClosed())
+			}()
+			gomega.Eventually(fakeClock.HasWaiters).Should(gomega.BeTrue())
+			stalls := stallCount()
+
+			// a handler that never completes
+			done := fakeOvn.controller.trackNodeHandler(nodeName)
+			fakeClock.Step(timeout / 2)
+			gomega.Consistently(fakeOvn.fakeRecorder.Events, "100ms").ShouldNot(gomega.Receive())
+			fakeClock.Step(timeout / 2)
+			gomega.Consistently(fakeOvn.fakeRecorder.Events, "100ms").ShouldNot(gomega.Receive())
+			fakeClock.Step(timeout / 2)
+			gomega.Eventually(fakeOvn.fakeRecorder.Events).Should(gomega.Receive(gomega.And(
+				gomega.ContainSubstring("NodeHandlerStalled"), gomega.ContainSubstring(nodeName))))
+			gomega.Eventually(stallCount).Should(gomega.Equal(stalls + 1))
+
+			fakeClock.Step(timeout)
+			gomega.Consistently(fakeOvn.fakeRecorder.Events, "100ms").ShouldNot(gomega.Receive())
+			gomega.Expect(stallCount()).To(gomega.Equal(stalls + 1))
+
+			// it is reported again if it stalls again after resuming
+			done()
+			fakeOvn.controller.trackNodeHandler("node2")
+			fakeClock.Step(timeout / 2)
+			gomega.Consistently(fakeOvn.fakeRecorder.Events, "100ms").ShouldNot(gomega.Receive())
+			fakeClock.Step(timeout)
+			gomega.Eventually(fakeOvn.fakeRecorder.Events).Should(gomega.Receive(gomega.ContainSubstring("node2")))
+			gomega.Eventually(stallCount).Should(gomega.Equal(stalls + 2))
+		})
+
+		ginkgo.It("doesn't report a handler that makes progress or is idle", func() {
+			// idle for long
+			fakeClock.Step(10 * timeout)
+			gomega.Expect(fakeOvn.controller.checkNodeHandlerProgress(timeout)).To(gomega.BeEmpty())
+
+			// a slow node event while others complete
+			fakeOvn.controller.trackNodeHandler("node2")
+			for i := 0; i < 3; i++ {
+				fakeClock.Step(timeout / 2)
+				fakeOvn.controller.trackNodeHandler(nodeName)()
+				gomega.Expect(fakeOvn.controller.checkNodeHandlerProgress(timeout)).To(gomega.BeEmpty())
+			}
+
+			// the events actually handled are tracked until they complete, failed or not
+			gomega.Expect(fakeOvn.controller.deleteNodeEvent(newNode(nil))).NotTo(gomega.Succeed())
+			fakeClock.Step(timeout / 2)
+			gomega.Expect(fakeOvn.controller.checkNodeHandlerProgress(timeout)).To(gomega.BeEmpty())
+			fakeClock.Step(timeout)
+			gomega.Expect(fakeOvn.controller.checkNodeHandlerProgress(timeout)).To(gomega.Equal([]string{"node2"}))
+			gomega.Expect(fakeOvn.controller.nodeHandlerInFlight).To(gomega.HaveLen(1))
+		})
+	})
+
+	ginkgo.Context("when recording the last node reconcile", func() {
+		var reconcileTimestamp = func() float64 {
+			metric := &dto.Metric{}
+			gomega.Expect(metrics.MetricNodeReconcileTimestamp.WithLabelValues(types.DefaultNetworkName).
+				Write(metric)).To(gomega.Succeed())
+			return metric.GetGauge().GetValue()
+		}
+
+		ginkgo.It("advances the timestamp after the initial and the periodic syncs", func() {
+			startController(newNode(map[string]string{}))
+			metrics.MetricNodeReconcileTimestamp.Reset()
+			gomega.Expect(reconcileTimestamp()).To(gomega.BeZero())
+
+			before := float64(time.Now().UnixNano()) / 1e9
+			gomega.Expect(fakeOvn.controller.WatchNodes()).To(gomega.Succeed())
+			initial := reconcileTimestamp()
+			gomega.Expect(initial).To(gomega.BeNumerically(">=", before))
+
+			fakeOvn.controller.syncNodesPeriodic()
+			gomega.Expect(reconcileTimestamp()).To(gomega.BeNumerically(">", initial))
+		})
+	})
+
+	ginkgo.Context("when counting the node subnet allocations and releases", func() {
+		var counterValue = func(counter *prometheus.CounterVec, family string) float64 {
+			metric := &dto.Metric{}
+			gomega.Expect(counter.WithLabelValues(types.DefaultNetworkName, family).Write(metric)).To(gomega.Succeed())
+			return metric.GetCounter().GetValue()
+		}
+		var allocations = func(family string) float64 {
+			return counterValue(metrics.MetricNodeSubnetAllocationCount, family)
+		}
+		var releases = func(family string) float64 {
+			return counterValue(metrics.MetricNodeSubnetReleaseCount, family)
+		}
+
+		ginkgo.BeforeEach(func() {
+			metrics.MetricNodeSubnetAllocationCount.Reset()
+			metrics.MetricNodeSubnetReleaseCount.Reset()
+		})
+
+		ginkgo.It("counts the subnets newly allocated and released by family", func() {
+			node := newNode(map[string]string{})
+			startController(node)
+
+			hostSubnets, _, err := fakeOvn.controller.allocateNodeSubnets(node, fakeOvn.controller.masterSubnetAllocator)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(allocations("ipv4")).To(gomega.Equal(float64(1)))
+			gomega.Expect(allocations("ipv6")).To(gomega.BeZero())
+
+			// keeping the annotated subnets is not an allocation
+			annotated := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets": `{"default":"` + hostSubnets[0].String() + `"}`,
+			})
+			_, _, err = fakeOvn.controller.allocateNodeSubnets(annotated, fakeOvn.controller.masterSubnetAllocator)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(allocations("ipv4")).To(gomega.Equal(float64(1)))
+			gomega.Expect(releases("ipv4")).To(gomega.BeZero())
+
+			fakeOvn.controller.releaseDeletedNodeSubnets(nodeName)
+			gomega.Expect(releases("ipv4")).To(gomega.Equal(float64(1)))
+			// nothing left to release
+			fakeOvn.controller.releaseDeletedNodeSubnets(nodeName)
+			gomega.Expect(releases("ipv4")).To(gomega.Equal(float64(1)))
+		})
+
+		ginkgo.It("counts the subnets released when the allocation is rolled back", func() {
+			node := newNode(map[string]string{})
+			startController(node)
+			fakeOvn.controller.masterSubnetAllocator = subnetallocator.NewHostSubnetAllocator()
+			clusterSubnets, err := config.ParseClusterSubnetEntries("10.1.0.0/23/24")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(fakeOvn.controller.masterSubnetAllocator.InitRanges(clusterSubnets)).To(gomega.Succeed())
+			config.Default.NodeSubnetReserve = 2
+
+			_, _, err = fakeOvn.controller.allocateNodeSubnets(node, fakeOvn.controller.masterSubnetAllocator)
+			gomega.Expect(err).To(gomega.MatchError(errNodeSubnetReserved))
+			gomega.Expect(allocations("ipv4")).To(gomega.Equal(float64(1)))
+			gomega.Expect(releases("ipv4")).To(gomega.Equal(float64(1)))
+		})
+	})
+
+	ginkgo.Context("when counting the managed objects", func() {
+		var gaugeValue = func(objectType string) float64 {
+			metric := &dto.Metric{}
+			gomega.Expect(metrics.MetricManagedObjectCount.WithLabelValues(types.DefaultNetworkName, objectType).
+				Write(metric)).To(gomega.Succeed())
+			return metric.GetGauge().GetValue()
+		}
+
+		var addNode = func(name, subnet, chassis string) {
+			hostSubnets := ovntest.MustParseIPNets(subnet)
+			// the nodes are not known to the API server: annotate them with their router
+			// port MAC already so that it isn't updated
+			node := &v1.Node{ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+				Annotations: map[string]string{
+					"k8s.ovn.org/node-chassis-id": chassis,
+					"k8s.ovn.org/node-lrp-mac":    nodeRouterPortMAC(hostSubnets).String(),
+				},
+			}}
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(name, hostSubnets, "")).Error().To(gomega.Succeed())
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, hostSubnets)).To(gomega.Succeed())
+		}
+
+		ginkgo.It("counts the switches, router ports and gateway chassis of the nodes", func() {
+			startController()
+			addNode("node1", "10.1.1.0/24", "chassis1")
+			addNode("node2", "10.1.2.0/24", "chassis2")
+			addNode("node3", "10.1.3.0/24", "chassis3")
+			// a switch without a router port yet
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch("node4",
+				ovntest.MustParseIPNets("10.1.4.0/24"), "")).Error().To(gomega.Succeed())
+
+			counts, err := fakeOvn.controller.ObjectCounts()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(counts).To(gomega.Equal(ManagedObjectCounts{
+				LogicalSwitches: 4,
+				RouterPorts:     3,
+				GatewayChassis:  3,
+			}))
+			gomega.Expect(gaugeValue("logical_switch")).To(gomega.Equal(4.0))
+			gomega.Expect(gaugeValue("logical_router_port")).To(gomega.Equal(3.0))
+			gomega.Expect(gaugeValue("gateway_chassis")).To(gomega.Equal(3.0))
+
+			// the router ports of switches that are not tracked are not counted
+			fakeOvn.controller.lsManager.DeleteSwitch("node3")
+			counts, err = fakeOvn.controller.ObjectCounts()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(counts).To(gomega.Equal(ManagedObjectCounts{
+				LogicalSwitches: 3,
+				RouterPorts:     2,
+				GatewayChassis:  2,
+			}))
+		})
+
+		ginkgo.It("refreshes the metrics every interval", func() {
+			startController()
+			fakeClock := clocktesting.NewFakeClock(time.Now())
+			stopChan := make(chan struct{})
+			fakeOvn.controller.clock = fakeClock
+			fakeOvn.controller.stopChan = stopChan
+			addNode("node1", "10.1.1.0/24", "chassis1")
+
+			stopped := make(chan struct{})
+			go func() {
+				defer close(stopped)
+				fakeOvn.controller.runPeriodically(fakeOvn.controller.recordObjectCounts, time.Minute)
+			}()
+			gomega.Eventually(fakeClock.HasWaiters).Should(gomega.BeTrue())
+			fakeClock.Step(time.Minute)
+			gomega.Eventually(func() float64 { return gaugeValue("logical_switch") }).Should(gomega.Equal(1.0))
+
+			addNode("node2", "10.1.2.0/24", "chassis2")
+			fakeClock.Step(time.Minute)
+			gomega.Eventually(func() float64 { return gaugeValue("logical_switch") }).Should(gomega.Equal(2.0))
+			gomega.Eventually(func() float64 { return gaugeValue("gateway_chassis") }).Should(gomega.Equal(2.0))
+
+			close(stopChan)
+			gomega.Eventually(stopped).Should(gomega.BeClosed())
+		})
+	})
+
+	ginkgo.Context("when creating the cluster router", func() {
+		ginkgo.It("creates a single router for concurrent callers", func() {
+			fakeOvn.startWithDBSetup(libovsdbtest.TestSetup{})
+
+			const callers = 10
+			errs := make([]error, callers)
+			var wg sync.WaitGroup
+			for i := 0; i < callers; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer ginkgo.GinkgoRecover()
+					defer wg.Done()
+					_, errs[i] = fakeOvn.controller.createOvnClusterRouter()
+				}(i)
+			}
+			wg.Wait()
+			for i := 0; i < callers; i++ {
+				gomega.Expect(errs[i]).NotTo(gomega.HaveOccurred())
+			}
+			logicalRouters, err := libovsdbops.FindLogicalRoutersWithPredicate(fakeOvn.nbClient,
+				func(item *nbdb.LogicalRouter) bool { return item.Name == types.OVNClusterRouter })
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(logicalRouters).To(gomega.HaveLen(1))
+		})
+
+		ginkgo.It("updates an existing router with the current configuration", func() {
+			fakeOvn.startWithDBSetup(libovsdbtest.TestSetup{})
+			router, err := fakeOvn.controller.createOvnClusterRouter()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			router.Options = map[string]string{"always_learn_from_arp_request": "true"}
+			router.Copp = nil
+			gomega.Expect(libovsdbops.CreateOrUpdateLogicalRouter(fakeOvn.nbClient, router,
+				&router.Options, &router.Copp)).To(gomega.Succeed())
+
+			updated, err := fakeOvn.controller.createOvnClusterRouter()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(updated.UUID).To(gomega.Equal(router.UUID))
+			existing, err := libovsdbops.GetLogicalRouter(fakeOvn.nbClient, &nbdb.LogicalRouter{Name: types.OVNClusterRouter})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(existing.Options).To(gomega.HaveKeyWithValue("always_learn_from_arp_request", "false"))
+			gomega.Expect(existing.Copp).NotTo(gomega.BeNil())
+		})
+
+		ginkgo.It("creates it again once deleted out-of-band", func() {
+			fakeOvn.startWithDBSetup(libovsdbtest.TestSetup{})
+			router, err := fakeOvn.controller.createOvnClusterRouter()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			gomega.Expect(libovsdbops.DeleteLogicalRouter(fakeOvn.nbClient, router)).To(gomega.Succeed())
+			fakeOvn.controller.syncNodesPeriodic()
+
+			recreated, err := libovsdbops.GetLogicalRouter(fakeOvn.nbClient, &nbdb.LogicalRouter{Name: types.OVNClusterRouter})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(recreated.UUID).NotTo(gomega.Equal(router.UUID))
+		})
+
+		ginkgo.It("references the COPP another network already created", func() {
+			meterNames := map[string]string{}
+			for _, protocol := range defaultProtocolNames {
+				meterNames[protocol] = getMeterNameForProtocol(protocol)
+			}
+			sharedCOPP := &nbdb.Copp{UUID: "shared-copp-UUID", Name: "network2", Meters: meterNames}
+			fakeOvn.startWithDBSetup(libovsdbtest.TestSetup{NBData: []libovsdbtest.TestData{sharedCOPP}})
+			_, err := fakeOvn.controller.createOvnClusterRouter()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			copps, err := libovsdbops.FindCOPPsWithPredicate(fakeOvn.nbClient, func(*nbdb.Copp) bool { return true })
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(copps).To(gomega.HaveLen(1))
+			router, err := libovsdbops.GetLogicalRouter(fakeOvn.nbClient, &nbdb.LogicalRouter{Name: types.OVNClusterRouter})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(router.Copp).To(gomega.Equal(&copps[0].UUID))
+		})
+
+		ginkgo.It("tags it with the configured external IDs alongside the topology version", func() {
+			config.Default.ClusterRouterExternalIDs = map[string]string{"owner": "team-a", "cost-center": "1234"}
+			fakeOvn.startWithDBSetup(libovsdbtest.TestSetup{})
+			_, err := fakeOvn.controller.createOvnClusterRouter()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(fakeOvn.controller.updateL3TopologyVersion()).To(gomega.Succeed())
+
+			router, err := libovsdbops.GetLogicalRouter(fakeOvn.nbClient, &nbdb.LogicalRouter{Name: types.OVNClusterRouter})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(router.ExternalIDs).To(gomega.Equal(map[string]string{
+				"k8s-cluster-router":              "yes",
+				"k8s-cluster-router-external-ids": "cost-center,owner",
+				"k8s-ovn-topo-version":            strconv.Itoa(types.OvnCurrentTopologyVersion),
+				"owner":                           "team-a",
+				"cost-center":                     "1234",
+			}))
+		})
+
+		ginkgo.It("keeps the external IDs of an existing router", func() {
+			config.Default.ClusterRouterExternalIDs = map[string]string{"owner": "team-a"}
+			fakeOvn.startWithDBSetup(libovsdbtest.TestSetup{
+				NBData: []libovsdbtest.TestData{&nbdb.LogicalRouter{
+					Name: types.OVNClusterRouter,
+					ExternalIDs: map[string]string{
+						"k8s-cluster-router":   "yes",
+						"k8s-ovn-topo-version": "1",
+						"owner":                "team-b",
+						"tagged-by":            "admin",
+					},
+				}},
+			})
+			_, err := fakeOvn.controller.createOvnClusterRouter()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			router, err := libovsdbops.GetLogicalRouter(fakeOvn.nbClient, &nbdb.LogicalRouter{Name: types.OVNClusterRouter})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(router.ExternalIDs).To(gomega.Equal(map[string]string{
+				"k8s-cluster-router":              "yes",
+				"k8s-cluster-router-external-ids": "owner",
+				"k8s-ovn-topo-version":            "1",
+				"owner":                           "team-a",
+				"tagged-by":                       "admin",
+			}))
+		})
+
+		ginkgo.It("removes the external IDs no longer configured", func() {
+			config.Default.ClusterRouterExternalIDs = map[string]string{"owner": "team-a", "cost-center": "1234"}
+			fakeOvn.startWithDBSetup(libovsdbtest.TestSetup{})
+			_, err := fakeOvn.controller.createOvnClusterRouter()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			router, err := libovsdbops.GetLogicalRouter(fakeOvn.nbClient, &nbdb.LogicalRouter{Name: types.OVNClusterRouter})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			router.ExternalIDs["tagged-by"] = "admin"
+			gomega.Expect(libovsdbops.CreateOrUpdateLogicalRouter(fakeOvn.nbClient, router, &router.ExternalIDs)).To(gomega.Succeed())
+
+			config.Default.ClusterRouterExternalIDs = map[string]string{"owner": "team-b"}
+			_, err = fakeOvn.controller.createOvnClusterRouter()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			router, err = libovsdbops.GetLogicalRouter(fakeOvn.nbClient, &nbdb.LogicalRouter{Name: types.OVNClusterRouter})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(router.ExternalIDs).To(gomega.Equal(map[string]string{
+				"k8s-cluster-router":              "yes",
+				"k8s-cluster-router-external-ids": "owner",
+				"owner":                           "team-b",
+				"tagged-by":                       "admin",
+			}))
+
+			config.Default.ClusterRouterExternalIDs = nil
+			_, err = fakeOvn.controller.createOvnClusterRouter()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			router, err = libovsdbops.GetLogicalRouter(fakeOvn.nbClient, &nbdb.LogicalRouter{Name: types.OVNClusterRouter})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(router.ExternalIDs).To(gomega.Equal(map[string]string{
+				"k8s-cluster-router": "yes",
+				"tagged-by":          "admin",
+			}))
+		})
+
+		ginkgo.It("recreates it keeping its external IDs and ports", func() {
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets":    `{"default":"` + nodeSubnet + `"}`,
+				"k8s.ovn.org/node-chassis-id": chassisID,
+			})
+			startController(node)
+			hostSubnets := ovntest.MustParseIPNets(nodeSubnet)
+			gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName, hostSubnets, "")).Error().To(gomega.Succeed())
+			gomega.Expect(fakeOvn.controller.syncNodeClusterRouterPort(node, hostSubnets)).To(gomega.Succeed())
+			gomega.Expect(fakeOvn.controller.updateL3TopologyVersion()).To(gomega.Succeed())
+			existing, err := libovsdbops.GetLogicalRouter(fakeOvn.nbClient, &nbdb.LogicalRouter{Name: types.OVNClusterRouter})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			existing.Options = map[string]string{"stale-option": "true"}
+			gomega.Expect(libovsdbops.CreateOrUpdateLogicalRouter(fakeOvn.nbClient, existing, &existing.Options)).To(gomega.Succeed())
+			lrp, err := libovsdbops.GetLogicalRouterPort(fakeOvn.nbClient,
+				&nbdb.LogicalRouterPort{Name: types.RouterToSwitchPrefix + nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			router, err := fakeOvn.controller.recreateClusterRouter()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(router.UUID).NotTo(gomega.Equal(existing.UUID))
+
+			logicalRouters, err := libovsdbops.FindLogicalRoutersWithPredicate(fakeOvn.nbClient,
+				func(item *nbdb.LogicalRouter) bool { return item.Name == types.OVNClusterRouter })
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(logicalRouters).To(gomega.HaveLen(1))
+			recreated := logicalRouters[0]
+			gomega.Expect(recreated.UUID).To(gomega.Equal(router.UUID))
+			gomega.Expect(recreated.ExternalIDs).To(gomega.HaveKeyWithValue("k8s-cluster-router", "yes"))
+			gomega.Expect(recreated.ExternalIDs).To(gomega.HaveKeyWithValue("k8s-ovn-topo-version",
+				strconv.Itoa(types.OvnCurrentTopologyVersion)))
+			gomega.Expect(recreated.Options).To(gomega.HaveKeyWithValue("always_learn_from_arp_request", "false"))
+			gomega.Expect(recreated.Options).NotTo(gomega.HaveKey("stale-option"))
+			gomega.Expect(recreated.Ports).To(gomega.ConsistOf(existing.Ports))
+			gomega.Expect(recreated.Ports).To(gomega.ContainElement(lrp.UUID))
+
+			// the node router port is still there, along with its gateway chassis
+			_, err = libovsdbops.GetLogicalRouterPort(fakeOvn.nbClient, &nbdb.LogicalRouterPort{UUID: lrp.UUID})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(lrp.GatewayChassis).To(gomega.HaveLen(1))
+			_, err = libovsdbops.GetGatewayChassis(fakeOvn.nbClient, &nbdb.GatewayChassis{UUID: lrp.GatewayChassis[0]})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("creates it when recreating a missing router", func() {
+			fakeOvn.startWithDBSetup(libovsdbtest.TestSetup{})
+
+			router, err := fakeOvn.controller.recreateClusterRouter()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			created, err := libovsdbops.GetLogicalRouter(fakeOvn.nbClient, &nbdb.LogicalRouter{Name: types.OVNClusterRouter})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(created.UUID).To(gomega.Equal(router.UUID))
+			gomega.Expect(created.ExternalIDs).To(gomega.Equal(map[string]string{"k8s-cluster-router": "yes"}))
+		})
+	})
+
+	ginkgo.Context("when reconciling the router COPPs", func() {
+		getCOPP := func(routerName string) *string {
+			router, err := libovsdbops.GetLogicalRouter(fakeOvn.nbClient, &nbdb.LogicalRouter{Name: routerName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			return router.Copp
+		}
+
+		ginkgo.BeforeEach(func() {
+			dbSetup.NBData = append(dbSetup.NBData,
+				&nbdb.LogicalRouter{UUID: "gr1-UUID", Name: types.GWRouterPrefix + "node1"},
+				&nbdb.LogicalRouter{UUID: "gr2-UUID", Name: types.GWRouterPrefix + "node2"},
+				&nbdb.LogicalRouter{UUID: "custom-UUID", Name: "custom-router"},
+			)
+		})
+
+		ginkgo.It("attaches the default COPP to every managed router", func() {
+			startController()
+			attached, err := fakeOvn.controller.reconcileRouterCOPPs()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(attached).To(gomega.ConsistOf(types.OVNClusterRouter,
+				types.GWRouterPrefix+"node1", types.GWRouterPrefix+"node2"))
+
+			defaultCOPPUUID := fakeOvn.controller.defaultCOPPUUID
+			gomega.Expect(defaultCOPPUUID).NotTo(gomega.BeEmpty())
+			for _, name := range attached {
+				gomega.Expect(getCOPP(name)).To(gomega.Equal(&defaultCOPPUUID))
+			}
+			gomega.Expect(getCOPP("custom-router")).To(gomega.BeNil())
+
+			// nothing left to attach
+			attached, err = fakeOvn.controller.reconcileRouterCOPPs()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(attached).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("only attaches the routers that lost the default COPP", func() {
+			startController()
+			gomega.Expect(fakeOvn.controller.SetupMaster(nil)).To(gomega.Succeed())
+
+			attached, err := fakeOvn.controller.reconcileRouterCOPPs()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(attached).To(gomega.ConsistOf(types.GWRouterPrefix+"node1", types.GWRouterPrefix+"node2"))
+			gomega.Expect(getCOPP(types.GWRouterPrefix + "node1")).To(gomega.Equal(getCOPP(types.OVNClusterRouter)))
+		})
+	})
+
+	ginkgo.Context("when upgrading the OVN topology", func() {
+		var topologyUpgrades = func(fromVersion int) float64 {
+			metric := &dto.Metric{}
+			gomega.Expect(metrics.MetricTopologyUpgradeCount.WithLabelValues(fmt.Sprintf("%d", fromVersion),
+				fmt.Sprintf("%d", types.OvnCurrentTopologyVersion)).Write(metric)).To(gomega.Succeed())
+			return metric.GetCounter().GetValue()
+		}
+		var startWithTopologyVersion = func(version int) {
+			router := newOVNClusterRouter()
+			router.ExternalIDs = map[string]string{"k8s-ovn-topo-version": fmt.Sprintf("%d", version)}
+			fakeOvn.startWithDBSetup(libovsdbtest.TestSetup{NBData: []libovsdbtest.TestData{router}})
+		}
+
+		ginkgo.It("reports the upgrade from an older version", func() {
+			const oldVersion = types.OvnPortBindingTopoVersion
+			startWithTopologyVersion(oldVersion)
+			upgrades := topologyUpgrades(oldVersion)
+
+			gomega.Expect(fakeOvn.controller.upgradeOVNTopology(&v1.NodeList{})).To(gomega.Succeed())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.And(
+				gomega.ContainSubstring("TopologyUpgrade"),
+				gomega.ContainSubstring(fmt.Sprintf("from version %d to version %d", oldVersion, types.OvnCurrentTopologyVersion)),
+			)))
+			gomega.Expect(topologyUpgrades(oldVersion)).To(gomega.Equal(upgrades + 1))
+		})
+
+		ginkgo.It("does not report an upgrade when the version is current", func() {
+			startWithTopologyVersion(types.OvnCurrentTopologyVersion)
+			upgrades := topologyUpgrades(types.OvnCurrentTopologyVersion)
+
+			gomega.Expect(fakeOvn.controller.upgradeOVNTopology(&v1.NodeList{})).To(gomega.Succeed())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.BeEmpty())
+			gomega.Expect(topologyUpgrades(types.OvnCurrentTopologyVersion)).To(gomega.Equal(upgrades))
+		})
+
+		ginkgo.It("bumps the version and merges the router options together", func() {
+			router := newOVNClusterRouter()
+			router.ExternalIDs = map[string]string{
+				"k8s-cluster-router":   "yes",
+				"k8s-ovn-topo-version": fmt.Sprintf("%d", types.OvnPortBindingTopoVersion),
+			}
+			router.Options = map[string]string{"mcast_relay": "true", "always_learn_from_arp_request": "true"}
+			fakeOvn.startWithDBSetup(libovsdbtest.TestSetup{NBData: []libovsdbtest.TestData{router}})
+
+			gomega.Expect(fakeOvn.controller.updateL3TopologyVersionAndRouterOptions(map[string]string{
+				"always_learn_from_arp_request": "false",
+			})).To(gomega.Succeed())
+			updated, err := libovsdbops.GetLogicalRouter(fakeOvn.nbClient, &nbdb.LogicalRouter{Name: types.OVNClusterRouter})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(updated.ExternalIDs).To(gomega.Equal(map[string]string{
+				"k8s-cluster-router":   "yes",
+				"k8s-ovn-topo-version": fmt.Sprintf("%d", types.OvnCurrentTopologyVersion),
+			}))
+			gomega.Expect(updated.Options).To(gomega.Equal(map[string]string{
+				"mcast_relay":                   "true",
+				"always_learn_from_arp_request": "false",
+			}))
+		})
+
+		ginkgo.It("does not report an upgrade of an empty database", func() {
+			fakeOvn.startWithDBSetup(libovsdbtest.TestSetup{})
+
+			gomega.Expect(fakeOvn.controller.upgradeOVNTopology(&v1.NodeList{})).To(gomega.Succeed())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.Context("when updating the cluster router options", func() {
+		ginkgo.It("merges them with the options of the existing router", func() {
+			router := newOVNClusterRouter()
+			router.Options = map[string]string{"dynamic_neigh_routers": "true", "mcast_relay": "false"}
+			fakeOvn.startWithDBSetup(libovsdbtest.TestSetup{NBData: []libovsdbtest.TestData{router}})
+			fakeOvn.controller.multicastSupport = true
+
+			_, err := fakeOvn.controller.createOvnClusterRouter()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(fakeOvn.controller.setClusterRouterMulticastRelay(true)).To(gomega.Succeed())
+
+			updated, err := libovsdbops.GetLogicalRouter(fakeOvn.nbClient, &nbdb.LogicalRouter{Name: types.OVNClusterRouter})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(updated.Options).To(gomega.Equal(map[string]string{
+				"always_learn_from_arp_request": "false",
+				"dynamic_neigh_routers":         "true",
+				"mcast_relay":                   "true",
+			}))
+		})
+
+		ginkgo.It("removes the multicast relay once multicast is not supported", func() {
+			router := newOVNClusterRouter()
+			router.Options = map[string]string{"dynamic_neigh_routers": "true", "mcast_relay": "true"}
+			fakeOvn.startWithDBSetup(libovsdbtest.TestSetup{NBData: []libovsdbtest.TestData{router}})
+			fakeOvn.controller.multicastSupport = false
+
+			_, err := fakeOvn.controller.createOvnClusterRouter()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			updated, err := libovsdbops.GetLogicalRouter(fakeOvn.nbClient, &nbdb.LogicalRouter{Name: types.OVNClusterRouter})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(updated.Options).To(gomega.Equal(map[string]string{
+				"always_learn_from_arp_request": "false",
+				"dynamic_neigh_routers":         "true",
+			}))
+		})
+
+		ginkgo.Context("counting the updates overwriting them", func() {
+			overwrites := func() float64 {
+				metric := &dto.Metric{}
+				gomega.Expect(metrics.MetricClusterRouterOptionsOverwriteCount.Write(metric)).To(gomega.Succeed())
+				return metric.GetCounter().GetValue()
+			}
+
+			ginkgo.It("does not count the updates merging them", func() {
+				router := newOVNClusterRouter()
+				router.Options = map[string]string{"dynamic_neigh_routers": "true", "mcast_relay": "false"}
+				fakeOvn.startWithDBSetup(libovsdbtest.TestSetup{NBData: []libovsdbtest.TestData{router}})
+				fakeOvn.controller.multicastSupport = true
+				before := overwrites()
+
+				_, err := fakeOvn.controller.createOvnClusterRouter()
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				gomega.Expect(fakeOvn.controller.setNamespaceMulticast("ns1", true)).To(gomega.Succeed())
+				gomega.Expect(fakeOvn.controller.setNamespaceMulticast("ns1", false)).To(gomega.Succeed())
+				_, err = fakeOvn.controller.createOvnClusterRouter()
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+				gomega.Expect(overwrites()).To(gomega.Equal(before))
+				updated, err := libovsdbops.GetLogicalRouter(fakeOvn.nbClient, &nbdb.LogicalRouter{Name: types.OVNClusterRouter})
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				gomega.Expect(updated.Options).To(gomega.Equal(map[string]string{
+					"always_learn_from_arp_request": "false",
+					"dynamic_neigh_routers":         "true",
+					"mcast_relay":                   "false",
+				}))
+			})
+
+			ginkgo.It("counts an update replacing them", func() {
+				router := newOVNClusterRouter()
+				router.Options = map[string]string{"always_learn_from_arp_request": "false", "mcast_relay": "true"}
+				fakeOvn.startWithDBSetup(libovsdbtest.TestSetup{NBData: []libovsdbtest.TestData{router}})
+				fakeOvn.controller.multicastSupport = true
+				before := overwrites()
+
+				existing, err := libovsdbops.GetLogicalRouter(fakeOvn.nbClient, &nbdb.LogicalRouter{Name: types.OVNClusterRouter})
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				replaced := &nbdb.LogicalRouter{Name: types.OVNClusterRouter, Options: map[string]string{"mcast_relay": "false"}}
+				gomega.Expect(fakeOvn.controller.createOrUpdateClusterRouter(existing, replaced, &replaced.Options)).To(gomega.Succeed())
+
+				gomega.Expect(overwrites()).To(gomega.Equal(before + 1))
+			})
+		})
+	})
+
+	ginkgo.Context("when reporting the effective config", func() {
+		ginkgo.It("reflects the constructor and config inputs", func() {
+			fakeOvn.start()
+			config.IPv4Mode = true
+			config.IPv6Mode = true
+			clusterSubnets, err := config.ParseClusterSubnetEntries("10.1.0.0/16/24,fd00:10:244::/48/64")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			config.Default.ClusterSubnets = clusterSubnets
+			config.Default.HostSubnetAlignmentBits = 2
+			config.Default.DisableDeferredAddressSetDestroy = true
+			config.HybridOverlay.Enabled = true
+			config.Gateway.Mode = config.GatewayModeLocal
+			config.OVNKubernetesFeature.EnableEgressIP = true
+
+			cnci := NewCommonNetworkControllerInfo(nil, nil, nil, nil, nil, nil, nil, true, false)
+			bnc := &BaseNetworkController{CommonNetworkControllerInfo: *cnci, netName: "net1"}
+			effective := bnc.EffectiveConfig()
+			gomega.Expect(effective).To(gomega.Equal(EffectiveConfig{
+				NetworkName:                "net1",
+				SCTPSupport:                true,
+				MulticastSupport:           false,
+				IPv4Mode:                   true,
+				IPv6Mode:                   true,
+				ClusterSubnets:             []string{"10.1.0.0/16/24", "fd00:10:244::/48/64"},
+				HostSubnetAlignmentBits:    2,
+				HybridOverlay:              true,
+				GatewayMode:                "local",
+				DeferredAddressSetDestroy:  false,
+				EgressIP:                   true,
+				SubnetUsageRefreshInterval: config.Metrics.SubnetUsageRefreshInterval,
+			}))
+
+			// it can be serialized for support tooling
+			data, err := json.Marshal(effective)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			var decoded map[string]interface{}
+			gomega.Expect(json.Unmarshal(data, &decoded)).To(gomega.Succeed())
+			gomega.Expect(decoded).To(gomega.HaveKeyWithValue("sctpSupport", true))
+			gomega.Expect(decoded).To(gomega.HaveKeyWithValue("gatewayMode", "local"))
+
+			gomega.Expect(fakeOvn.controller.EffectiveConfig().NetworkName).To(gomega.Equal(types.DefaultNetworkName))
+		})
+	})
+
+	ginkgo.Context("when reporting the load balancer groups of a node switch", func() {
+		ginkgo.It("returns the names of the groups the switch belongs to", func() {
+			otherGroup := &nbdb.LoadBalancerGroup{Name: "aOtherLBGroup", UUID: "aOtherLBGroup-UUID"}
+			unusedGroup := &nbdb.LoadBalancerGroup{Name: "unusedLBGroup", UUID: "unusedLBGroup-UUID"}
+			dbSetup.NBData = append(dbSetup.NBData, otherGroup, unusedGroup)
+			startController()
+			// the test server assigns real UUIDs to the groups
+			lbGroupUUIDs := map[string]string{}
+			lbGroups, err := libovsdbops.FindLoadBalancerGroupsWithPredicate(fakeOvn.nbClient,
+				func(*nbdb.LoadBalancerGroup) bool { return true })
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			for _, lbGroup := range lbGroups {
+				lbGroupUUIDs[lbGroup.Name] = lbGroup.UUID
+			}
+			hostSubnets := ovntest.MustParseIPNets(nodeSubnet)
+			_, err = fakeOvn.controller.createNodeLogicalSwitch(nodeName, hostSubnets, lbGroupUUIDs[types.ClusterLBGroupName])
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			groups, err := fakeOvn.controller.NodeSwitchLoadBalancerGroups(nodeName)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(groups).To(gomega.Equal([]string{types.ClusterLBGroupName}))
+
+			logicalSwitch, err := libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			logicalSwitch.LoadBalancerGroup = append(logicalSwitch.LoadBalancerGroup, lbGroupUUIDs[otherGroup.Name])
+			err = libovsdbops.CreateOrUpdateLogicalSwitch(fakeOvn.nbClient, logicalSwitch, &logicalSwitch.LoadBalancerGroup)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			groups, err = fakeOvn.controller.NodeSwitchLoadBalancerGroups(nodeName)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(groups).To(gomega.Equal([]string{otherGroup.Name, types.ClusterLBGroupName}))
+		})
+
+		ginkgo.It("returns no groups for a switch without load balancer groups", func() {
+			startController()
+			_, err := fakeOvn.controller.createNodeLogicalSwitch(nodeName, ovntest.MustParseIPNets(nodeSubnet), "")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			groups, err := fakeOvn.controller.NodeSwitchLoadBalancerGroups(nodeName)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(groups).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("fails for a node without a switch", func() {
+			startController()
+			_, err := fakeOvn.controller.NodeSwitchLoadBalancerGroups(nodeName)
+			gomega.Expect(err).To(gomega.HaveOccurred())
+		})
+	})
+
+	ginkgo.Context("when exporting the topology graph", func() {
+		ginkgo.It("contains the cluster router, node switch, router port and gateway chassis", func() {
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets":    `{"default":"` + nodeSubnet + `"}`,
+				"k8s.ovn.org/node-chassis-id": chassisID,
+			})
+			startController(node)
+			hostSubnets := ovntest.MustParseIPNets(nodeSubnet)
+			_, err := fakeOvn.controller.createNodeLogicalSwitch(nodeName, hostSubnets, "")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			err = fakeOvn.controller.syncNodeClusterRouterPort(node, hostSubnets)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			graph, err := fakeOvn.controller.ExportTopologyGraph()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			routerID := TopologyNodeRouter + "/" + types.OVNClusterRouter
+			lrpID := TopologyNodeRouterPort + "/" + types.RouterToSwitchPrefix + nodeName
+			switchID := TopologyNodeSwitch + "/" + nodeName
+			chassisNodeID := TopologyNodeGatewayChassis + "/" + types.RouterToSwitchPrefix + nodeName + "-" + chassisID
+			gomega.Expect(graph.Nodes).To(gomega.ConsistOf(
+				TopologyNode{ID: routerID, Kind: TopologyNodeRouter, Name: types.OVNClusterRouter},
+				TopologyNode{ID: lrpID, Kind: TopologyNodeRouterPort, Name: types.RouterToSwitchPrefix + nodeName,
+					Attributes: map[string]string{"mac": "0a:58:0a:01:01:01", "networks": "10.1.1.1/24"}},
+				TopologyNode{ID: switchID, Kind: TopologyNodeSwitch, Name: nodeName,
+					Attributes: map[string]string{"subnet": nodeSubnet}},
+				TopologyNode{ID: chassisNodeID, Kind: TopologyNodeGatewayChassis, Name: types.RouterToSwitchPrefix + nodeName + "-" + chassisID,
+					Attributes: map[string]string{"chassis": chassisID, "priority": "1"}},
+			))
+			gomega.Expect(graph.Edges).To(gomega.ConsistOf(
+				TopologyEdge{From: routerID, To: lrpID},
+				TopologyEdge{From: lrpID, To: switchID},
+				TopologyEdge{From: lrpID, To: chassisNodeID},
+			))
+
+			// the graph can be serialized as is
+			data, err := json.Marshal(graph)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			decoded := &TopologyGraph{}
+			gomega.Expect(json.Unmarshal(data, decoded)).To(gomega.Succeed())
+			gomega.Expect(decoded).To(gomega.Equal(graph))
+		})
+
+		ginkgo.It("fails without a cluster router", func() {
+			fakeOvn.startWithDBSetup(libovsdbtest.TestSetup{})
+			_, err := fakeOvn.controller.ExportTopologyGraph()
+			gomega.Expect(err).To(gomega.HaveOccurred())
+		})
+	})
+
+	ginkgo.Context("when syncing node host subnets", func() {
+		ginkgo.It("marks the annotated subnets allocated", func() {
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets": `{"default":"` + nodeSubnet + `"}`,
+			})
+			startController(node)
+
+			foundNodes := sets.NewString()
+			hostSubnets := fakeOvn.controller.updateNodesManageHostSubnets(node, fakeOvn.controller.masterSubnetAllocator, foundNodes)
+			gomega.Expect(hostSubnets).To(gomega.Equal(ovntest.MustParseIPNets(nodeSubnet)))
+			gomega.Expect(foundNodes.Has(nodeName)).To(gomega.BeTrue())
+			err := fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated("node2", ovntest.MustParseIPNets(nodeSubnet)...)
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("reports a corrupt subnet annotation", func() {
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets": `{"default":"not-a-subnet"}`,
+			})
+			startController(node)
+
+			foundNodes := sets.NewString()
+			hostSubnets := fakeOvn.controller.updateNodesManageHostSubnets(node, fakeOvn.controller.masterSubnetAllocator, foundNodes)
+			gomega.Expect(hostSubnets).To(gomega.BeEmpty())
+			// the node still exists, its switch must not be removed
+			gomega.Expect(foundNodes.Has(nodeName)).To(gomega.BeTrue())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.ContainSubstring("InvalidNodeSubnetAnnotation")))
+		})
+
+		ginkgo.It("ignores subnets that are not within the cluster subnets", func() {
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets": `{"default":["` + nodeSubnet + `","192.168.1.0/24"]}`,
+			})
+			startController(node)
+
+			foundNodes := sets.NewString()
+			hostSubnets := fakeOvn.controller.updateNodesManageHostSubnets(node, fakeOvn.controller.masterSubnetAllocator, foundNodes)
+			gomega.Expect(hostSubnets).To(gomega.Equal(ovntest.MustParseIPNets(nodeSubnet)))
+			gomega.Expect(foundNodes.Has(nodeName)).To(gomega.BeTrue())
+			// the node subnet within the cluster subnets is still marked allocated
+			err := fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated("node2", ovntest.MustParseIPNets(nodeSubnet)...)
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.And(
+				gomega.ContainSubstring("ForeignNodeSubnet"),
+				gomega.ContainSubstring("192.168.1.0/24"),
+			)))
+			gomega.Expect(fakeOvn.fakeRecorder.Events).NotTo(gomega.Receive())
+		})
+
+		ginkgo.It("ignores a subnet of another cluster", func() {
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets": `{"default":"10.2.1.0/24"}`,
+			})
+			startController(node)
+
+			foundNodes := sets.NewString()
+			hostSubnets := fakeOvn.controller.updateNodesManageHostSubnets(node, fakeOvn.controller.masterSubnetAllocator, foundNodes)
+			gomega.Expect(hostSubnets).To(gomega.BeEmpty())
+			gomega.Expect(foundNodes.Has(nodeName)).To(gomega.BeTrue())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.ContainSubstring("ForeignNodeSubnet")))
+
+			// the node gets a subnet of the cluster subnets instead
+			hostSubnets, _, err := fakeOvn.controller.allocateNodeSubnets(node, fakeOvn.controller.masterSubnetAllocator)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(hostSubnets).To(gomega.HaveLen(1))
+			gomega.Expect(ovntest.MustParseIPNet("10.1.0.0/16").Contains(hostSubnets[0].IP)).To(gomega.BeTrue())
+		})
+
+		ginkgo.It("does not report nodes without a subnet annotation", func() {
+			node := newNode(map[string]string{})
+			startController(node)
+
+			foundNodes := sets.NewString()
+			hostSubnets := fakeOvn.controller.updateNodesManageHostSubnets(node, fakeOvn.controller.masterSubnetAllocator, foundNodes)
+			gomega.Expect(hostSubnets).To(gomega.BeEmpty())
+			gomega.Expect(foundNodes.Has(nodeName)).To(gomega.BeTrue())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.Context("with a subnet annotation fallback key", func() {
+		const fallbackKey = "k8s.ovn.org/node-subnets-legacy"
+
+		ginkgo.It("marks the subnets of the fallback annotation allocated", func() {
+			node := newNode(map[string]string{fallbackKey: `{"default":"` + nodeSubnet + `"}`})
+			startController(node)
+			fakeOvn.controller.subnetAnnotationFallbackKey = fallbackKey
+
+			foundNodes := sets.NewString()
+			hostSubnets := fakeOvn.controller.updateNodesManageHostSubnets(node, fakeOvn.controller.masterSubnetAllocator, foundNodes)
+			gomega.Expect(hostSubnets).To(gomega.Equal(ovntest.MustParseIPNets(nodeSubnet)))
+			err := fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated("node2", ovntest.MustParseIPNets(nodeSubnet)...)
+			gomega.Expect(err).To(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("migrates the subnets of the fallback annotation to the current annotation", func() {
+			node := newNode(map[string]string{
+				fallbackKey:                   `{"default":"` + nodeSubnet + `"}`,
+				"k8s.ovn.org/node-chassis-id": chassisID,
+			})
+			startController(node)
+			fakeOvn.controller.subnetAnnotationFallbackKey = fallbackKey
+
+			hostSubnets, err := fakeOvn.controller.addNode(node)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(hostSubnets).To(gomega.Equal(ovntest.MustParseIPNets(nodeSubnet)))
+			node, err = fakeOvn.fakeClient.KubeClient.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			hostSubnets, err = util.ParseNodeHostSubnetAnnotation(node, types.DefaultNetworkName)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(hostSubnets).To(gomega.Equal(ovntest.MustParseIPNets(nodeSubnet)))
+		})
+
+		ginkgo.It("prefers the current annotation to the fallback annotation", func() {
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets": `{"default":"` + nodeSubnet + `"}`,
+				fallbackKey:                `{"default":"10.1.2.0/24"}`,
+			})
+			startController(node)
+			fakeOvn.controller.subnetAnnotationFallbackKey = fallbackKey
+
+			hostSubnets, _, err := fakeOvn.controller.allocateNodeSubnets(node, fakeOvn.controller.masterSubnetAllocator)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(hostSubnets).To(gomega.Equal(ovntest.MustParseIPNets(nodeSubnet)))
+		})
+
+		ginkgo.It("ignores the fallback annotation unless configured", func() {
+			node := newNode(map[string]string{fallbackKey: `{"default":"` + nodeSubnet + `"}`})
+			startController(node)
+
+			foundNodes := sets.NewString()
+			hostSubnets := fakeOvn.controller.updateNodesManageHostSubnets(node, fakeOvn.controller.masterSubnetAllocator, foundNodes)
+			gomega.Expect(hostSubnets).To(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.Context("when allocating node subnets", func() {
+		const nodeIPv6Subnet = "fd00:10:244:1::/64"
+
+		var subnetsByFamily = func(subnets []*net.IPNet) (v4, v6 []string) {
+			for _, subnet := range subnets {
+				if utilnet.IsIPv6CIDR(subnet) {
+					v6 = append(v6, subnet.String())
+				} else {
+					v4 = append(v4, subnet.String())
+				}
+			}
+			return v4, v6
+		}
+
+		table.DescribeTable("adds the missing IP family when upgrading to dual-stack",
+			func(existingSubnet string, existingIsIPv6 bool) {
+				config.IPv4Mode = true
+				config.IPv6Mode = true
+				node := newNode(map[string]string{
+					"k8s.ovn.org/node-subnets": `{"default":"` + existingSubnet + `"}`,
+				})
+				startController(node)
+				v6ClusterSubnets, err := config.ParseClusterSubnetEntries("fd00:10:244::/48/64")
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				gomega.Expect(fakeOvn.controller.masterSubnetAllocator.InitRanges(v6ClusterSubnets)).To(gomega.Succeed())
+
+				hostSubnets, err := fakeOvn.controller.addNode(node)
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				v4, v6 := subnetsByFamily(hostSubnets)
+				gomega.Expect(v4).To(gomega.HaveLen(1))
+				gomega.Expect(v6).To(gomega.HaveLen(1))
+				// the existing subnet is kept
+				if existingIsIPv6 {
+					gomega.Expect(v6[0]).To(gomega.Equal(existingSubnet))
+				} else {
+					gomega.Expect(v4[0]).To(gomega.Equal(existingSubnet))
+				}
+
+				// and the annotation is updated with both subnets
+				updatedNode, err := fakeOvn.fakeClient.KubeClient.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				annotatedSubnets, err := util.ParseNodeHostSubnetAnnotation(updatedNode, types.DefaultNetworkName)
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				gomega.Expect(sameSubnets(annotatedSubnets, hostSubnets)).To(gomega.BeTrue())
+			},
+			table.Entry("from IPv4", nodeSubnet, false),
+			table.Entry("from IPv6", nodeIPv6Subnet, true),
+		)
+
+		ginkgo.It("only detects subnets missing a configured IP family as partial", func() {
+			fakeOvn.start()
+			config.IPv4Mode = true
+			config.IPv6Mode = true
+			gomega.Expect(isPartialHostSubnets(ovntest.MustParseIPNets(nodeSubnet))).To(gomega.BeTrue())
+			gomega.Expect(isPartialHostSubnets(ovntest.MustParseIPNets(nodeIPv6Subnet))).To(gomega.BeTrue())
+			gomega.Expect(isPartialHostSubnets(ovntest.MustParseIPNets(nodeSubnet, nodeIPv6Subnet))).To(gomega.BeFalse())
+			gomega.Expect(isPartialHostSubnets(nil)).To(gomega.BeFalse())
+
+			config.IPv6Mode = false
+			gomega.Expect(isPartialHostSubnets(ovntest.MustParseIPNets(nodeSubnet))).To(gomega.BeFalse())
+			gomega.Expect(isPartialHostSubnets(ovntest.MustParseIPNets(nodeSubnet, nodeIPv6Subnet))).To(gomega.BeFalse())
+		})
+
+		ginkgo.Context("with a single-family node in a dual-stack cluster", func() {
+			startDualStackController := func(families string) {
+				config.IPv4Mode = true
+				config.IPv6Mode = true
+				node := newNode(map[string]string{"k8s.ovn.org/node-ip-families": families})
+				startController(node)
+				v6ClusterSubnets, err := config.ParseClusterSubnetEntries("fd00:10:244::/48/64")
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				gomega.Expect(fakeOvn.controller.masterSubnetAllocator.InitRanges(v6ClusterSubnets)).To(gomega.Succeed())
+			}
+
+			getSwitchOtherConfig := func() map[string]string {
+				ls, err := libovsdbops.GetLogicalSwitch(fakeOvn.nbClient, &nbdb.LogicalSwitch{Name: nodeName})
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				return ls.OtherConfig
+			}
+
+			table.DescribeTable("only gives it subnets of its IP families", func(families string, isIPv6 bool) {
+				config.Default.AllowSingleFamilyNodes = true
+				startDualStackController(families)
+
+				hostSubnets, err := fakeOvn.controller.addNode(newNode(map[string]string{"k8s.ovn.org/node-ip-families": families}))
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				v4, v6 := subnetsByFamily(hostSubnets)
+				otherConfig := getSwitchOtherConfig()
+				if isIPv6 {
+					gomega.Expect(v4).To(gomega.BeEmpty())
+					gomega.Expect(v6).To(gomega.HaveLen(1))
+					gomega.Expect(otherConfig).NotTo(gomega.HaveKey("subnet"))
+					gomega.Expect(otherConfig).To(gomega.HaveKey("ipv6_prefix"))
+				} else {
+					gomega.Expect(v4).To(gomega.HaveLen(1))
+					gomega.Expect(v6).To(gomega.BeEmpty())
+					gomega.Expect(otherConfig).To(gomega.HaveKeyWithValue("subnet", v4[0]))
+					gomega.Expect(otherConfig).NotTo(gomega.HaveKey("ipv6_prefix"))
+				}
+
+				// and keeps them when synced again
+				updatedNode, err := fakeOvn.fakeClient.KubeClient.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				syncedSubnets, err := fakeOvn.controller.addNode(updatedNode)
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				gomega.Expect(sameSubnets(syncedSubnets, hostSubnets)).To(gomega.BeTrue())
+			},
+				table.Entry("IPv4", "ipv4", false),
+				table.Entry("IPv6", "ipv6", true),
+			)
+
+			ginkgo.It("gives it subnets of both IP families unless allowed", func() {
+				startDualStackController("ipv4")
+
+				hostSubnets, err := fakeOvn.controller.addNode(newNode(map[string]string{"k8s.ovn.org/node-ip-families": "ipv4"}))
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				v4, v6 := subnetsByFamily(hostSubnets)
+				gomega.Expect(v4).To(gomega.HaveLen(1))
+				gomega.Expect(v6).To(gomega.HaveLen(1))
+			})
+
+			ginkgo.It("only adds the subnets of its IP families to its switch", func() {
+				config.Default.AllowSingleFamilyNodes = true
+				startDualStackController("ipv4")
+
+				gomega.Expect(fakeOvn.controller.createNodeLogicalSwitch(nodeName,
+					ovntest.MustParseIPNets(nodeSubnet, nodeIPv6Subnet), "")).Error().To(gomega.Succeed())
+				otherConfig := getSwitchOtherConfig()
+				gomega.Expect(otherConfig).To(gomega.HaveKeyWithValue("subnet", nodeSubnet))
+				gomega.Expect(otherConfig).NotTo(gomega.HaveKey("ipv6_prefix"))
+				gomega.Expect(sameSubnets(fakeOvn.controller.lsManager.GetSwitchSubnets(nodeName),
+					ovntest.MustParseIPNets(nodeSubnet))).To(gomega.BeTrue())
+			})
+		})
+
+		ginkgo.Context("when the node subnets of one IP family are exhausted", func() {
+			startExhaustedIPv4Controller := func() {
+				config.IPv4Mode = true
+				config.IPv6Mode = true
+				startController(newNode(nil))
+				v6ClusterSubnets, err := config.ParseClusterSubnetEntries("fd00:10:244::/48/64")
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				gomega.Expect(fakeOvn.controller.masterSubnetAllocator.InitRanges(v6ClusterSubnets)).To(gomega.Succeed())
+				for i := 0; ; i++ {
+					if _, _, err := fakeOvn.controller.masterSubnetAllocator.AllocateNodeSubnets(
+						fmt.Sprintf("filler%d", i), nil, true, false); err != nil {
+						break
+					}
+				}
+			}
+
+			exhaustedCount := func(singleFamily string) float64 {
+				metric := &dto.Metric{}
+				gomega.Expect(metrics.MetricNodeSubnetFamilyExhaustedCount.WithLabelValues("ipv4", singleFamily).
+					Write(metric)).To(gomega.Succeed())
+				return metric.GetCounter().GetValue()
+			}
+
+			ginkgo.It("fails to allocate the subnets of a new node unless allowed", func() {
+				startExhaustedIPv4Controller()
+				before := exhaustedCount("false")
+
+				_, _, err := fakeOvn.controller.allocateNodeSubnets(newNode(nil), fakeOvn.controller.masterSubnetAllocator)
+				gomega.Expect(errors.Is(err, subnetallocator.ErrSubnetAllocatorFull)).To(gomega.BeTrue())
+				gomega.Expect(exhaustedCount("false")).To(gomega.Equal(before + 1))
+				// the IPv6 subnet is not left allocated
+				v4Free, v6Free := fakeOvn.controller.masterSubnetAllocator.FreeSubnets()
+				gomega.Expect(v4Free).To(gomega.BeZero())
+				gomega.Expect(v6Free).To(gomega.Equal(uint64(65536)))
+			})
+
+			ginkgo.It("gives a new node the subnet of the other IP family when allowed", func() {
+				config.Default.AllowSingleFamilyOnSubnetExhaustion = true
+				startExhaustedIPv4Controller()
+				before := exhaustedCount("true")
+
+				hostSubnets, allocated, err := fakeOvn.controller.allocateNodeSubnets(newNode(nil),
+					fakeOvn.controller.masterSubnetAllocator)
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				v4, v6 := subnetsByFamily(hostSubnets)
+				gomega.Expect(v4).To(gomega.BeEmpty())
+				gomega.Expect(v6).To(gomega.HaveLen(1))
+				gomega.Expect(allocated).To(gomega.Equal(hostSubnets))
+				gomega.Expect(exhaustedCount("true")).To(gomega.Equal(before + 1))
+				gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.ContainSubstring("NodeSubnetFamilyExhausted")))
+			})
+
+			ginkgo.It("keeps the subnet a node already has of the other IP family when allowed", func() {
+				config.Default.AllowSingleFamilyOnSubnetExhaustion = true
+				startExhaustedIPv4Controller()
+
+				node := newNode(map[string]string{
+					"k8s.ovn.org/node-subnets": `{"default":"` + nodeIPv6Subnet + `"}`,
+				})
+				hostSubnets, allocated, err := fakeOvn.controller.allocateNodeSubnets(node,
+					fakeOvn.controller.masterSubnetAllocator)
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				gomega.Expect(hostSubnets).To(gomega.Equal(ovntest.MustParseIPNets(nodeIPv6Subnet)))
+				gomega.Expect(allocated).To(gomega.BeEmpty())
+			})
+		})
+	})
+
+	ginkgo.Context("with node subnets for multiple networks", func() {
+		const (
+			secondaryNetName    = "blue"
+			secondaryNodeSubnet = "10.2.1.0/24"
+		)
+
+		newSecondaryController := func() (*BaseNetworkController, *subnetallocator.HostSubnetAllocator) {
+			allocator := subnetallocator.NewHostSubnetAllocator()
+			clusterSubnets, err := config.ParseClusterSubnetEntries("10.2.0.0/16")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(allocator.InitRanges(clusterSubnets)).To(gomega.Succeed())
+			return &BaseNetworkController{
+				CommonNetworkControllerInfo: fakeOvn.controller.CommonNetworkControllerInfo,
+				netName:                     secondaryNetName,
+				lsManager:                   lsm.NewLogicalSwitchManager(),
+				clock:                       fakeOvn.controller.clock,
+			}, allocator
+		}
+
+		ginkgo.It("reads the subnets of its own network only", func() {
+			config.IPv4Mode = true
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets": `{"default":"` + nodeSubnet + `","` + secondaryNetName + `":"` + secondaryNodeSubnet + `"}`,
+			})
+			startController(node)
+			secondary, secondaryAllocator := newSecondaryController()
+
+			hostSubnets := fakeOvn.controller.updateNodesManageHostSubnets(node, fakeOvn.controller.masterSubnetAllocator, sets.NewString())
+			gomega.Expect(hostSubnets).To(gomega.Equal(ovntest.MustParseIPNets(nodeSubnet)))
+			hostSubnets = secondary.updateNodesManageHostSubnets(node, secondaryAllocator, sets.NewString())
+			gomega.Expect(hostSubnets).To(gomega.Equal(ovntest.MustParseIPNets(secondaryNodeSubnet)))
+
+			hostSubnets, _, err := fakeOvn.controller.allocateNodeSubnets(node, fakeOvn.controller.masterSubnetAllocator)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(hostSubnets).To(gomega.Equal(ovntest.MustParseIPNets(nodeSubnet)))
+			hostSubnets, _, err = secondary.allocateNodeSubnets(node, secondaryAllocator)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(hostSubnets).To(gomega.Equal(ovntest.MustParseIPNets(secondaryNodeSubnet)))
+		})
+
+		ginkgo.It("checks the node switch against the subnets of the network of the controller", func() {
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets": `{"default":"` + nodeSubnet + `","` + secondaryNetName + `":"` + secondaryNodeSubnet + `"}`,
+			})
+			startController(node)
+			gomega.Expect(fakeOvn.controller.netName).To(gomega.Equal(types.DefaultNetworkName))
+			err := fakeOvn.controller.lsManager.AddSwitch(nodeName, "node1-UUID", ovntest.MustParseIPNets(nodeSubnet))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(fakeOvn.controller.nodeSwitchSubnetsOutdated(node)).To(gomega.BeFalse())
+
+			fakeOvn.controller.netName = secondaryNetName
+			gomega.Expect(fakeOvn.controller.nodeSwitchSubnetsOutdated(node)).To(gomega.BeTrue())
+		})
+
+		ginkgo.It("allocates subnets for a network missing from the annotation", func() {
+			config.IPv4Mode = true
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets": `{"default":"` + nodeSubnet + `"}`,
+			})
+			startController(node)
+			secondary, secondaryAllocator := newSecondaryController()
+
+			gomega.Expect(secondary.updateNodesManageHostSubnets(node, secondaryAllocator, sets.NewString())).To(gomega.BeNil())
+			hostSubnets, _, err := secondary.allocateNodeSubnets(node, secondaryAllocator)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(hostSubnets).To(gomega.HaveLen(1))
+			gomega.Expect(ovntest.MustParseIPNet("10.2.0.0/16").Contains(hostSubnets[0].IP)).To(gomega.BeTrue())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.Context("when defragmenting node subnets", func() {
+		ginkgo.It("reports the moves without changing the node subnets", func() {
+			startController()
+			allocator := fakeOvn.controller.masterSubnetAllocator
+			nodeSubnets := map[string]*net.IPNet{}
+			for _, name := range []string{"node1", "node2", "node3"} {
+				hostSubnets, _, err := allocator.AllocateNodeSubnets(name, nil, true, false)
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				nodeSubnets[name] = hostSubnets[0]
+			}
+			gomega.Expect(fakeOvn.controller.DefragmentNodeSubnets()).To(gomega.BeEmpty())
+
+			allocator.ReleaseAllNodeSubnets("node1")
+			moves := fakeOvn.controller.DefragmentNodeSubnets()
+			gomega.Expect(moves).To(gomega.HaveLen(1))
+			gomega.Expect(moves[0].Owner).To(gomega.Equal("node3"))
+			gomega.Expect(moves[0].From.String()).To(gomega.Equal(nodeSubnets["node3"].String()))
+			gomega.Expect(moves[0].To.String()).To(gomega.Equal(nodeSubnets["node1"].String()))
+
+			// node3 still owns its subnet and the freed subnet is still available
+			gomega.Expect(allocator.MarkSubnetsAllocated("node3", nodeSubnets["node3"])).To(gomega.Succeed())
+			gomega.Expect(allocator.MarkSubnetsAllocated("node4", nodeSubnets["node1"])).To(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Context("when peeking at the next node subnets", func() {
+		ginkgo.It("returns the subnets the next node gets without allocating them", func() {
+			node := newNode(map[string]string{})
+			startController(node)
+
+			peeked, err := fakeOvn.controller.PeekNextNodeSubnets()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(peeked).To(gomega.HaveLen(1))
+			again, err := fakeOvn.controller.PeekNextNodeSubnets()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(again).To(gomega.Equal(peeked))
+
+			hostSubnets, _, err := fakeOvn.controller.allocateNodeSubnets(node, fakeOvn.controller.masterSubnetAllocator)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(hostSubnets).To(gomega.Equal(peeked))
+
+			// the next peek moves on to a free subnet
+			next, err := fakeOvn.controller.PeekNextNodeSubnets()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(next).To(gomega.HaveLen(1))
+			gomega.Expect(next[0].String()).NotTo(gomega.Equal(hostSubnets[0].String()))
+		})
+	})
+
+	ginkgo.Context("when recording the node subnet allocation time", func() {
+		ginkgo.It("restores the allocation time of the annotated nodes", func() {
+			allocatedAt := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+			annotated := newNode(util.CreateNodeSubnetsAllocatedAtAnnotation(map[string]string{
+				"k8s.ovn.org/node-subnets": `{"default":"` + nodeSubnet + `"}`,
+			}, allocatedAt))
+			unannotated := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets": `{"default":"10.1.2.0/24"}`,
+			})
+			unannotated.Name = "node2"
+			startController(annotated, unannotated)
+
+			gomega.Expect(fakeOvn.controller.syncNodes([]interface{}{annotated, unannotated})).To(gomega.Succeed())
+			restored, ok := fakeOvn.controller.masterSubnetAllocator.SubnetsAllocatedAt(nodeName)
+			gomega.Expect(ok).To(gomega.BeTrue())
+			gomega.Expect(restored.Equal(allocatedAt)).To(gomega.BeTrue())
+
+			// nodes annotated before the time was recorded start aging from the sync
+			ages := fakeOvn.controller.NodeSubnetAllocationAges()
+			gomega.Expect(ages[nodeName]).To(gomega.BeNumerically(">=", 48*time.Hour))
+			gomega.Expect(ages).To(gomega.HaveKey("node2"))
+			gomega.Expect(ages["node2"]).To(gomega.BeNumerically("<", time.Minute))
+		})
+	})
+
+	ginkgo.Context("when reconfiguring the cluster subnets", func() {
+		ginkgo.It("adds the new cluster subnets keeping the node subnets", func() {
+			startController()
+			allocator := fakeOvn.controller.masterSubnetAllocator
+			clusterSubnets, err := config.ParseClusterSubnetEntries("10.1.0.0/23/24")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(fakeOvn.controller.ReconfigureClusterSubnets(clusterSubnets)).To(gomega.Succeed())
+			for _, name := range []string{"node1", "node2"} {
+				_, _, err := allocator.AllocateNodeSubnets(name, nil, true, false)
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			}
+			_, _, err = allocator.AllocateNodeSubnets("node3", nil, true, false)
+			gomega.Expect(errors.Is(err, subnetallocator.ErrSubnetAllocatorFull)).To(gomega.BeTrue())
+
+			// the node subnets must stay part of the cluster subnets
+			clusterSubnets, err = config.ParseClusterSubnetEntries("10.2.0.0/16/24")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(fakeOvn.controller.ReconfigureClusterSubnets(clusterSubnets)).To(
+				gomega.MatchError(gomega.ContainSubstring("does not fit in any of the new ranges")))
+
+			clusterSubnets, err = config.ParseClusterSubnetEntries("10.1.0.0/23/24,10.2.0.0/16/24")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(fakeOvn.controller.ReconfigureClusterSubnets(clusterSubnets)).To(gomega.Succeed())
+			hostSubnets, _, err := allocator.AllocateNodeSubnets("node3", nil, true, false)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(hostSubnets).To(gomega.ConsistOf(ovntest.MustParseIPNet("10.2.0.0/24")))
+			hostSubnets, _, err = allocator.AllocateNodeSubnets("node1", []*net.IPNet{ovntest.MustParseIPNet("10.1.0.0/24")}, true, false)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(hostSubnets).To(gomega.ConsistOf(ovntest.MustParseIPNet("10.1.0.0/24")))
+		})
+	})
+
+	ginkgo.Context("when preallocating node subnets", func() {
+		var fakeClock *clocktesting.FakeClock
+
+		startPreallocating := func(nodes ...*v1.Node) {
+			config.IPv4Mode = true
+			startController(nodes...)
+			fakeClock = clocktesting.NewFakeClock(time.Now())
+			fakeOvn.controller.clock = fakeClock
+		}
+
+		ginkgo.It("gives the preallocated subnets to the node when it joins", func() {
+			startPreallocating()
+			preallocated, err := fakeOvn.controller.PreallocateNodeSubnets(nodeName)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(preallocated).To(gomega.HaveLen(1))
+			// preallocating again returns the same subnets
+			again, err := fakeOvn.controller.PreallocateNodeSubnets(nodeName)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(again).To(gomega.Equal(preallocated))
+
+			// other nodes don't get the preallocated subnets
+			otherSubnets, _, err := fakeOvn.controller.allocateNodeSubnets(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node2"}},
+				fakeOvn.controller.masterSubnetAllocator)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(otherSubnets).NotTo(gomega.Equal(preallocated))
+
+			hostSubnets, _, err := fakeOvn.controller.allocateNodeSubnets(newNode(nil), fakeOvn.controller.masterSubnetAllocator)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(hostSubnets).To(gomega.Equal(preallocated))
+			gomega.Expect(fakeOvn.controller.getPreallocatedNodeSubnets(nodeName)).To(gomega.BeEmpty())
+
+			// the subnets are not released once the preallocation expires
+			fakeClock.Step(nodeSubnetPreallocationTimeout)
+			fakeOvn.controller.reclaimExpiredNodeSubnetPreallocations(fakeOvn.controller.masterSubnetAllocator)
+			err = fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated("node3", hostSubnets...)
+			gomega.Expect(err).To(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("releases the preallocated subnets of a node that joins with its own", func() {
+			startPreallocating()
+			preallocated, err := fakeOvn.controller.PreallocateNodeSubnets(nodeName)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(preallocated).NotTo(gomega.Equal(ovntest.MustParseIPNets(nodeSubnet)))
+
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets": `{"default":"` + nodeSubnet + `"}`,
+			})
+			hostSubnets, _, err := fakeOvn.controller.allocateNodeSubnets(node, fakeOvn.controller.masterSubnetAllocator)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(hostSubnets).To(gomega.Equal(ovntest.MustParseIPNets(nodeSubnet)))
+			err = fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated("node2", preallocated...)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("releases the preallocated subnets once they expire", func() {
+			startPreallocating()
+			preallocated, err := fakeOvn.controller.PreallocateNodeSubnets(nodeName)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			fakeClock.Step(nodeSubnetPreallocationTimeout / 2)
+			fakeOvn.controller.reclaimExpiredNodeSubnetPreallocations(fakeOvn.controller.masterSubnetAllocator)
+			gomega.Expect(fakeOvn.controller.getPreallocatedNodeSubnets(nodeName)).To(gomega.Equal(preallocated))
+			err = fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated("node2", preallocated...)
+			gomega.Expect(err).To(gomega.HaveOccurred())
+
+			fakeClock.Step(nodeSubnetPreallocationTimeout / 2)
+			fakeOvn.controller.reclaimExpiredNodeSubnetPreallocations(fakeOvn.controller.masterSubnetAllocator)
+			gomega.Expect(fakeOvn.controller.getPreallocatedNodeSubnets(nodeName)).To(gomega.BeEmpty())
+			err = fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated("node2", preallocated...)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("refuses to preallocate subnets for an existing node", func() {
+			startPreallocating(newNode(nil))
+			_, err := fakeOvn.controller.PreallocateNodeSubnets(nodeName)
+			gomega.Expect(err).To(gomega.HaveOccurred())
+		})
+	})
+
+	ginkgo.Context("when delaying the release of deleted node subnets", func() {
+		var fakeClock *clocktesting.FakeClock
+		var hostSubnets []*net.IPNet
+
+		deleteWithAllocatedSubnets := func(delay int) {
+			config.IPv4Mode = true
+			config.Kubernetes.NodeSubnetReleaseDelay = delay
+			startController()
+			fakeClock = clocktesting.NewFakeClock(time.Now())
+			fakeOvn.controller.clock = fakeClock
+			hostSubnets = ovntest.MustParseIPNets(nodeSubnet)
+			err := fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated(nodeName, hostSubnets...)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			err = fakeOvn.controller.lsManager.AddSwitch(nodeName, "", hostSubnets)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			fakeOvn.controller.releaseDeletedNodeSubnets(nodeName)
+			fakeOvn.controller.lsManager.DeleteSwitch(nodeName)
+		}
+
+		ginkgo.It("gives the subnets back to a node re-added within the delay", func() {
+			deleteWithAllocatedSubnets(30)
+			err := fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated("node2", hostSubnets...)
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			// a retried delete keeps holding them
+			fakeOvn.controller.releaseDeletedNodeSubnets(nodeName)
+			gomega.Expect(fakeOvn.controller.getPreallocatedNodeSubnets(nodeName)).To(gomega.Equal(hostSubnets))
+
+			fakeClock.Step(10 * time.Second)
+			reAdded, _, err := fakeOvn.controller.allocateNodeSubnets(newNode(nil), fakeOvn.controller.masterSubnetAllocator)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(reAdded).To(gomega.Equal(hostSubnets))
+
+			// the release was canceled
+			fakeClock.Step(time.Minute)
+			fakeOvn.controller.reclaimExpiredNodeSubnetPreallocations(fakeOvn.controller.masterSubnetAllocator)
+			err = fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated("node2", hostSubnets...)
+			gomega.Expect(err).To(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("releases the subnets of a node not re-added within the delay", func() {
+			deleteWithAllocatedSubnets(30)
+
+			fakeClock.Step(20 * time.Second)
+			fakeOvn.controller.reclaimExpiredNodeSubnetPreallocations(fakeOvn.controller.masterSubnetAllocator)
+			err := fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated("node2", hostSubnets...)
+			gomega.Expect(err).To(gomega.HaveOccurred())
+
+			fakeClock.Step(10 * time.Second)
+			fakeOvn.controller.reclaimExpiredNodeSubnetPreallocations(fakeOvn.controller.masterSubnetAllocator)
+			gomega.Expect(fakeOvn.controller.getPreallocatedNodeSubnets(nodeName)).To(gomega.BeEmpty())
+			err = fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated("node2", hostSubnets...)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("releases the subnets still preallocated to the node that it didn't end up with", func() {
+			config.IPv4Mode = true
+			config.Kubernetes.NodeSubnetReleaseDelay = 30
+			startController()
+			fakeClock = clocktesting.NewFakeClock(time.Now())
+			fakeOvn.controller.clock = fakeClock
+			preallocated, err := fakeOvn.controller.PreallocateNodeSubnets(nodeName)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			hostSubnets = ovntest.MustParseIPNets(nodeSubnet)
+			gomega.Expect(preallocated).NotTo(gomega.Equal(hostSubnets))
+			err = fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated(nodeName, hostSubnets...)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			err = fakeOvn.controller.lsManager.AddSwitch(nodeName, "", hostSubnets)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			fakeOvn.controller.releaseDeletedNodeSubnets(nodeName)
+			gomega.Expect(fakeOvn.controller.getPreallocatedNodeSubnets(nodeName)).To(gomega.Equal(hostSubnets))
+			err = fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated("node2", preallocated...)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			err = fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated("node2", hostSubnets...)
+			gomega.Expect(err).To(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("releases the subnets right away without a delay", func() {
+			deleteWithAllocatedSubnets(0)
+			gomega.Expect(fakeOvn.controller.getPreallocatedNodeSubnets(nodeName)).To(gomega.BeEmpty())
+			err := fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated("node2", hostSubnets...)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+	})
+
+	ginkgo.Context("when forcibly releasing node subnets", func() {
+		var hostSubnets []*net.IPNet
+
+		// startWithAllocatedSubnets starts the controller with a cluster network with room
+		// for two node subnets, one of them taken by node3 and the other one by the node
+		startWithAllocatedSubnets := func() {
+			node := newNode(map[string]string{
+				"k8s.ovn.org/node-subnets": `{"default":"` + nodeSubnet + `"}`,
+			})
+			startController(node)
+			fakeOvn.controller.masterSubnetAllocator = subnetallocator.NewHostSubnetAllocator()
+			clusterSubnets, err := config.ParseClusterSubnetEntries("10.1.0.0/23/24")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(fakeOvn.controller.masterSubnetAllocator.InitRanges(clusterSubnets)).To(gomega.Succeed())
+			err = fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated("node3",
+				ovntest.MustParseIPNets("10.1.0.0/24")...)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			hostSubnets = ovntest.MustParseIPNets(nodeSubnet)
+			err = fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated(nodeName, hostSubnets...)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		}
+
+		getAnnotatedSubnets := func() ([]*net.IPNet, error) {
+			node, err := fakeOvn.fakeClient.KubeClient.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			return util.ParseNodeHostSubnetAnnotation(node, types.DefaultNetworkName)
+		}
+
+		addSecondNode := func() ([]*net.IPNet, error) {
+			node2 := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node2"}}
+			hostSubnets, _, err := fakeOvn.controller.allocateNodeSubnets(node2, fakeOvn.controller.masterSubnetAllocator)
+			return hostSubnets, err
+		}
+
+		ginkgo.It("refuses to release them unless enabled", func() {
+			startWithAllocatedSubnets()
+
+			err := fakeOvn.controller.ForceReleaseNodeSubnets(nodeName, fakeOvn.controller.masterSubnetAllocator)
+			gomega.Expect(err).To(gomega.HaveOccurred())
+
+			// the subnet is still allocated to the node, and annotated
+			_, err = addSecondNode()
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			annotatedSubnets, err := getAnnotatedSubnets()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(annotatedSubnets).To(gomega.Equal(hostSubnets))
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("refuses to release them while the node switch still exists", func() {
+			config.Kubernetes.AllowForceReleaseNodeSubnets = true
+			startWithAllocatedSubnets()
+			err := createNodeLogicalNetworks(fakeOvn.nbClient, []string{nodeName})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			err = fakeOvn.controller.ForceReleaseNodeSubnets(nodeName, fakeOvn.controller.masterSubnetAllocator)
+			gomega.Expect(err).To(gomega.HaveOccurred())
+
+			// a second node does not get the subnet still used by the node switch
+			node2Subnets, err := addSecondNode()
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			gomega.Expect(node2Subnets).To(gomega.BeEmpty())
+			annotatedSubnets, err := getAnnotatedSubnets()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(annotatedSubnets).To(gomega.Equal(hostSubnets))
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.BeEmpty())
+
+			// once the node logical network is gone, the subnets can be released
+			gomega.Expect(fakeOvn.controller.deleteNodeLogicalNetwork(nodeName)).To(gomega.Succeed())
+			err = fakeOvn.controller.ForceReleaseNodeSubnets(nodeName, fakeOvn.controller.masterSubnetAllocator)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			node2Subnets, err = addSecondNode()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(node2Subnets).To(gomega.Equal(hostSubnets))
+		})
+
+		ginkgo.It("releases them and clears the annotation", func() {
+			config.Kubernetes.AllowForceReleaseNodeSubnets = true
+			startWithAllocatedSubnets()
+
+			err := fakeOvn.controller.ForceReleaseNodeSubnets(nodeName, fakeOvn.controller.masterSubnetAllocator)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			err = fakeOvn.controller.masterSubnetAllocator.MarkSubnetsAllocated("node2", hostSubnets...)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			_, err = getAnnotatedSubnets()
+			gomega.Expect(util.IsAnnotationNotSetError(err)).To(gomega.BeTrue())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.ContainSubstring("annotation cleared")))
+		})
+	})
+})
+
+// createNodeLogicalNetworks creates a logical switch and a cluster router port for each node
+func createNodeLogicalNetworks(nbClient libovsdbclient.Client, nodeNames []string) error {
+	router := &nbdb.LogicalRouter{Name: types.OVNClusterRouter}
+	for i, nodeName := range nodeNames {
+		if err := libovsdbops.CreateOrUpdateLogicalSwitch(nbClient, &nbdb.LogicalSwitch{Name: nodeName}); err != nil {
+			return err
+		}
+		lrp := &nbdb.LogicalRouterPort{
+			Name:     types.RouterToSwitchPrefix + nodeName,
+			MAC:      util.IPAddrToHWAddr(net.IPv4(10, 128, byte(i/256), byte(i%256))).String(),
+			Networks: []string{fmt.Sprintf("10.128.%d.%d/32", i/256, i%256)},
+		}
+		if err := libovsdbops.CreateOrUpdateLogicalRouterPort(nbClient, router, lrp, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BenchmarkDeleteNodeLogicalNetworks deletes the logical networks of many nodes, one node
+// at a time or in batches
+func BenchmarkDeleteNodeLogicalNetworks(b *testing.B) {
+	const nodes = 256
+	nodeNames := make([]string, 0, nodes)
+	for i := 0; i < nodes; i++ {
+		nodeNames = append(nodeNames, fmt.Sprintf("node%d", i))
+	}
+	for _, batched := range []bool{false, true} {
+		b.Run(fmt.Sprintf("batched-%t", batched), func(b *testing.B) {
+			nbClient, cleanup, err := libovsdbtest.NewNBTestHarness(libovsdbtest.TestSetup{
+				NBData: []libovsdbtest.TestData{&nbdb.LogicalRouter{Name: types.OVNClusterRouter}},
+			}, nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer cleanup.Cleanup()
+			bnc := &BaseNetworkController{
+				CommonNetworkControllerInfo: CommonNetworkControllerInfo{nbClient: nbClient, recorder: &record.FakeRecorder{}},
+			}
+
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				if err := createNodeLogicalNetworks(nbClient, nodeNames); err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+				if batched {
+					if nodeErrs := bnc.deleteNodeLogicalNetworks(nodeNames); len(nodeErrs) > 0 {
+						b.Fatal(nodeErrs)
+					}
+					continue
+				}
+				for _, nodeName := range nodeNames {
+					if err := bnc.deleteNodeLogicalNetwork(nodeName); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
@@ -2,12 +2,16 @@ package ovn
 
 import (
 	"fmt"
+	"reflect"
+	"sort"
+	"strings"
 
 	libovsdbclient "github.com/ovn-org/libovsdb/client"
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/libovsdbops"
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/nbdb"
 
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/types"
+	"k8s.io/klog/v2"
 )
 
 const (
@@ -41,8 +45,32 @@ func getMeterNameForProtocol(protocol string) string {
 	return protocol + "-" + types.OvnRateLimitingMeter
 }
 
+// findEquivalentCOPP returns the named COPP with the given meters a router can reference
+// instead of the default COPP, such as one created for another network, or nil if there
+// is none. The default COPP itself is preferred, then the first by name.
+func findEquivalentCOPP(nbClient libovsdbclient.Client, meterNames map[string]string) (*nbdb.Copp, error) {
+	copps, err := libovsdbops.FindCOPPsWithPredicate(nbClient, func(item *nbdb.Copp) bool {
+		return item.Name != "" && reflect.DeepEqual(item.Meters, meterNames)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(copps) == 0 {
+		return nil, nil
+	}
+	sort.Slice(copps, func(i, j int) bool {
+		if copps[i].Name == defaultCOPPName || copps[j].Name == defaultCOPPName {
+			return copps[i].Name == defaultCOPPName
+		}
+		return copps[i].Name < copps[j].Name
+	})
+	return copps[0], nil
+}
+
 // EnsureDefaultCOPP creates the default COPP that needs to be added to each GR
-// if not already present. Also cleans up old COPP entries if required.
+// if not already present. Also cleans up old COPP entries if required. An existing
+// COPP with the same meters is reused rather than duplicated, so that the routers of
+// all the networks share a single COPP.
 func EnsureDefaultCOPP(nbClient libovsdbclient.Client) (string, error) {
 	p := func(item *nbdb.Copp) bool {
 		return item.Name == ""
@@ -84,6 +112,17 @@ func EnsureDefaultCOPP(nbClient libovsdbclient.Client) (string, error) {
 		Name:   defaultCOPPName,
 		Meters: meterNames,
 	}
+	equivalentCOPP, err := findEquivalentCOPP(nbClient, meterNames)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up an equivalent COPP: %w", err)
+	}
+	if equivalentCOPP != nil && equivalentCOPP.Name != defaultCOPPName {
+		klog.V(5).Infof("Reusing COPP %s (%s) as the default COPP", equivalentCOPP.Name, equivalentCOPP.UUID)
+		if _, err := libovsdbops.TransactAndCheck(nbClient, ops); err != nil {
+			return "", fmt.Errorf("failed to transact default COPP meters: %w", err)
+		}
+		return equivalentCOPP.UUID, nil
+	}
 	ops, err = libovsdbops.CreateOrUpdateCOPPsOps(nbClient, ops, defaultCOPP)
 	if err != nil {
 		return "", fmt.Errorf("failed to create/update default COPP: %w", err)
@@ -95,3 +134,44 @@ func EnsureDefaultCOPP(nbClient libovsdbclient.Client) (string, error) {
 
 	return defaultCOPP.UUID, nil
 }
+
+// isCOPPManagedRouter returns true if the router is one of the routers this controller
+// attaches the default COPP to: the cluster router and the gateway routers of the nodes
+func isCOPPManagedRouter(router *nbdb.LogicalRouter) bool {
+	return router.Name == types.OVNClusterRouter || strings.HasPrefix(router.Name, types.GWRouterPrefix)
+}
+
+// reconcileRouterCOPPs ensures the default COPP exists and that every router managed by
+// this controller references it. The default COPP is garbage collected by OVN once no
+// router references it, so it may have been recreated with a new UUID that routers added
+// since then pick up. Returns the names of the routers that were attached to it.
+func (oc *DefaultNetworkController) reconcileRouterCOPPs() ([]string, error) {
+	oc.defaultCOPPLock.Lock()
+	defer oc.defaultCOPPLock.Unlock()
+
+	defaultCOPPUUID, err := EnsureDefaultCOPP(oc.nbClient)
+	if err != nil {
+		return nil, err
+	}
+	if defaultCOPPUUID != oc.defaultCOPPUUID {
+		klog.Infof("Default COPP changed from %q to %s", oc.defaultCOPPUUID, defaultCOPPUUID)
+		oc.defaultCOPPUUID = defaultCOPPUUID
+	}
+
+	routers, err := libovsdbops.FindLogicalRoutersWithPredicate(oc.nbClient, func(item *nbdb.LogicalRouter) bool {
+		return isCOPPManagedRouter(item) && (item.Copp == nil || *item.Copp != defaultCOPPUUID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the routers missing the default COPP: %w", err)
+	}
+	attached := make([]string, 0, len(routers))
+	for _, router := range routers {
+		router.Copp = &defaultCOPPUUID
+		if err := libovsdbops.CreateOrUpdateLogicalRouter(oc.nbClient, router, &router.Copp); err != nil {
+			return attached, fmt.Errorf("failed to attach the default COPP to router %s: %w", router.Name, err)
+		}
+		klog.Infof("Attached the default COPP to router %s", router.Name)
+		attached = append(attached, router.Name)
+	}
+	return attached, nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/libovsdbops"
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/nbdb"
 	libovsdbtest "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/testing/libovsdb"
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/types"
@@ -170,3 +171,108 @@ func TestEnsureDefaultCOPP(t *testing.T) {
 		})
 	}
 }
+
+func TestEnsureDefaultCOPPReusesEquivalentCOPP(t *testing.T) {
+	meterMap := make(map[string]string, len(defaultProtocolNames))
+	for _, protocol := range defaultProtocolNames {
+		meterMap[protocol] = getMeterNameForProtocol(protocol)
+	}
+	meterBand := &nbdb.MeterBand{
+		UUID:   "meter-band-UUID",
+		Action: types.MeterAction,
+		Rate:   int(25),
+	}
+	meterFairness := true
+	meters := []libovsdbtest.TestData{meterBand}
+	for i, protocol := range defaultProtocolNames {
+		meters = append(meters, &nbdb.Meter{
+			UUID:  fmt.Sprintf("meter-%d-UUID", i),
+			Name:  getMeterNameForProtocol(protocol),
+			Fair:  &meterFairness,
+			Unit:  types.PacketsPerSecond,
+			Bands: []string{meterBand.UUID},
+		})
+	}
+	otherMeterMap := map[string]string{OVNARPRateLimiter: "custom-arp-meter"}
+
+	tests := []struct {
+		desc         string
+		initialCOPPs []libovsdbtest.TestData
+		expectedName string
+		expectedNbdb []libovsdbtest.TestData
+	}{
+		{
+			desc: "reuses the COPP of another network with the same meters",
+			initialCOPPs: []libovsdbtest.TestData{
+				&nbdb.Copp{UUID: "copp-network2-UUID", Name: "network2", Meters: meterMap},
+			},
+			expectedName: "network2",
+			expectedNbdb: []libovsdbtest.TestData{
+				&nbdb.Copp{UUID: "copp-network2-UUID", Name: "network2", Meters: meterMap},
+			},
+		},
+		{
+			desc: "prefers the default COPP over other equivalent COPPs",
+			initialCOPPs: []libovsdbtest.TestData{
+				&nbdb.Copp{UUID: "copp-network2-UUID", Name: "network2", Meters: meterMap},
+				&nbdb.Copp{UUID: "copp-UUID", Name: defaultCOPPName, Meters: meterMap},
+			},
+			expectedName: defaultCOPPName,
+			expectedNbdb: []libovsdbtest.TestData{
+				&nbdb.Copp{UUID: "copp-network2-UUID", Name: "network2", Meters: meterMap},
+				&nbdb.Copp{UUID: "copp-UUID", Name: defaultCOPPName, Meters: meterMap},
+			},
+		},
+		{
+			desc: "doesn't reuse a COPP with other meters",
+			initialCOPPs: []libovsdbtest.TestData{
+				&nbdb.Copp{UUID: "copp-network2-UUID", Name: "network2", Meters: otherMeterMap},
+			},
+			expectedName: defaultCOPPName,
+			expectedNbdb: []libovsdbtest.TestData{
+				&nbdb.Copp{UUID: "copp-network2-UUID", Name: "network2", Meters: otherMeterMap},
+				&nbdb.Copp{UUID: "copp-UUID", Name: defaultCOPPName, Meters: meterMap},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			nbClient, cleanup, err := libovsdbtest.NewNBTestHarness(libovsdbtest.TestSetup{NBData: tt.initialCOPPs}, nil)
+			if err != nil {
+				t.Fatalf("failed to set up test harness: %v", err)
+			}
+			t.Cleanup(cleanup.Cleanup)
+
+			// every network ensures the default COPP and gets the same one
+			coppUUID, err := EnsureDefaultCOPP(nbClient)
+			if err != nil {
+				t.Fatalf("EnsureDefaultCOPP() error = %v", err)
+			}
+			copps, err := libovsdbops.FindCOPPsWithPredicate(nbClient, func(item *nbdb.Copp) bool {
+				return item.UUID == coppUUID
+			})
+			if err != nil || len(copps) != 1 {
+				t.Fatalf("failed to find the COPP %s: %v", coppUUID, err)
+			}
+			if copps[0].Name != tt.expectedName {
+				t.Fatalf("EnsureDefaultCOPP() returned COPP %s, expected %s", copps[0].Name, tt.expectedName)
+			}
+			secondUUID, err := EnsureDefaultCOPP(nbClient)
+			if err != nil {
+				t.Fatalf("second EnsureDefaultCOPP() error = %v", err)
+			}
+			if secondUUID != coppUUID {
+				t.Fatalf("second EnsureDefaultCOPP() = %s, expected %s", secondUUID, coppUUID)
+			}
+
+			matcher := libovsdbtest.HaveData(append(tt.expectedNbdb, meters...))
+			success, err := matcher.Match(nbClient)
+			if err != nil {
+				t.Fatalf("failed to match the expected data: %v", err)
+			}
+			if !success {
+				t.Fatal(matcher.FailureMessage(nbClient))
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package ovn
 import (
 	"context"
 	"fmt"
+	"net"
 	"reflect"
 	"sync"
 	"time"
@@ -30,11 +31,13 @@ import (
 	kapi "k8s.io/api/core/v1"
 	knet "k8s.io/api/networking/v1"
 	ktypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/informers"
 	corev1listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
 )
 
 // DefaultNetworkController structure is the object which holds the controls for starting
@@ -89,9 +92,15 @@ type DefaultNetworkController struct {
 
 	// Cluster wide Load_Balancer_Group UUID.
 	loadBalancerGroupUUID string
+	// loadBalancerGroupLock protects loadBalancerGroupUUID, which changes when the group is
+	// recreated by reconcileNodeSwitchLoadBalancerGroup
+	loadBalancerGroupLock sync.RWMutex
 
 	// Cluster-wide router default Control Plane Protection (COPP) UUID
 	defaultCOPPUUID string
+	// defaultCOPPLock protects defaultCOPPUUID, which changes when the default COPP is
+	// recreated by reconcileRouterCOPPs
+	defaultCOPPLock sync.Mutex
 
 	// Controller used for programming OVN for egress IP
 	eIPC egressIPController
@@ -143,6 +152,10 @@ type DefaultNetworkController struct {
 	// variable to determine if all pods present on the node during startup have been processed
 	// updated atomically
 	allInitialPodsProcessed uint32
+
+	// IPs allocated on each node switch that no pod held at the last periodic node sync,
+	// reclaimed if still unused at the next one. Only accessed by the periodic node sync.
+	suspectedLeakedPodIPs map[string]sets.String
 }
 
 // NewDefaultNetworkController creates a new OVN controller for creating logical network
@@ -169,11 +182,17 @@ func newDefaultNetworkControllerCommon(cnci *CommonNetworkControllerInfo,
 	oc := &DefaultNetworkController{
 		BaseNetworkController: BaseNetworkController{
 			CommonNetworkControllerInfo: *cnci,
+			netName:                     ovntypes.DefaultNetworkName,
 			lsManager:                   lsm.NewLogicalSwitchManager(),
 			logicalPortCache:            newPortCache(defaultStopChan),
 			namespaces:                  make(map[string]*namespaceInfo),
+			pendingAddressSetDestroys:   make(map[string]chan struct{}),
+			namespaceGenerations:        make(map[string]uint64),
 			namespacesMutex:             sync.Mutex{},
 			addressSetFactory:           addressSetFactory,
+			subnetAnnotationFallbackKey: config.Default.NodeSubnetsAnnotationFallback,
+			managementPortOnly:          config.Default.ManagementPortOnly,
+			clock:                       clock.RealClock{},
 			stopChan:                    defaultStopChan,
 		},
 		wg:                           defaultWg,
@@ -203,6 +222,12 @@ func newDefaultNetworkControllerCommon(cnci *CommonNetworkControllerInfo,
 		svcController:            svcController,
 		svcFactory:               svcFactory,
 		egressSvcController:      egressSvcController,
+		suspectedLeakedPodIPs:    make(map[string]sets.String),
+	}
+	oc.addressSetDestroyer = newAddressSetDestroyer(oc.destroyDeferredAddressSets)
+	oc.eIPC.getNodeManagementPortName = oc.getNodeManagementPortName
+	oc.subnetOwner = func(subnet *net.IPNet) (string, bool) {
+		return oc.masterSubnetAllocator.SubnetOwner(subnet)
 	}
 
 	oc.initRetryFramework()
@@ -222,6 +247,9 @@ func (oc *DefaultNetworkController) initRetryFramework() {
 	oc.retryEgressNodes = oc.newRetryFrameworkWithParameters(factory.EgressNodeType, nil, nil)
 	oc.retryCloudPrivateIPConfig = oc.newRetryFrameworkWithParameters(factory.CloudPrivateIPConfigType, nil, nil)
 	oc.retryNamespaces = oc.newRetryFrameworkWithParameters(factory.NamespaceType, nil, nil)
+	oc.retryPods.SetMaxFailedAttempts(uint8(config.Default.PodRetryMaxAttempts))
+	oc.enableRetryPersistence(oc.retryPods, "pods")
+	oc.enableRetryPersistence(oc.retryNodes, "nodes")
 }
 
 // newRetryFrameworkWithParameters builds and returns a retry framework for the input resource
@@ -302,10 +330,14 @@ func (oc *DefaultNetworkController) Init() error {
 	}
 
 	klog.Infof("Allocating subnets")
-	if err := oc.masterSubnetAllocator.InitRanges(config.Default.ClusterSubnets); err != nil {
+	if err := oc.masterSubnetAllocator.InitAlignedRanges(config.Default.ClusterSubnets, config.Default.HostSubnetAlignmentBits); err != nil {
 		klog.Errorf("Failed to initialize host subnet allocator ranges: %v", err)
 		return err
 	}
+	if err := oc.masterSubnetAllocator.SetMaxNodes(config.Default.ClusterSubnetMaxNodes); err != nil {
+		klog.Errorf("Failed to cap the nodes of the cluster subnets: %v", err)
+		return err
+	}
 	if config.HybridOverlay.Enabled {
 		if err := oc.hybridOverlaySubnetAllocator.InitRanges(config.HybridOverlay.ClusterSubnets); err != nil {
 			klog.Errorf("Failed to initialize hybrid overlay subnet allocator ranges: %v", err)
@@ -350,6 +382,7 @@ func (oc *DefaultNetworkController) Init() error {
 
 // Run starts the actual watching.
 func (oc *DefaultNetworkController) Run(ctx context.Context) error {
+	klog.Infof("Running with effective config %+v", oc.EffectiveConfig())
 	oc.syncPeriodic()
 	klog.Infof("Starting all the Watchers...")
 	start := time.Now()
@@ -371,6 +404,12 @@ func (oc *DefaultNetworkController) Run(ctx context.Context) error {
 		return err
 	}
 
+	// All node switches exist now, fix router ports missing from or left in the
+	// cluster router port group since multicast support changed
+	if err := oc.reconcileClusterRouterPortGroup(); err != nil {
+		klog.Errorf("Failed to reconcile the cluster router port group: %v", err)
+	}
+
 	// Start service watch factory and sync services
 	oc.svcFactory.Start(oc.stopChan)
 
@@ -455,6 +494,46 @@ func (oc *DefaultNetworkController) Run(ctx context.Context) error {
 		oc.egressSvcController.Run(1)
 	}()
 
+	if config.Metrics.SubnetUsageRefreshInterval > 0 {
+		// refresh the subnet usage metrics even while no node subnets are
+		// allocated or released
+		oc.wg.Add(1)
+		go func() {
+			defer oc.wg.Done()
+			oc.runPeriodically(oc.masterSubnetAllocator.RecordUsageMetrics,
+				time.Duration(config.Metrics.SubnetUsageRefreshInterval)*time.Second)
+		}()
+	}
+
+	if config.Metrics.ObjectCountRefreshInterval > 0 {
+		oc.wg.Add(1)
+		go func() {
+			defer oc.wg.Done()
+			oc.runPeriodically(oc.recordObjectCounts,
+				time.Duration(config.Metrics.ObjectCountRefreshInterval)*time.Second)
+		}()
+	}
+
+	reclaimInterval := time.Minute
+	if delay := time.Duration(config.Kubernetes.NodeSubnetReleaseDelay) * time.Second; delay > 0 && delay < reclaimInterval {
+		reclaimInterval = delay
+	}
+	oc.wg.Add(1)
+	go func() {
+		defer oc.wg.Done()
+		oc.runPeriodically(func() {
+			oc.reclaimExpiredNodeSubnetPreallocations(oc.masterSubnetAllocator)
+		}, reclaimInterval)
+	}()
+
+	if timeout := time.Duration(config.Kubernetes.NodeHandlerStallTimeout) * time.Second; timeout > 0 {
+		oc.wg.Add(1)
+		go func() {
+			defer oc.wg.Done()
+			oc.runPeriodically(func() { oc.checkNodeHandlerProgress(timeout) }, timeout/2)
+		}()
+	}
+
 	klog.Infof("Completing all the Watchers took %v", time.Since(start))
 
 	if config.Kubernetes.OVNEmptyLbEvents {
@@ -650,9 +729,13 @@ func (h *defaultNetworkControllerEventHandler) AddResource(obj interface{}, from
 				clusterRtrSync,
 				mgmtSync,
 				gwSync,
-				hoSync}
+				hoSync,
+				false}
 		} else {
-			nodeParams = &nodeSyncs{true, true, true, true, config.HybridOverlay.Enabled}
+			nodeParams = &nodeSyncs{true, true, true, true, config.HybridOverlay.Enabled, false}
+			if err := h.oc.waitForNodeStartupSync(); err != nil {
+				return err
+			}
 		}
 
 		if err = h.oc.addUpdateNodeEvent(node, nodeParams); err != nil {
@@ -788,19 +871,7 @@ func (h *defaultNetworkControllerEventHandler) UpdateResource(oldObj, newObj int
 		if !ok {
 			return fmt.Errorf("could not cast oldObj of type %T to *kapi.Node", oldObj)
 		}
-		// determine what actually changed in this update
-		_, nodeSync := h.oc.addNodeFailed.Load(newNode.Name)
-		_, failed := h.oc.nodeClusterRouterPortFailed.Load(newNode.Name)
-		clusterRtrSync := failed || nodeChassisChanged(oldNode, newNode) || nodeSubnetChanged(oldNode, newNode)
-		_, failed = h.oc.mgmtPortFailed.Load(newNode.Name)
-		mgmtSync := failed || macAddressChanged(oldNode, newNode) || nodeSubnetChanged(oldNode, newNode)
-		_, failed = h.oc.gatewaysFailed.Load(newNode.Name)
-		gwSync := (failed || gatewayChanged(oldNode, newNode) ||
-			nodeSubnetChanged(oldNode, newNode) || hostAddressesChanged(oldNode, newNode) ||
-			nodeGatewayMTUSupportChanged(oldNode, newNode))
-		_, hoSync := h.oc.hybridOverlayFailed.Load(newNode.Name)
-
-		return h.oc.addUpdateNodeEvent(newNode, &nodeSyncs{nodeSync, clusterRtrSync, mgmtSync, gwSync, hoSync})
+		return h.oc.addUpdateNodeEvent(newNode, h.oc.nodeUpdateSyncs(oldNode, newNode))
 
 	case factory.PeerPodSelectorType:
 		extraParameters := h.extraParameters.(*NetworkPolicyExtraParameters)
@@ -1945,14 +1945,10 @@ func (oc *DefaultNetworkController) initEgressIPAllocator(node *kapi.Node) (err
 		if err != nil {
 			return fmt.Errorf("failed to parse node %s subnets annotation %v", node.Name, err)
 		}
-		mgmtIPs := make([]net.IP, len(nodeSubnets))
-		for i, subnet := range nodeSubnets {
-			mgmtIPs[i] = util.GetNodeManagementIfAddr(subnet).IP
-		}
 		oc.eIPC.allocator.cache[node.Name] = &egressNode{
 			name:           node.Name,
 			egressIPConfig: parsedEgressIPConfig,
-			mgmtIPs:        mgmtIPs,
+			mgmtIPs:        NodeManagementIPs(nodeSubnets),
 			allocations:    make(map[string]string),
 			healthClient:   hccAllocator.allocate(node.Name),
 		}
@@ -2119,6 +2115,9 @@ type egressIPController struct {
 	reachabilityCheckInterval time.Duration
 	// EgressIP Node reachability gRPC port (0 means it should use dial instead)
 	egressIPNodeHealthCheckPort int
+	// getNodeManagementPortName returns the name of the management port of a node,
+	// which egress IP SNATs are bound to
+	getNodeManagementPortName func(nodeName string) string
 }
 
 // addStandByEgressIPAssignment does the same setup that is done by addPodEgressIPAssignments but for
@@ -2184,7 +2183,7 @@ func (e *egressIPController) addPodEgressIPAssignment(egressIPName string, statu
 		return fmt.Errorf("unable to create logical router policy, err: %v", err)
 	}
 	var ops []ovsdb.Operation
-	ops, err = createNATRuleOps(e.nbClient, podIPs, status, egressIPName)
+	ops, err = createNATRuleOps(e.nbClient, podIPs, status, egressIPName, e.getNodeManagementPortName(status.Node))
 	if err != nil {
 		return fmt.Errorf("unable to create NAT rule for status: %v, err: %v", status, err)
 	}
@@ -2212,7 +2211,8 @@ func (e *egressIPController) deletePodEgressIPAssignment(egressIPName string, st
 		return fmt.Errorf("unable to delete logical router policy, err: %v", err)
 	}
 	var ops []ovsdb.Operation
-	ops, err = deleteNATRuleOps(e.nbClient, []ovsdb.Operation{}, podIPs, status, egressIPName)
+	ops, err = deleteNATRuleOps(e.nbClient, []ovsdb.Operation{}, podIPs, status, egressIPName,
+		e.getNodeManagementPortName(status.Node))
 	if err != nil {
 		return fmt.Errorf("unable to delete NAT rule for status: %v, err: %v", status, err)
 	}
@@ -2699,7 +2699,7 @@ func DeleteDefaultNoRerouteNodePolicies(nbClient libovsdbclient.Client, node str
 	return libovsdbops.DeleteLogicalRouterPoliciesWithPredicate(nbClient, types.OVNClusterRouter, p)
 }
 
-func buildSNATFromEgressIPStatus(podIP net.IP, status egressipv1.EgressIPStatusItem, egressIPName string) (*nbdb.NAT, error) {
+func buildSNATFromEgressIPStatus(podIP net.IP, status egressipv1.EgressIPStatusItem, egressIPName, logicalPort string) (*nbdb.NAT, error) {
 	podIPStr := podIP.String()
 	mask := util.GetIPFullMask(podIPStr)
 	_, logicalIP, err := net.ParseCIDR(podIPStr + mask)
@@ -2707,19 +2707,18 @@ func buildSNATFromEgressIPStatus(podIP net.IP, status egressipv1.EgressIPStatusI
 		return nil, fmt.Errorf("failed to parse podIP: %s, error: %v", podIP.String(), err)
 	}
 	externalIP := net.ParseIP(status.EgressIP)
-	logicalPort := types.K8sPrefix + status.Node
 	externalIds := map[string]string{"name": egressIPName}
 	nat := libovsdbops.BuildSNAT(&externalIP, logicalIP, logicalPort, externalIds)
 	return nat, nil
 }
 
-func createNATRuleOps(nbClient libovsdbclient.Client, podIPs []*net.IPNet, status egressipv1.EgressIPStatusItem, egressIPName string) ([]ovsdb.Operation, error) {
+func createNATRuleOps(nbClient libovsdbclient.Client, podIPs []*net.IPNet, status egressipv1.EgressIPStatusItem, egressIPName, logicalPort string) ([]ovsdb.Operation, error) {
 	nats := make([]*nbdb.NAT, 0, len(podIPs))
 	var nat *nbdb.NAT
 	var err error
 	for _, podIP := range podIPs {
 		if (utilnet.IsIPv6String(status.EgressIP) && utilnet.IsIPv6(podIP.IP)) || (!utilnet.IsIPv6String(status.EgressIP) && !utilnet.IsIPv6(podIP.IP)) {
-			nat, err = buildSNATFromEgressIPStatus(podIP.IP, status, egressIPName)
+			nat, err = buildSNATFromEgressIPStatus(podIP.IP, status, egressIPName, logicalPort)
 			if err != nil {
 				return nil, err
 			}
@@ -2736,13 +2735,13 @@ func createNATRuleOps(nbClient libovsdbclient.Client, podIPs []*net.IPNet, statu
 	return ops, nil
 }
 
-func deleteNATRuleOps(nbClient libovsdbclient.Client, ops []ovsdb.Operation, podIPs []*net.IPNet, status egressipv1.EgressIPStatusItem, egressIPName string) ([]ovsdb.Operation, error) {
+func deleteNATRuleOps(nbClient libovsdbclient.Client, ops []ovsdb.Operation, podIPs []*net.IPNet, status egressipv1.EgressIPStatusItem, egressIPName, logicalPort string) ([]ovsdb.Operation, error) {
 	nats := make([]*nbdb.NAT, 0, len(podIPs))
 	var nat *nbdb.NAT
 	var err error
 	for _, podIP := range podIPs {
 		if (utilnet.IsIPv6String(status.EgressIP) && utilnet.IsIPv6(podIP.IP)) || (!utilnet.IsIPv6String(status.EgressIP) && !utilnet.IsIPv6(podIP.IP)) {
-			nat, err = buildSNATFromEgressIPStatus(podIP.IP, status, egressIPName)
+			nat, err = buildSNATFromEgressIPStatus(podIP.IP, status, egressIPName, logicalPort)
 			if err != nil {
 				return nil, err
 			}
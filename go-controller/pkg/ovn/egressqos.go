@@ -120,7 +120,11 @@ func (oc *DefaultNetworkController) createASForEgressQoSRule(podSelector metav1.
 
 	selector, _ := metav1.LabelSelectorAsSelector(&podSelector)
 	if selector.Empty() { // empty selector means that the rule applies to all pods in the namespace
-		addrSet, err := oc.addressSetFactory.EnsureAddressSet(namespace)
+		asf, _, err := oc.getNamespaceAddressSetFactory(namespace, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		addrSet, err := asf.EnsureAddressSet(namespace)
 		if err != nil {
 			return nil, nil, fmt.Errorf("cannot ensure that addressSet for namespace %s exists %v", namespace, err)
 		}
@@ -909,7 +913,7 @@ func (oc *DefaultNetworkController) syncEgressQoSNode(key string) error {
 	klog.V(5).Infof("EgressQoS %s node retrieved from lister: %v", n.Name, n)
 
 	nodeSw := &nbdb.LogicalSwitch{
-		Name: n.Name,
+		Name: oc.getNodeSwitchName(n.Name),
 	}
 	nodeSw, err = libovsdbops.GetLogicalSwitch(oc.nbClient, nodeSw)
 	if err != nil {
@@ -118,15 +118,18 @@ func (oc *DefaultNetworkController) gatewayInit(nodeName string, clusterIPSubnet
 		"physical_ips": strings.Join(physicalIPs, ","),
 	}
 
+	oc.defaultCOPPLock.Lock()
+	defaultCOPPUUID := oc.defaultCOPPUUID
+	oc.defaultCOPPLock.Unlock()
 	logicalRouter := nbdb.LogicalRouter{
 		Name:        gatewayRouter,
 		Options:     logicalRouterOptions,
 		ExternalIDs: logicalRouterExternalIDs,
-		Copp:        &oc.defaultCOPPUUID,
+		Copp:        &defaultCOPPUUID,
 	}
 
-	if oc.loadBalancerGroupUUID != "" {
-		logicalRouter.LoadBalancerGroup = []string{oc.loadBalancerGroupUUID}
+	if loadBalancerGroupUUID := oc.getLoadBalancerGroupUUID(); loadBalancerGroupUUID != "" {
+		logicalRouter.LoadBalancerGroup = []string{loadBalancerGroupUUID}
 	}
 
 	// If l3gatewayAnnotation.IPAddresses changed, we need to update the perPodSNATs,
@@ -510,7 +513,7 @@ func (oc *DefaultNetworkController) addPolicyBasedRoutes(nodeName, mgmtPortIP st
 		// embed nodeName as comment so that it is easier to delete these rules later on.
 		// logical router policy doesn't support external_ids to stash metadata
 		matchStr := fmt.Sprintf(`inport == "%s%s" && %s.dst == %s /* %s */`,
-			types.RouterToSwitchPrefix, nodeName, l3Prefix, hostIP, nodeName)
+			types.RouterToSwitchPrefix, oc.getNodeSwitchName(nodeName), l3Prefix, hostIP, nodeName)
 		matches = matches.Insert(matchStr)
 	}
 	if err := oc.syncPolicyBasedRoutes(nodeName, matches, types.NodeSubnetPolicyPriority, mgmtPortIP); err != nil {
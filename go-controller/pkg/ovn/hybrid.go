@@ -139,7 +139,7 @@ func (oc *DefaultNetworkController) handleHybridOverlayPort(node *kapi.Node, ann
 			Name:      portName,
 			Addresses: []string{portMAC.String()},
 		}
-		sw := nbdb.LogicalSwitch{Name: node.Name}
+		sw := nbdb.LogicalSwitch{Name: oc.getNodeSwitchName(node.Name)}
 
 		err := libovsdbops.CreateOrUpdateLogicalSwitchPortsOnSwitch(oc.nbClient, &sw, &lsp)
 		if err != nil {
@@ -166,7 +166,7 @@ func (oc *DefaultNetworkController) deleteHybridOverlayPort(node *kapi.Node) {
 	klog.Infof("Removing node %s hybrid overlay port", node.Name)
 	portName := util.GetHybridOverlayPortName(node.Name)
 	lsp := nbdb.LogicalSwitchPort{Name: portName}
-	sw := nbdb.LogicalSwitch{Name: node.Name}
+	sw := nbdb.LogicalSwitch{Name: oc.getNodeSwitchName(node.Name)}
 	if err := libovsdbops.DeleteLogicalSwitchPorts(oc.nbClient, &sw, &lsp); err != nil {
 		klog.Errorf("Failed deleting hybrind overlay port %s for node %s err: %v", portName, node.Name, err)
 	}
@@ -208,7 +208,7 @@ func (oc *DefaultNetworkController) setupHybridLRPolicySharedGw(nodeSubnets []*n
 			}
 			drIP := drIPs
 			matchStr := fmt.Sprintf(`inport == "%s%s" && %s.dst == %s`,
-				ovntypes.RouterToSwitchPrefix, nodeName, L3Prefix, hybridCIDR)
+				ovntypes.RouterToSwitchPrefix, oc.getNodeSwitchName(nodeName), L3Prefix, hybridCIDR)
 
 			// Logic route policy to steer packet from pod to hybrid overlay nodes
 			logicalRouterPolicy := nbdb.LogicalRouterPolicy{
@@ -228,7 +228,7 @@ func (oc *DefaultNetworkController) setupHybridLRPolicySharedGw(nodeSubnets []*n
 				return fmt.Errorf("failed to add policy route '%s' for host %q on %s , error: %v", matchStr, nodeName, ovntypes.OVNClusterRouter, err)
 			}
 
-			logicalPort := ovntypes.RouterToSwitchPrefix + nodeName
+			logicalPort := ovntypes.RouterToSwitchPrefix + oc.getNodeSwitchName(nodeName)
 			if err := util.CreateMACBinding(oc.sbClient, logicalPort, ovntypes.OVNClusterRouter, portMac, drIP); err != nil {
 				return fmt.Errorf("failed to create MAC Binding for hybrid overlay: %v", err)
 			}
@@ -342,7 +342,7 @@ func (oc *DefaultNetworkController) allocateHybridOverlayDRIP(node *kapi.Node) e
 		ips = strings.Split(nodeHybridOverlayDRIP, ",")
 	}
 
-	allocatedHybridOverlayDRIPs, err := oc.lsManager.AllocateHybridOverlay(node.Name, ips)
+	allocatedHybridOverlayDRIPs, err := oc.lsManager.AllocateHybridOverlay(oc.getNodeSwitchName(node.Name), ips)
 	if err != nil {
 		return fmt.Errorf("cannot allocate hybrid overlay interface addresses on node %s: %v", node.Name, err)
 	}
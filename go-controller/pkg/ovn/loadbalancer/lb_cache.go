@@ -106,6 +106,20 @@ func (c *LBCache) RemoveSwitch(switchname string) {
 	}
 }
 
+// RemoveStaleSwitches removes the switchnames that are not among the provided existing
+// ones from all the lb.Switches in the LBCache, and returns those it removed.
+func (c *LBCache) RemoveStaleSwitches(existing sets.String) sets.String {
+	c.Lock()
+	defer c.Unlock()
+	removed := sets.NewString()
+	for _, lbCache := range c.existing {
+		stale := lbCache.Switches.Difference(existing)
+		lbCache.Switches.Delete(stale.UnsortedList()...)
+		removed.Insert(stale.UnsortedList()...)
+	}
+	return removed
+}
+
 // RemoveRouter removes the provided routername from all the lb.Routers in the LBCache.
 func (c *LBCache) RemoveRouter(routername string) {
 	c.Lock()
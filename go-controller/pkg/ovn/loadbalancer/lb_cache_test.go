@@ -132,3 +132,30 @@ func TestNewCache(t *testing.T) {
 		"ovn-worker2": {},
 	})
 }
+
+func TestRemoveStaleSwitches(t *testing.T) {
+	c := &LBCache{
+		existing: map[string]*CachedLB{
+			"lb1": {
+				UUID:     "lb1",
+				Switches: sets.NewString("ovn-worker", "ovn-worker2"),
+				Routers:  sets.NewString("GR_ovn-worker"),
+			},
+			"lb2": {
+				UUID:     "lb2",
+				Switches: sets.NewString("ovn-worker2", "ovn-control-plane"),
+				Routers:  sets.NewString(),
+			},
+		},
+	}
+
+	removed := c.RemoveStaleSwitches(sets.NewString("ovn-worker", "ovn-control-plane"))
+	assert.Equal(t, sets.NewString("ovn-worker2"), removed)
+	assert.Equal(t, sets.NewString("ovn-worker"), c.existing["lb1"].Switches)
+	assert.Equal(t, sets.NewString("ovn-control-plane"), c.existing["lb2"].Switches)
+	// routers are left alone
+	assert.Equal(t, sets.NewString("GR_ovn-worker"), c.existing["lb1"].Routers)
+
+	// nothing left to remove
+	assert.Empty(t, c.RemoveStaleSwitches(sets.NewString("ovn-worker", "ovn-control-plane")))
+}
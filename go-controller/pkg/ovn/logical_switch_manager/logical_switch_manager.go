@@ -149,6 +149,17 @@ func (manager *LogicalSwitchManager) IsNonHostSubnetSwitch(switchName string) bo
 	return ok && lsi.noHostSubnet
 }
 
+// GetSwitchNames returns the names of all the switches in the cache
+func (manager *LogicalSwitchManager) GetSwitchNames() []string {
+	manager.RLock()
+	defer manager.RUnlock()
+	names := make([]string, 0, len(manager.cache))
+	for switchName := range manager.cache {
+		names = append(names, switchName)
+	}
+	return names
+}
+
 // Given a switch name, get all its host-subnets
 func (manager *LogicalSwitchManager) GetSwitchSubnets(switchName string) []*net.IPNet {
 	manager.RLock()
@@ -167,6 +178,23 @@ func (manager *LogicalSwitchManager) GetSwitchSubnets(switchName string) []*net.
 	return nil
 }
 
+// GetAllocatedIPs returns the IPs allocated from the host subnets of the given switch
+func (manager *LogicalSwitchManager) GetAllocatedIPs(switchName string) ([]net.IP, error) {
+	manager.RLock()
+	defer manager.RUnlock()
+	lsi, ok := manager.cache[switchName]
+	if !ok {
+		return nil, fmt.Errorf("unable to get allocated IPs for switch %s: %w", switchName, SwitchNotFound)
+	}
+	var ips []net.IP
+	for _, ipam := range lsi.ipams {
+		ipam.ForEach(func(ip net.IP) {
+			ips = append(ips, ip)
+		})
+	}
+	return ips, nil
+}
+
 // AllocateUntilFull used for unit testing only, allocates the rest of the switch subnet
 func (manager *LogicalSwitchManager) AllocateUntilFull(switchName string) error {
 	manager.RLock()
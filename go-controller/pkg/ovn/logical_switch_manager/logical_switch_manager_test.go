@@ -392,6 +392,33 @@ var _ = ginkgo.Describe("OVN Logical Switch Manager operations", func() {
 			gomega.Expect(err).NotTo(gomega.HaveOccurred())
 		})
 
+		ginkgo.It("returns the allocated IPs of a switch", func() {
+			app.Action = func(ctx *cli.Context) error {
+				_, err := config.InitConfig(ctx, fexec, nil)
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				err = lsManager.AddSwitch("testNode1", "", ovntest.MustParseIPNets("10.1.1.0/24", "2000::/64"))
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				err = lsManager.AllocateIPs("testNode1", ovntest.MustParseIPNets("10.1.1.7/24", "2000::7/64"))
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+				ips, err := lsManager.GetAllocatedIPs("testNode1")
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				ipStrings := []string{}
+				for _, ip := range ips {
+					ipStrings = append(ipStrings, ip.String())
+				}
+				// the gateway and management IPs are reserved on creation
+				gomega.Expect(ipStrings).To(gomega.ConsistOf("10.1.1.1", "10.1.1.2", "10.1.1.7",
+					"2000::1", "2000::2", "2000::7"))
+
+				_, err = lsManager.GetAllocatedIPs("testNode2")
+				gomega.Expect(err).To(gomega.MatchError(SwitchNotFound))
+				return nil
+			}
+			err := app.Run([]string{app.Name})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+
 	})
 
 })
@@ -1,6 +1,7 @@
 package ovn
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"strings"
@@ -17,15 +18,19 @@ import (
 	"k8s.io/klog/v2"
 	utilnet "k8s.io/utils/net"
 
+	libovsdbclient "github.com/ovn-org/libovsdb/client"
+
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/config"
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/kube"
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/libovsdbops"
+	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/metrics"
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/nbdb"
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/sbdb"
 
 	hotypes "github.com/ovn-org/ovn-kubernetes/go-controller/hybrid-overlay/pkg/types"
 	houtil "github.com/ovn-org/ovn-kubernetes/go-controller/hybrid-overlay/pkg/util"
 	lsm "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/ovn/logical_switch_manager"
+	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/ovn/subnetallocator"
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/types"
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/util"
 )
@@ -93,6 +98,9 @@ func (oc *DefaultNetworkController) upgradeOVNTopology(existingNodes *kapi.NodeL
 	if err != nil {
 		return err
 	}
+	if ver < types.OvnCurrentTopologyVersion {
+		oc.reportTopologyUpgrade(ver)
+	}
 
 	// If current DB version is greater than OvnSingleJoinSwitchTopoVersion, no need to upgrade to single switch topology
 	if ver < types.OvnSingleJoinSwitchTopoVersion {
@@ -118,7 +126,9 @@ func (oc *DefaultNetworkController) SetupMaster(existingNodeNames []string) erro
 	if err != nil {
 		return err
 	}
+	oc.defaultCOPPLock.Lock()
 	oc.defaultCOPPUUID = *(logicalRouter.Copp)
+	oc.defaultCOPPLock.Unlock()
 
 	// Create a cluster-wide port group that all logical switch ports are part of
 	pg := libovsdbops.BuildPortGroup(types.ClusterPortGroupName, types.ClusterPortGroupName, nil, nil)
@@ -227,7 +237,7 @@ func (oc *DefaultNetworkController) syncNodeManagementPort(node *kapi.Node, host
 	}
 
 	if hostSubnets == nil {
-		hostSubnets, err = util.ParseNodeHostSubnetAnnotation(node, types.DefaultNetworkName)
+		hostSubnets, err = util.ParseNodeHostSubnetAnnotation(node, oc.getNetworkName())
 		if err != nil {
 			return err
 		}
@@ -266,10 +276,16 @@ func (oc *DefaultNetworkController) syncNodeManagementPort(node *kapi.Node, host
 
 	// Create this node's management logical port on the node switch
 	logicalSwitchPort := nbdb.LogicalSwitchPort{
-		Name:      types.K8sPrefix + node.Name,
+		Name:      oc.getNodeManagementPortName(node.Name),
 		Addresses: []string{addresses},
 	}
-	sw := nbdb.LogicalSwitch{Name: node.Name}
+	if config.Default.EnableNodePortSecurity {
+		logicalSwitchPort.PortSecurity, err = getNodePortSecurity(logicalSwitchPort.Addresses)
+		if err != nil {
+			return fmt.Errorf("failed to set port security on logical port %s: %v", logicalSwitchPort.Name, err)
+		}
+	}
+	sw := nbdb.LogicalSwitch{Name: oc.getNodeSwitchName(node.Name)}
 	err = libovsdbops.CreateOrUpdateLogicalSwitchPortsOnSwitch(oc.nbClient, &sw, &logicalSwitchPort)
 	if err != nil {
 		return err
@@ -368,7 +384,17 @@ func (oc *DefaultNetworkController) ensureNodeLogicalNetwork(node *kapi.Node, ho
 		return err
 	}
 
-	return oc.createNodeLogicalSwitch(node.Name, hostSubnets, oc.loadBalancerGroupUUID)
+	return oc.nodeAddSteps().ensureSwitch(node, hostSubnets)
+}
+
+// nodeAddSteps returns the steps setting up the logical network of a node, with the
+// default network management port unless in management port only mode
+func (oc *DefaultNetworkController) nodeAddSteps() nodeAddSteps {
+	steps := oc.getNodeAddSteps(oc.getLoadBalancerGroupUUID())
+	if steps.syncMgmtPort == nil {
+		steps.syncMgmtPort = oc.syncNodeManagementPort
+	}
+	return steps
 }
 
 func (oc *DefaultNetworkController) addNode(node *kapi.Node) ([]*net.IPNet, error) {
@@ -390,15 +416,36 @@ func (oc *DefaultNetworkController) addNode(node *kapi.Node) ([]*net.IPNet, erro
 			node.Name, gwLRPIPs)
 	}
 
-	hostSubnets, err := oc.allocateNodeSubnets(node, oc.masterSubnetAllocator)
+	hostSubnets, allocatedSubnets, err := oc.allocateNodeSubnets(node, oc.masterSubnetAllocator)
 	if err != nil {
+		if condErr := oc.UpdateNodeSubnetAllocatedConditionWithRetry(node.Name, nil, err); condErr != nil {
+			klog.Warningf("Failed to report the subnet allocation failure of node %s: %v", node.Name, condErr)
+		}
 		return nil, err
 	}
-
-	hostSubnetsMap := map[string][]*net.IPNet{types.DefaultNetworkName: hostSubnets}
-	err = oc.UpdateNodeAnnotationWithRetry(node.Name, hostSubnetsMap, updatedNodeAnnotation)
+	// let host agents know about the gateway addresses of the node's cluster router port
+	updatedNodeAnnotation, err = util.CreateNodeGatewayIPsAnnotation(updatedNodeAnnotation, hostSubnets)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to marshal node %q annotation for gateway IPs of subnets %s: %v",
+			node.Name, util.JoinIPNets(hostSubnets, ","), err)
+	}
+
+	if allocatedAt, ok := oc.masterSubnetAllocator.SubnetsAllocatedAt(node.Name); ok {
+		updatedNodeAnnotation = util.CreateNodeSubnetsAllocatedAtAnnotation(updatedNodeAnnotation, allocatedAt)
+	}
+
+	// nodes re-added with the subnets they are annotated with, eg on restart, usually
+	// need no patch
+	if len(allocatedSubnets) > 0 || !oc.nodeAnnotationsUpToDate(node, hostSubnets, updatedNodeAnnotation) {
+		hostSubnetsMap := map[string][]*net.IPNet{oc.getNetworkName(): hostSubnets}
+		err = oc.UpdateNodeAnnotationWithRetry(node.Name, hostSubnetsMap, updatedNodeAnnotation)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// the condition is only informational, so failing to report it doesn't hold the node back
+	if condErr := oc.UpdateNodeSubnetAllocatedConditionWithRetry(node.Name, hostSubnets, nil); condErr != nil {
+		klog.Warningf("Failed to report the subnet allocation of node %s: %v", node.Name, condErr)
 	}
 
 	// delete stale chassis in SBDB if any
@@ -459,8 +506,207 @@ func (oc *DefaultNetworkController) deleteStaleNodeChassis(node *kapi.Node) erro
 	return nil
 }
 
+// PreallocateNodeSubnets allocates the subnets of a node that is about to join the
+// cluster, eg on scale-up, before the node object exists. The node gets these
+// subnets when it is added, unless that takes longer than
+// nodeSubnetPreallocationTimeout, in which case they are released.
+func (oc *DefaultNetworkController) PreallocateNodeSubnets(nodeName string) ([]*net.IPNet, error) {
+	return oc.preallocateNodeSubnets(nodeName, oc.masterSubnetAllocator)
+}
+
+// PeekNextNodeSubnets returns the subnets the next node added would get, without
+// allocating them, eg for what-if analysis
+func (oc *DefaultNetworkController) PeekNextNodeSubnets() ([]*net.IPNet, error) {
+	return oc.peekNextNodeSubnets(oc.masterSubnetAllocator)
+}
+
+// NodeSubnetAllocationAges returns how long each node has held its current subnets
+func (oc *DefaultNetworkController) NodeSubnetAllocationAges() map[string]time.Duration {
+	return oc.masterSubnetAllocator.SubnetAllocationAges()
+}
+
+// restoreNodeSubnetsAllocatedAt restores the time the node got its subnets allocated
+// from its annotation. Nodes annotated before the time was recorded keep the time their
+// subnets were marked allocated by this run.
+func (oc *DefaultNetworkController) restoreNodeSubnetsAllocatedAt(node *kapi.Node) {
+	allocatedAt, err := util.ParseNodeSubnetsAllocatedAt(node)
+	if err != nil {
+		if !util.IsAnnotationNotSetError(err) {
+			klog.Warningf("Failed to restore the time node %s got its subnets allocated: %v", node.Name, err)
+		}
+		return
+	}
+	oc.masterSubnetAllocator.SetSubnetsAllocatedAt(node.Name, allocatedAt)
+}
+
+// DefragmentNodeSubnets returns a plan of node subnet moves that would make the free
+// subnets of each cluster subnet contiguous. It is triggered by admins and only
+// reports the plan, no node subnet is changed.
+func (oc *DefaultNetworkController) DefragmentNodeSubnets() []subnetallocator.SubnetMove {
+	return oc.planNodeSubnetDefragmentation(oc.masterSubnetAllocator)
+}
+
+// ReconfigureClusterSubnets makes node subnets be allocated from the given cluster
+// subnets, eg when cluster subnets are added at runtime, without a restart. The node
+// subnets already allocated are kept, and it fails if any of them is not part of the
+// given cluster subnets.
+func (oc *DefaultNetworkController) ReconfigureClusterSubnets(clusterSubnets []config.CIDRNetworkEntry) error {
+	return oc.reconfigureNodeSubnetRanges(oc.masterSubnetAllocator, clusterSubnets)
+}
+
+// MigrateNodeSubnet moves a node to the given host subnet, eg to renumber it following
+// a DefragmentNodeSubnets plan. See migrateNodeSubnet for the disruption it causes.
+func (oc *DefaultNetworkController) MigrateNodeSubnet(nodeName string, newSubnet *net.IPNet) error {
+	return oc.migrateNodeSubnet(nodeName, newSubnet)
+}
+
+// migrateNodeSubnet replaces the host subnet of a node with newSubnet, of the same IP
+// family: newSubnet is allocated, the node switch other_config and the cluster router
+// port networks are moved to it, the node is annotated with it and the old subnet is
+// released. If any step fails, the steps already done are rolled back and the node
+// keeps its old subnet.
+//
+// The node is disrupted for a short while: its switch and router port move to the new
+// subnet before the node picks up the new annotation and reconfigures its management
+// port and routes. The pods of the node keep their addresses from the old subnet,
+// which are no longer routed, until they are recreated.
+func (oc *DefaultNetworkController) migrateNodeSubnet(nodeName string, newSubnet *net.IPNet) error {
+	var err error
+	// node events are handled under the same lock, so they don't interleave with the migration
+	oc.retryNodes.DoWithLock(nodeName, func(nodeName string) {
+		err = oc.migrateNodeSubnetLocked(nodeName, newSubnet)
+	})
+	return err
+}
+
+func (oc *DefaultNetworkController) migrateNodeSubnetLocked(nodeName string, newSubnet *net.IPNet) (err error) {
+	node, err := oc.watchFactory.GetNode(nodeName)
+	if err != nil {
+		return fmt.Errorf("failed to get node %s: %w", nodeName, err)
+	}
+	if util.IsNodeOVNFrozen(node) {
+		return fmt.Errorf("node %s is frozen, its subnet can't be migrated", nodeName)
+	}
+	oldSubnets, err := util.ParseNodeHostSubnetAnnotation(node, oc.getNetworkName())
+	if err != nil {
+		return fmt.Errorf("failed to get the subnets of node %s: %w", nodeName, err)
+	}
+	var oldSubnet *net.IPNet
+	newSubnets := make([]*net.IPNet, 0, len(oldSubnets))
+	for _, subnet := range oldSubnets {
+		if utilnet.IsIPv6CIDR(subnet) == utilnet.IsIPv6CIDR(newSubnet) {
+			oldSubnet = subnet
+			subnet = newSubnet
+		}
+		newSubnets = append(newSubnets, subnet)
+	}
+	if oldSubnet == nil {
+		return fmt.Errorf("node %s has no subnet of the IP family of %s", nodeName, newSubnet)
+	}
+	if oldSubnet.String() == newSubnet.String() {
+		return nil
+	}
+	if !oc.masterSubnetAllocator.IsClusterSubnet(newSubnet) {
+		return fmt.Errorf("subnet %s is not part of the cluster subnets", newSubnet)
+	}
+	if err = oc.masterSubnetAllocator.MarkSubnetsAllocated(nodeName, newSubnet); err != nil {
+		return fmt.Errorf("failed to allocate subnet %s to node %s: %w", newSubnet, nodeName, err)
+	}
+	oc.recordNodeSubnetAllocations([]*net.IPNet{newSubnet})
+	klog.Infof("Migrating node %s from subnet %s to %s", nodeName, oldSubnet, newSubnet)
+
+	// the rollback of each step is registered before the step is done, as a failed step
+	// may be half done
+	var rollbacks []func() error
+	defer func() {
+		if err == nil {
+			return
+		}
+		klog.Warningf("Rolling back the migration of node %s to subnet %s: %v", nodeName, newSubnet, err)
+		for i := len(rollbacks) - 1; i >= 0; i-- {
+			if errR := rollbacks[i](); errR != nil {
+				klog.Errorf("Failed to roll back the migration of node %s to subnet %s: %v", nodeName, newSubnet, errR)
+			}
+		}
+	}()
+	rollbacks = append(rollbacks, func() error {
+		if err := oc.masterSubnetAllocator.ReleaseNodeSubnets(nodeName, newSubnet); err != nil {
+			return err
+		}
+		oc.recordNodeSubnetReleases([]*net.IPNet{newSubnet})
+		return nil
+	})
+
+	// recreating the switch rebuilds its IPAM: the pod IPs of the other IP family, or
+	// all of them on a rollback, are allocated again
+	switchName := oc.getNodeSwitchName(nodeName)
+	allocatedIPs, err := oc.lsManager.GetAllocatedIPs(switchName)
+	if err != nil {
+		return fmt.Errorf("failed to get the IPs allocated on the logical switch of node %s: %w", nodeName, err)
+	}
+	rollbacks = append(rollbacks, func() error {
+		if _, err := oc.createNodeLogicalSwitch(nodeName, oldSubnets, oc.getLoadBalancerGroupUUID()); err != nil {
+			return err
+		}
+		return oc.reallocateSwitchIPs(switchName, allocatedIPs)
+	})
+	if _, err = oc.createNodeLogicalSwitch(nodeName, newSubnets, oc.getLoadBalancerGroupUUID()); err != nil {
+		return fmt.Errorf("failed to move the logical switch of node %s to subnet %s: %w", nodeName, newSubnet, err)
+	}
+	if err = oc.reallocateSwitchIPs(switchName, allocatedIPs); err != nil {
+		return err
+	}
+
+	rollbacks = append(rollbacks, func() error {
+		return oc.syncNodeClusterRouterPort(node, oldSubnets)
+	})
+	if err = oc.syncNodeClusterRouterPort(node, newSubnets); err != nil {
+		return fmt.Errorf("failed to move the cluster router port of node %s to subnet %s: %w", nodeName, newSubnet, err)
+	}
+
+	gatewayIPsAnnotation, err := util.CreateNodeGatewayIPsAnnotation(nil, newSubnets)
+	if err != nil {
+		return fmt.Errorf("failed to marshal node %q annotation for gateway IPs of subnets %s: %v",
+			nodeName, util.JoinIPNets(newSubnets, ","), err)
+	}
+	// the node holds its subnets since the migration
+	allocatedAt := oc.clock.Now()
+	gatewayIPsAnnotation = util.CreateNodeSubnetsAllocatedAtAnnotation(gatewayIPsAnnotation, allocatedAt)
+	hostSubnetsMap := map[string][]*net.IPNet{oc.getNetworkName(): newSubnets}
+	if err = oc.UpdateNodeAnnotationWithRetry(nodeName, hostSubnetsMap, gatewayIPsAnnotation); err != nil {
+		return err
+	}
+	oc.masterSubnetAllocator.SetSubnetsAllocatedAt(nodeName, allocatedAt)
+
+	if errR := oc.masterSubnetAllocator.ReleaseNodeSubnets(nodeName, oldSubnet); errR != nil {
+		klog.Warningf("Failed to release subnet %s of node %s after its migration: %v", oldSubnet, nodeName, errR)
+	} else {
+		oc.recordNodeSubnetReleases([]*net.IPNet{oldSubnet})
+	}
+	klog.Infof("Migrated node %s from subnet %s to %s", nodeName, oldSubnet, newSubnet)
+	return nil
+}
+
+// releaseDeletedNodeSubnets releases the subnets of a deleted node, or holds them for
+// config.Kubernetes.NodeSubnetReleaseDelay so that a node flapping out of and back into
+// the cluster, eg through the autoscaler, keeps its subnets.
+func (oc *DefaultNetworkController) releaseDeletedNodeSubnets(nodeName string) {
+	delay := time.Duration(config.Kubernetes.NodeSubnetReleaseDelay) * time.Second
+	if delay > 0 {
+		if subnets := oc.lsManager.GetSwitchSubnets(oc.getNodeSwitchName(nodeName)); len(subnets) > 0 {
+			oc.holdDeletedNodeSubnets(nodeName, subnets, delay, oc.masterSubnetAllocator)
+			return
+		}
+		// a retried delete no longer finds the switch subnets but already holds them
+		if len(oc.getPreallocatedNodeSubnets(nodeName)) > 0 {
+			return
+		}
+	}
+	oc.recordNodeSubnetReleases(oc.masterSubnetAllocator.ReleaseAllNodeSubnets(nodeName))
+}
+
 func (oc *DefaultNetworkController) deleteNode(nodeName string) error {
-	oc.masterSubnetAllocator.ReleaseAllNodeSubnets(nodeName)
+	oc.releaseDeletedNodeSubnets(nodeName)
 
 	if err := oc.deleteNodeLogicalNetwork(nodeName); err != nil {
 		return fmt.Errorf("error deleting node %s logical network: %v", nodeName, err)
@@ -483,6 +729,53 @@ func (oc *DefaultNetworkController) deleteNode(nodeName string) error {
 	return nil
 }
 
+// cleanupNoHostSubnetNode removes the logical network, gateway and join switch IPs of a
+// node that now manages its own host subnet, and releases the subnets it was assigned.
+// Nothing is done for a node that has none of them left.
+func (oc *DefaultNetworkController) cleanupNoHostSubnetNode(nodeName string) error {
+	hasNetwork, hasGateway, err := oc.findNoHostSubnetNodeLeftovers(nodeName)
+	if err != nil || (!hasNetwork && !hasGateway) {
+		return err
+	}
+	if hasNetwork {
+		if err := oc.deleteNoHostSubnetNodeLogicalNetwork(nodeName, oc.masterSubnetAllocator); err != nil {
+			return err
+		}
+	}
+	if hasGateway {
+		if err := oc.gatewayCleanup(nodeName); err != nil {
+			return fmt.Errorf("failed to clean up node %s gateway: (%v)", nodeName, err)
+		}
+	}
+	if err := oc.joinSwIPManager.ReleaseJoinLRPIPs(nodeName); err != nil {
+		return fmt.Errorf("failed to clean up GR LRP IPs for node %s: %v", nodeName, err)
+	}
+	oc.addNodeFailed.Delete(nodeName)
+	oc.mgmtPortFailed.Delete(nodeName)
+	oc.gatewaysFailed.Delete(nodeName)
+	oc.nodeClusterRouterPortFailed.Delete(nodeName)
+	return nil
+}
+
+// findNoHostSubnetNodeLeftovers returns whether a node still has subnets assigned or a
+// logical switch, and whether it still has a gateway router
+func (oc *DefaultNetworkController) findNoHostSubnetNodeLeftovers(nodeName string) (bool, bool, error) {
+	switchName := oc.getNodeSwitchName(nodeName)
+	hasNetwork := len(oc.lsManager.GetSwitchSubnets(switchName)) > 0
+	if !hasNetwork {
+		_, err := libovsdbops.GetLogicalSwitch(oc.nbClient, &nbdb.LogicalSwitch{Name: switchName})
+		if err != nil && !errors.Is(err, libovsdbclient.ErrNotFound) {
+			return false, false, fmt.Errorf("failed to get node %s logical switch: %v", nodeName, err)
+		}
+		hasNetwork = err == nil
+	}
+	_, err := libovsdbops.GetLogicalRouter(oc.nbClient, &nbdb.LogicalRouter{Name: types.GWRouterPrefix + nodeName})
+	if err != nil && !errors.Is(err, libovsdbclient.ErrNotFound) {
+		return false, false, fmt.Errorf("failed to get node %s gateway router: %v", nodeName, err)
+	}
+	return hasNetwork, err == nil, nil
+}
+
 // OVN uses an overlay and doesn't need GCE Routes, we need to
 // clear the NetworkUnavailable condition that kubelet adds to initial node
 // status when using GCE (done here: https://github.com/kubernetes/kubernetes/blob/master/pkg/controller/cloud/node_controller.go#L237).
@@ -532,7 +825,9 @@ func (oc *DefaultNetworkController) clearInitialNodeNetworkUnavailableCondition(
 }
 
 // this is the worker function that does the periodic sync of nodes from kube API
-// and sbdb and deletes chassis that are stale
+// and sbdb and deletes chassis that are stale. It also recreates the cluster router if
+// it was deleted, and repairs node host subnet annotations that diverged from the node
+// logical switch subnets.
 func (oc *DefaultNetworkController) syncNodesPeriodic() {
 	//node names is a slice of all node names
 	nodes, err := oc.kube.GetNodes()
@@ -572,6 +867,118 @@ func (oc *DefaultNetworkController) syncNodesPeriodic() {
 		klog.Errorf("Failed Deleting chassis %v error: %v", chassisHostNameMap, err)
 		return
 	}
+
+	// the node router ports are attached to the cluster router, recreate it first if it
+	// was deleted
+	if _, err = oc.createOvnClusterRouter(); err != nil {
+		klog.Errorf("Failed to ensure the cluster router: %v", err)
+	}
+
+	nodeList := make([]*kapi.Node, 0, len(nodes.Items))
+	for i := range nodes.Items {
+		nodeList = append(nodeList, &nodes.Items[i])
+	}
+	if err = oc.reconcileNodeSwitchSubnets(nodeList); err != nil {
+		klog.Errorf("Failed to reconcile node switch subnets: %v", err)
+	}
+	if err = oc.reconcileNodeSwitchesPodIPs(nodeList); err != nil {
+		klog.Errorf("Failed to reconcile node switch pod IPs: %v", err)
+	}
+	if _, err = oc.reconcileNodeSwitchRouterPorts(nodeList); err != nil {
+		klog.Errorf("Failed to reconcile node switch router ports: %v", err)
+	}
+	if _, err = oc.reconcileNodeClusterRouterPortNetworks(nodeList); err != nil {
+		klog.Errorf("Failed to reconcile node cluster router port networks: %v", err)
+	}
+	if _, err = oc.reconcileNodeSwitchLoadBalancerGroup(nodeList); err != nil {
+		klog.Errorf("Failed to reconcile node switch load balancer group: %v", err)
+	}
+	if _, err = oc.reconcileRouterCOPPs(); err != nil {
+		klog.Errorf("Failed to reconcile router COPPs: %v", err)
+	}
+	metrics.RecordNodeReconcile(oc.getNetworkName())
+}
+
+// getLoadBalancerGroupUUID returns the UUID of the cluster wide load balancer group, empty
+// if load balancer groups are not supported
+func (oc *DefaultNetworkController) getLoadBalancerGroupUUID() string {
+	oc.loadBalancerGroupLock.RLock()
+	defer oc.loadBalancerGroupLock.RUnlock()
+	return oc.loadBalancerGroupUUID
+}
+
+// reconcileNodeSwitchLoadBalancerGroup points the node switches and gateway routers back at
+// the cluster load balancer group when it was recreated with a new UUID, which leaves them
+// with a stale or no group. Switches of nodes excluded from the group are left alone. It
+// returns the names of the switches that were updated.
+func (oc *DefaultNetworkController) reconcileNodeSwitchLoadBalancerGroup(nodes []*kapi.Node) ([]string, error) {
+	if oc.getLoadBalancerGroupUUID() == "" {
+		return nil, nil
+	}
+	groups, err := libovsdbops.FindLoadBalancerGroupsWithPredicate(oc.nbClient, func(group *nbdb.LoadBalancerGroup) bool {
+		return group.Name == types.ClusterLBGroupName
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find load balancer group %s: %w", types.ClusterLBGroupName, err)
+	}
+	if len(groups) != 1 {
+		return nil, fmt.Errorf("expected one load balancer group %s, found %d", types.ClusterLBGroupName, len(groups))
+	}
+	groupUUID := groups[0].UUID
+	oc.loadBalancerGroupLock.Lock()
+	if groupUUID != oc.loadBalancerGroupUUID {
+		klog.Warningf("Load balancer group %s was recreated, its UUID changed from %s to %s",
+			types.ClusterLBGroupName, oc.loadBalancerGroupUUID, groupUUID)
+		oc.loadBalancerGroupUUID = groupUUID
+	}
+	oc.loadBalancerGroupLock.Unlock()
+
+	var errs []error
+	gatewayRouters, err := libovsdbops.FindLogicalRoutersWithPredicate(oc.nbClient, func(lr *nbdb.LogicalRouter) bool {
+		return strings.HasPrefix(lr.Name, types.GWRouterPrefix) &&
+			!(len(lr.LoadBalancerGroup) == 1 && lr.LoadBalancerGroup[0] == groupUUID)
+	})
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to find gateway routers: %w", err))
+	}
+	for _, lr := range gatewayRouters {
+		klog.Infof("Updating the load balancer group of gateway router %s from %v to %s",
+			lr.Name, lr.LoadBalancerGroup, groupUUID)
+		lr.LoadBalancerGroup = []string{groupUUID}
+		if err = libovsdbops.CreateOrUpdateLogicalRouter(oc.nbClient, lr, &lr.LoadBalancerGroup); err != nil {
+			errs = append(errs, fmt.Errorf("failed to update the load balancer group of gateway router %s: %w",
+				lr.Name, err))
+		}
+	}
+
+	var updated []string
+	for _, node := range nodes {
+		switchName := oc.getNodeSwitchName(node.Name)
+		if oc.lsManager.IsNonHostSubnetSwitch(switchName) || len(oc.lsManager.GetSwitchSubnets(switchName)) == 0 ||
+			util.IsNodeOVNFrozen(node) || util.IsNodeExcludedFromLoadBalancerGroup(node) {
+			continue
+		}
+		ls, err := libovsdbops.GetLogicalSwitch(oc.nbClient, &nbdb.LogicalSwitch{Name: switchName})
+		if err != nil {
+			if !errors.Is(err, libovsdbclient.ErrNotFound) {
+				errs = append(errs, fmt.Errorf("failed to get logical switch %s: %w", switchName, err))
+			}
+			continue
+		}
+		if len(ls.LoadBalancerGroup) == 1 && ls.LoadBalancerGroup[0] == groupUUID {
+			continue
+		}
+		klog.Infof("Updating the load balancer group of logical switch %s from %v to %s",
+			switchName, ls.LoadBalancerGroup, groupUUID)
+		ls.LoadBalancerGroup = []string{groupUUID}
+		if err = libovsdbops.UpdateLogicalSwitchSetLoadBalancerGroup(oc.nbClient, ls); err != nil {
+			errs = append(errs, fmt.Errorf("failed to update the load balancer group of logical switch %s: %w",
+				switchName, err))
+			continue
+		}
+		updated = append(updated, switchName)
+	}
+	return updated, kerrors.NewAggregate(errs)
 }
 
 // We only deal with cleaning up nodes that shouldn't exist here, since
@@ -585,7 +992,16 @@ func (oc *DefaultNetworkController) syncNodes(nodes []interface{}) error {
 		if !ok {
 			return fmt.Errorf("spurious object in syncNodes: %v", tmp)
 		}
+		if noHostSubnet(node) {
+			// the node may have had a host subnet assigned before it was labeled
+			if err := oc.cleanupNoHostSubnetNode(node.Name); err != nil {
+				utilruntime.HandleError(err)
+			}
+		}
 		hostSubnets := oc.updateNodesManageHostSubnets(node, oc.masterSubnetAllocator, foundNodes)
+		if len(hostSubnets) > 0 {
+			oc.restoreNodeSubnetsAllocatedAt(node)
+		}
 		if config.HybridOverlay.Enabled && len(hostSubnets) == 0 && houtil.IsHybridOverlayNode(node) {
 			// this is a hybrid overlay node so mark as allocated from the hybrid overlay subnet allocator
 			hostSubnet, err := houtil.ParseHybridOverlayHostSubnet(node)
@@ -615,13 +1031,22 @@ func (oc *DefaultNetworkController) syncNodes(nodes []interface{}) error {
 		return fmt.Errorf("failed to get node logical switches which have other-config set: %v", err)
 	}
 	for _, nodeSwitch := range nodeSwitches {
-		if !foundNodes.Has(nodeSwitch.Name) {
-			if err := oc.deleteNode(nodeSwitch.Name); err != nil {
-				return fmt.Errorf("failed to delete node:%s, err:%v", nodeSwitch.Name, err)
+		nodeName, ok := oc.getSwitchNodeName(nodeSwitch)
+		if !ok {
+			klog.Warningf("Skipping logical switch %s: its node is unknown", nodeSwitch.Name)
+			continue
+		}
+		if !foundNodes.Has(nodeName) {
+			if err := oc.deleteNode(nodeName); err != nil {
+				return fmt.Errorf("failed to delete node:%s, err:%v", nodeName, err)
 			}
 		}
 	}
 
+	if err := oc.reconcileLoadBalancerCacheSwitches(); err != nil {
+		return err
+	}
+
 	// cleanup stale chassis with no corresponding nodes
 	chassisList, err := libovsdbops.ListChassis(oc.sbClient)
 	if err != nil {
@@ -671,15 +1096,93 @@ type nodeSyncs struct {
 	syncMgmtPort          bool
 	syncGw                bool
 	syncHo                bool
+	// syncSwitch only reconciles the node switch, unlike syncNode which adds the
+	// whole node, subnet allocation and pods included
+	syncSwitch bool
+}
+
+// nodeUpdateSyncs returns the parts of a node to reconcile on an update, so that an
+// update only reconciles what changed, eg a chassis change only the cluster router
+// port, plus whatever failed before
+func (oc *DefaultNetworkController) nodeUpdateSyncs(oldNode, newNode *kapi.Node) *nodeSyncs {
+	// whatever was skipped while the node was frozen has to be caught up with once it is not
+	freezeChanged := nodeOVNFreezeChanged(oldNode, newNode)
+	_, nodeSync := oc.addNodeFailed.Load(newNode.Name)
+	nodeSync = nodeSync || freezeChanged
+	switchSync := freezeChanged || nodeLoadBalancerGroupExclusionChanged(oldNode, newNode) || nodeSubnetExclusionsChanged(oldNode, newNode) ||
+		(nodeSubnetChanged(oldNode, newNode) && oc.nodeSwitchSubnetsOutdated(newNode))
+	_, failed := oc.nodeClusterRouterPortFailed.Load(newNode.Name)
+	clusterRtrSync := failed || freezeChanged || nodeChassisChanged(oldNode, newNode) || nodeSubnetChanged(oldNode, newNode) ||
+		nodeAlwaysLearnFromARPRequestChanged(oldNode, newNode) || nodeBackupChassisChanged(oldNode, newNode)
+	_, failed = oc.mgmtPortFailed.Load(newNode.Name)
+	mgmtSync := failed || macAddressChanged(oldNode, newNode) || nodeSubnetChanged(oldNode, newNode)
+	_, failed = oc.gatewaysFailed.Load(newNode.Name)
+	gwSync := (failed || gatewayChanged(oldNode, newNode) ||
+		nodeSubnetChanged(oldNode, newNode) || hostAddressesChanged(oldNode, newNode) ||
+		nodeGatewayMTUSupportChanged(oldNode, newNode))
+	_, hoSync := oc.hybridOverlayFailed.Load(newNode.Name)
+	return &nodeSyncs{nodeSync, clusterRtrSync, mgmtSync, gwSync, hoSync, switchSync}
+}
+
+// nodeSwitchSubnetsOutdated returns whether the node is annotated with subnets its switch
+// does not have yet. It does not when the annotation was just patched after adding the
+// node, nor when the annotation was removed, which is up to the node add to handle.
+func (oc *DefaultNetworkController) nodeSwitchSubnetsOutdated(node *kapi.Node) bool {
+	hostSubnets, err := util.ParseNodeHostSubnetAnnotation(node, oc.getNetworkName())
+	if err != nil {
+		return false
+	}
+	switchSubnets := oc.lsManager.GetSwitchSubnets(oc.getNodeSwitchName(node.Name))
+	return util.JoinIPNets(hostSubnets, ",") != util.JoinIPNets(switchSubnets, ",")
+}
+
+// syncNodeSwitch reconciles the switch of a node with the subnets it is annotated with.
+// Subnets that are not allocated to the node, eg if the annotation was edited, are
+// handled by adding the node all over again, which validates them.
+func (oc *DefaultNetworkController) syncNodeSwitch(node *kapi.Node) ([]*net.IPNet, error) {
+	hostSubnets, err := util.ParseNodeHostSubnetAnnotation(node, oc.getNetworkName())
+	if err == nil {
+		for _, hostSubnet := range hostSubnets {
+			if owner, ok := oc.masterSubnetAllocator.SubnetOwner(hostSubnet); !ok || owner != node.Name {
+				err = fmt.Errorf("subnet %s is not allocated to node %s", hostSubnet, node.Name)
+				break
+			}
+		}
+	}
+	if err != nil {
+		klog.Infof("Adding node %s again to sync its switch: %v", node.Name, err)
+		return oc.addNode(node)
+	}
+	// the switch IPAM is rebuilt with the switch, the IPs of the pods of the node are
+	// allocated again
+	switchName := oc.getNodeSwitchName(node.Name)
+	allocatedIPs, err := oc.lsManager.GetAllocatedIPs(switchName)
+	if err != nil && !errors.Is(err, lsm.SwitchNotFound) {
+		return nil, err
+	}
+	if err = oc.ensureNodeLogicalNetwork(node, hostSubnets); err != nil {
+		return nil, err
+	}
+	if err = oc.reallocateSwitchIPs(switchName, allocatedIPs); err != nil {
+		return nil, err
+	}
+	return hostSubnets, nil
 }
 
 func (oc *DefaultNetworkController) addUpdateNodeEvent(node *kapi.Node, nSyncs *nodeSyncs) error {
+	defer oc.trackNodeHandler(node.Name)()
+
 	var hostSubnets []*net.IPNet
 	var errs []error
 	var err error
+	var chassisPendingErr error
 
 	if noHostSubnet := noHostSubnet(node); noHostSubnet {
-		err := oc.lsManager.AddNoHostSubnetSwitch(node.Name)
+		// the node may have had a host subnet assigned before it was labeled
+		if err := oc.cleanupNoHostSubnetNode(node.Name); err != nil {
+			return err
+		}
+		err := oc.lsManager.AddNoHostSubnetSwitch(oc.getNodeSwitchName(node.Name))
 		if err != nil {
 			return fmt.Errorf("nodeAdd: error adding noHost subnet for switch %s: %w", node.Name, err)
 		}
@@ -705,11 +1208,19 @@ func (oc *DefaultNetworkController) addUpdateNodeEvent(node *kapi.Node, nSyncs *
 			oc.mgmtPortFailed.Store(node.Name, true)
 			oc.gatewaysFailed.Store(node.Name, true)
 			oc.hybridOverlayFailed.Store(node.Name, config.HybridOverlay.Enabled)
-			err = fmt.Errorf("nodeAdd: error adding node %q: %w", node.Name, err)
+			err = fmt.Errorf("nodeAdd: error adding node %q: %w", node.Name, newNodeAddError(err))
 			oc.recordNodeErrorEvent(node, err)
 			return err
 		}
 		oc.addNodeFailed.Delete(node.Name)
+	} else if nSyncs.syncSwitch {
+		if hostSubnets, err = oc.syncNodeSwitch(node); err != nil {
+			// the retry adds the whole node
+			oc.addNodeFailed.Store(node.Name, true)
+			err = fmt.Errorf("nodeUpdate: error syncing the switch of node %q: %w", node.Name, newNodeAddError(err))
+			oc.recordNodeErrorEvent(node, err)
+			return err
+		}
 	}
 
 	// since the nodeSync objects are created knowing if hybridOverlay is enabled this should work
@@ -722,17 +1233,26 @@ func (oc *DefaultNetworkController) addUpdateNodeEvent(node *kapi.Node, nSyncs *
 		}
 	}
 
-	if nSyncs.syncClusterRouterPort {
-		if err = oc.syncNodeClusterRouterPort(node, nil); err != nil {
-			errs = append(errs, err)
+	steps := oc.nodeAddSteps()
+	if nSyncs.syncClusterRouterPort && steps.syncRouterPort != nil {
+		if err = steps.syncRouterPort(node, nil); err != nil {
+			err = newNodeAddError(err)
 			oc.nodeClusterRouterPortFailed.Store(node.Name, true)
+			if errors.Is(err, errNodeChassisNotFound) {
+				// ovnkube-node has not annotated the chassis yet; the node switch is already
+				// in place, so carry on with the rest of the node and only retry the router port.
+				klog.Infof("Deferring cluster router port for node %s: %v", node.Name, err)
+				chassisPendingErr = err
+			} else {
+				errs = append(errs, err)
+			}
 		} else {
 			oc.nodeClusterRouterPortFailed.Delete(node.Name)
 		}
 	}
 
 	if nSyncs.syncMgmtPort {
-		err := oc.syncNodeManagementPort(node, hostSubnets)
+		err := steps.syncMgmtPort(node, hostSubnets)
 		if err != nil {
 			errs = append(errs, err)
 			oc.mgmtPortFailed.Store(node.Name, true)
@@ -759,7 +1279,8 @@ func (oc *DefaultNetworkController) addUpdateNodeEvent(node *kapi.Node, nSyncs *
 
 	oc.clearInitialNodeNetworkUnavailableCondition(node)
 
-	if nSyncs.syncGw {
+	// nodes don't get a gateway in management port only mode
+	if nSyncs.syncGw && !oc.managementPortOnly {
 		err := oc.syncNodeGateway(node, nil)
 		if err != nil {
 			errs = append(errs, err)
@@ -781,8 +1302,14 @@ func (oc *DefaultNetworkController) addUpdateNodeEvent(node *kapi.Node, nSyncs *
 	err = kerrors.NewAggregate(errs)
 	if err != nil {
 		oc.recordNodeErrorEvent(node, err)
+		return err
 	}
-	return err
+	if chassisPendingErr != nil {
+		// not a node error, but hand it back to the retry framework so that the
+		// cluster router port gets retried with backoff until the chassis shows up
+		return fmt.Errorf("cluster router port for node %s is pending: %w", node.Name, chassisPendingErr)
+	}
+	return nil
 }
 
 func (oc *DefaultNetworkController) recordNodeErrorEvent(node *kapi.Node, nodeErr error) {
@@ -797,13 +1324,15 @@ func (oc *DefaultNetworkController) recordNodeErrorEvent(node *kapi.Node, nodeEr
 }
 
 func (oc *DefaultNetworkController) deleteNodeEvent(node *kapi.Node) error {
+	defer oc.trackNodeHandler(node.Name)()
+
 	klog.V(5).Infof("Deleting Node %q. Removing the node from "+
 		"various caches", node.Name)
 
 	if config.HybridOverlay.Enabled {
 		if noHostSubnet := noHostSubnet(node); noHostSubnet {
 			// noHostSubnet nodes are different, only remove the switch and delete the hybrid overlay subnet
-			oc.lsManager.DeleteSwitch(node.Name)
+			oc.lsManager.DeleteSwitch(oc.getNodeSwitchName(node.Name))
 			oc.releaseHybridOverlayNodeSubnet(node.Name)
 			return nil
 		}
@@ -814,10 +1343,19 @@ func (oc *DefaultNetworkController) deleteNodeEvent(node *kapi.Node) error {
 			return err
 		}
 	}
+	// the IPs of the node are removed from the namespace address sets before its subnets
+	// are released, as they could otherwise be handed out to the pods of another node
+	// that would then lose them
+	if !config.Default.DisableNodeDeleteAddressSetCleanup {
+		hostSubnets := oc.lsManager.GetSwitchSubnets(oc.getNodeSwitchName(node.Name))
+		if err := oc.deleteSubnetsFromNamespaceAddressSets(hostSubnets); err != nil {
+			return fmt.Errorf("failed to remove the IPs of node %s from the namespace address sets: %w", node.Name, err)
+		}
+	}
 	if err := oc.deleteNode(node.Name); err != nil {
 		return err
 	}
-	oc.lsManager.DeleteSwitch(node.Name)
+	oc.lsManager.DeleteSwitch(oc.getNodeSwitchName(node.Name))
 	oc.addNodeFailed.Delete(node.Name)
 	oc.mgmtPortFailed.Delete(node.Name)
 	oc.gatewaysFailed.Delete(node.Name)
@@ -301,6 +301,7 @@ func addNodeLogicalFlows(testData []libovsdbtest.TestData, expectedOVNClusterRou
 		MAC:            node.NodeLRPMAC,
 		Networks:       []string{node.NodeGWIP},
 		GatewayChassis: []string{chassisName + "-UUID"},
+		ExternalIDs:    map[string]string{types.OvnNodeExternalID: node.Name},
 	})
 
 	expectedOVNClusterRouter.Ports = append(expectedOVNClusterRouter.Ports, types.RouterToSwitchPrefix+node.Name+"-UUID")
@@ -1374,7 +1375,9 @@ var _ = ginkgo.Describe("Gateway Init Operations", func() {
 				oc.retryNodes.ResourceHandler.AddResource(
 					&testNode, false)).To(
 				gomega.MatchError(
-					"nodeAdd: error adding node \"node1\": error allocating networks for node node1: 1 subnets expected only new 0 subnets allocated"))
+					"nodeAdd: error adding node \"node1\": error allocating networks for node node1: 1 subnets expected only new 0 subnets allocated: " +
+						"no network range configured for the IP family (SubnetNotConfigured: the cluster subnets do not cover all the " +
+						"IP families of the node, check the cluster-subnets configuration)"))
 
 			ginkgo.By("annotating the node with no host subnet")
 			testNode.Labels = nodeNoHostSubnetAnnotation()
@@ -376,5 +376,60 @@ var _ = ginkgo.Describe("OVN NetworkPolicy Operations with IP Address Family", f
 				gomega.Expect(err).NotTo(gomega.HaveOccurred())
 			})
 		}
+
+		ginkgo.It("relays multicast on the cluster router only while a namespace has multicast enabled", func() {
+			getRelay := func() string {
+				logicalRouter, err := libovsdbops.GetLogicalRouter(fakeOvn.nbClient,
+					&nbdb.LogicalRouter{Name: types.OVNClusterRouter})
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				gomega.Expect(logicalRouter.Options).To(gomega.HaveKeyWithValue("always_learn_from_arp_request", "false"))
+				return logicalRouter.Options["mcast_relay"]
+			}
+			setMulticast := func(name, enabled string) {
+				ns, err := fakeOvn.fakeClient.KubeClient.CoreV1().Namespaces().Get(context.TODO(), name, metav1.GetOptions{})
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				ns.Annotations[util.NsMulticastAnnotation] = enabled
+				_, err = fakeOvn.fakeClient.KubeClient.CoreV1().Namespaces().Update(context.TODO(), ns, metav1.UpdateOptions{})
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			}
+
+			namespace1 := newNamespace(namespaceName1)
+			namespace1.Annotations[util.NsMulticastAnnotation] = "true"
+			fakeOvn.startWithDBSetup(libovsdb.TestSetup{},
+				&v1.NamespaceList{
+					Items: []v1.Namespace{
+						*namespace1,
+						*newNamespace(namespaceName2),
+					},
+				},
+			)
+
+			// the router is created with relay on as a namespace asks for multicast,
+			// before namespaces are even handled
+			_, err := fakeOvn.controller.createOvnClusterRouter()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(getRelay()).To(gomega.Equal("true"))
+
+			err = fakeOvn.controller.WatchNamespaces()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(getRelay()).To(gomega.Equal("true"))
+
+			setMulticast(namespaceName2, "true")
+			setMulticast(namespaceName1, "false")
+			gomega.Consistently(getRelay).Should(gomega.Equal("true"))
+
+			// disabling multicast in the last namespace turns relay off
+			setMulticast(namespaceName2, "false")
+			gomega.Eventually(getRelay).Should(gomega.Equal("false"))
+
+			// and enabling it again turns relay back on
+			setMulticast(namespaceName1, "true")
+			gomega.Eventually(getRelay).Should(gomega.Equal("true"))
+
+			// deleting the last multicast namespace also turns relay off
+			err = fakeOvn.fakeClient.KubeClient.CoreV1().Namespaces().Delete(context.TODO(), namespaceName1, *metav1.NewDeleteOptions(0))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Eventually(getRelay).Should(gomega.Equal("false"))
+		})
 	})
 })
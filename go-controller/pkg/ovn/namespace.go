@@ -34,6 +34,18 @@ type namespaceInfo struct {
 	// addressSet is an address set object that holds the IP addresses
 	// of all pods in the namespace.
 	addressSet addressset.AddressSet
+	// addressSetClass is the class addressSet was created with, see NamespaceAddressSetClassLabel
+	addressSetClass string
+
+	// addressSetIPsLock protects addressSetIPs and addressSetLimitReached, as pods are added
+	// and deleted holding the namespaceInfo's read lock
+	addressSetIPsLock sync.Mutex
+	// addressSetIPs holds the IPs of addressSet, only tracked when the number of IPs of
+	// namespace address sets is limited, so that the limit is checked without listing it
+	addressSetIPs sets.String
+	// addressSetLimitReached is set once pod IPs are left out of addressSet for reaching
+	// the limit, and cleared once IPs are deleted from it below the limit
+	addressSetLimitReached bool
 
 	// Map of related network policies. Policy will add itself to this list when it's ready to subscribe
 	// to namespace Update events. Retry logic to update network policy based on namespace event is handled by namespace.
@@ -74,7 +86,20 @@ func (oc *DefaultNetworkController) syncNamespaces(namespaces []interface{}) err
 		expectedNs[ns.Name] = true
 	}
 
-	err := oc.addressSetFactory.ProcessEachAddressSet(func(hashedName, addrSetName string) error {
+	// namespace address sets may have been created by the factory of any namespace class
+	for _, asf := range oc.getAddressSetFactories() {
+		if err := oc.syncNamespaceAddressSets(asf, expectedNs); err != nil {
+			return fmt.Errorf("error in syncing namespaces: %v", err)
+		}
+	}
+	return nil
+}
+
+// syncNamespaceAddressSets destroys the address sets of the factory owned by namespaces that
+// are not expected anymore.
+func (oc *DefaultNetworkController) syncNamespaceAddressSets(asf addressset.AddressSetFactory,
+	expectedNs map[string]bool) error {
+	return asf.ProcessEachAddressSet(func(hashedName, addrSetName string) error {
 		// filter out address sets owned by HybridRoutePolicy and EgressQoS by prefix.
 		// network policy-owned address set would have a dot in the address set name due to the format
 		// (namespace can't have dots in its name, and their address sets too).
@@ -106,17 +131,13 @@ func (oc *DefaultNetworkController) syncNamespaces(namespaces []interface{}) err
 		}
 		// address set is owned by namespace, namespace name = address set name
 		if !expectedNs[addrSetName] {
-			if err = oc.addressSetFactory.DestroyAddressSetInBackingStore(addrSetName); err != nil {
+			if err = asf.DestroyAddressSetInBackingStore(addrSetName); err != nil {
 				return err
 			}
 		}
 
 		return nil
 	})
-	if err != nil {
-		return fmt.Errorf("error in syncing namespaces: %v", err)
-	}
-	return nil
 }
 
 func (oc *DefaultNetworkController) getRoutingExternalGWs(nsInfo *namespaceInfo) *gatewayInfo {
@@ -170,13 +191,116 @@ func (oc *DefaultNetworkController) addPodToNamespace(ns string, ips []*net.IPNe
 
 	defer nsUnlock()
 
-	if ops, err = nsInfo.addressSet.AddIPsReturnOps(createIPAddressSlice(ips)); err != nil {
+	ipAddrs := oc.limitNamespaceAddressSetIPs(ns, nsInfo, createIPAddressSlice(ips))
+	if ops, err = nsInfo.addressSet.AddIPsReturnOps(ipAddrs); err != nil {
 		return nil, nil, nil, nil, err
 	}
 
 	return oc.getRoutingExternalGWs(nsInfo), oc.getRoutingPodGWs(nsInfo), nsInfo.hybridOverlayExternalGW, ops, nil
 }
 
+// limitNamespaceAddressSetIPs returns the IPs of a pod to add to the address set of namespace
+// ns: none of them if the address set would then hold more IPs than configured, in which case
+// the pod is still added but is left out of the address set. IPs already in the address set
+// don't count against the limit. An event is posted for the namespace when it reaches the
+// limit, not again until IPs are deleted from it below the limit.
+// nsInfo must be locked.
+func (oc *DefaultNetworkController) limitNamespaceAddressSetIPs(ns string, nsInfo *namespaceInfo, ips []net.IP) []net.IP {
+	maxIPs := config.Default.NamespaceAddressSetMaxIPs
+	if maxIPs == 0 || nsInfo.addressSetIPs == nil {
+		return ips
+	}
+	nsInfo.addressSetIPsLock.Lock()
+	defer nsInfo.addressSetIPsLock.Unlock()
+	newIPs := sets.NewString()
+	for _, ip := range ips {
+		if !nsInfo.addressSetIPs.Has(ip.String()) {
+			newIPs.Insert(ip.String())
+		}
+	}
+	if nsInfo.addressSetIPs.Len()+newIPs.Len() <= maxIPs {
+		nsInfo.addressSetIPs.Insert(newIPs.UnsortedList()...)
+		return ips
+	}
+
+	klog.Warningf("Not adding IPs %v to the address set of namespace %s: it already holds %d IPs of at most %d",
+		newIPs.List(), ns, nsInfo.addressSetIPs.Len(), maxIPs)
+	if !nsInfo.addressSetLimitReached {
+		nsInfo.addressSetLimitReached = true
+		nsRef := &kapi.ObjectReference{Kind: "Namespace", Name: ns}
+		oc.recorder.Eventf(nsRef, kapi.EventTypeWarning, "AddressSetLimitReached",
+			"The address set of the namespace holds %d IPs, the IPs of new pods are no longer added to it", maxIPs)
+	}
+	return nil
+}
+
+// forgetNamespaceAddressSetIPs stops tracking the IPs deleted from the address set of a
+// namespace for its limit, once the delete succeeded. nsInfo must be locked.
+func forgetNamespaceAddressSetIPs(nsInfo *namespaceInfo, ips []net.IP) {
+	if nsInfo.addressSetIPs == nil {
+		return
+	}
+	nsInfo.addressSetIPsLock.Lock()
+	defer nsInfo.addressSetIPsLock.Unlock()
+	for _, ip := range ips {
+		nsInfo.addressSetIPs.Delete(ip.String())
+	}
+	if nsInfo.addressSetIPs.Len() < config.Default.NamespaceAddressSetMaxIPs {
+		nsInfo.addressSetLimitReached = false
+	}
+}
+
+// deleteSubnetsFromNamespaceAddressSets removes the IPs within subnets from the address
+// sets of all the namespaces. When a node is deleted, this drops the IPs of all its pods
+// at once, rather than as the delete of each of its pods gets handled.
+func (oc *DefaultNetworkController) deleteSubnetsFromNamespaceAddressSets(subnets []*net.IPNet) error {
+	if len(subnets) == 0 {
+		return nil
+	}
+	oc.namespacesMutex.Lock()
+	namespaces := make([]string, 0, len(oc.namespaces))
+	for ns := range oc.namespaces {
+		namespaces = append(namespaces, ns)
+	}
+	oc.namespacesMutex.Unlock()
+
+	var errs []error
+	for _, ns := range namespaces {
+		nsInfo, nsUnlock := oc.getNamespaceLocked(ns, true)
+		if nsInfo == nil {
+			continue
+		}
+		if nsInfo.addressSet != nil {
+			v4IPs, v6IPs := nsInfo.addressSet.GetIPs()
+			staleIPs := []net.IP{}
+			for _, ipStr := range append(v4IPs, v6IPs...) {
+				ip := net.ParseIP(ipStr)
+				if ip == nil {
+					continue
+				}
+				for _, subnet := range subnets {
+					if subnet.Contains(ip) {
+						staleIPs = append(staleIPs, ip)
+						break
+					}
+				}
+			}
+			if len(staleIPs) > 0 {
+				if err := nsInfo.addressSet.DeleteIPs(staleIPs); err != nil {
+					errs = append(errs, fmt.Errorf("failed to remove IPs %v from the address set of namespace %s: %w",
+						staleIPs, ns, err))
+				} else {
+					forgetNamespaceAddressSetIPs(nsInfo, staleIPs)
+					klog.Infof("Removed %d IPs of subnets %s from the address set of namespace %s",
+						len(staleIPs), util.JoinIPNets(subnets, ","), ns)
+				}
+			}
+		}
+		nsUnlock()
+	}
+	return kerrors.NewAggregate(errs)
+}
+
 func createIPAddressSlice(ips []*net.IPNet) []net.IP {
 	ipAddrs := make([]net.IP, 0)
 	for _, ip := range ips {
@@ -203,6 +327,11 @@ func (oc *DefaultNetworkController) multicastUpdateNamespace(ns *kapi.Namespace,
 		return nil
 	}
 
+	// update the cluster router first so that a failure is retried from scratch
+	if err := oc.setNamespaceMulticast(ns.Name, enabled); err != nil {
+		return err
+	}
+
 	var err error
 	nsInfo.multicastEnabled = enabled
 	if enabled {
@@ -220,6 +349,9 @@ func (oc *DefaultNetworkController) multicastUpdateNamespace(ns *kapi.Namespace,
 // previously allowed.
 func (oc *DefaultNetworkController) multicastDeleteNamespace(ns *kapi.Namespace, nsInfo *namespaceInfo) error {
 	if nsInfo.multicastEnabled {
+		if err := oc.setNamespaceMulticast(ns.Name, false); err != nil {
+			return err
+		}
 		nsInfo.multicastEnabled = false
 		if err := deleteMulticastAllowPolicy(oc.nbClient, ns.Name); err != nil {
 			return err
@@ -243,6 +375,7 @@ func (oc *DefaultNetworkController) AddNamespace(ns *kapi.Namespace) error {
 		return fmt.Errorf("failed to ensure namespace locked: %v", err)
 	}
 	defer nsUnlock()
+	oc.checkNamespaceAddressSetClass(nsInfo, ns)
 
 	// OCP HACK -- hybrid overlay
 	annotation := ns.Annotations[hotypes.HybridOverlayExternalGw]
@@ -267,6 +400,22 @@ func (oc *DefaultNetworkController) AddNamespace(ns *kapi.Namespace) error {
 	return kerrors.NewAggregate(errors)
 }
 
+// checkNamespaceAddressSetClass warns if the address set class of namespace ns is not the one
+// its address set was created with, which is kept until the namespace is recreated. That is the
+// case if its class label changed, or if its address set was created before the namespace.
+// must be called with nsInfo lock
+func (oc *DefaultNetworkController) checkNamespaceAddressSetClass(nsInfo *namespaceInfo, ns *kapi.Namespace) {
+	class := ns.Labels[NamespaceAddressSetClassLabel]
+	if class == nsInfo.addressSetClass {
+		return
+	}
+	klog.Warningf("Namespace %s: ignoring its address set class %q, its address set keeps class %q "+
+		"until the namespace is recreated", ns.Name, class, nsInfo.addressSetClass)
+	oc.recorder.Eventf(&kapi.ObjectReference{Kind: "Namespace", Name: ns.Name}, kapi.EventTypeWarning,
+		"AddressSetClassChangeRejected", "Address set class of namespace %s cannot be changed from %q to %q",
+		ns.Name, nsInfo.addressSetClass, class)
+}
+
 // configureNamespace ensures internal structures are updated based on namespace
 // must be called with nsInfo lock
 func (oc *DefaultNetworkController) configureNamespace(nsInfo *namespaceInfo, ns *kapi.Namespace) error {
@@ -320,6 +469,10 @@ func (oc *DefaultNetworkController) updateNamespace(old, newer *kapi.Namespace)
 	}
 	defer nsUnlock()
 
+	if newer.Labels[NamespaceAddressSetClassLabel] != old.Labels[NamespaceAddressSetClassLabel] {
+		oc.checkNamespaceAddressSetClass(nsInfo, newer)
+	}
+
 	gwAnnotation := newer.Annotations[util.RoutingExternalGWsAnnotation]
 	oldGWAnnotation := old.Annotations[util.RoutingExternalGWsAnnotation]
 	_, newBFDEnabled := newer.Annotations[util.BfdAnnotation]
@@ -485,13 +638,24 @@ func (oc *DefaultNetworkController) ensureNamespaceLocked(ns string, readOnly bo
 		// we are creating nsInfo and going to set it in namespaces map
 		// so safe to hold the lock while we create and add it
 		defer oc.namespacesMutex.Unlock()
+		// the namespace labels select the address set factory
+		asf, class, err := oc.getNamespaceAddressSetFactory(ns, namespace)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create address set for namespace: %s, error: %v", ns, err)
+		}
+		nsInfo.addressSetClass = class
 		// create the adddress set for the new namespace
-		var err error
-		nsInfo.addressSet, err = oc.createNamespaceAddrSetAllPods(ns)
+		nsInfo.addressSet, err = oc.createNamespaceAddrSetAllPods(asf, ns)
 		if err != nil {
 			return nil, nil, fmt.Errorf("failed to create address set for namespace: %s, error: %v", ns, err)
 		}
+		if config.Default.NamespaceAddressSetMaxIPs > 0 {
+			v4IPs, v6IPs := nsInfo.addressSet.GetIPs()
+			nsInfo.addressSetIPs = sets.NewString(v4IPs...).Insert(v6IPs...)
+		}
 		oc.namespaces[ns] = nsInfo
+		oc.namespaceGeneration++
+		oc.namespaceGenerations[ns] = oc.namespaceGeneration
 	} else {
 		nsInfoExisted = true
 		// if we found an existing nsInfo, do not hold the namespaces lock
@@ -542,7 +706,7 @@ func (oc *DefaultNetworkController) ensureNamespaceLocked(ns string, readOnly bo
 	return nsInfo, unlockFunc, nil
 }
 
-func (oc *DefaultNetworkController) createNamespaceAddrSetAllPods(ns string) (addressset.AddressSet, error) {
+func (oc *DefaultNetworkController) createNamespaceAddrSetAllPods(asf addressset.AddressSetFactory, ns string) (addressset.AddressSet, error) {
 	var ips []net.IP
 	// special handling of host network namespace
 	if config.Kubernetes.HostNetworkNamespace != "" &&
@@ -554,7 +718,7 @@ func (oc *DefaultNetworkController) createNamespaceAddrSetAllPods(ns string) (ad
 		} else {
 			ips = make([]net.IP, 0, len(existingNodes))
 			for _, node := range existingNodes {
-				hostSubnets, err := util.ParseNodeHostSubnetAnnotation(node, types.DefaultNetworkName)
+				hostSubnets, err := util.ParseNodeHostSubnetAnnotation(node, oc.getNetworkName())
 				if err != nil {
 					klog.Warningf("Error parsing host subnet annotation for node %s (%v)",
 						node.Name, err)
@@ -593,5 +757,5 @@ func (oc *DefaultNetworkController) createNamespaceAddrSetAllPods(ns string) (ad
 			}
 		}
 	}
-	return oc.addressSetFactory.NewAddressSet(ns, ips)
+	return asf.NewAddressSet(ns, ips)
 }
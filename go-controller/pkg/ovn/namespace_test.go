@@ -2,15 +2,23 @@ package ovn
 
 import (
 	"context"
+	"fmt"
+	"math/rand"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/config"
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/kube"
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/nbdb"
+	addressset "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/ovn/address_set"
 	lsm "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/ovn/logical_switch_manager"
 	ovntest "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/testing"
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/testing/libovsdb"
@@ -24,8 +32,25 @@ import (
 
 	"github.com/onsi/ginkgo"
 	"github.com/onsi/gomega"
+	"github.com/ovn-org/libovsdb/ovsdb"
 )
 
+// failingBatchAddressSet is an address set that can only be destroyed on its own, its
+// destroy ops fail any transaction they are part of
+type failingBatchAddressSet struct {
+	addressset.AddressSet
+	destroyed bool
+}
+
+func (as *failingBatchAddressSet) DestroyReturnOps() ([]ovsdb.Operation, error) {
+	return []ovsdb.Operation{{Op: ovsdb.OperationDelete, Table: "Unknown_Table"}}, nil
+}
+
+func (as *failingBatchAddressSet) Destroy() error {
+	as.destroyed = true
+	return nil
+}
+
 func getNamespaceAnnotations(fakeClient kubernetes.Interface, name string) map[string]string {
 	ns, err := fakeClient.CoreV1().Namespaces().Get(context.TODO(), name, metav1.GetOptions{})
 	gomega.Expect(err).NotTo(gomega.HaveOccurred())
@@ -327,5 +352,567 @@ var _ = ginkgo.Describe("OVN Namespace Operations", func() {
 			gomega.Expect(err).NotTo(gomega.HaveOccurred())
 			fakeOvn.asf.EventuallyExpectNoAddressSet(namespaceName)
 		})
+
+		ginkgo.It("creates address sets with the factory registered for the namespace class", func() {
+			sensitiveNamespace := newNamespaceWithLabels("sensitive1",
+				map[string]string{NamespaceAddressSetClassLabel: "sensitive"})
+			fakeOvn.start(&v1.NamespaceList{
+				Items: []v1.Namespace{
+					*newNamespace(namespaceName),
+					*sensitiveNamespace,
+				},
+			})
+			sensitiveASF := addressset.NewFakeAddressSetFactory()
+			err := fakeOvn.controller.RegisterNamespaceAddressSetFactory("sensitive", sensitiveASF)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			err = fakeOvn.controller.WatchNamespaces()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			// unlabeled namespace uses the default factory
+			fakeOvn.asf.ExpectEmptyAddressSet(namespaceName)
+			sensitiveASF.ExpectNoAddressSet(namespaceName)
+			// labeled namespace uses the factory registered for its class
+			sensitiveASF.ExpectEmptyAddressSet(sensitiveNamespace.Name)
+			fakeOvn.asf.ExpectNoAddressSet(sensitiveNamespace.Name)
+
+			err = fakeOvn.fakeClient.KubeClient.CoreV1().Namespaces().Delete(context.TODO(), sensitiveNamespace.Name, *metav1.NewDeleteOptions(1))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			sensitiveASF.EventuallyExpectNoAddressSet(sensitiveNamespace.Name)
+		})
+
+		ginkgo.It("destroys the stale address sets of every namespace class", func() {
+			sensitiveASF := addressset.NewFakeAddressSetFactory()
+			_, err := sensitiveASF.NewAddressSet("sensitive1", []net.IP{net.ParseIP("1.1.1.1")})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			_, err = sensitiveASF.NewAddressSet("sensitive2", []net.IP{net.ParseIP("1.1.1.2")})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			fakeOvn.start()
+			err = fakeOvn.controller.RegisterNamespaceAddressSetFactory("sensitive", sensitiveASF)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			sensitiveNamespace := newNamespaceWithLabels("sensitive1",
+				map[string]string{NamespaceAddressSetClassLabel: "sensitive"})
+			err = fakeOvn.controller.syncNamespaces([]interface{}{sensitiveNamespace})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			sensitiveASF.ExpectAddressSetWithIPs("sensitive1", []string{"1.1.1.1"})
+			sensitiveASF.ExpectNoAddressSet("sensitive2")
+		})
+
+		ginkgo.It("ensures the namespace address set of egress QoS with the namespace class factory", func() {
+			sensitiveNamespace := newNamespaceWithLabels("sensitive1",
+				map[string]string{NamespaceAddressSetClassLabel: "sensitive"})
+			fakeOvn.start(&v1.NamespaceList{Items: []v1.Namespace{*sensitiveNamespace}})
+			sensitiveASF := addressset.NewFakeAddressSetFactory()
+			err := fakeOvn.controller.RegisterNamespaceAddressSetFactory("sensitive", sensitiveASF)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			_, _, err = fakeOvn.controller.createASForEgressQoSRule(metav1.LabelSelector{}, sensitiveNamespace.Name, 1000)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			sensitiveASF.ExpectEmptyAddressSet(sensitiveNamespace.Name)
+			fakeOvn.asf.ExpectNoAddressSet(sensitiveNamespace.Name)
+
+			// a namespace that doesn't exist yet is unlabeled
+			_, _, err = fakeOvn.controller.createASForEgressQoSRule(metav1.LabelSelector{}, "missing", 1000)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			fakeOvn.asf.ExpectEmptyAddressSet("missing")
+
+			// the class of a namespace that can't be looked up is not known
+			fakeOvn.fakeClient.KubeClient.(*fake.Clientset).PrependReactor("get", "namespaces",
+				func(action k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, fmt.Errorf("failed to get namespace")
+				})
+			_, _, err = fakeOvn.controller.createASForEgressQoSRule(metav1.LabelSelector{}, "unknown", 1000)
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			fakeOvn.asf.ExpectNoAddressSet("unknown")
+		})
+
+		ginkgo.It("keeps the address set class of a namespace added after its address set", func() {
+			fakeOvn.start()
+			sensitiveASF := addressset.NewFakeAddressSetFactory()
+			err := fakeOvn.controller.RegisterNamespaceAddressSetFactory("sensitive", sensitiveASF)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			// e.g. a pod of the namespace is handled first
+			_, nsUnlock, err := fakeOvn.controller.ensureNamespaceLocked(namespaceName, true, nil)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			nsUnlock()
+			fakeOvn.asf.ExpectEmptyAddressSet(namespaceName)
+
+			err = fakeOvn.controller.AddNamespace(newNamespaceWithLabels(namespaceName,
+				map[string]string{NamespaceAddressSetClassLabel: "sensitive"}))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.ContainSubstring("AddressSetClassChangeRejected")))
+			fakeOvn.asf.ExpectEmptyAddressSet(namespaceName)
+			sensitiveASF.ExpectNoAddressSet(namespaceName)
+		})
+
+		ginkgo.It("keeps the address set class of a namespace whose label changes", func() {
+			namespace := newNamespace(namespaceName)
+			fakeOvn.start(&v1.NamespaceList{Items: []v1.Namespace{*namespace}})
+			sensitiveASF := addressset.NewFakeAddressSetFactory()
+			err := fakeOvn.controller.RegisterNamespaceAddressSetFactory("sensitive", sensitiveASF)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			err = fakeOvn.controller.WatchNamespaces()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			fakeOvn.asf.ExpectEmptyAddressSet(namespaceName)
+
+			labeled := namespace.DeepCopy()
+			labeled.Labels[NamespaceAddressSetClassLabel] = "sensitive"
+			err = fakeOvn.controller.updateNamespace(namespace, labeled)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.ContainSubstring("AddressSetClassChangeRejected")))
+			fakeOvn.asf.ExpectEmptyAddressSet(namespaceName)
+			sensitiveASF.ExpectNoAddressSet(namespaceName)
+		})
+
+		ginkgo.It("fails to add a namespace labeled with an unregistered class", func() {
+			namespace := newNamespaceWithLabels(namespaceName,
+				map[string]string{NamespaceAddressSetClassLabel: "unknown"})
+			fakeOvn.start()
+
+			err := fakeOvn.controller.AddNamespace(namespace)
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			fakeOvn.asf.ExpectNoAddressSet(namespaceName)
+		})
+
+		ginkgo.It("validates namespace address set factory registrations", func() {
+			fakeOvn.start()
+
+			err := fakeOvn.controller.RegisterNamespaceAddressSetFactory("sensitive", nil)
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			err = fakeOvn.controller.RegisterNamespaceAddressSetFactory("not a label value", addressset.NewFakeAddressSetFactory())
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			err = fakeOvn.controller.RegisterNamespaceAddressSetFactory("", addressset.NewFakeAddressSetFactory())
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			err = fakeOvn.controller.RegisterNamespaceAddressSetFactory("sensitive", addressset.NewFakeAddressSetFactory())
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			err = fakeOvn.controller.RegisterNamespaceAddressSetFactory("sensitive", addressset.NewFakeAddressSetFactory())
+			gomega.Expect(err).To(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("lists the address set names owned by namespaces", func() {
+			namespaces := []string{"namespace1", "namespace2", "namespace3"}
+			namespaceList := &v1.NamespaceList{}
+			for _, ns := range namespaces {
+				namespaceList.Items = append(namespaceList.Items, *newNamespace(ns))
+			}
+			fakeOvn.start(namespaceList)
+			gomega.Expect(fakeOvn.controller.NamespaceAddressSetNames()).To(gomega.BeEmpty())
+
+			err := fakeOvn.controller.WatchNamespaces()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			expectedNames := []string{}
+			for _, ns := range namespaces {
+				v4Name, _ := addressset.MakeAddressSetHashNames(ns)
+				expectedNames = append(expectedNames, v4Name)
+			}
+			gomega.Expect(fakeOvn.controller.NamespaceAddressSetNames()).To(gomega.ConsistOf(expectedNames))
+
+			err = fakeOvn.fakeClient.KubeClient.CoreV1().Namespaces().Delete(context.TODO(), namespaces[1], *metav1.NewDeleteOptions(1))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Eventually(fakeOvn.controller.NamespaceAddressSetNames).Should(
+				gomega.ConsistOf(expectedNames[0], expectedNames[2]))
+		})
+
+		ginkgo.It("returns the IPs of a namespace address set", func() {
+			fakeOvn.start(&v1.NamespaceList{Items: []v1.Namespace{*newNamespace(namespaceName)}})
+			_, err := fakeOvn.controller.NamespaceAddressSetIPs(namespaceName)
+			gomega.Expect(err).To(gomega.HaveOccurred())
+
+			err = fakeOvn.controller.WatchNamespaces()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			ips, err := fakeOvn.controller.NamespaceAddressSetIPs(namespaceName)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(ips).To(gomega.BeEmpty())
+
+			for _, ip := range []string{"10.128.1.12/24", "10.128.1.3/24", "10.128.1.4/24"} {
+				_, _, _, _, err = fakeOvn.controller.addPodToNamespace(namespaceName, ovntest.MustParseIPNets(ip))
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			}
+			ips, err = fakeOvn.controller.NamespaceAddressSetIPs(namespaceName)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(ips).To(gomega.Equal(ovntest.MustParseIPs("10.128.1.3", "10.128.1.4", "10.128.1.12")))
+
+			_, err = fakeOvn.controller.NamespaceAddressSetIPs("unknown")
+			gomega.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("not found")))
+		})
+
+		ginkgo.It("stops adding IPs to a namespace address set at the configured limit", func() {
+			config.Default.NamespaceAddressSetMaxIPs = 2
+			fakeOvn.start(&v1.NamespaceList{Items: []v1.Namespace{*newNamespace(namespaceName)}})
+			err := fakeOvn.controller.WatchNamespaces()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			for _, ip := range []string{"10.128.1.3/24", "10.128.1.4/24"} {
+				_, _, _, _, err = fakeOvn.controller.addPodToNamespace(namespaceName, ovntest.MustParseIPNets(ip))
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			}
+			// IPs already in the address set can still be added
+			_, _, _, _, err = fakeOvn.controller.addPodToNamespace(namespaceName, ovntest.MustParseIPNets("10.128.1.4/24"))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.BeEmpty())
+
+			// pods beyond the limit are still added, without their IPs in the address set
+			_, _, _, _, err = fakeOvn.controller.addPodToNamespace(namespaceName, ovntest.MustParseIPNets("10.128.1.5/24"))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.ContainSubstring("AddressSetLimitReached")))
+			fakeOvn.asf.ExpectAddressSetWithIPs(namespaceName, []string{"10.128.1.3", "10.128.1.4"})
+
+			// the event is posted once as the limit is reached
+			_, _, _, _, err = fakeOvn.controller.addPodToNamespace(namespaceName, ovntest.MustParseIPNets("10.128.1.6/24"))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.BeEmpty())
+
+			// deleting a pod makes room again once its IPs are deleted, until the limit is reached again
+			_, deletedIPs, err := fakeOvn.controller.deletePodFromNamespace(namespaceName, ovntest.MustParseIPNets("10.128.1.3/24"), "")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(deletedIPs).To(gomega.Equal(ovntest.MustParseIPs("10.128.1.3")))
+			_, _, _, _, err = fakeOvn.controller.addPodToNamespace(namespaceName, ovntest.MustParseIPNets("10.128.1.6/24"))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			fakeOvn.asf.ExpectAddressSetWithIPs(namespaceName, []string{"10.128.1.4"})
+			fakeOvn.controller.forgetPodNamespaceAddressSetIPs(namespaceName, deletedIPs)
+			_, _, _, _, err = fakeOvn.controller.addPodToNamespace(namespaceName, ovntest.MustParseIPNets("10.128.1.6/24"))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			fakeOvn.asf.ExpectAddressSetWithIPs(namespaceName, []string{"10.128.1.4", "10.128.1.6"})
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.BeEmpty())
+			_, _, _, _, err = fakeOvn.controller.addPodToNamespace(namespaceName, ovntest.MustParseIPNets("10.128.1.7/24"))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.ContainSubstring("AddressSetLimitReached")))
+			fakeOvn.asf.ExpectAddressSetWithIPs(namespaceName, []string{"10.128.1.4", "10.128.1.6"})
+		})
+
+		ginkgo.It("counts the IPs of existing pods against the namespace address set limit", func() {
+			config.Default.NamespaceAddressSetMaxIPs = 1
+			pod := newPod(namespaceName, "pod1", "node1", "10.128.1.3")
+			fakeOvn.start(
+				&v1.NamespaceList{Items: []v1.Namespace{*newNamespace(namespaceName)}},
+				&v1.PodList{Items: []v1.Pod{*pod}},
+			)
+			err := fakeOvn.controller.WatchNamespaces()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			fakeOvn.asf.ExpectAddressSetWithIPs(namespaceName, []string{"10.128.1.3"})
+
+			_, _, _, _, err = fakeOvn.controller.addPodToNamespace(namespaceName, ovntest.MustParseIPNets("10.128.1.4/24"))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.Receive(gomega.ContainSubstring("AddressSetLimitReached")))
+			fakeOvn.asf.ExpectAddressSetWithIPs(namespaceName, []string{"10.128.1.3"})
+		})
+
+		ginkgo.It("does not limit namespace address sets by default", func() {
+			fakeOvn.start(&v1.NamespaceList{Items: []v1.Namespace{*newNamespace(namespaceName)}})
+			err := fakeOvn.controller.WatchNamespaces()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			ips := []string{"10.128.1.3", "10.128.1.4", "10.128.1.5"}
+			for _, ip := range ips {
+				_, _, _, _, err = fakeOvn.controller.addPodToNamespace(namespaceName, ovntest.MustParseIPNets(ip+"/24"))
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			}
+			gomega.Expect(fakeOvn.fakeRecorder.Events).To(gomega.BeEmpty())
+			fakeOvn.asf.ExpectAddressSetWithIPs(namespaceName, ips)
+		})
+
+		ginkgo.Context("with namespaces rapidly deleted and recreated", func() {
+			var savedDelay time.Duration
+
+			ginkgo.BeforeEach(func() {
+				savedDelay = deferredAddressSetDestroyDelay
+				deferredAddressSetDestroyDelay = 200 * time.Millisecond
+			})
+
+			ginkgo.AfterEach(func() {
+				deferredAddressSetDestroyDelay = savedDelay
+			})
+
+			pendingDestroys := func() int {
+				fakeOvn.controller.namespacesMutex.Lock()
+				defer fakeOvn.controller.namespacesMutex.Unlock()
+				return len(fakeOvn.controller.pendingAddressSetDestroys)
+			}
+
+			ginkgo.It("keeps a single deferred address set destroy pending", func() {
+				namespace := newNamespace(namespaceName)
+				fakeOvn.start()
+
+				for i := 0; i < 5; i++ {
+					gomega.Expect(fakeOvn.controller.AddNamespace(namespace)).To(gomega.Succeed())
+					fakeOvn.asf.ExpectEmptyAddressSet(namespaceName)
+					gomega.Expect(fakeOvn.controller.deleteNamespace(namespace)).To(gomega.Succeed())
+					gomega.Expect(pendingDestroys()).To(gomega.Equal(1))
+				}
+
+				gomega.Eventually(pendingDestroys).Should(gomega.Equal(0))
+				fakeOvn.asf.ExpectNoAddressSet(namespaceName)
+			})
+
+			ginkgo.It("keeps the address set of the recreated namespace", func() {
+				namespace := newNamespace(namespaceName)
+				fakeOvn.start()
+
+				for i := 0; i < 5; i++ {
+					gomega.Expect(fakeOvn.controller.AddNamespace(namespace)).To(gomega.Succeed())
+					gomega.Expect(fakeOvn.controller.deleteNamespace(namespace)).To(gomega.Succeed())
+				}
+				gomega.Expect(fakeOvn.controller.AddNamespace(namespace)).To(gomega.Succeed())
+				gomega.Expect(pendingDestroys()).To(gomega.Equal(1))
+
+				gomega.Eventually(pendingDestroys).Should(gomega.Equal(0))
+				gomega.Consistently(func() bool {
+					nsInfo, nsUnlock := fakeOvn.controller.getNamespaceLocked(namespaceName, true)
+					if nsInfo == nil {
+						return false
+					}
+					defer nsUnlock()
+					return nsInfo.addressSet != nil
+				}).Should(gomega.BeTrue())
+				fakeOvn.asf.ExpectEmptyAddressSet(namespaceName)
+			})
+
+			ginkgo.It("keeps the address sets of the namespaces recreated while their destroys are batched", func() {
+				deferredAddressSetDestroyDelay = 10 * time.Millisecond
+				fakeOvn.start()
+
+				// hold the first batch until the other destroys are queued behind it
+				release := make(chan struct{})
+				var batches, held int32
+				destroyer := newAddressSetDestroyer(func(destroys []*deferredAddressSetDestroy) {
+					if atomic.AddInt32(&batches, 1) == 1 {
+						atomic.StoreInt32(&held, int32(len(destroys)))
+						<-release
+					}
+					fakeOvn.controller.destroyDeferredAddressSets(destroys)
+				})
+				destroyer.maxWorkers = 1
+				fakeOvn.controller.addressSetDestroyer = destroyer
+				// queuedOrHeld returns the number of destroys held in the first batch or
+				// queued behind it, once the first batch is held
+				queuedOrHeld := func() int {
+					destroyer.Lock()
+					defer destroyer.Unlock()
+					if atomic.LoadInt32(&held) == 0 {
+						return 0
+					}
+					return int(atomic.LoadInt32(&held)) + len(destroyer.queue)
+				}
+
+				const count = 10
+				namespaces := make([]*v1.Namespace, 0, count)
+				for i := 0; i < count; i++ {
+					namespace := newNamespace(fmt.Sprintf("namespace%d", i))
+					namespaces = append(namespaces, namespace)
+					gomega.Expect(fakeOvn.controller.AddNamespace(namespace)).To(gomega.Succeed())
+				}
+				for _, namespace := range namespaces {
+					gomega.Expect(fakeOvn.controller.deleteNamespace(namespace)).To(gomega.Succeed())
+				}
+				// the timers of several destroys may fire before the first batch is taken
+				gomega.Eventually(queuedOrHeld).Should(gomega.Equal(count))
+
+				// recreate every other namespace before its address set is destroyed
+				for i := 0; i < count; i += 2 {
+					gomega.Expect(fakeOvn.controller.AddNamespace(namespaces[i])).To(gomega.Succeed())
+				}
+				close(release)
+
+				gomega.Eventually(pendingDestroys).Should(gomega.Equal(0))
+				expectedBatches := int32(2)
+				if atomic.LoadInt32(&held) == count {
+					expectedBatches = 1
+				}
+				gomega.Eventually(func() int32 { return atomic.LoadInt32(&batches) }).Should(gomega.Equal(expectedBatches))
+				for i, namespace := range namespaces {
+					if i%2 == 0 {
+						fakeOvn.asf.ExpectEmptyAddressSet(namespace.Name)
+					} else {
+						fakeOvn.asf.ExpectNoAddressSet(namespace.Name)
+					}
+				}
+			})
+
+			ginkgo.It("destroys the address sets one by one if their batch fails", func() {
+				fakeOvn.start()
+
+				var destroys []*deferredAddressSetDestroy
+				var addressSets []*failingBatchAddressSet
+				fakeOvn.controller.namespacesMutex.Lock()
+				for i := 0; i < 2; i++ {
+					destroy := &deferredAddressSetDestroy{
+						namespace:  fmt.Sprintf("namespace%d", i),
+						addressSet: &failingBatchAddressSet{},
+						token:      make(chan struct{}),
+					}
+					fakeOvn.controller.pendingAddressSetDestroys[destroy.namespace] = destroy.token
+					destroys = append(destroys, destroy)
+					addressSets = append(addressSets, destroy.addressSet.(*failingBatchAddressSet))
+				}
+				fakeOvn.controller.namespacesMutex.Unlock()
+
+				fakeOvn.controller.destroyDeferredAddressSets(destroys)
+				gomega.Expect(pendingDestroys()).To(gomega.Equal(0))
+				for _, addressSet := range addressSets {
+					gomega.Expect(addressSet.destroyed).To(gomega.BeTrue())
+				}
+			})
+
+			ginkgo.Context("when deleted, recreated and deleted again", func() {
+				var release chan struct{}
+				namespace := newNamespace(namespaceName)
+
+				// deleteTwice deletes the namespace twice, with the destroy of the first
+				// delete held by the destroyer until release is closed
+				deleteTwice := func() {
+					deferredAddressSetDestroyDelay = 10 * time.Millisecond
+					fakeOvn.start()
+
+					release = make(chan struct{})
+					var batches int32
+					destroyer := newAddressSetDestroyer(func(destroys []*deferredAddressSetDestroy) {
+						if atomic.AddInt32(&batches, 1) == 1 {
+							<-release
+						}
+						fakeOvn.controller.destroyDeferredAddressSets(destroys)
+					})
+					destroyer.maxWorkers = 1
+					fakeOvn.controller.addressSetDestroyer = destroyer
+					queued := func() int {
+						destroyer.Lock()
+						defer destroyer.Unlock()
+						return len(destroyer.queue)
+					}
+
+					gomega.Expect(fakeOvn.controller.AddNamespace(namespace)).To(gomega.Succeed())
+					gomega.Expect(fakeOvn.controller.deleteNamespace(namespace)).To(gomega.Succeed())
+					gomega.Eventually(func() int32 { return atomic.LoadInt32(&batches) }).Should(gomega.Equal(int32(1)))
+
+					gomega.Expect(fakeOvn.controller.AddNamespace(namespace)).To(gomega.Succeed())
+					gomega.Expect(fakeOvn.controller.deleteNamespace(namespace)).To(gomega.Succeed())
+					gomega.Eventually(queued).Should(gomega.Equal(1))
+				}
+
+				generations := func() map[string]uint64 {
+					fakeOvn.controller.namespacesMutex.Lock()
+					defer fakeOvn.controller.namespacesMutex.Unlock()
+					generations := map[string]uint64{}
+					for ns, generation := range fakeOvn.controller.namespaceGenerations {
+						generations[ns] = generation
+					}
+					return generations
+				}
+
+				ginkgo.It("only runs the destroy of the last delete", func() {
+					deleteTwice()
+					close(release)
+
+					gomega.Eventually(pendingDestroys).Should(gomega.Equal(0))
+					fakeOvn.asf.ExpectNoAddressSet(namespaceName)
+					gomega.Expect(generations()).To(gomega.BeEmpty())
+				})
+
+				ginkgo.It("runs neither destroy once the namespace is recreated", func() {
+					deleteTwice()
+					gomega.Expect(fakeOvn.controller.AddNamespace(namespace)).To(gomega.Succeed())
+					close(release)
+
+					gomega.Eventually(pendingDestroys).Should(gomega.Equal(0))
+					gomega.Consistently(func() error {
+						_, err := fakeOvn.controller.NamespaceAddressSetIPs(namespaceName)
+						return err
+					}).Should(gomega.Succeed())
+					fakeOvn.asf.ExpectEmptyAddressSet(namespaceName)
+					// the namespace was created three times
+					gomega.Expect(generations()).To(gomega.HaveKeyWithValue(namespaceName, uint64(3)))
+				})
+			})
+
+			ginkgo.It("never returns a stale namespace or destroys a live address set under concurrent access", func() {
+				deferredAddressSetDestroyDelay = time.Millisecond
+				namespace := newNamespace(namespaceName)
+				fakeOvn.start()
+
+				const iterations = 1000
+				var stale int32
+				checkNamespace := func(readOnly bool) {
+					nsInfo, nsUnlock := fakeOvn.controller.getNamespaceLocked(namespaceName, readOnly)
+					if nsInfo == nil {
+						return
+					}
+					defer nsUnlock()
+					fakeOvn.controller.namespacesMutex.Lock()
+					current := fakeOvn.controller.namespaces[namespaceName]
+					fakeOvn.controller.namespacesMutex.Unlock()
+					if current != nsInfo {
+						atomic.AddInt32(&stale, 1)
+						return
+					}
+					// the address set of a live namespace must not have been destroyed
+					nsInfo.addressSet.GetIPs()
+					fakeOvn.asf.ExpectEmptyAddressSet(namespaceName)
+				}
+
+				wg := &sync.WaitGroup{}
+				worker := func(fn func()) {
+					wg.Add(1)
+					go func() {
+						defer ginkgo.GinkgoRecover()
+						defer wg.Done()
+						for i := 0; i < iterations; i++ {
+							fn()
+							time.Sleep(time.Duration(rand.Intn(100)) * time.Microsecond)
+						}
+					}()
+				}
+				worker(func() {
+					gomega.Expect(fakeOvn.controller.AddNamespace(namespace)).To(gomega.Succeed())
+				})
+				worker(func() {
+					gomega.Expect(fakeOvn.controller.deleteNamespace(namespace)).To(gomega.Succeed())
+				})
+				worker(func() { checkNamespace(true) })
+				worker(func() { checkNamespace(false) })
+				wg.Wait()
+
+				gomega.Expect(atomic.LoadInt32(&stale)).To(gomega.BeZero())
+				gomega.Eventually(pendingDestroys).Should(gomega.Equal(0))
+				nsInfo, nsUnlock := fakeOvn.controller.getNamespaceLocked(namespaceName, true)
+				if nsInfo != nil {
+					nsUnlock()
+					fakeOvn.asf.ExpectEmptyAddressSet(namespaceName)
+				} else {
+					fakeOvn.asf.ExpectNoAddressSet(namespaceName)
+				}
+			})
+
+			ginkgo.It("destroys the address set right away when deferred destroy is disabled", func() {
+				config.Default.DisableDeferredAddressSetDestroy = true
+				namespace := newNamespace(namespaceName)
+				fakeOvn.start()
+
+				gomega.Expect(fakeOvn.controller.AddNamespace(namespace)).To(gomega.Succeed())
+				fakeOvn.asf.ExpectEmptyAddressSet(namespaceName)
+				gomega.Expect(fakeOvn.controller.deleteNamespace(namespace)).To(gomega.Succeed())
+				gomega.Expect(pendingDestroys()).To(gomega.Equal(0))
+				fakeOvn.asf.ExpectNoAddressSet(namespaceName)
+
+				// the recreated namespace gets a new address set
+				gomega.Expect(fakeOvn.controller.AddNamespace(namespace)).To(gomega.Succeed())
+				fakeOvn.asf.ExpectEmptyAddressSet(namespaceName)
+			})
+
+			ginkgo.It("cancels a pending deferred destroy when deferred destroy is disabled", func() {
+				namespace := newNamespace(namespaceName)
+				fakeOvn.start()
+
+				gomega.Expect(fakeOvn.controller.AddNamespace(namespace)).To(gomega.Succeed())
+				gomega.Expect(fakeOvn.controller.deleteNamespace(namespace)).To(gomega.Succeed())
+				gomega.Expect(pendingDestroys()).To(gomega.Equal(1))
+
+				config.Default.DisableDeferredAddressSetDestroy = true
+				gomega.Expect(fakeOvn.controller.AddNamespace(namespace)).To(gomega.Succeed())
+				gomega.Expect(fakeOvn.controller.deleteNamespace(namespace)).To(gomega.Succeed())
+				gomega.Expect(pendingDestroys()).To(gomega.Equal(0))
+				fakeOvn.asf.ExpectNoAddressSet(namespaceName)
+			})
+		})
 	})
 })
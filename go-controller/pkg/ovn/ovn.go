@@ -63,8 +63,9 @@ func getPodNamespacedName(pod *kapi.Pod) string {
 
 // syncPeriodic adds a goroutine that periodically does some work
 // right now there is only one ticker registered
-// for syncNodesPeriodic which deletes chassis records from the sbdb
-// every 5 minutes
+// for syncNodesPeriodic which deletes chassis records from the sbdb,
+// repairs node subnet annotations and reconciles the pod IPs allocated
+// on the node switches every 5 minutes
 func (oc *DefaultNetworkController) syncPeriodic() {
 	go func() {
 		nodeSyncTicker := time.NewTicker(5 * time.Minute)
@@ -350,11 +351,64 @@ func nodeChassisChanged(oldNode, node *kapi.Node) bool {
 	return oldChassis != newChassis
 }
 
+// nodeBackupChassisChanged returns true if the backup chassis the node is annotated with changed
+func nodeBackupChassisChanged(oldNode, node *kapi.Node) bool {
+	oldChassis, _ := util.ParseNodeBackupChassisAnnotation(oldNode)
+	newChassis, _ := util.ParseNodeBackupChassisAnnotation(node)
+	return !reflect.DeepEqual(oldChassis, newChassis)
+}
+
+// nodeAlwaysLearnFromARPRequestChanged returns true if the node opted in to or out of learning
+// from every ARP request on its cluster router port
+func nodeAlwaysLearnFromARPRequestChanged(oldNode, node *kapi.Node) bool {
+	return util.NodeAlwaysLearnsFromARPRequest(oldNode) != util.NodeAlwaysLearnsFromARPRequest(node)
+}
+
+// nodeLoadBalancerGroupExclusionChanged returns true if the node was annotated to be
+// excluded from the load balancer group or no longer is
+func nodeLoadBalancerGroupExclusionChanged(oldNode, node *kapi.Node) bool {
+	return util.IsNodeExcludedFromLoadBalancerGroup(oldNode) != util.IsNodeExcludedFromLoadBalancerGroup(node)
+}
+
+// nodeOVNFreezeChanged returns true if the node was annotated to freeze its OVN objects or
+// no longer is
+func nodeOVNFreezeChanged(oldNode, node *kapi.Node) bool {
+	return util.IsNodeOVNFrozen(oldNode) != util.IsNodeOVNFrozen(node)
+}
+
+// nodeSubnetExclusionsChanged returns true if the CIDRs the node is annotated to exclude
+// from the addressing of its switch changed
+func nodeSubnetExclusionsChanged(oldNode, node *kapi.Node) bool {
+	return util.NodeExcludeSubnetsAnnotationChanged(oldNode, node)
+}
+
 // nodeGatewayMTUSupportChanged returns true if annotation "k8s.ovn.org/gateway-mtu-support" on the node was updated.
 func nodeGatewayMTUSupportChanged(oldNode, node *kapi.Node) bool {
 	return util.ParseNodeGatewayMTUSupport(oldNode) != util.ParseNodeGatewayMTUSupport(node)
 }
 
+// nodeUpdateRelevant returns true if an update of a node changed its labels, annotations or
+// spec, or its NetworkUnavailable condition, which the node handler clears when set by the
+// kubelet. Heartbeats only refresh the other status conditions and are not relevant.
+func nodeUpdateRelevant(oldNode, node *kapi.Node) bool {
+	if !reflect.DeepEqual(oldNode.Labels, node.Labels) ||
+		!reflect.DeepEqual(oldNode.Annotations, node.Annotations) ||
+		!reflect.DeepEqual(oldNode.Spec, node.Spec) {
+		return true
+	}
+	networkUnavailable := func(node *kapi.Node) (kapi.ConditionStatus, string) {
+		for _, condition := range node.Status.Conditions {
+			if condition.Type == kapi.NodeNetworkUnavailable {
+				return condition.Status, condition.Reason
+			}
+		}
+		return "", ""
+	}
+	oldStatus, oldReason := networkUnavailable(oldNode)
+	status, reason := networkUnavailable(node)
+	return oldStatus != status || oldReason != reason
+}
+
 // noHostSubnet() compares the no-hostsubnet-nodes flag with node labels to see if the node is managing its
 // own network.
 func noHostSubnet(node *kapi.Node) bool {
@@ -367,8 +421,9 @@ func noHostSubnet(node *kapi.Node) bool {
 }
 
 // shouldUpdateNode() determines if the ovn-kubernetes plugin should update the state of the node.
-// ovn-kube should not perform an update if it does not assign a hostsubnet, or if you want to change
-// whether or not ovn-kubernetes assigns a hostsubnet
+// ovn-kube should not perform an update if it does not assign a hostsubnet, or if you want to
+// start assigning a hostsubnet to the node. A node that stops getting a hostsubnet assigned is
+// updated so that its logical network gets cleaned up.
 func shouldUpdateNode(node, oldNode *kapi.Node) (bool, error) {
 	newNoHostSubnet := noHostSubnet(node)
 	oldNoHostSubnet := noHostSubnet(oldNode)
@@ -377,8 +432,6 @@ func shouldUpdateNode(node, oldNode *kapi.Node) (bool, error) {
 		return false, nil
 	} else if oldNoHostSubnet && !newNoHostSubnet {
 		return false, fmt.Errorf("error updating node %s, cannot remove assigned hostsubnet, please delete node and recreate.", node.Name)
-	} else if !oldNoHostSubnet && newNoHostSubnet {
-		return false, fmt.Errorf("error updating node %s, cannot assign a hostsubnet to already created node, please delete node and recreate.", node.Name)
 	}
 
 	return true, nil
@@ -422,7 +475,7 @@ func (oc *DefaultNetworkController) StartServiceController(wg *sync.WaitGroup, r
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		useLBGroups := oc.loadBalancerGroupUUID != ""
+		useLBGroups := oc.getLoadBalancerGroupUUID() != ""
 		// use 5 workers like most of the kubernetes controllers in the
 		// kubernetes controller-manager
 		err := oc.svcController.Run(5, oc.stopChan, runRepair, useLBGroups)
@@ -3,10 +3,12 @@ package ovn
 import (
 	"fmt"
 	"net"
+	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/ovn-org/libovsdb/ovsdb"
+	hotypes "github.com/ovn-org/ovn-kubernetes/go-controller/hybrid-overlay/pkg/types"
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/config"
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/libovsdbops"
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/metrics"
@@ -15,7 +17,10 @@ import (
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/util"
 	kapi "k8s.io/api/core/v1"
 	ktypes "k8s.io/apimachinery/pkg/types"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
 )
 
 func (oc *DefaultNetworkController) syncPods(pods []interface{}) error {
@@ -47,7 +52,7 @@ func (oc *DefaultNetworkController) syncPods(pods []interface{}) error {
 		if annotations != nil && !hasHybridAnnotation(pod.ObjectMeta) {
 			// END OCP HACK
 			newRoutes := []util.PodRoute{}
-			switchName := pod.Spec.NodeName
+			switchName := oc.getNodeSwitchName(pod.Spec.NodeName)
 			for _, subnet := range oc.lsManager.GetSwitchSubnets(switchName) {
 				hybridOverlayIFAddr := util.GetNodeHybridOverlayIfAddr(subnet).IP
 				for _, route := range annotations.Routes {
@@ -134,7 +139,7 @@ func (oc *DefaultNetworkController) deleteLogicalPort(pod *kapi.Pod, portInfo *l
 
 func (oc *DefaultNetworkController) addLogicalPort(pod *kapi.Pod) (err error) {
 	// If a node does node have an assigned hostsubnet don't wait for the logical switch to appear
-	switchName := pod.Spec.NodeName
+	switchName := oc.getNodeSwitchName(pod.Spec.NodeName)
 	if oc.lsManager.IsNonHostSubnetSwitch(switchName) {
 		return nil
 	}
@@ -247,3 +252,191 @@ func (oc *DefaultNetworkController) addLogicalPort(pod *kapi.Pod) (err error) {
 	}
 	return nil
 }
+
+// verifyNodeSwitchSubnets checks that the subnets cached in lsManager for the logical switch
+// of the node, which pod IPs are allocated from, are the subnets configured on the switch in
+// nbdb. If they drifted apart the node is queued for its switch to be reconciled and an error
+// is returned, so that the pod is retried once the switch is repaired instead of getting an
+// IP OVN won't serve. Switches with no subnet in their other_config are not checked.
+func (oc *DefaultNetworkController) verifyNodeSwitchSubnets(nodeName, switchName string) error {
+	ls, err := libovsdbops.GetLogicalSwitch(oc.nbClient, &nbdb.LogicalSwitch{Name: switchName})
+	if err != nil {
+		return fmt.Errorf("failed to get logical switch %s: %w", switchName, err)
+	}
+	cachedSubnets := oc.lsManager.GetSwitchSubnets(switchName)
+	if !nodeSwitchSubnetsDrifted(ls, cachedSubnets) {
+		return nil
+	}
+
+	err = fmt.Errorf("logical switch %s has subnet %q and ipv6_prefix %q but %s is cached",
+		switchName, ls.OtherConfig["subnet"], ls.OtherConfig["ipv6_prefix"], util.JoinIPNets(cachedSubnets, ","))
+	klog.Warningf("Reconciling node %s: %v", nodeName, err)
+	node, nodeErr := oc.watchFactory.GetNode(nodeName)
+	if nodeErr != nil {
+		return fmt.Errorf("%v, and failed to get node %s to reconcile it: %w", err, nodeName, nodeErr)
+	}
+	oc.recorder.Eventf(node, kapi.EventTypeWarning, "NodeSwitchSubnetDrift",
+		"Logical switch subnets of node %s do not match the allocated subnets %s and are reconciled",
+		nodeName, util.JoinIPNets(cachedSubnets, ","))
+	oc.addNodeFailed.Store(nodeName, true)
+	if retryErr := oc.retryNodes.AddRetryObjWithAddNoBackoff(node); retryErr != nil {
+		return fmt.Errorf("%v, and failed to queue node %s to reconcile it: %w", err, nodeName, retryErr)
+	}
+	oc.retryNodes.RequestRetryObjs()
+	return err
+}
+
+// nodeSwitchSubnetsDrifted returns true if the subnets configured in the other_config of the
+// logical switch are not the given subnets
+func nodeSwitchSubnetsDrifted(ls *nbdb.LogicalSwitch, subnets []*net.IPNet) bool {
+	if ls.OtherConfig["subnet"] == "" && ls.OtherConfig["ipv6_prefix"] == "" {
+		return false
+	}
+	var subnet, ipv6Prefix string
+	for _, hostSubnet := range subnets {
+		if utilnet.IsIPv6CIDR(hostSubnet) {
+			ipv6Prefix = hostSubnet.IP.String()
+		} else {
+			subnet = hostSubnet.String()
+		}
+	}
+	return ls.OtherConfig["subnet"] != subnet || ls.OtherConfig["ipv6_prefix"] != ipv6Prefix
+}
+
+// reconcileNodeSwitchesPodIPs reconciles the pod IPs allocated on the logical switch of
+// each of the nodes with the IPs annotated on the pods scheduled to it
+func (oc *DefaultNetworkController) reconcileNodeSwitchesPodIPs(nodes []*kapi.Node) error {
+	pods, err := oc.watchFactory.GetAllPods()
+	if err != nil {
+		return fmt.Errorf("failed to get pods: %w", err)
+	}
+	nodePods := map[string][]*kapi.Pod{}
+	for _, pod := range pods {
+		if util.PodScheduled(pod) {
+			nodePods[pod.Spec.NodeName] = append(nodePods[pod.Spec.NodeName], pod)
+		}
+	}
+	var errs []error
+	switchNames := sets.NewString()
+	for _, node := range nodes {
+		switchNames.Insert(oc.getNodeSwitchName(node.Name))
+		if _, _, err := oc.reconcileNodeSwitchPodIPs(node, nodePods[node.Name]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	// forget the suspects of the switches of deleted nodes
+	for switchName := range oc.suspectedLeakedPodIPs {
+		if !switchNames.Has(switchName) {
+			delete(oc.suspectedLeakedPodIPs, switchName)
+		}
+	}
+	return kerrors.NewAggregate(errs)
+}
+
+// reconcileNodeSwitchPodIPs compares the IPs allocated in lsManager on the logical switch
+// of the node with the IPs annotated on its pods, which are all the pods scheduled to it.
+// An IP held by no pod is only reclaimed when it was already unused at the previous
+// reconcile, as pods being added get their IPs allocated before they are annotated.
+// Pods annotated with IPs that are not allocated are flagged with an event, and their IPs
+// allocated so that they are not handed out to other pods. Returns the reclaimed IPs and
+// the unaccounted ones.
+func (oc *DefaultNetworkController) reconcileNodeSwitchPodIPs(node *kapi.Node, pods []*kapi.Pod) ([]net.IP, []net.IP, error) {
+	switchName := oc.getNodeSwitchName(node.Name)
+	hostSubnets := oc.lsManager.GetSwitchSubnets(switchName)
+	if len(hostSubnets) == 0 {
+		return nil, nil, nil
+	}
+	allocatedIPs, err := oc.lsManager.GetAllocatedIPs(switchName)
+	if err != nil {
+		return nil, nil, err
+	}
+	allocated := sets.NewString()
+	for _, ip := range allocatedIPs {
+		allocated.Insert(ip.String())
+	}
+
+	// the IPs reserved on the switch for the node itself
+	inUse := sets.NewString()
+	for _, hostSubnet := range hostSubnets {
+		inUse.Insert(util.GetNodeGatewayIfAddr(hostSubnet).IP.String(),
+			util.GetNodeManagementIfAddr(hostSubnet).IP.String())
+		if config.HybridOverlay.Enabled {
+			inUse.Insert(util.GetNodeHybridOverlayIfAddr(hostSubnet).IP.String())
+		}
+	}
+	if drIPs, ok := node.Annotations[hotypes.HybridOverlayDRIP]; ok {
+		for _, drIP := range strings.Split(drIPs, ",") {
+			if ip := net.ParseIP(drIP); ip != nil {
+				inUse.Insert(ip.String())
+			}
+		}
+	}
+	// pods being deleted still hold their IPs until they are released
+	for _, ipNet := range oc.logicalPortCache.getSwitchIPs(switchName) {
+		inUse.Insert(ipNet.IP.String())
+	}
+
+	var errs []error
+	var unaccounted []net.IP
+	for _, pod := range pods {
+		if !util.PodWantsNetwork(pod) || util.PodCompleted(pod) {
+			continue
+		}
+		annotation, err := util.UnmarshalPodAnnotation(pod.Annotations, ovntypes.DefaultNetworkName)
+		if err != nil {
+			continue
+		}
+		var podUnaccounted []net.IP
+		for _, ipNet := range annotation.IPs {
+			ip := ipNet.IP.String()
+			if inUse.Has(ip) {
+				continue
+			}
+			inUse.Insert(ip)
+			if allocated.Has(ip) {
+				continue
+			}
+			podUnaccounted = append(podUnaccounted, ipNet.IP)
+			if err := oc.lsManager.AllocateIPs(switchName, []*net.IPNet{ipNet}); err != nil {
+				errs = append(errs, fmt.Errorf("failed to allocate IP %s of pod %s/%s on switch %s: %w",
+					ip, pod.Namespace, pod.Name, switchName, err))
+			}
+		}
+		if len(podUnaccounted) == 0 {
+			continue
+		}
+		klog.Warningf("Pod %s/%s IPs %v were not allocated on switch %s", pod.Namespace, pod.Name,
+			podUnaccounted, switchName)
+		oc.recorder.Eventf(pod, kapi.EventTypeWarning, "PodIPNotAllocated",
+			"IPs %v of the pod were not marked allocated on node %s", podUnaccounted, node.Name)
+		unaccounted = append(unaccounted, podUnaccounted...)
+	}
+
+	var reclaimed []net.IP
+	previousSuspects := oc.suspectedLeakedPodIPs[switchName]
+	suspects := sets.NewString()
+	for _, ip := range allocatedIPs {
+		if inUse.Has(ip.String()) {
+			continue
+		}
+		if !previousSuspects.Has(ip.String()) {
+			suspects.Insert(ip.String())
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(ip.String() + util.GetIPFullMask(ip.String()))
+		if err == nil {
+			err = oc.lsManager.ReleaseIPs(switchName, []*net.IPNet{ipNet})
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to release leaked IP %s on switch %s: %w", ip, switchName, err))
+			suspects.Insert(ip.String())
+			continue
+		}
+		reclaimed = append(reclaimed, ip)
+	}
+	oc.suspectedLeakedPodIPs[switchName] = suspects
+	if len(reclaimed) > 0 {
+		klog.Warningf("Reclaimed IPs %v allocated on switch %s to no pod", reclaimed, switchName)
+	}
+	return reclaimed, unaccounted, kerrors.NewAggregate(errs)
+}
@@ -1025,6 +1025,73 @@ var _ = ginkgo.Describe("OVN Pod Operations", func() {
 			gomega.Expect(err).NotTo(gomega.HaveOccurred())
 		})
 
+		ginkgo.It("gives up on a pod that exhausts its attempts and moves it to the dead-letter set", func() {
+			app.Action = func(ctx *cli.Context) error {
+				config.Default.PodRetryMaxAttempts = 2
+				namespace1 := *newNamespace("namespace1")
+				pod := newPod(namespace1.Name, "myPod", "node1", "10.128.1.3")
+				// a pod can never be set up with more than one default network
+				pod.Annotations = map[string]string{
+					util.DefNetworkAnnotation: `[{"name":"net1"},{"name":"net2"}]`,
+				}
+				key, err := retry.GetResourceKey(pod)
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+				fakeOvn.startWithDBSetup(initialDB,
+					&v1.NamespaceList{
+						Items: []v1.Namespace{
+							namespace1,
+						},
+					},
+					&v1.PodList{
+						Items: []v1.Pod{*pod},
+					},
+				)
+				err = fakeOvn.controller.WatchNamespaces()
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				err = fakeOvn.controller.WatchPods()
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+				retry.CheckRetryObjectMultipleFieldsEventually(
+					key,
+					fakeOvn.controller.retryPods,
+					gomega.BeNil(),                // oldObj should be nil
+					gomega.Not(gomega.BeNil()),    // newObj should not be nil
+					nil,                           // skip config
+					gomega.BeNumerically("==", 1), // failedAttempts should be 1
+				)
+				gomega.Expect(fakeOvn.controller.DeadLetterPods()).To(gomega.BeEmpty())
+
+				retry.SetRetryObjWithNoBackoff(key, fakeOvn.controller.retryPods)
+				fakeOvn.controller.retryPods.RequestRetryObjs()
+				retry.CheckRetryObjectMultipleFieldsEventually(
+					key,
+					fakeOvn.controller.retryPods,
+					gomega.BeNil(),                // oldObj should be nil
+					gomega.Not(gomega.BeNil()),    // newObj should not be nil
+					nil,                           // skip config
+					gomega.BeNumerically("==", 2), // failedAttempts should reach the max
+				)
+
+				// the next retry gives up on the pod
+				retry.SetRetryObjWithNoBackoff(key, fakeOvn.controller.retryPods)
+				fakeOvn.controller.retryPods.RequestRetryObjs()
+				retry.CheckRetryObjectEventually(key, false, fakeOvn.controller.retryPods)
+				deadLetters := fakeOvn.controller.DeadLetterPods()
+				gomega.Expect(deadLetters).To(gomega.HaveLen(1))
+				gomega.Expect(deadLetters[0].Key).To(gomega.Equal(key))
+				gomega.Expect(deadLetters[0].FailedAttempts).To(gomega.Equal(2))
+				gomega.Expect(deadLetters[0].LastError).To(gomega.MatchError(
+					gomega.ContainSubstring("more than one default network")))
+				gomega.Eventually(fakeOvn.fakeRecorder.Events).Should(gomega.Receive(gomega.ContainSubstring("RetryGaveUp")))
+
+				return nil
+			}
+
+			err := app.Run([]string{app.Name})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+
 		ginkgo.It("correctly stops retrying deleting a pod after failing n times", func() {
 			app.Action = func(ctx *cli.Context) error {
 				namespace1 := *newNamespace("namespace1")
@@ -59,6 +59,20 @@ func (c *portCache) add(logicalSwitch, logicalPort, uuid string, mac net.Hardwar
 	return portInfo
 }
 
+// getSwitchIPs returns the IPs of the ports of the given logical switch that are
+// not scheduled for removal
+func (c *portCache) getSwitchIPs(logicalSwitch string) []*net.IPNet {
+	c.RLock()
+	defer c.RUnlock()
+	var ips []*net.IPNet
+	for _, info := range c.cache {
+		if info.logicalSwitch == logicalSwitch && info.expires.IsZero() {
+			ips = append(ips, info.ips...)
+		}
+	}
+	return ips
+}
+
 func (c *portCache) remove(logicalPort string) {
 	c.Lock()
 	defer c.Unlock()
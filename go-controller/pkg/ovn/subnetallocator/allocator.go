@@ -1,8 +1,10 @@
 package subnetallocator
 
 import (
+	"bytes"
 	"fmt"
 	"net"
+	"sort"
 	"sync"
 
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
@@ -11,8 +13,14 @@ import (
 
 var ErrSubnetAllocatorFull = fmt.Errorf("no subnets available.")
 
+// ErrSubnetRangeNotConfigured is returned when no network range of a wanted IP family was added
+var ErrSubnetRangeNotConfigured = fmt.Errorf("no network range configured for the IP family")
+
 type SubnetAllocator interface {
 	AddNetworkRange(network *net.IPNet, hostSubnetLen int) error
+	// AddAlignedNetworkRange is like AddNetworkRange, but subnets allocated from the
+	// range start on boundaries alignBits shorter than the host subnet length
+	AddAlignedNetworkRange(network *net.IPNet, hostSubnetLen, alignBits int) error
 	MarkAllocatedNetworks(string, ...*net.IPNet) error
 	// Usage returns the number of available and used v4 subnets, and
 	// the number of available and used v6 subnets
@@ -20,11 +28,49 @@ type SubnetAllocator interface {
 	AllocateNetworks(string) ([]*net.IPNet, error)
 	AllocateIPv4Network(string) (*net.IPNet, error)
 	AllocateIPv6Network(string) (*net.IPNet, error)
+	// PeekIPv4Network and PeekIPv6Network return the network the matching Allocate
+	// method would allocate next, without allocating it
+	PeekIPv4Network() (*net.IPNet, error)
+	PeekIPv6Network() (*net.IPNet, error)
 	// ReleaseNetworks releases the given networks if they are owned by the
 	// given owner
 	ReleaseNetworks(string, ...*net.IPNet) error
-	// ReleaseAllNetworks releases all networks owned by the given owner
-	ReleaseAllNetworks(string)
+	// ReleaseAllNetworks releases all networks owned by the given owner and
+	// returns them
+	ReleaseAllNetworks(string) []*net.IPNet
+	// DefragmentationPlan returns the moves of allocated networks that would leave
+	// the free networks of each range contiguous at its end, sorted by address. It
+	// doesn't move any network.
+	DefragmentationPlan() []SubnetMove
+	// ContainsNetwork returns whether the given network is part of any range
+	ContainsNetwork(*net.IPNet) bool
+	// NetworkOwner returns the owner the given network is allocated to, if it is allocated
+	NetworkOwner(*net.IPNet) (string, bool)
+	// ReconfigureNetworkRanges replaces the ranges available for allocation with the
+	// given ones, keeping the allocated networks. It fails without changing anything
+	// if an allocated network doesn't fit in the new ranges.
+	ReconfigureNetworkRanges([]NetworkRange) error
+	// Clone returns a copy of the allocator, ranges and allocated networks included,
+	// that can be allocated from without affecting the original
+	Clone() SubnetAllocator
+	// SetMaxNetworks caps the number of networks allocated from the range of the given
+	// network, whatever the number of networks it has room for. No cap if 0.
+	SetMaxNetworks(network *net.IPNet, maxNetworks int) error
+}
+
+// NetworkRange is a range subnets of HostSubnetLen are allocated from, aligned to
+// blocks of 2^AlignBits subnets
+type NetworkRange struct {
+	Network       *net.IPNet
+	HostSubnetLen int
+	AlignBits     int
+}
+
+// SubnetMove is the move of a network allocated to an owner to another network
+type SubnetMove struct {
+	Owner string
+	From  *net.IPNet
+	To    *net.IPNet
 }
 
 type BaseSubnetAllocator struct {
@@ -60,10 +106,17 @@ func (sna *BaseSubnetAllocator) Usage() (uint64, uint64, uint64, uint64) {
 // AddNetworkRange makes the given range available for allocation and returns
 // nil, or an error on failure.
 func (sna *BaseSubnetAllocator) AddNetworkRange(network *net.IPNet, hostSubnetLen int) error {
+	return sna.AddAlignedNetworkRange(network, hostSubnetLen, 0)
+}
+
+// AddAlignedNetworkRange makes the given range available for allocation of subnets
+// aligned to blocks of 2^alignBits subnets, eg /24 subnets aligned to /20 blocks
+// with alignBits 4, and returns nil, or an error on failure.
+func (sna *BaseSubnetAllocator) AddAlignedNetworkRange(network *net.IPNet, hostSubnetLen, alignBits int) error {
 	sna.Lock()
 	defer sna.Unlock()
 
-	snr, err := newSubnetAllocatorRange(network, hostSubnetLen)
+	snr, err := newSubnetAllocatorRange(network, hostSubnetLen, alignBits)
 	if err != nil {
 		return err
 	}
@@ -176,16 +229,180 @@ func (sna *BaseSubnetAllocator) AllocateIPv6Network(owner string) (*net.IPNet, e
 	return nil, ErrSubnetAllocatorFull
 }
 
+func (sna *BaseSubnetAllocator) PeekIPv4Network() (*net.IPNet, error) {
+	sna.Lock()
+	defer sna.Unlock()
+	return peekNetwork(sna.v4ranges)
+}
+
+func (sna *BaseSubnetAllocator) PeekIPv6Network() (*net.IPNet, error) {
+	sna.Lock()
+	defer sna.Unlock()
+	return peekNetwork(sna.v6ranges)
+}
+
+// peekNetwork returns the network the first of the ranges that is not full would
+// allocate next, nil if there are no ranges, or an error if they are all full
+func peekNetwork(ranges []*subnetAllocatorRange) (*net.IPNet, error) {
+	if len(ranges) == 0 {
+		return nil, nil
+	}
+	for _, snr := range ranges {
+		if sn, _ := snr.nextNetwork(); sn != nil {
+			return sn, nil
+		}
+	}
+	return nil, ErrSubnetAllocatorFull
+}
+
 func (sna *BaseSubnetAllocator) ReleaseNetworks(owner string, subnets ...*net.IPNet) error {
 	sna.Lock()
 	defer sna.Unlock()
 	return sna.releaseNetworks(owner, subnets...)
 }
 
-func (sna *BaseSubnetAllocator) ReleaseAllNetworks(owner string) {
+func (sna *BaseSubnetAllocator) ReleaseAllNetworks(owner string) []*net.IPNet {
+	sna.Lock()
+	defer sna.Unlock()
+	return sna.releaseAllNetworks(owner)
+}
+
+func (sna *BaseSubnetAllocator) DefragmentationPlan() []SubnetMove {
+	// plan on copies of the ranges, so that allocations don't wait for it
+	sna.Lock()
+	ranges := make([]*subnetAllocatorRange, 0, len(sna.v4ranges)+len(sna.v6ranges))
+	for _, snr := range append(append([]*subnetAllocatorRange{}, sna.v4ranges...), sna.v6ranges...) {
+		ranges = append(ranges, snr.copy())
+	}
+	sna.Unlock()
+
+	var moves []SubnetMove
+	for _, snr := range ranges {
+		moves = append(moves, snr.defragmentationPlan()...)
+	}
+	return moves
+}
+
+func (sna *BaseSubnetAllocator) ContainsNetwork(network *net.IPNet) bool {
+	sna.Lock()
+	defer sna.Unlock()
+	networkLen, _ := network.Mask.Size()
+	for _, snr := range append(append([]*subnetAllocatorRange{}, sna.v4ranges...), sna.v6ranges...) {
+		if rangeLen, _ := snr.network.Mask.Size(); snr.network.Contains(network.IP) && networkLen >= rangeLen {
+			return true
+		}
+	}
+	return false
+}
+
+func (sna *BaseSubnetAllocator) NetworkOwner(network *net.IPNet) (string, bool) {
+	sna.Lock()
+	defer sna.Unlock()
+	for _, snr := range append(append([]*subnetAllocatorRange{}, sna.v4ranges...), sna.v6ranges...) {
+		if owner, ok := snr.allocMap[network.String()]; ok {
+			return owner, true
+		}
+	}
+	return "", false
+}
+
+func (sna *BaseSubnetAllocator) Clone() SubnetAllocator {
+	sna.Lock()
+	defer sna.Unlock()
+	clone := &BaseSubnetAllocator{}
+	for _, snr := range sna.v4ranges {
+		clone.v4ranges = append(clone.v4ranges, snr.clone())
+	}
+	for _, snr := range sna.v6ranges {
+		clone.v6ranges = append(clone.v6ranges, snr.clone())
+	}
+	return clone
+}
+
+// SetMaxNetworks caps the number of networks allocated from the range of the given
+// network. Networks already allocated past the cap are kept, and the networks marked
+// allocated are not capped.
+func (sna *BaseSubnetAllocator) SetMaxNetworks(network *net.IPNet, maxNetworks int) error {
+	sna.Lock()
+	defer sna.Unlock()
+	if maxNetworks < 0 {
+		return fmt.Errorf("invalid maximum number of networks %d for range %s: must not be negative", maxNetworks, network)
+	}
+	for _, snr := range append(append([]*subnetAllocatorRange{}, sna.v4ranges...), sna.v6ranges...) {
+		if snr.network.String() == network.String() {
+			snr.maxNetworks = uint32(maxNetworks)
+			return nil
+		}
+	}
+	return fmt.Errorf("no range with network %s", network)
+}
+
+// ReconfigureNetworkRanges replaces the ranges available for allocation with the given
+// ones. Ranges that are unchanged keep their allocations as they are, the networks
+// allocated from ranges that are removed are marked allocated in the added ranges.
+func (sna *BaseSubnetAllocator) ReconfigureNetworkRanges(ranges []NetworkRange) error {
 	sna.Lock()
 	defer sna.Unlock()
-	sna.releaseAllNetworks(owner)
+
+	existing := make(map[string]*subnetAllocatorRange, len(sna.v4ranges)+len(sna.v6ranges))
+	for _, snr := range append(append([]*subnetAllocatorRange{}, sna.v4ranges...), sna.v6ranges...) {
+		existing[snr.String()] = snr
+	}
+
+	var v4ranges, v6ranges, added []*subnetAllocatorRange
+	for _, r := range ranges {
+		snr, err := newSubnetAllocatorRange(r.Network, r.HostSubnetLen, r.AlignBits)
+		if err != nil {
+			return err
+		}
+		if old, ok := existing[snr.String()]; ok {
+			snr = old
+			delete(existing, snr.String())
+		} else {
+			added = append(added, snr)
+		}
+		if utilnet.IsIPv6(snr.network.IP) {
+			v6ranges = append(v6ranges, snr)
+		} else {
+			v4ranges = append(v4ranges, snr)
+		}
+	}
+
+	// what is left are the removed ranges; their allocations are only marked in the
+	// added ranges, which are discarded on error, so nothing changes if one doesn't fit
+	var removedNetworks []string
+	owners := map[string]string{}
+	for _, snr := range existing {
+		for network, owner := range snr.allocMap {
+			removedNetworks = append(removedNetworks, network)
+			owners[network] = owner
+		}
+	}
+	sort.Strings(removedNetworks)
+	for _, network := range removedNetworks {
+		_, subnet, err := net.ParseCIDR(network)
+		if err != nil {
+			return fmt.Errorf("invalid network %s allocated to %s: %v", network, owners[network], err)
+		}
+		marked := false
+		for _, snr := range added {
+			if !snr.allocates(subnet) {
+				continue
+			}
+			if marked, err = snr.markAllocatedNetwork(owners[network], subnet); err != nil {
+				return err
+			} else if marked {
+				break
+			}
+		}
+		if !marked {
+			return fmt.Errorf("network %s allocated to %s does not fit in any of the new ranges", network, owners[network])
+		}
+	}
+
+	sna.v4ranges = v4ranges
+	sna.v6ranges = v6ranges
+	return nil
 }
 
 // releaseNetworks attempts to release all given subnets, even if a failure
@@ -225,16 +442,16 @@ func (sna *BaseSubnetAllocator) releaseNetworks(owner string, subnets ...*net.IP
 	return utilerrors.NewAggregate(errorList)
 }
 
-// releaseAllNetworks attempts to release all subnets of a given owner, even
-// if a failure occurs during release. It returns nil, or an aggregate error
-// for any failures that occurred.
-func (sna *BaseSubnetAllocator) releaseAllNetworks(owner string) {
+// releaseAllNetworks releases all subnets of a given owner and returns them.
+func (sna *BaseSubnetAllocator) releaseAllNetworks(owner string) []*net.IPNet {
+	var released []*net.IPNet
 	for _, snr := range sna.v4ranges {
-		snr.releaseAllNetworks(owner)
+		released = append(released, snr.releaseAllNetworks(owner)...)
 	}
 	for _, snr := range sna.v6ranges {
-		snr.releaseAllNetworks(owner)
+		released = append(released, snr.releaseAllNetworks(owner)...)
 	}
+	return released
 }
 
 // subnetAllocatorRange handles allocating subnets out of a single CIDR
@@ -245,6 +462,10 @@ type subnetAllocatorRange struct {
 	next       uint32
 	allocMap   map[string]string
 	used       uint32
+	// allocated subnets start on boundaries alignBits shorter than the subnet length
+	alignBits uint32
+	// maxNetworks caps the number of subnets allocated from the range, if not 0
+	maxNetworks uint32
 
 	// IPv4-only address-alignment hackery; see below
 	leftShift  uint32
@@ -253,12 +474,21 @@ type subnetAllocatorRange struct {
 	rightMask  uint32
 }
 
-func newSubnetAllocatorRange(network *net.IPNet, hostSubnetLen int) (*subnetAllocatorRange, error) {
+func newSubnetAllocatorRange(network *net.IPNet, hostSubnetLen, alignBits int) (*subnetAllocatorRange, error) {
 	clusterCIDRLen, addrLen := network.Mask.Size()
 	if hostSubnetLen >= addrLen {
 		return nil, fmt.Errorf("host capacity cannot be zero.")
 	} else if hostSubnetLen < clusterCIDRLen {
 		return nil, fmt.Errorf("subnet capacity cannot be larger than number of networks available.")
+	} else if alignBits < 0 {
+		return nil, fmt.Errorf("subnet alignment cannot be negative.")
+	} else if hostSubnetLen-alignBits < clusterCIDRLen {
+		return nil, fmt.Errorf("cannot align /%d subnets of %s to /%d blocks: the blocks are larger than the network",
+			hostSubnetLen, network, hostSubnetLen-alignBits)
+	} else if addrLen == 128 && hostSubnetLen-clusterCIDRLen >= 16 && alignBits >= 16 {
+		// aligned subnets would all be skipped for having all 0s in the low word, see subnet()
+		return nil, fmt.Errorf("cannot align /%d subnets of %s to /%d blocks: the blocks must be less than 2^16 subnets",
+			hostSubnetLen, network, hostSubnetLen-alignBits)
 	}
 	hostBits := uint32(addrLen - hostSubnetLen)
 	subnetBits := uint32(hostSubnetLen - clusterCIDRLen)
@@ -269,6 +499,7 @@ func newSubnetAllocatorRange(network *net.IPNet, hostSubnetLen int) (*subnetAllo
 		subnetBits: subnetBits,
 		next:       0,
 		allocMap:   make(map[string]string),
+		alignBits:  uint32(alignBits),
 	}
 
 	// In the simple case, the subnet part of the 32-bit IP address is just the subnet
@@ -302,10 +533,47 @@ func newSubnetAllocatorRange(network *net.IPNet, hostSubnetLen int) (*subnetAllo
 	return snr, nil
 }
 
-// usage returns the number of available subnets and the number of allocated subnets
+// String returns the network of the range with its subnet length and alignment
+func (snr *subnetAllocatorRange) String() string {
+	clusterCIDRLen, _ := snr.network.Mask.Size()
+	return fmt.Sprintf("%s/%d/%d", snr.network, clusterCIDRLen+int(snr.subnetBits), snr.alignBits)
+}
+
+// clone returns a copy of snr with its own map of allocated networks
+func (snr *subnetAllocatorRange) clone() *subnetAllocatorRange {
+	clone := *snr
+	clone.allocMap = make(map[string]string, len(snr.allocMap))
+	for network, owner := range snr.allocMap {
+		clone.allocMap[network] = owner
+	}
+	return &clone
+}
+
+// allocates returns whether network is in snr's range and has the length of its subnets
+func (snr *subnetAllocatorRange) allocates(network *net.IPNet) bool {
+	clusterCIDRLen, _ := snr.network.Mask.Size()
+	networkLen, _ := network.Mask.Size()
+	return snr.network.Contains(network.IP) && networkLen == clusterCIDRLen+int(snr.subnetBits)
+}
+
+// usage returns the number of available subnets and the number of allocated subnets.
+// The available subnets are capped to maxNetworks, or to the allocated subnets if more
+// were marked allocated. The allocated subnets are capped to the available ones, which
+// they exceed when misaligned subnets were marked allocated in an aligned range.
 func (snr *subnetAllocatorRange) usage() (uint64, uint64) {
 	var one uint64 = 1
-	return one << snr.subnetBits, uint64(snr.used)
+	count := one << (snr.subnetBits - snr.alignBits)
+	used := uint64(snr.used)
+	if snr.maxNetworks != 0 && uint64(snr.maxNetworks) < count {
+		count = uint64(snr.maxNetworks)
+		if used > count {
+			count = used
+		}
+	}
+	if used > count {
+		used = count
+	}
+	return count, used
 }
 
 type alreadyOwnedError struct {
@@ -344,54 +612,93 @@ func (snr *subnetAllocatorRange) markAllocatedNetwork(owner string, network *net
 	return false, alreadyOwnedError{str, existingOwner}
 }
 
-// allocateNetwork returns a new subnet, or nil if the range is full
-func (snr *subnetAllocatorRange) allocateNetwork(owner string) *net.IPNet {
-	netMaskSize, addrLen := snr.network.Mask.Size()
-	numSubnets := uint32(1) << snr.subnetBits
+// numSubnets returns the number of subnets of the range considered for allocation
+func (snr *subnetAllocatorRange) numSubnets() uint32 {
 	if snr.subnetBits > 24 {
-		// We need to make sure that the uint32 math below won't overflow. If
-		// snr.subnetBits > 32 then numSubnets has already overflowed, but also if
+		// We need to make sure that the uint32 math in subnet() won't overflow. If
+		// snr.subnetBits > 32 then numSubnets would overflow, but also if
 		// numSubnets is between 1<<24 and 1<<32 then "base << (snr.hostBits % 8)"
-		// below could overflow if snr.hostBits%8 is non-0. So we cap numSubnets
+		// could overflow if snr.hostBits%8 is non-0. So we cap numSubnets
 		// at 1<<24. "16M subnets ought to be enough for anybody."
-		numSubnets = 1 << 24
+		return 1 << 24
 	}
+	return uint32(1) << snr.subnetBits
+}
 
-	var i uint32
-	for i = 0; i < numSubnets; i++ {
-		n := (i + snr.next) % numSubnets
-		base := n
-		if snr.leftShift != 0 {
-			base = ((base << snr.leftShift) & snr.leftMask) | ((base >> snr.rightShift) & snr.rightMask)
-		} else if addrLen == 128 && snr.subnetBits >= 16 {
-			// Skip the 0 subnet (and other subnets with all 0s in the low word)
-			// since the extra 0 word will get compressed out and make the address
-			// look different from addresses on other subnets.
-			if (base & 0xFFFF) == 0 {
-				continue
-			}
+// subnet returns the n-th subnet of the range in allocation order, or nil if that
+// subnet is never allocated
+func (snr *subnetAllocatorRange) subnet(n uint32) *net.IPNet {
+	base := n
+	if snr.leftShift != 0 {
+		base = ((base << snr.leftShift) & snr.leftMask) | ((base >> snr.rightShift) & snr.rightMask)
+	}
+	return snr.subnetAt(base)
+}
+
+// subnetAt returns the n-th subnet of the range in address order, or nil if that
+// subnet is never allocated
+func (snr *subnetAllocatorRange) subnetAt(base uint32) *net.IPNet {
+	netMaskSize, addrLen := snr.network.Mask.Size()
+	if addrLen == 128 && snr.subnetBits >= 16 {
+		// Skip the 0 subnet (and other subnets with all 0s in the low word)
+		// since the extra 0 word will get compressed out and make the address
+		// look different from addresses on other subnets.
+		if (base & 0xFFFF) == 0 {
+			return nil
 		}
+	}
 
-		genIP := append([]byte{}, []byte(snr.network.IP)...)
-		subnetBits := base << (snr.hostBits % 8)
-		b := (uint32(addrLen) - snr.hostBits - 1) / 8
-		for subnetBits != 0 {
-			genIP[b] |= byte(subnetBits)
-			subnetBits >>= 8
-			b--
+	genIP := append([]byte{}, []byte(snr.network.IP)...)
+	subnetBits := base << (snr.hostBits % 8)
+	b := (uint32(addrLen) - snr.hostBits - 1) / 8
+	for subnetBits != 0 {
+		genIP[b] |= byte(subnetBits)
+		subnetBits >>= 8
+		b--
+	}
+
+	genSubnet := &net.IPNet{IP: genIP, Mask: net.CIDRMask(int(snr.subnetBits)+netMaskSize, addrLen)}
+	if snr.alignBits != 0 {
+		blockMask := net.CIDRMask(int(snr.subnetBits-snr.alignBits)+netMaskSize, addrLen)
+		if ip := net.IP(genIP); !ip.Mask(blockMask).Equal(ip) {
+			return nil
 		}
+	}
+	return genSubnet
+}
 
-		genSubnet := &net.IPNet{IP: genIP, Mask: net.CIDRMask(int(snr.subnetBits)+netMaskSize, addrLen)}
+// nextNetwork returns the free subnet allocateNetwork would allocate next and its
+// number in allocation order, or nil if the range is full or at its cap
+func (snr *subnetAllocatorRange) nextNetwork() (*net.IPNet, uint32) {
+	if snr.maxNetworks != 0 && snr.used >= snr.maxNetworks {
+		return nil, 0
+	}
+	numSubnets := snr.numSubnets()
+	var i uint32
+	for i = 0; i < numSubnets; i++ {
+		n := (i + snr.next) % numSubnets
+		genSubnet := snr.subnet(n)
+		if genSubnet == nil {
+			continue
+		}
 		if _, ok := snr.allocMap[genSubnet.String()]; !ok {
-			snr.allocMap[genSubnet.String()] = owner
-			snr.next = n + 1
-			snr.used++
-			return genSubnet
+			return genSubnet, n
 		}
 	}
+	return nil, 0
+}
 
-	snr.next = 0
-	return nil
+// allocateNetwork returns a new subnet, or nil if the range is full
+func (snr *subnetAllocatorRange) allocateNetwork(owner string) *net.IPNet {
+	genSubnet, n := snr.nextNetwork()
+	if genSubnet == nil {
+		snr.next = 0
+		return nil
+	}
+	snr.allocMap[genSubnet.String()] = owner
+	snr.next = n + 1
+	snr.used++
+	return genSubnet
 }
 
 // releaseNetwork marks network as being not in use, if it is part of snr's range.
@@ -414,12 +721,80 @@ func (snr *subnetAllocatorRange) releaseNetwork(owner string, network *net.IPNet
 	return false, alreadyOwnedError{str, existingOwner}
 }
 
-// releaseAllNetworks marks all networks of a given owner as being not in use.
-func (snr *subnetAllocatorRange) releaseAllNetworks(owner string) {
+// releaseAllNetworks marks all networks of a given owner as being not in use and
+// returns them.
+func (snr *subnetAllocatorRange) releaseAllNetworks(owner string) []*net.IPNet {
+	var released []*net.IPNet
 	for network, existingOwner := range snr.allocMap {
 		if existingOwner == owner {
 			delete(snr.allocMap, network)
 			snr.used--
+			if _, ipnet, err := net.ParseCIDR(network); err == nil {
+				released = append(released, ipnet)
+			}
 		}
 	}
+	return released
+}
+
+// copy returns a copy of the range, with its own allocated networks
+func (snr *subnetAllocatorRange) copy() *subnetAllocatorRange {
+	c := *snr
+	c.allocMap = make(map[string]string, len(snr.allocMap))
+	for network, owner := range snr.allocMap {
+		c.allocMap[network] = owner
+	}
+	return &c
+}
+
+// defragmentationPlan returns the moves that would pack the allocated networks of the
+// range into its first subnets by address, leaving the remaining subnets free. Only as
+// many subnets as there are allocated networks are gone over. Allocated networks that
+// are not subnets the range allocates, eg misaligned ones marked from a previous
+// configuration, are moved as well. The moves are sorted by the address of the network
+// moved, and each is moved to the first free subnet left.
+func (snr *subnetAllocatorRange) defragmentationPlan() []SubnetMove {
+	allocated := len(snr.allocMap)
+	packed := make(map[string]bool, allocated)
+	var holes []*net.IPNet
+
+	// aligned subnets are the ones whose low alignBits are 0 in address order
+	numSubnets := snr.numSubnets()
+	step := uint32(1) << snr.alignBits
+	for base := uint32(0); base < numSubnets && len(packed)+len(holes) < allocated; base += step {
+		subnet := snr.subnetAt(base)
+		if subnet == nil {
+			continue
+		}
+		if _, ok := snr.allocMap[subnet.String()]; ok {
+			packed[subnet.String()] = true
+		} else {
+			holes = append(holes, subnet)
+		}
+	}
+
+	var moves []SubnetMove
+	for network, owner := range snr.allocMap {
+		if packed[network] {
+			continue
+		}
+		_, subnet, err := net.ParseCIDR(network)
+		if err != nil {
+			continue
+		}
+		moves = append(moves, SubnetMove{Owner: owner, From: subnet})
+	}
+	sort.Slice(moves, func(i, j int) bool {
+		return bytes.Compare(moves[i].From.IP, moves[j].From.IP) < 0
+	})
+
+	// there are as many holes as moves, unless the range has more networks
+	// allocated than subnets it allocates
+	if len(moves) > len(holes) {
+		moves = moves[:len(holes)]
+	}
+	for i := range moves {
+		moves[i].To = holes[i]
+	}
+	return moves
 }
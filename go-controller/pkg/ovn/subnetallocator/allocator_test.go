@@ -327,6 +327,76 @@ func TestAllocateSubnetInvalidHostBitsOrCIDR(t *testing.T) {
 	}
 }
 
+// 10.1.ssss0000.hhhhhhhh
+func TestAllocateAlignedSubnetIPv4(t *testing.T) {
+	sna := NewSubnetAllocator()
+	if err := sna.AddAlignedNetworkRange(ovntest.MustParseIPNet("10.1.0.0/16"), 24, 4); err != nil {
+		t.Fatal("Failed to initialize subnet allocator: ", err)
+	}
+	if err := expectNumSubnets(t, sna, 16, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	for n := 0; n < 16; n++ {
+		if err := allocateExpected(sna, n, fmt.Sprintf("10.1.%d.0/24", n*16)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := allocateNotExpected(sna, 16); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAllocateAlignedSubnetIPv6(t *testing.T) {
+	sna := NewSubnetAllocator()
+	if err := sna.AddAlignedNetworkRange(ovntest.MustParseIPNet("fd01::/48"), 64, 8); err != nil {
+		t.Fatal("Failed to initialize subnet allocator: ", err)
+	}
+	if err := expectNumSubnets(t, sna, 0, 256); err != nil {
+		t.Fatal(err)
+	}
+
+	// the 0 subnet is skipped as without alignment
+	for n := 1; n < 256; n++ {
+		if err := allocateExpected(sna, n, fmt.Sprintf("fd01:0:0:%x::/64", n<<8)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := allocateNotExpected(sna, 256); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAllocateAlignedSubnetInvalidAlignment(t *testing.T) {
+	sna := NewSubnetAllocator()
+	if err := sna.AddAlignedNetworkRange(ovntest.MustParseIPNet("10.1.0.0/22"), 24, 4); err == nil {
+		t.Fatal("Unexpectedly succeeded in aligning subnets to blocks larger than the network")
+	}
+	if err := sna.AddAlignedNetworkRange(ovntest.MustParseIPNet("10.1.0.0/16"), 24, -1); err == nil {
+		t.Fatal("Unexpectedly succeeded in initializing subnet allocator with negative alignment")
+	}
+	if err := sna.AddAlignedNetworkRange(ovntest.MustParseIPNet("fd01::/32"), 64, 16); err == nil {
+		t.Fatal("Unexpectedly succeeded in aligning subnets that all have a zero low word")
+	}
+}
+
+func TestAlignedSubnetUsageWithMisalignedSubnets(t *testing.T) {
+	sna := NewSubnetAllocator()
+	if err := sna.AddAlignedNetworkRange(ovntest.MustParseIPNet("10.1.0.0/20"), 24, 4); err != nil {
+		t.Fatal("Failed to initialize subnet allocator: ", err)
+	}
+	// marked from the annotations of nodes added before the subnets were aligned
+	if err := sna.MarkAllocatedNetworks("node1", ovntest.MustParseIPNet("10.1.1.0/24")); err != nil {
+		t.Fatal(err)
+	}
+	if err := sna.MarkAllocatedNetworks("node2", ovntest.MustParseIPNet("10.1.2.0/24")); err != nil {
+		t.Fatal(err)
+	}
+	if v4count, v4used, _, _ := sna.Usage(); v4count != 1 || v4used != 1 {
+		t.Fatalf("expected 1 of 1 v4 subnets used, got %d of %d", v4used, v4count)
+	}
+}
+
 func TestMarkAllocatedNetwork(t *testing.T) {
 	sna, err := newSubnetAllocator("10.1.0.0/16", 18)
 	if err != nil {
@@ -581,3 +651,379 @@ func TestDualStack(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func movesToStrings(moves []SubnetMove) []string {
+	strs := make([]string, 0, len(moves))
+	for _, move := range moves {
+		strs = append(strs, fmt.Sprintf("%s: %s -> %s", move.Owner, move.From, move.To))
+	}
+	return strs
+}
+
+func expectMoves(t *testing.T, sna SubnetAllocator, expected ...string) {
+	t.Helper()
+	moves := movesToStrings(sna.DefragmentationPlan())
+	if fmt.Sprint(moves) != fmt.Sprint(expected) {
+		t.Fatalf("expected defragmentation plan %v, got %v", expected, moves)
+	}
+}
+
+func TestDefragmentationPlan(t *testing.T) {
+	sna, err := newSubnetAllocator("10.1.0.0/16", 24)
+	if err != nil {
+		t.Fatal("Failed to initialize subnet allocator: ", err)
+	}
+	for n := 0; n < 6; n++ {
+		if _, err := allocateOneNetwork(sna, fmt.Sprintf("node%d", n)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// nothing to move while the allocated subnets are contiguous
+	expectMoves(t, sna)
+
+	if err := sna.ReleaseNetworks("node1", ovntest.MustParseIPNet("10.1.1.0/24")); err != nil {
+		t.Fatal(err)
+	}
+	if err := sna.ReleaseNetworks("node3", ovntest.MustParseIPNet("10.1.3.0/24")); err != nil {
+		t.Fatal(err)
+	}
+	expectMoves(t, sna,
+		"node4: 10.1.4.0/24 -> 10.1.1.0/24",
+		"node5: 10.1.5.0/24 -> 10.1.3.0/24",
+	)
+
+	// the plan doesn't move anything
+	if err := sna.ReleaseNetworks("node5", ovntest.MustParseIPNet("10.1.5.0/24")); err != nil {
+		t.Fatal(err)
+	}
+	expectMoves(t, sna, "node4: 10.1.4.0/24 -> 10.1.1.0/24")
+}
+
+func TestDefragmentationPlanDualStack(t *testing.T) {
+	sna, err := newSubnetAllocator("10.1.0.0/16", 24)
+	if err != nil {
+		t.Fatal("Failed to initialize subnet allocator: ", err)
+	}
+	if err := sna.AddNetworkRange(ovntest.MustParseIPNet("fd01::/48"), 64); err != nil {
+		t.Fatal("Failed to add network range: ", err)
+	}
+	for n := 0; n < 3; n++ {
+		if _, err := sna.AllocateNetworks(fmt.Sprintf("node%d", n)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sna.ReleaseNetworks("node0", ovntest.MustParseIPNet("10.1.0.0/24"),
+		ovntest.MustParseIPNet("fd01:0:0:1::/64")); err != nil {
+		t.Fatal(err)
+	}
+	expectMoves(t, sna,
+		"node2: 10.1.2.0/24 -> 10.1.0.0/24",
+		"node2: fd01:0:0:3::/64 -> fd01:0:0:1::/64",
+	)
+}
+
+func TestDefragmentationPlanMisalignedSubnet(t *testing.T) {
+	sna := NewSubnetAllocator()
+	if err := sna.AddAlignedNetworkRange(ovntest.MustParseIPNet("10.1.0.0/16"), 24, 4); err != nil {
+		t.Fatal("Failed to initialize subnet allocator: ", err)
+	}
+	if _, err := allocateOneNetwork(sna, "node0"); err != nil {
+		t.Fatal(err)
+	}
+	// marked from the annotation of a node added before the subnets were aligned
+	if err := sna.MarkAllocatedNetworks("node1", ovntest.MustParseIPNet("10.1.33.0/24")); err != nil {
+		t.Fatal(err)
+	}
+	expectMoves(t, sna, "node1: 10.1.33.0/24 -> 10.1.16.0/24")
+}
+
+// 10.1.ssssssss.sshhhhhh
+func TestDefragmentationPlanByAddress(t *testing.T) {
+	sna, err := newSubnetAllocator("10.1.0.0/16", 26)
+	if err != nil {
+		t.Fatal("Failed to initialize subnet allocator: ", err)
+	}
+	expectAllocations(t, sna, "10.1.0.0/26", "10.1.1.0/26", "10.1.2.0/26")
+	// subnets are allocated spread over the range, but packed by address
+	expectMoves(t, sna,
+		"test: 10.1.1.0/26 -> 10.1.0.64/26",
+		"test: 10.1.2.0/26 -> 10.1.0.128/26",
+	)
+}
+
+func TestDefragmentationPlanLargeRange(t *testing.T) {
+	sna, err := newSubnetAllocator("fd01::/16", 64)
+	if err != nil {
+		t.Fatal("Failed to initialize subnet allocator: ", err)
+	}
+	// the 0 subnet is never allocated, only the subnets up to the allocated count are
+	// gone over to find where it goes
+	if err := sna.MarkAllocatedNetworks("node0", ovntest.MustParseIPNet("fd01::/64")); err != nil {
+		t.Fatal(err)
+	}
+	expectMoves(t, sna, "node0: fd01::/64 -> fd01:0:0:1::/64")
+}
+
+func expectAllocations(t *testing.T, sna SubnetAllocator, expected ...string) {
+	t.Helper()
+	for n, subnet := range expected {
+		if err := allocateExpected(sna, n, subnet); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReconfigureNetworkRangesAddsRange(t *testing.T) {
+	sna, err := newSubnetAllocator("10.1.0.0/23", 24)
+	if err != nil {
+		t.Fatal("Failed to initialize subnet allocator: ", err)
+	}
+	expectAllocations(t, sna, "10.1.0.0/24", "10.1.1.0/24")
+	if err := allocateNotExpected(sna, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	err = sna.ReconfigureNetworkRanges([]NetworkRange{
+		{Network: ovntest.MustParseIPNet("10.1.0.0/23"), HostSubnetLen: 24},
+		{Network: ovntest.MustParseIPNet("10.2.0.0/23"), HostSubnetLen: 24},
+	})
+	if err != nil {
+		t.Fatal("Failed to reconfigure network ranges: ", err)
+	}
+	if v4count, v4used, _, _ := sna.Usage(); v4count != 4 || v4used != 2 {
+		t.Fatalf("expected 2 of 4 subnets used, got %d of %d", v4used, v4count)
+	}
+	// the existing allocations are kept, new ones come from the added range
+	if err := sna.MarkAllocatedNetworks("other", ovntest.MustParseIPNet("10.1.1.0/24")); !IsAlreadyOwnedError(err) {
+		t.Fatalf("expected 10.1.1.0/24 to still be owned, got %v", err)
+	}
+	expectAllocations(t, sna, "10.2.0.0/24", "10.2.1.0/24")
+	if err := allocateNotExpected(sna, 4); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReconfigureNetworkRangesWidensRange(t *testing.T) {
+	sna, err := newSubnetAllocator("10.1.0.0/23", 24)
+	if err != nil {
+		t.Fatal("Failed to initialize subnet allocator: ", err)
+	}
+	expectAllocations(t, sna, "10.1.0.0/24", "10.1.1.0/24")
+
+	err = sna.ReconfigureNetworkRanges([]NetworkRange{{Network: ovntest.MustParseIPNet("10.1.0.0/22"), HostSubnetLen: 24}})
+	if err != nil {
+		t.Fatal("Failed to reconfigure network ranges: ", err)
+	}
+	if v4count, v4used, _, _ := sna.Usage(); v4count != 4 || v4used != 2 {
+		t.Fatalf("expected 2 of 4 subnets used, got %d of %d", v4used, v4count)
+	}
+	// the allocations of the replaced range moved to the wider one
+	if err := sna.MarkAllocatedNetworks("other", ovntest.MustParseIPNet("10.1.0.0/24")); !IsAlreadyOwnedError(err) {
+		t.Fatalf("expected 10.1.0.0/24 to still be owned, got %v", err)
+	}
+	expectAllocations(t, sna, "10.1.2.0/24", "10.1.3.0/24")
+	if err := allocateNotExpected(sna, 4); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReconfigureNetworkRangesKeepsAllocationsInRange(t *testing.T) {
+	sna, err := newSubnetAllocator("10.1.0.0/23", 24)
+	if err != nil {
+		t.Fatal("Failed to initialize subnet allocator: ", err)
+	}
+	expectAllocations(t, sna, "10.1.0.0/24")
+
+	tests := []struct {
+		desc   string
+		ranges []NetworkRange
+	}{
+		{
+			desc:   "range removed",
+			ranges: []NetworkRange{{Network: ovntest.MustParseIPNet("10.2.0.0/16"), HostSubnetLen: 24}},
+		},
+		{
+			desc:   "host subnet length changed",
+			ranges: []NetworkRange{{Network: ovntest.MustParseIPNet("10.1.0.0/16"), HostSubnetLen: 26}},
+		},
+	}
+	for _, tc := range tests {
+		if err := sna.ReconfigureNetworkRanges(tc.ranges); err == nil {
+			t.Fatalf("%s: expected the allocated 10.1.0.0/24 to fail the reconfiguration", tc.desc)
+		}
+		// nothing changed
+		if v4count, v4used, _, _ := sna.Usage(); v4count != 2 || v4used != 1 {
+			t.Fatalf("%s: expected 1 of 2 subnets used, got %d of %d", tc.desc, v4used, v4count)
+		}
+	}
+	expectAllocations(t, sna, "10.1.1.0/24")
+}
+
+func TestContainsNetwork(t *testing.T) {
+	sna, err := newSubnetAllocator("10.1.0.0/16", 24)
+	if err != nil {
+		t.Fatal("Failed to initialize subnet allocator: ", err)
+	}
+	if err := sna.AddNetworkRange(ovntest.MustParseIPNet("fd01::/48"), 64); err != nil {
+		t.Fatal("Failed to add network range: ", err)
+	}
+	tests := []struct {
+		network  string
+		expected bool
+	}{
+		{"10.1.1.0/24", true},
+		{"10.1.255.0/24", true},
+		{"fd01:0:0:1::/64", true},
+		{"10.2.1.0/24", false},
+		{"10.0.0.0/8", false},
+		{"fd02:0:0:1::/64", false},
+	}
+	for _, tc := range tests {
+		if contains := sna.ContainsNetwork(ovntest.MustParseIPNet(tc.network)); contains != tc.expected {
+			t.Errorf("expected ContainsNetwork(%s) to be %v, got %v", tc.network, tc.expected, contains)
+		}
+	}
+}
+
+func TestPeekNetwork(t *testing.T) {
+	sna, err := newSubnetAllocator("10.1.0.0/16", 18)
+	if err != nil {
+		t.Fatal("Failed to initialize subnet allocator: ", err)
+	}
+
+	// peeking leaves the network free, allocating then returns the same network
+	for i := 0; i < 4; i++ {
+		expected := fmt.Sprintf("10.1.%d.0/18", i*64)
+		for j := 0; j < 2; j++ {
+			sn, err := sna.PeekIPv4Network()
+			if err != nil {
+				t.Fatal("Failed to peek at the next network: ", err)
+			}
+			if sn.String() != expected {
+				t.Fatalf("Did not peek at the expected network (i=%d, sn=%s)", i, sn.String())
+			}
+		}
+		if err := allocateExpected(sna, i, expected); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if sn, err := sna.PeekIPv4Network(); err != ErrSubnetAllocatorFull {
+		t.Fatalf("Expected ErrSubnetAllocatorFull peeking at a full range, got %v (sn=%v)", err, sn)
+	}
+	if sn, err := sna.PeekIPv6Network(); err != nil || sn != nil {
+		t.Fatalf("Expected no IPv6 network without IPv6 ranges, got %v (err=%v)", sn, err)
+	}
+
+	// a released network is peeked at once the next networks are taken
+	if err := sna.ReleaseNetworks(testNodeName, ovntest.MustParseIPNet("10.1.64.0/18")); err != nil {
+		t.Fatal(err)
+	}
+	sn, err := sna.PeekIPv4Network()
+	if err != nil {
+		t.Fatal("Failed to peek at the next network: ", err)
+	}
+	if sn.String() != "10.1.64.0/18" {
+		t.Fatalf("Did not peek at the released network (sn=%s)", sn.String())
+	}
+	if err := allocateExpected(sna, -1, sn.String()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNetworkOwner(t *testing.T) {
+	sna, err := newSubnetAllocator("10.1.0.0/16", 24)
+	if err != nil {
+		t.Fatal("Failed to initialize subnet allocator: ", err)
+	}
+	if err := sna.AddNetworkRange(ovntest.MustParseIPNet("fd01::/48"), 64); err != nil {
+		t.Fatal("Failed to add network range: ", err)
+	}
+	if err := sna.MarkAllocatedNetworks("node1", ovntest.MustParseIPNet("10.1.1.0/24"),
+		ovntest.MustParseIPNet("fd01:0:0:1::/64")); err != nil {
+		t.Fatal("Failed to mark networks allocated: ", err)
+	}
+	if err := sna.MarkAllocatedNetworks("node2", ovntest.MustParseIPNet("10.1.2.0/24")); err != nil {
+		t.Fatal("Failed to mark networks allocated: ", err)
+	}
+	tests := []struct {
+		network       string
+		expectedOwner string
+		expectedOK    bool
+	}{
+		{"10.1.1.0/24", "node1", true},
+		{"fd01:0:0:1::/64", "node1", true},
+		{"10.1.2.0/24", "node2", true},
+		{"10.1.3.0/24", "", false},
+		{"10.1.0.0/16", "", false},
+		{"10.2.1.0/24", "", false},
+	}
+	for _, tc := range tests {
+		owner, ok := sna.NetworkOwner(ovntest.MustParseIPNet(tc.network))
+		if owner != tc.expectedOwner || ok != tc.expectedOK {
+			t.Errorf("expected NetworkOwner(%s) to be %q, %v, got %q, %v",
+				tc.network, tc.expectedOwner, tc.expectedOK, owner, ok)
+		}
+	}
+
+	if err := sna.ReleaseNetworks("node2", ovntest.MustParseIPNet("10.1.2.0/24")); err != nil {
+		t.Fatal(err)
+	}
+	if owner, ok := sna.NetworkOwner(ovntest.MustParseIPNet("10.1.2.0/24")); ok {
+		t.Errorf("expected released network 10.1.2.0/24 to have no owner, got %q", owner)
+	}
+}
+
+func TestSetMaxNetworks(t *testing.T) {
+	sna, err := newSubnetAllocator("10.1.0.0/22", 24)
+	if err != nil {
+		t.Fatal("Failed to initialize subnet allocator: ", err)
+	}
+	if err := sna.AddNetworkRange(ovntest.MustParseIPNet("10.2.0.0/23"), 24); err != nil {
+		t.Fatal("Failed to add network range: ", err)
+	}
+	if err := sna.SetMaxNetworks(ovntest.MustParseIPNet("10.1.0.0/22"), 2); err != nil {
+		t.Fatal("Failed to cap network range: ", err)
+	}
+	if err := sna.SetMaxNetworks(ovntest.MustParseIPNet("10.3.0.0/22"), 2); err == nil {
+		t.Fatal("Unexpectedly capped a network range that doesn't exist")
+	}
+	if v4count, v4used, _, _ := sna.Usage(); v4count != 4 || v4used != 0 {
+		t.Fatalf("expected 0 of 4 subnets used, got %d of %d", v4used, v4count)
+	}
+
+	// the capped range is left for the next one once it reaches its cap, even though
+	// it has room for more
+	expectAllocations(t, sna, "10.1.0.0/24", "10.1.1.0/24", "10.2.0.0/24", "10.2.1.0/24")
+	if err := allocateNotExpected(sna, 4); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sna.PeekIPv4Network(); err != ErrSubnetAllocatorFull {
+		t.Fatalf("expected no network to peek at, got %v", err)
+	}
+
+	// networks marked allocated past the cap are kept and counted
+	if err := sna.MarkAllocatedNetworks("other", ovntest.MustParseIPNet("10.1.3.0/24")); err != nil {
+		t.Fatal("Failed to mark network allocated: ", err)
+	}
+	if v4count, v4used, _, _ := sna.Usage(); v4count != 5 || v4used != 5 {
+		t.Fatalf("expected 5 of 5 subnets used, got %d of %d", v4used, v4count)
+	}
+
+	// releasing a network of the capped range makes room for one more
+	if err := sna.ReleaseNetworks("other", ovntest.MustParseIPNet("10.1.3.0/24")); err != nil {
+		t.Fatal("Failed to release network: ", err)
+	}
+	if err := sna.ReleaseNetworks(testNodeName, ovntest.MustParseIPNet("10.1.0.0/24")); err != nil {
+		t.Fatal("Failed to release network: ", err)
+	}
+	expectAllocations(t, sna, "10.1.0.0/24")
+
+	// no cap
+	if err := sna.SetMaxNetworks(ovntest.MustParseIPNet("10.1.0.0/22"), 0); err != nil {
+		t.Fatal("Failed to uncap network range: ", err)
+	}
+	if v4count, v4used, _, _ := sna.Usage(); v4count != 6 || v4used != 4 {
+		t.Fatalf("expected 4 of 6 subnets used, got %d of %d", v4used, v4count)
+	}
+}
@@ -3,8 +3,11 @@ package subnetallocator
 import (
 	"fmt"
 	"net"
+	"sync"
+	"time"
 
 	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
 	utilnet "k8s.io/utils/net"
 
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/config"
@@ -15,17 +18,35 @@ type HostSubnetAllocator struct {
 	// Don't inherit from BaseSubnetAllocator to ensure users of
 	// hostSubnetAllocator can't directly call the underlying methods
 	base SubnetAllocator
+
+	clock clock.Clock
+	// allocatedAtLock protects allocatedAt
+	allocatedAtLock sync.Mutex
+	// allocatedAt is the time each node got its current subnets allocated
+	allocatedAt map[string]time.Time
+	// maxNodes is the maximum number of nodes allocated subnets from each cluster
+	// subnet with a cap, keyed by CIDR
+	maxNodes map[string]int
 }
 
 func NewHostSubnetAllocator() *HostSubnetAllocator {
 	return &HostSubnetAllocator{
-		base: NewSubnetAllocator(),
+		base:        NewSubnetAllocator(),
+		clock:       clock.RealClock{},
+		allocatedAt: map[string]time.Time{},
 	}
 }
 
 func (sna *HostSubnetAllocator) InitRanges(subnets []config.CIDRNetworkEntry) error {
+	return sna.InitAlignedRanges(subnets, 0)
+}
+
+// InitAlignedRanges is like InitRanges, but node subnets are allocated on boundaries
+// alignBits shorter than the host subnet length of each range. It fails if a range
+// is too small for a single aligned block.
+func (sna *HostSubnetAllocator) InitAlignedRanges(subnets []config.CIDRNetworkEntry, alignBits int) error {
 	for _, entry := range subnets {
-		if err := sna.base.AddNetworkRange(entry.CIDR, entry.HostSubnetLength); err != nil {
+		if err := sna.base.AddAlignedNetworkRange(entry.CIDR, entry.HostSubnetLength, alignBits); err != nil {
 			return err
 		}
 		klog.V(5).Infof("Added network range %s to host subnet allocator", entry.CIDR)
@@ -37,6 +58,74 @@ func (sna *HostSubnetAllocator) InitRanges(subnets []config.CIDRNetworkEntry) er
 	return nil
 }
 
+// ReconfigureRanges replaces the ranges node subnets are allocated from, eg to add
+// cluster subnets at runtime. The node subnets already allocated are kept, and it
+// fails without changing anything if any of them is not part of the new ranges.
+func (sna *HostSubnetAllocator) ReconfigureRanges(subnets []config.CIDRNetworkEntry, alignBits int) error {
+	ranges := make([]NetworkRange, 0, len(subnets))
+	for _, entry := range subnets {
+		ranges = append(ranges, NetworkRange{Network: entry.CIDR, HostSubnetLen: entry.HostSubnetLength, AlignBits: alignBits})
+	}
+	if err := sna.base.ReconfigureNetworkRanges(ranges); err != nil {
+		return err
+	}
+	// the caps of the ranges that were added apply as well
+	for cidr, max := range sna.maxNodes {
+		_, network, _ := net.ParseCIDR(cidr)
+		if err := sna.base.SetMaxNetworks(network, max); err != nil {
+			klog.Infof("Cluster subnet %s capped to %d nodes is not configured: %v", cidr, max, err)
+		}
+	}
+	klog.Infof("Reconfigured host subnet allocator ranges to %v", ranges)
+	sna.RecordUsageMetrics()
+	return nil
+}
+
+// SetMaxNodes caps the number of nodes allocated subnets from each of the given cluster
+// subnets, keyed by CIDR, even if the cluster subnet has room for more. The nodes
+// already holding subnets past the cap keep them. The caps are kept when the ranges are
+// reconfigured.
+func (sna *HostSubnetAllocator) SetMaxNodes(maxNodes map[string]int) error {
+	for cidr, max := range maxNodes {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("invalid cluster subnet %q: %v", cidr, err)
+		}
+		if err := sna.base.SetMaxNetworks(network, max); err != nil {
+			return fmt.Errorf("failed to cap the nodes of cluster subnet %s to %d: %w", cidr, max, err)
+		}
+		klog.Infof("Capped the nodes allocated subnets from cluster subnet %s to %d", cidr, max)
+		metrics.RecordClusterSubnetMaxNodes(cidr, max)
+	}
+	sna.maxNodes = maxNodes
+	sna.RecordUsageMetrics()
+	return nil
+}
+
+// RecordUsageMetrics records the number of available and allocated host subnets
+func (sna *HostSubnetAllocator) RecordUsageMetrics() {
+	v4count, v4used, v6count, v6used := sna.base.Usage()
+	metrics.RecordSubnetCount(float64(v4count), float64(v6count))
+	metrics.RecordSubnetUsage(float64(v4used), float64(v6used))
+}
+
+// FreeSubnets returns the number of IPv4 and IPv6 node subnets left to allocate
+func (sna *HostSubnetAllocator) FreeSubnets() (uint64, uint64) {
+	v4count, v4used, v6count, v6used := sna.base.Usage()
+	return v4count - v4used, v6count - v6used
+}
+
+// IsClusterSubnet returns whether subnet is within one of the cluster subnets node
+// subnets are allocated from
+func (sna *HostSubnetAllocator) IsClusterSubnet(subnet *net.IPNet) bool {
+	return sna.base.ContainsNetwork(subnet)
+}
+
+// SubnetOwner returns the node subnet is allocated to, if it is allocated
+func (sna *HostSubnetAllocator) SubnetOwner(subnet *net.IPNet) (string, bool) {
+	return sna.base.NetworkOwner(subnet)
+}
+
 // MarkSubnetsAllocated will mark the given subnets as already allocated by
 // the given owner. Marking is all-or-nothing; if marking one of the subnets
 // fails then none of them are marked as allocated.
@@ -46,9 +135,50 @@ func (sna *HostSubnetAllocator) MarkSubnetsAllocated(nodeName string, subnets ..
 	}
 	_, v4used, _, v6used := sna.base.Usage()
 	metrics.RecordSubnetUsage(float64(v4used), float64(v6used))
+	sna.recordAllocation(nodeName, false)
 	return nil
 }
 
+// recordAllocation records the node got its subnets allocated now, unless an earlier
+// allocation time is known and reset is false
+func (sna *HostSubnetAllocator) recordAllocation(nodeName string, reset bool) {
+	sna.allocatedAtLock.Lock()
+	defer sna.allocatedAtLock.Unlock()
+	if _, ok := sna.allocatedAt[nodeName]; ok && !reset {
+		return
+	}
+	sna.allocatedAt[nodeName] = sna.clock.Now()
+}
+
+// SubnetsAllocatedAt returns the time the node got its current subnets allocated, and
+// false if the node has no subnets allocated
+func (sna *HostSubnetAllocator) SubnetsAllocatedAt(nodeName string) (time.Time, bool) {
+	sna.allocatedAtLock.Lock()
+	defer sna.allocatedAtLock.Unlock()
+	allocatedAt, ok := sna.allocatedAt[nodeName]
+	return allocatedAt, ok
+}
+
+// SetSubnetsAllocatedAt sets the time the node got its current subnets allocated, eg
+// as persisted by a previous run
+func (sna *HostSubnetAllocator) SetSubnetsAllocatedAt(nodeName string, allocatedAt time.Time) {
+	sna.allocatedAtLock.Lock()
+	defer sna.allocatedAtLock.Unlock()
+	sna.allocatedAt[nodeName] = allocatedAt
+}
+
+// SubnetAllocationAges returns how long each node has held its current subnets
+func (sna *HostSubnetAllocator) SubnetAllocationAges() map[string]time.Duration {
+	sna.allocatedAtLock.Lock()
+	defer sna.allocatedAtLock.Unlock()
+	now := sna.clock.Now()
+	ages := make(map[string]time.Duration, len(sna.allocatedAt))
+	for nodeName, allocatedAt := range sna.allocatedAt {
+		ages[nodeName] = now.Sub(allocatedAt)
+	}
+	return ages
+}
+
 // AllocateNodeSubnets either validates existing node subnets against the allocators
 // ranges, or allocates new subnets if the node doesn't have any yet, or returns an error
 func (sna *HostSubnetAllocator) AllocateNodeSubnets(nodeName string, existingSubnets []*net.IPNet, ipv4Mode, ipv6Mode bool) ([]*net.IPNet, []*net.IPNet, error) {
@@ -117,7 +247,7 @@ func (sna *HostSubnetAllocator) AllocateNodeSubnets(nodeName string, existingSub
 	// allocateOneSubnet is a helper to process the result of a subnet allocation
 	allocateOneSubnet := func(allocatedHostSubnet *net.IPNet, allocErr error) error {
 		if allocErr != nil {
-			return fmt.Errorf("error allocating network for node %s: %v", nodeName, allocErr)
+			return fmt.Errorf("error allocating network for node %s: %w", nodeName, allocErr)
 		}
 		// the allocator returns nil if it can't provide a subnet
 		// we should filter them out or they will be appended to the slice
@@ -145,8 +275,8 @@ func (sna *HostSubnetAllocator) AllocateNodeSubnets(nodeName string, existingSub
 	// so it will require a reconfiguration and restart.
 	wantedSubnets := expectedHostSubnets - len(existingSubnets)
 	if wantedSubnets > 0 && len(allocatedSubnets) != wantedSubnets {
-		return nil, nil, fmt.Errorf("error allocating networks for node %s: %d subnets expected only new %d subnets allocated",
-			nodeName, expectedHostSubnets, len(allocatedSubnets))
+		return nil, nil, fmt.Errorf("error allocating networks for node %s: %d subnets expected only new %d subnets allocated: %w",
+			nodeName, expectedHostSubnets, len(allocatedSubnets), ErrSubnetRangeNotConfigured)
 	}
 
 	_, v4used, _, v6used := sna.base.Usage()
@@ -157,9 +287,97 @@ func (sna *HostSubnetAllocator) AllocateNodeSubnets(nodeName string, existingSub
 
 	// Success; prevent the release-on-error from triggering and return all node subnets
 	releaseAllocatedSubnets = false
+	sna.recordAllocation(nodeName, len(allocatedSubnets) > 0)
 	return hostSubnets, allocatedSubnets, nil
 }
 
+// PeekNextSubnet returns the subnets of the given IP families AllocateNodeSubnets would
+// allocate next to a node without subnets, without allocating them
+func (sna *HostSubnetAllocator) PeekNextSubnet(ipv4, ipv6 bool) ([]*net.IPNet, error) {
+	subnets := []*net.IPNet{}
+	if ipv4 {
+		subnet, err := sna.base.PeekIPv4Network()
+		if err != nil {
+			return nil, fmt.Errorf("error peeking at the next IPv4 network: %w", err)
+		}
+		if subnet != nil {
+			subnets = append(subnets, subnet)
+		}
+	}
+	if ipv6 {
+		subnet, err := sna.base.PeekIPv6Network()
+		if err != nil {
+			return nil, fmt.Errorf("error peeking at the next IPv6 network: %w", err)
+		}
+		if subnet != nil {
+			subnets = append(subnets, subnet)
+		}
+	}
+	return subnets, nil
+}
+
+// SimulationResult is the outcome of a simulated allocation of node subnets
+type SimulationResult struct {
+	// Nodes is the number of nodes that got all the subnets they needed
+	Nodes int
+	// ExhaustedFamily is the IP family, "IPv4" or "IPv6", that ran out of subnets
+	// first, or empty if all the nodes fit
+	ExhaustedFamily string
+	// LastSubnets are the subnets of the last node that fit, nil if none did
+	LastSubnets []*net.IPNet
+}
+
+// SimulateAllocation simulates allocating subnets of the given IP families to nodeCount
+// new nodes, to check that the cluster subnets can accommodate them. It allocates from a
+// copy of the allocator, so the subnets already allocated are taken into account but
+// nothing is actually allocated, and no metrics are recorded.
+func (sna *HostSubnetAllocator) SimulateAllocation(nodeCount int, ipv4, ipv6 bool) (*SimulationResult, error) {
+	if !ipv4 && !ipv6 {
+		return nil, fmt.Errorf("no IP family to simulate the allocation of node subnets for")
+	}
+	v4count, _, v6count, _ := sna.base.Usage()
+	if ipv4 && v4count == 0 {
+		return nil, fmt.Errorf("no IPv4 cluster subnet to simulate the allocation of node subnets from")
+	}
+	if ipv6 && v6count == 0 {
+		return nil, fmt.Errorf("no IPv6 cluster subnet to simulate the allocation of node subnets from")
+	}
+
+	base := sna.base.Clone()
+	result := &SimulationResult{}
+	for i := 0; i < nodeCount; i++ {
+		nodeName := fmt.Sprintf("simulated-node-%d", i)
+		subnets := []*net.IPNet{}
+		if ipv4 {
+			subnet, err := base.AllocateIPv4Network(nodeName)
+			if err == ErrSubnetAllocatorFull {
+				result.ExhaustedFamily = "IPv4"
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("error allocating an IPv4 network for simulated node %d: %w", i, err)
+			}
+			subnets = append(subnets, subnet)
+		}
+		if ipv6 {
+			subnet, err := base.AllocateIPv6Network(nodeName)
+			if err == ErrSubnetAllocatorFull {
+				result.ExhaustedFamily = "IPv6"
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("error allocating an IPv6 network for simulated node %d: %w", i, err)
+			}
+			subnets = append(subnets, subnet)
+		}
+		result.Nodes++
+		result.LastSubnets = subnets
+	}
+	if result.ExhaustedFamily != "" {
+		klog.Infof("Simulated node subnet allocation: %d of %d nodes fit, %s subnets exhausted after %v",
+			result.Nodes, nodeCount, result.ExhaustedFamily, result.LastSubnets)
+	}
+	return result, nil
+}
+
 func (sna *HostSubnetAllocator) ReleaseNodeSubnets(nodeName string, subnets ...*net.IPNet) error {
 	err := sna.base.ReleaseNetworks(nodeName, subnets...)
 	_, v4used, _, v6used := sna.base.Usage()
@@ -167,8 +385,20 @@ func (sna *HostSubnetAllocator) ReleaseNodeSubnets(nodeName string, subnets ...*
 	return err
 }
 
-func (sna *HostSubnetAllocator) ReleaseAllNodeSubnets(nodeName string) {
-	sna.base.ReleaseAllNetworks(nodeName)
+// DefragmentSubnets returns the node subnet moves that would leave the free subnets of
+// each cluster subnet contiguous, eg to make room for a larger host subnet length.
+// Nothing is moved: migrating nodes to their planned subnets is left to the admin.
+func (sna *HostSubnetAllocator) DefragmentSubnets() []SubnetMove {
+	return sna.base.DefragmentationPlan()
+}
+
+// ReleaseAllNodeSubnets releases all the subnets allocated to the node and returns them
+func (sna *HostSubnetAllocator) ReleaseAllNodeSubnets(nodeName string) []*net.IPNet {
+	released := sna.base.ReleaseAllNetworks(nodeName)
 	_, v4used, _, v6used := sna.base.Usage()
 	metrics.RecordSubnetUsage(float64(v4used), float64(v6used))
+	sna.allocatedAtLock.Lock()
+	defer sna.allocatedAtLock.Unlock()
+	delete(sna.allocatedAt, nodeName)
+	return released
 }
@@ -1,13 +1,19 @@
 package subnetallocator
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/config"
+	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/metrics"
 	ovntest "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/testing"
+
+	dto "github.com/prometheus/client_model/go"
+	clocktesting "k8s.io/utils/clock/testing"
 )
 
 func rangesFromStrings(ranges []string, networkLens []int) ([]config.CIDRNetworkEntry, error) {
@@ -253,6 +259,22 @@ func TestController_allocateNodeSubnets(t *testing.T) {
 	}
 }
 
+func TestController_allocateNodeSubnets_RangeNotConfigured(t *testing.T) {
+	sna := NewHostSubnetAllocator()
+	ranges, err := rangesFromStrings([]string{"2001:db2::/64"}, []int{112})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sna.InitRanges(ranges); err != nil {
+		t.Fatalf("Failed to initialize network ranges: %v", err)
+	}
+
+	_, _, err = sna.AllocateNodeSubnets("testnode", nil, true, false)
+	if !errors.Is(err, ErrSubnetRangeNotConfigured) {
+		t.Fatalf("Expected an error wrapping %v, got %v", ErrSubnetRangeNotConfigured, err)
+	}
+}
+
 func TestController_allocateNodeSubnets_ReleaseOnError(t *testing.T) {
 	ranges, err := rangesFromStrings([]string{"172.16.0.0/16", "2000::/127"}, []int{24, 127})
 	if err != nil {
@@ -408,3 +430,349 @@ func TestController_markSubnetsAllocated(t *testing.T) {
 		})
 	}
 }
+
+func TestHostSubnetAllocator_PeekNextSubnet(t *testing.T) {
+	tests := []struct {
+		name          string
+		networkRanges []string
+		networkLens   []int
+		configIPv4    bool
+		configIPv6    bool
+		allocations   int
+	}{
+		{
+			name:          "IPv4 only cluster",
+			networkRanges: []string{"172.16.0.0/22"},
+			networkLens:   []int{24},
+			configIPv4:    true,
+			allocations:   4,
+		},
+		{
+			name:          "IPv6 only cluster",
+			networkRanges: []string{"2001:db2::/62"},
+			networkLens:   []int{64},
+			configIPv6:    true,
+			allocations:   4,
+		},
+		{
+			name:          "dual stack cluster",
+			networkRanges: []string{"172.16.0.0/22", "2001:db2::/62"},
+			networkLens:   []int{24, 64},
+			configIPv4:    true,
+			configIPv6:    true,
+			allocations:   4,
+		},
+		{
+			name:          "several cluster subnets",
+			networkRanges: []string{"172.16.0.0/23", "172.17.0.0/23"},
+			networkLens:   []int{24, 24},
+			configIPv4:    true,
+			allocations:   4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sna := NewHostSubnetAllocator()
+			ranges, err := rangesFromStrings(tt.networkRanges, tt.networkLens)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := sna.InitRanges(ranges); err != nil {
+				t.Fatalf("Failed to initialize network ranges: %v", err)
+			}
+
+			for i := 0; i < tt.allocations; i++ {
+				peeked, err := sna.PeekNextSubnet(tt.configIPv4, tt.configIPv6)
+				if err != nil {
+					t.Fatalf("PeekNextSubnet() error = %v", err)
+				}
+				nodeName := fmt.Sprintf("node%d", i)
+				allocated, _, err := sna.AllocateNodeSubnets(nodeName, nil, tt.configIPv4, tt.configIPv6)
+				if err != nil {
+					t.Fatalf("AllocateNodeSubnets() error = %v", err)
+				}
+				if !reflect.DeepEqual(peeked, allocated) {
+					t.Fatalf("Peeked at %v but node %s got %v", peeked, nodeName, allocated)
+				}
+			}
+
+			// with all subnets allocated, peeking fails like allocating would
+			if _, err := sna.PeekNextSubnet(tt.configIPv4, tt.configIPv6); err == nil {
+				t.Fatalf("PeekNextSubnet() unexpectedly succeeded with no free subnet")
+			}
+			if _, _, err := sna.AllocateNodeSubnets("nodeFull", nil, tt.configIPv4, tt.configIPv6); err == nil {
+				t.Fatalf("AllocateNodeSubnets() unexpectedly succeeded with no free subnet")
+			}
+		})
+	}
+}
+
+func TestHostSubnetAllocator_SubnetAllocationAges(t *testing.T) {
+	start := time.Date(2022, 11, 4, 10, 0, 0, 0, time.UTC)
+	fakeClock := clocktesting.NewFakeClock(start)
+	sna := NewHostSubnetAllocator()
+	sna.clock = fakeClock
+	ranges, err := rangesFromStrings([]string{"172.16.0.0/16", "2001:db2::/56"}, []int{24, 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sna.InitRanges(ranges); err != nil {
+		t.Fatalf("Failed to initialize network ranges: %v", err)
+	}
+	expectAges := func(expected map[string]time.Duration) {
+		t.Helper()
+		if ages := sna.SubnetAllocationAges(); !reflect.DeepEqual(ages, expected) {
+			t.Fatalf("Expected allocation ages %v, got %v", expected, ages)
+		}
+	}
+
+	// node1 gets new subnets, node2 had its subnets before
+	if _, _, err := sna.AllocateNodeSubnets("node1", nil, true, false); err != nil {
+		t.Fatalf("Failed to allocate subnets of node1: %v", err)
+	}
+	if err := sna.MarkSubnetsAllocated("node2", ovntest.MustParseIPNet("172.16.10.0/24")); err != nil {
+		t.Fatalf("Failed to mark subnets of node2 allocated: %v", err)
+	}
+	fakeClock.Step(time.Hour)
+	expectAges(map[string]time.Duration{"node1": time.Hour, "node2": time.Hour})
+
+	// re-validating the subnets of a node or restoring its persisted allocation time does
+	// not reset its age
+	existing := ovntest.MustParseIPNets("172.16.10.0/24")
+	if _, allocated, err := sna.AllocateNodeSubnets("node2", existing, true, false); err != nil || len(allocated) != 0 {
+		t.Fatalf("Failed to keep the subnets of node2: %v, allocated %v", err, allocated)
+	}
+	sna.SetSubnetsAllocatedAt("node1", start.Add(-time.Hour))
+	fakeClock.Step(time.Hour)
+	expectAges(map[string]time.Duration{"node1": 3 * time.Hour, "node2": 2 * time.Hour})
+
+	// new subnets do, even if the node keeps some of its subnets
+	if _, allocated, err := sna.AllocateNodeSubnets("node2", existing, true, true); err != nil || len(allocated) != 1 {
+		t.Fatalf("Failed to allocate an IPv6 subnet to node2: %v, allocated %v", err, allocated)
+	}
+	allocatedAt, ok := sna.SubnetsAllocatedAt("node2")
+	if !ok || !allocatedAt.Equal(fakeClock.Now()) {
+		t.Fatalf("Expected node2 subnets allocated at %v, got %v (%t)", fakeClock.Now(), allocatedAt, ok)
+	}
+	fakeClock.Step(time.Minute)
+	expectAges(map[string]time.Duration{"node1": 3*time.Hour + time.Minute, "node2": time.Minute})
+
+	if released := sna.ReleaseAllNodeSubnets("node1"); len(released) != 1 {
+		t.Fatalf("Expected the single subnet of node1 to be released, got %v", released)
+	}
+	if _, ok := sna.SubnetsAllocatedAt("node1"); ok {
+		t.Fatalf("Expected no allocation time for node1 after releasing its subnets")
+	}
+	expectAges(map[string]time.Duration{"node2": time.Minute})
+}
+
+func TestHostSubnetAllocator_SimulateAllocation(t *testing.T) {
+	tests := []struct {
+		name          string
+		networkRanges []string
+		networkLens   []int
+		configIPv4    bool
+		configIPv6    bool
+		existingNodes int
+		nodeCount     int
+		wantNodes     int
+		wantExhausted string
+		wantLast      []string
+		wantErr       bool
+	}{
+		{
+			name:          "small IPv4 cluster subnet",
+			networkRanges: []string{"172.16.0.0/22"},
+			networkLens:   []int{24},
+			configIPv4:    true,
+			nodeCount:     10,
+			wantNodes:     4,
+			wantExhausted: "IPv4",
+			wantLast:      []string{"172.16.3.0/24"},
+		},
+		{
+			name:          "large IPv4 cluster subnet",
+			networkRanges: []string{"10.128.0.0/14"},
+			networkLens:   []int{23},
+			configIPv4:    true,
+			nodeCount:     500,
+			wantNodes:     500,
+		},
+		{
+			name:          "exactly as many IPv4 subnets as nodes",
+			networkRanges: []string{"10.128.0.0/14"},
+			networkLens:   []int{23},
+			configIPv4:    true,
+			nodeCount:     513,
+			wantNodes:     512,
+			wantExhausted: "IPv4",
+		},
+		{
+			name:          "IPv6 cluster subnet",
+			networkRanges: []string{"2001:db2::/62"},
+			networkLens:   []int{64},
+			configIPv6:    true,
+			nodeCount:     5,
+			wantNodes:     4,
+			wantExhausted: "IPv6",
+			wantLast:      []string{"2001:db2:0:3::/64"},
+		},
+		{
+			name:          "dual stack cluster with a smaller IPv6 cluster subnet",
+			networkRanges: []string{"172.16.0.0/22", "2001:db2::/63"},
+			networkLens:   []int{24, 64},
+			configIPv4:    true,
+			configIPv6:    true,
+			nodeCount:     4,
+			wantNodes:     2,
+			wantExhausted: "IPv6",
+			wantLast:      []string{"172.16.1.0/24", "2001:db2:0:1::/64"},
+		},
+		{
+			name:          "several cluster subnets",
+			networkRanges: []string{"172.16.0.0/23", "172.17.0.0/23"},
+			networkLens:   []int{24, 24},
+			configIPv4:    true,
+			nodeCount:     4,
+			wantNodes:     4,
+			wantLast:      []string{"172.17.1.0/24"},
+		},
+		{
+			name:          "subnets already allocated",
+			networkRanges: []string{"172.16.0.0/22"},
+			networkLens:   []int{24},
+			configIPv4:    true,
+			existingNodes: 3,
+			nodeCount:     2,
+			wantNodes:     1,
+			wantExhausted: "IPv4",
+			wantLast:      []string{"172.16.3.0/24"},
+		},
+		{
+			name:          "no cluster subnet of a family",
+			networkRanges: []string{"172.16.0.0/22"},
+			networkLens:   []int{24},
+			configIPv4:    true,
+			configIPv6:    true,
+			nodeCount:     1,
+			wantErr:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sna := NewHostSubnetAllocator()
+			ranges, err := rangesFromStrings(tt.networkRanges, tt.networkLens)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := sna.InitRanges(ranges); err != nil {
+				t.Fatalf("Failed to initialize network ranges: %v", err)
+			}
+			for i := 0; i < tt.existingNodes; i++ {
+				if _, _, err := sna.AllocateNodeSubnets(fmt.Sprintf("node%d", i), nil, tt.configIPv4, tt.configIPv6); err != nil {
+					t.Fatalf("AllocateNodeSubnets() error = %v", err)
+				}
+			}
+			freeV4, freeV6 := sna.FreeSubnets()
+
+			result, err := sna.SimulateAllocation(tt.nodeCount, tt.configIPv4, tt.configIPv6)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SimulateAllocation() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if result.Nodes != tt.wantNodes || result.ExhaustedFamily != tt.wantExhausted {
+				t.Fatalf("Expected %d nodes to fit with %q exhausted, got %d with %q exhausted",
+					tt.wantNodes, tt.wantExhausted, result.Nodes, result.ExhaustedFamily)
+			}
+			if tt.wantLast != nil && !reflect.DeepEqual(result.LastSubnets, ovntest.MustParseIPNets(tt.wantLast...)) {
+				t.Fatalf("Expected the last node to get %v, got %v", tt.wantLast, result.LastSubnets)
+			}
+
+			// nothing is allocated for real
+			if v4, v6 := sna.FreeSubnets(); v4 != freeV4 || v6 != freeV6 {
+				t.Fatalf("Expected %d/%d free subnets after the simulation, got %d/%d", freeV4, freeV6, v4, v6)
+			}
+			if tt.wantNodes > 0 {
+				peeked, err := sna.PeekNextSubnet(tt.configIPv4, tt.configIPv6)
+				if err != nil {
+					t.Fatalf("PeekNextSubnet() error = %v", err)
+				}
+				if _, owned := sna.SubnetOwner(peeked[0]); owned {
+					t.Fatalf("Expected subnet %v to be free after the simulation", peeked[0])
+				}
+			}
+		})
+	}
+}
+
+func TestHostSubnetAllocator_SetMaxNodes(t *testing.T) {
+	sna := NewHostSubnetAllocator()
+	ranges, err := rangesFromStrings([]string{"172.16.0.0/22", "172.17.0.0/23", "2001:db2::/56"}, []int{24, 24, 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sna.InitRanges(ranges); err != nil {
+		t.Fatalf("Failed to initialize network ranges: %v", err)
+	}
+	if err := sna.SetMaxNodes(map[string]int{"10.0.0.0/16": 1}); err == nil {
+		t.Fatalf("SetMaxNodes() unexpectedly succeeded for a network that isn't a cluster subnet")
+	}
+	maxNodes := map[string]int{"172.16.0.0/22": 1, "2001:db2::/56": 2}
+	if err := sna.SetMaxNodes(maxNodes); err != nil {
+		t.Fatalf("SetMaxNodes() error = %v", err)
+	}
+	for cidr, max := range maxNodes {
+		metric := &dto.Metric{}
+		if err := metrics.MetricClusterSubnetMaxNodes.WithLabelValues(cidr).Write(metric); err != nil {
+			t.Fatal(err)
+		}
+		if metric.GetGauge().GetValue() != float64(max) {
+			t.Fatalf("expected the max nodes of %s to be recorded as %d, got %v", cidr, max, metric.GetGauge().GetValue())
+		}
+	}
+	if v4free, v6free := sna.FreeSubnets(); v4free != 3 || v6free != 2 {
+		t.Fatalf("expected 3 IPv4 and 2 IPv6 free subnets, got %d and %d", v4free, v6free)
+	}
+
+	// the capped IPv4 subnet takes a single node, the others go to the next one
+	for i, expected := range []string{"172.16.0.0/24", "172.17.0.0/24", "172.17.1.0/24"} {
+		nodeName := fmt.Sprintf("node%d", i)
+		allocated, _, err := sna.AllocateNodeSubnets(nodeName, nil, true, false)
+		if err != nil {
+			t.Fatalf("AllocateNodeSubnets(%s) error = %v", nodeName, err)
+		}
+		if len(allocated) != 1 || allocated[0].String() != expected {
+			t.Fatalf("expected node %s to get %s, got %v", nodeName, expected, allocated)
+		}
+	}
+	// refused past the cap though addresses remain
+	if _, _, err := sna.AllocateNodeSubnets("node3", nil, true, false); err == nil {
+		t.Fatalf("AllocateNodeSubnets() unexpectedly succeeded past the cap")
+	}
+	for i := 0; i < 2; i++ {
+		if _, _, err := sna.AllocateNodeSubnets(fmt.Sprintf("v6node%d", i), nil, false, true); err != nil {
+			t.Fatalf("AllocateNodeSubnets() error = %v", err)
+		}
+	}
+	if _, _, err := sna.AllocateNodeSubnets("v6node2", nil, false, true); err == nil {
+		t.Fatalf("AllocateNodeSubnets() unexpectedly succeeded past the IPv6 cap")
+	}
+
+	// the caps are kept when the ranges are reconfigured
+	ranges, err = rangesFromStrings([]string{"172.16.0.0/22", "2001:db2::/56"}, []int{24, 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sna.ReleaseAllNodeSubnets("node1")
+	sna.ReleaseAllNodeSubnets("node2")
+	if err := sna.ReconfigureRanges(ranges, 0); err != nil {
+		t.Fatalf("ReconfigureRanges() error = %v", err)
+	}
+	if _, _, err := sna.AllocateNodeSubnets("node3", nil, true, false); err == nil {
+		t.Fatalf("AllocateNodeSubnets() unexpectedly succeeded past the cap after reconfiguring the ranges")
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"strconv"
 
 	globalconfig "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/config"
+	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/metrics"
 	addressset "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/ovn/address_set"
 	ovntypes "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/types"
 
+	kapi "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	corev1apply "k8s.io/client-go/applyconfigurations/core/v1"
@@ -28,6 +30,21 @@ func (oc *DefaultNetworkController) ovnTopologyCleanup() error {
 	return err
 }
 
+// reportTopologyUpgrade lets operators know, with an event on the topology status ConfigMap
+// and a metric, that the OVN topology is about to be upgraded from the given version
+func (oc *DefaultNetworkController) reportTopologyUpgrade(fromVersion int) {
+	toVersion := ovntypes.OvnCurrentTopologyVersion
+	klog.Infof("Upgrading the OVN topology from version %d to version %d", fromVersion, toVersion)
+	cmRef := &kapi.ObjectReference{
+		Kind:      "ConfigMap",
+		Namespace: globalconfig.Kubernetes.OVNConfigNamespace,
+		Name:      ovntypes.OvnK8sStatusCMName,
+	}
+	oc.recorder.Eventf(cmRef, kapi.EventTypeNormal, "TopologyUpgrade",
+		"Upgrading the OVN topology from version %d to version %d", fromVersion, toVersion)
+	metrics.RecordTopologyUpgrade(fromVersion, toVersion)
+}
+
 // reportTopologyVersion saves the topology version to two places:
 // - an ExternalID on the ovn_cluster_router LogicalRouter in nbdb
 // - a ConfigMap. This is used by nodes to determine the cluster's topology
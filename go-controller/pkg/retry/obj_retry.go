@@ -1,14 +1,19 @@
 package retry
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand"
+	"os"
 	"reflect"
+	"sort"
 	"sync"
 	"time"
 
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/tools/cache"
 
 	"k8s.io/klog/v2"
@@ -22,6 +27,9 @@ const MaxFailedAttempts = 15 // same value used for the services level-driven co
 const initialBackoff = 1
 const noBackoff = 0
 
+// errNotScheduled is the error recorded for objects whose retry was attempted before they were scheduled
+var errNotScheduled = errors.New("not scheduled")
+
 // retryObjEntry is a generic object caching with retry mechanism
 // that resources can use to eventually complete their intended operations.
 type retryObjEntry struct {
@@ -36,6 +44,8 @@ type retryObjEntry struct {
 	backoffSec time.Duration
 	// number of times this object has been unsuccessfully added/updated/deleted
 	failedAttempts uint8
+	// error of the last unsuccessful add/update/delete
+	lastErr error
 }
 
 type EventHandler interface {
@@ -81,6 +91,17 @@ type RetryFramework struct {
 	watchFactory      *factory.WatchFactory
 	ResourceHandler   *ResourceHandler
 	terminatedObjects sync.Map
+
+	// file the keys of objects pending retry are persisted to, if any
+	persistPath string
+	// keys of the objects pending an add or update retry, as saved in persistPath
+	persistedKeys sets.String
+	persistLock   sync.Mutex
+
+	// number of failed attempts after which an object is no longer retried
+	maxFailedAttempts uint8
+	// objects that exhausted their attempts since their last event, by key
+	deadLetters sync.Map
 }
 
 // NewRetryFramework returns a new RetryFramework instance, essential for the whole retry logic.
@@ -100,9 +121,16 @@ func NewRetryFramework(
 		doneWg:            doneWg,
 		ResourceHandler:   resourceHandler,
 		terminatedObjects: sync.Map{},
+		maxFailedAttempts: MaxFailedAttempts,
 	}
 }
 
+// SetMaxFailedAttempts sets the number of failed attempts after which an object is given
+// up on and moved to the dead-letter set, instead of the default MaxFailedAttempts
+func (r *RetryFramework) SetMaxFailedAttempts(maxFailedAttempts uint8) {
+	r.maxFailedAttempts = maxFailedAttempts
+}
+
 func (r *RetryFramework) DoWithLock(key string, f func(key string)) {
 	r.retryEntries.LockKey(key)
 	defer r.retryEntries.UnlockKey(key)
@@ -115,7 +143,9 @@ func (r *RetryFramework) initRetryObjWithAddBackoff(obj interface{}, lockedKey s
 	entry.timeStamp = time.Now()
 	entry.newObj = obj
 	entry.failedAttempts = 0
+	entry.lastErr = nil
 	entry.backoffSec = backoff
+	r.deadLetters.Delete(lockedKey)
 	return entry
 }
 
@@ -133,6 +163,8 @@ func (r *RetryFramework) initRetryObjWithUpdate(oldObj, newObj interface{}, lock
 	entry.newObj = newObj
 	entry.config = oldObj
 	entry.failedAttempts = 0
+	entry.lastErr = nil
+	r.deadLetters.Delete(lockedKey)
 	return entry
 }
 
@@ -150,6 +182,8 @@ func (r *RetryFramework) InitRetryObjWithDelete(obj interface{}, lockedKey strin
 		entry.config = config
 	}
 	entry.failedAttempts = 0
+	entry.lastErr = nil
+	r.deadLetters.Delete(lockedKey)
 	if noRetryAdd {
 		// will not be retried for addition
 		entry.newObj = nil
@@ -176,6 +210,7 @@ func (r *RetryFramework) getRetryObj(lockedKey string) (value *retryObjEntry, fo
 
 func (r *RetryFramework) DeleteRetryObj(lockedKey string) {
 	r.retryEntries.Delete(lockedKey)
+	r.setRetryObjPersisted(lockedKey, false)
 }
 
 // setRetryObjWithNoBackoff sets an object's backoff to be retried
@@ -192,9 +227,208 @@ func (r *RetryFramework) removeDeleteFromRetryObj(entry *retryObjEntry) {
 }
 
 // increaseFailedAttemptsCounter increases by one the counter of failed add/update/delete attempts
-// for the given key
-func (r *RetryFramework) increaseFailedAttemptsCounter(entry *retryObjEntry) {
+// for the given key and records the error the attempt failed with
+func (r *RetryFramework) increaseFailedAttemptsCounter(lockedKey string, entry *retryObjEntry, err error) {
 	entry.failedAttempts++
+	entry.lastErr = err
+	r.setRetryObjPersisted(lockedKey, entry.newObj != nil)
+}
+
+// FailedObj is an object whose add, update or delete failed and is pending retry
+type FailedObj struct {
+	// Key is the key of the object, as returned by GetResourceKey
+	Key string
+	// FailedAttempts is the number of failed attempts since the last event for the object
+	FailedAttempts int
+	// LastError is the error the last attempt failed with
+	LastError error
+}
+
+// GetFailedObjs returns the objects in the retry cache that failed at least once, sorted by key
+func (r *RetryFramework) GetFailedObjs() []FailedObj {
+	failed := []FailedObj{}
+	for _, key := range r.retryEntries.GetKeys() {
+		r.DoWithLock(key, func(key string) {
+			entry, found := r.getRetryObj(key)
+			if !found || entry.failedAttempts == 0 {
+				return
+			}
+			failed = append(failed, FailedObj{
+				Key:            key,
+				FailedAttempts: int(entry.failedAttempts),
+				LastError:      entry.lastErr,
+			})
+		})
+	}
+	sort.Slice(failed, func(i, j int) bool { return failed[i].Key < failed[j].Key })
+	return failed
+}
+
+// BackoffState is the retry backoff of an object in the retry cache
+type BackoffState struct {
+	// Key is the key of the object, as returned by GetResourceKey
+	Key string
+	// FailedAttempts is the number of failed attempts since the last event for the object
+	FailedAttempts int
+	// Backoff is how long after its last attempt the object is retried, 0 if it is
+	// retried during the next retry iteration
+	Backoff time.Duration
+	// NextRetry is the earliest time the object is retried at, up to half a second of
+	// jitter is added to it
+	NextRetry time.Time
+}
+
+// GetBackoffStates returns the backoff state of the objects in the retry cache, sorted by key
+func (r *RetryFramework) GetBackoffStates() []BackoffState {
+	states := []BackoffState{}
+	for _, key := range r.retryEntries.GetKeys() {
+		r.DoWithLock(key, func(key string) {
+			entry, found := r.getRetryObj(key)
+			if !found {
+				return
+			}
+			// the backoff is doubled ahead of each attempt, so it is already the one
+			// of the next attempt
+			backoff := entry.backoffSec * time.Second
+			states = append(states, BackoffState{
+				Key:            key,
+				FailedAttempts: int(entry.failedAttempts),
+				Backoff:        backoff,
+				NextRetry:      entry.timeStamp.Add(backoff),
+			})
+		})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Key < states[j].Key })
+	return states
+}
+
+// GetDeadLetterObjs returns the objects that were given up on after exhausting their
+// failed attempts, and have not had a new event since, sorted by key
+func (r *RetryFramework) GetDeadLetterObjs() []FailedObj {
+	deadLetters := []FailedObj{}
+	r.deadLetters.Range(func(_, value interface{}) bool {
+		deadLetters = append(deadLetters, value.(FailedObj))
+		return true
+	})
+	sort.Slice(deadLetters, func(i, j int) bool { return deadLetters[i].Key < deadLetters[j].Key })
+	return deadLetters
+}
+
+// giveUpRetryObj drops the retry entry of an object that exhausted its failed attempts,
+// moves the object to the dead-letter set and records an error event for it
+func (r *RetryFramework) giveUpRetryObj(lockedKey string, entry *retryObjEntry) {
+	klog.Warningf("Dropping retry entry for %s %s: exceeded number of failed attempts",
+		r.ResourceHandler.ObjType, lockedKey)
+	r.deadLetters.Store(lockedKey, FailedObj{
+		Key:            lockedKey,
+		FailedAttempts: int(entry.failedAttempts),
+		LastError:      entry.lastErr,
+	})
+	obj := entry.newObj
+	if obj == nil {
+		obj = entry.oldObj
+	}
+	if obj != nil {
+		r.ResourceHandler.RecordErrorEvent(obj, "RetryGaveUp",
+			fmt.Errorf("gave up after %d failed attempts: %v", entry.failedAttempts, entry.lastErr))
+	}
+	r.DeleteRetryObj(lockedKey)
+}
+
+// EnablePersistence makes the retry framework save the keys of the objects whose add or
+// update failed to the given file as they start or stop failing, so that they are retried
+// again as soon as the resource is watched after a restart instead of waiting for their
+// backoff. The keys already saved in the file are loaded, an error is returned if they can't.
+func (r *RetryFramework) EnablePersistence(path string) error {
+	r.persistLock.Lock()
+	defer r.persistLock.Unlock()
+	r.persistPath = path
+	r.persistedKeys = sets.NewString()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read %s retry keys from %s: %v", r.ResourceHandler.ObjType, path, err)
+	}
+	persisted := persistedRetryObjs{}
+	if err := json.Unmarshal(data, &persisted); err != nil {
+		return fmt.Errorf("failed to unmarshal %s retry keys from %s: %v", r.ResourceHandler.ObjType, path, err)
+	}
+	r.persistedKeys.Insert(persisted.Keys...)
+	return nil
+}
+
+// persistedRetryObjs is the content of the retry persistence file. Only object keys are
+// saved, the objects themselves are added again from the informer cache on startup.
+type persistedRetryObjs struct {
+	Keys []string `json:"keys"`
+}
+
+// setRetryObjPersisted adds the given key to the persisted keys, or removes it, and saves them
+// if they changed. Objects pending only a delete are not saved, since stale objects are already
+// cleaned up by the resource sync function on startup. Failing to save is only logged, since it
+// doesn't prevent objects from being retried.
+func (r *RetryFramework) setRetryObjPersisted(lockedKey string, persisted bool) {
+	r.persistLock.Lock()
+	defer r.persistLock.Unlock()
+	if r.persistPath == "" || r.persistedKeys.Has(lockedKey) == persisted {
+		return
+	}
+	if persisted {
+		r.persistedKeys.Insert(lockedKey)
+	} else {
+		r.persistedKeys.Delete(lockedKey)
+	}
+	if err := r.savePersistedKeys(); err != nil {
+		klog.Warningf("Failed to persist retry cache: %v", err)
+	}
+}
+
+// savePersistedKeys writes the persisted keys to the persistence file, it must be called
+// with persistLock held
+func (r *RetryFramework) savePersistedKeys() error {
+	data, err := json.Marshal(&persistedRetryObjs{Keys: r.persistedKeys.List()})
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s retry keys: %v", r.ResourceHandler.ObjType, err)
+	}
+	// write to a temporary file first so that a crash never leaves a partial file behind
+	tmpPath := r.persistPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s retry keys to %s: %v", r.ResourceHandler.ObjType, tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, r.persistPath); err != nil {
+		return fmt.Errorf("failed to rename %s to %s: %v", tmpPath, r.persistPath, err)
+	}
+	return nil
+}
+
+// ReloadRetryObjs is called once the initial add of the existing objects is done and requests
+// an immediate retry of the persisted objects that are still pending an add or update retry,
+// returning how many there are. Objects that are in sync by now, or that were deleted, are
+// no longer persisted.
+func (r *RetryFramework) ReloadRetryObjs() int {
+	r.persistLock.Lock()
+	keys := r.persistedKeys.List()
+	r.persistLock.Unlock()
+	pending := 0
+	for _, key := range keys {
+		r.DoWithLock(key, func(key string) {
+			entry, found := r.getRetryObj(key)
+			if !found || entry.newObj == nil {
+				klog.V(5).Infof("Persisted %s %s is no longer pending retry, not retrying it",
+					r.ResourceHandler.ObjType, key)
+				r.setRetryObjPersisted(key, false)
+				return
+			}
+			r.setRetryObjWithNoBackoff(entry)
+			pending++
+		})
+	}
+	if pending > 0 {
+		r.RequestRetryObjs()
+	}
+	return pending
 }
 
 // RequestRetryFramework allows a caller to immediately request to iterate through all objects that
@@ -227,10 +461,8 @@ func (r *RetryFramework) resourceRetry(objKey string, now time.Time) {
 			return
 		}
 
-		if entry.failedAttempts >= MaxFailedAttempts {
-			klog.Warningf("Dropping retry entry for %s %s: exceeded number of failed attempts",
-				r.ResourceHandler.ObjType, objKey)
-			r.DeleteRetryObj(key)
+		if entry.failedAttempts >= r.maxFailedAttempts {
+			r.giveUpRetryObj(key, entry)
 			return
 		}
 		forceRetry := false
@@ -284,7 +516,7 @@ func (r *RetryFramework) resourceRetry(objKey string, now time.Time) {
 			if err := r.ResourceHandler.UpdateResource(entry.config, entry.newObj, true); err != nil {
 				klog.Infof("%v retry update failed for %s, will try again later: %v", r.ResourceHandler.ObjType, objKey, err)
 				entry.timeStamp = time.Now()
-				entry.failedAttempts++
+				r.increaseFailedAttemptsCounter(key, entry, err)
 				return
 			}
 			// successfully cleaned up new and old object, remove it from the retry cache
@@ -297,7 +529,7 @@ func (r *RetryFramework) resourceRetry(objKey string, now time.Time) {
 					r.ResourceHandler.ObjType, objKey, entry.failedAttempts)
 				if !r.ResourceHandler.IsResourceScheduled(entry.oldObj) {
 					klog.V(5).Infof("Retry: %s %s not scheduled", r.ResourceHandler.ObjType, objKey)
-					entry.failedAttempts++
+					r.increaseFailedAttemptsCounter(key, entry, errNotScheduled)
 					return
 				}
 				if err := r.ResourceHandler.DeleteResource(entry.oldObj, entry.config); err != nil {
@@ -305,7 +537,7 @@ func (r *RetryFramework) resourceRetry(objKey string, now time.Time) {
 						r.ResourceHandler.ObjType, objKey, err)
 
 					entry.timeStamp = time.Now()
-					entry.failedAttempts++
+					r.increaseFailedAttemptsCounter(key, entry, err)
 					return
 				}
 				// successfully cleaned up old object, remove it from the retry cache
@@ -317,13 +549,13 @@ func (r *RetryFramework) resourceRetry(objKey string, now time.Time) {
 				klog.Infof("Adding new object: %s %s", r.ResourceHandler.ObjType, objKey)
 				if !r.ResourceHandler.IsResourceScheduled(entry.newObj) {
 					klog.V(5).Infof("Retry: %s %s not scheduled", r.ResourceHandler.ObjType, objKey)
-					entry.failedAttempts++
+					r.increaseFailedAttemptsCounter(key, entry, errNotScheduled)
 					return
 				}
 				if err := r.ResourceHandler.AddResource(entry.newObj, true); err != nil {
 					klog.Infof("Retry add failed for %s %s, will try again later: %v", r.ResourceHandler.ObjType, objKey, err)
 					entry.timeStamp = time.Now()
-					entry.failedAttempts++
+					r.increaseFailedAttemptsCounter(key, entry, err)
 					return
 				}
 				// successfully cleaned up new object, remove it from the retry cache
@@ -419,7 +651,7 @@ func (r *RetryFramework) processObjectInTerminalState(obj interface{}, lockedKey
 		klog.Errorf("Failed to delete object %s of type %s in terminal state, during %s event: %v",
 			lockedKey, r.ResourceHandler.ObjType, event, err)
 		r.ResourceHandler.RecordErrorEvent(obj, "ErrorDeletingResource", err)
-		r.increaseFailedAttemptsCounter(retryEntry)
+		r.increaseFailedAttemptsCounter(lockedKey, retryEntry, err)
 		return
 	}
 	r.DeleteRetryObj(lockedKey)
@@ -477,7 +709,7 @@ func (r *RetryFramework) WatchResourceFiltered(namespaceForFilteredHandler strin
 							klog.Errorf("Failed to delete old object %s of type %s,"+
 								" during add event: %v", key, r.ResourceHandler.ObjType, err)
 							r.ResourceHandler.RecordErrorEvent(obj, "ErrorDeletingResource", err)
-							r.increaseFailedAttemptsCounter(retryObj)
+							r.increaseFailedAttemptsCounter(key, retryObj, err)
 							return
 						}
 						r.removeDeleteFromRetryObj(retryObj)
@@ -486,7 +718,7 @@ func (r *RetryFramework) WatchResourceFiltered(namespaceForFilteredHandler strin
 					if err := r.ResourceHandler.AddResource(obj, false); err != nil {
 						klog.Errorf("Failed to create %s %s, error: %v", r.ResourceHandler.ObjType, key, err)
 						r.ResourceHandler.RecordErrorEvent(obj, "ErrorAddingResource", err)
-						r.increaseFailedAttemptsCounter(retryObj)
+						r.increaseFailedAttemptsCounter(key, retryObj, err)
 						return
 					}
 					klog.Infof("Creating %s %s took: %v", r.ResourceHandler.ObjType, key, time.Since(start))
@@ -576,7 +808,7 @@ func (r *RetryFramework) WatchResourceFiltered(namespaceForFilteredHandler strin
 							klog.Errorf("Failed to delete stale object %s, during update: %v", oldKey, err)
 							r.ResourceHandler.RecordErrorEvent(retryEntryOrNil.oldObj, "ErrorDeletingResource", err)
 							retryEntry := r.initRetryObjWithAdd(latest, key)
-							r.increaseFailedAttemptsCounter(retryEntry)
+							r.increaseFailedAttemptsCounter(key, retryEntry, err)
 							return
 						}
 						// remove the old object from retry entry since it was correctly deleted
@@ -604,7 +836,7 @@ func (r *RetryFramework) WatchResourceFiltered(namespaceForFilteredHandler strin
 							r.ResourceHandler.RecordErrorEvent(old, "ErrorDeletingResource", err)
 							retryEntry := r.InitRetryObjWithDelete(old, key, nil, false)
 							r.initRetryObjWithAdd(latest, key)
-							r.increaseFailedAttemptsCounter(retryEntry)
+							r.increaseFailedAttemptsCounter(key, retryEntry, err)
 							return
 						}
 						// remove the old object from retry entry since it was correctly deleted
@@ -627,14 +859,14 @@ func (r *RetryFramework) WatchResourceFiltered(namespaceForFilteredHandler strin
 							} else {
 								retryEntry = r.initRetryObjWithAdd(latest, key)
 							}
-							r.increaseFailedAttemptsCounter(retryEntry)
+							r.increaseFailedAttemptsCounter(key, retryEntry, err)
 							return
 						}
 					} else { // we previously deleted old object, now let's add the new one
 						if err := r.ResourceHandler.AddResource(latest, false); err != nil {
 							r.ResourceHandler.RecordErrorEvent(latest, "ErrorAddingResource", err)
 							retryEntry := r.initRetryObjWithAdd(latest, key)
-							r.increaseFailedAttemptsCounter(retryEntry)
+							r.increaseFailedAttemptsCounter(key, retryEntry, err)
 							klog.Errorf("Failed to add %s %s, during update: %v",
 								r.ResourceHandler.ObjType, newKey, err)
 							return
@@ -670,7 +902,7 @@ func (r *RetryFramework) WatchResourceFiltered(namespaceForFilteredHandler strin
 					internalCacheEntry := r.ResourceHandler.GetInternalCacheEntry(obj)
 					retryEntry := r.InitRetryObjWithDelete(obj, key, internalCacheEntry, false) // set up the retry obj for deletion
 					if err = r.ResourceHandler.DeleteResource(obj, internalCacheEntry); err != nil {
-						retryEntry.failedAttempts++
+						r.increaseFailedAttemptsCounter(key, retryEntry, err)
 						klog.Errorf("Failed to delete %s %s, error: %v", r.ResourceHandler.ObjType, key, err)
 						return
 					}
@@ -686,6 +918,12 @@ func (r *RetryFramework) WatchResourceFiltered(namespaceForFilteredHandler strin
 			"Failed addHandlerFunc: %v", r.ResourceHandler.ObjType, err)
 	}
 
+	// objects that were pending retry before a restart can be retried right away now that
+	// the informer cache is populated
+	if pending := r.ReloadRetryObjs(); pending > 0 {
+		klog.Infof("Reloaded %d persisted retry objects of type %s", pending, r.ResourceHandler.ObjType)
+	}
+
 	// track the retry entries and every 30 seconds (or upon explicit request) check if any objects
 	// need to be retried
 	r.doneWg.Add(1)
@@ -0,0 +1,243 @@
+package retry
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	kapi "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/factory"
+)
+
+// fakeInformerHandler serves objects from a map in place of the informer cache
+// and fails to add the objects that have an error in addErrs
+type fakeInformerHandler struct {
+	EventHandler
+	objs    map[string]interface{}
+	addErrs map[string]error
+	// reasons of the error events recorded
+	errorEvents []string
+}
+
+func (h *fakeInformerHandler) AddResource(obj interface{}, fromRetryLoop bool) error {
+	key, _ := GetResourceKey(obj)
+	return h.addErrs[key]
+}
+
+func (h *fakeInformerHandler) IsResourceScheduled(obj interface{}) bool {
+	return true
+}
+
+func (h *fakeInformerHandler) RecordSuccessEvent(obj interface{}) {}
+
+func (h *fakeInformerHandler) RecordErrorEvent(obj interface{}, reason string, err error) {
+	h.errorEvents = append(h.errorEvents, reason)
+}
+
+func (h *fakeInformerHandler) GetResourceFromInformerCache(key string) (interface{}, error) {
+	obj, ok := h.objs[key]
+	if !ok {
+		return nil, kerrors.NewNotFound(schema.GroupResource{Resource: "pods"}, key)
+	}
+	return obj, nil
+}
+
+func newTestPod(namespace, name string) *kapi.Pod {
+	return &kapi.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+}
+
+func newTestRetryFramework(objs map[string]interface{}) *RetryFramework {
+	return NewRetryFramework(make(chan struct{}), &sync.WaitGroup{}, nil, &ResourceHandler{
+		ObjType:      factory.PodType,
+		EventHandler: &fakeInformerHandler{objs: objs},
+	})
+}
+
+func assertPersistedRetryObjs(t *testing.T, path string, expected string) {
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.JSONEq(t, expected, string(data))
+}
+
+func TestPersistAndReloadRetryObjs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pods.json")
+	pod1 := newTestPod("ns", "pod1")
+	pod2 := newTestPod("ns", "pod2")
+	pod3 := newTestPod("ns", "pod3")
+	pod4 := newTestPod("ns", "pod4")
+	addErr := errors.New("add failed")
+
+	r := newTestRetryFramework(map[string]interface{}{"ns/pod1": pod1, "ns/pod2": pod2, "ns/pod4": pod4})
+	handler := r.ResourceHandler.EventHandler.(*fakeInformerHandler)
+	handler.addErrs = map[string]error{"ns/pod1": addErr, "ns/pod2": addErr, "ns/pod4": addErr}
+	assert.NoError(t, r.EnablePersistence(path))
+	for _, pod := range []*kapi.Pod{pod1, pod2, pod4} {
+		assert.NoError(t, r.AddRetryObjWithAddNoBackoff(pod))
+	}
+	// objects are persisted once they fail, not when they are queued
+	_, err := os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+	r.iterateRetryResources()
+	assertPersistedRetryObjs(t, path, `{"keys":["ns/pod1","ns/pod2","ns/pod4"]}`)
+
+	// objects only pending a delete are not persisted
+	r.DoWithLock("ns/pod3", func(key string) {
+		entry := r.InitRetryObjWithDelete(pod3, key, nil, true)
+		r.increaseFailedAttemptsCounter(key, entry, errors.New("delete failed"))
+	})
+	assertPersistedRetryObjs(t, path, `{"keys":["ns/pod1","ns/pod2","ns/pod4"]}`)
+
+	// pod4 is deleted while the controller is down, pod2 is added on startup and pod1 fails again
+	restarted := newTestRetryFramework(map[string]interface{}{"ns/pod1": pod1, "ns/pod2": pod2})
+	restarted.ResourceHandler.EventHandler.(*fakeInformerHandler).addErrs = map[string]error{"ns/pod1": addErr}
+	assert.NoError(t, restarted.EnablePersistence(path))
+	for _, pod := range []*kapi.Pod{pod1, pod2} {
+		assert.NoError(t, restarted.AddRetryObjWithAddNoBackoff(pod))
+	}
+	restarted.iterateRetryResources()
+	assertPersistedRetryObjs(t, path, `{"keys":["ns/pod1","ns/pod4"]}`)
+
+	// only the object still pending retry is retried right away
+	assert.Equal(t, 1, restarted.ReloadRetryObjs())
+	assertPersistedRetryObjs(t, path, `{"keys":["ns/pod1"]}`)
+	assert.Equal(t, 1, RetryObjsLen(restarted))
+	entry, _ := GetRetryObj("ns/pod1", restarted)
+	assert.Equal(t, time.Duration(noBackoff), entry.backoffSec)
+	assert.Len(t, restarted.retryChan, 1)
+
+	// the object is no longer persisted once it is added
+	restarted.ResourceHandler.EventHandler.(*fakeInformerHandler).addErrs = nil
+	restarted.iterateRetryResources()
+	assertPersistedRetryObjs(t, path, `{"keys":[]}`)
+}
+
+func TestReloadRetryObjsWithoutPersistence(t *testing.T) {
+	pod1 := newTestPod("ns", "pod1")
+	r := newTestRetryFramework(map[string]interface{}{"ns/pod1": pod1})
+	r.ResourceHandler.EventHandler.(*fakeInformerHandler).addErrs = map[string]error{"ns/pod1": errors.New("add failed")}
+	assert.NoError(t, r.AddRetryObjWithAddNoBackoff(pod1))
+	r.iterateRetryResources()
+	assert.Equal(t, 0, r.ReloadRetryObjs())
+	assert.Len(t, r.retryChan, 0)
+
+	// nothing was persisted yet
+	assert.NoError(t, r.EnablePersistence(filepath.Join(t.TempDir(), "pods.json")))
+	assert.Equal(t, 0, r.ReloadRetryObjs())
+}
+
+func TestReloadRetryObjsCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pods.json")
+	pod1 := newTestPod("ns", "pod1")
+	assert.NoError(t, os.WriteFile(path, []byte("{not json"), 0600))
+	r := newTestRetryFramework(map[string]interface{}{"ns/pod1": pod1})
+	r.ResourceHandler.EventHandler.(*fakeInformerHandler).addErrs = map[string]error{"ns/pod1": errors.New("add failed")}
+	assert.Error(t, r.EnablePersistence(path))
+	assert.Equal(t, 0, r.ReloadRetryObjs())
+
+	// the file is still written over as objects fail
+	assert.NoError(t, r.AddRetryObjWithAddNoBackoff(pod1))
+	r.iterateRetryResources()
+	assertPersistedRetryObjs(t, path, `{"keys":["ns/pod1"]}`)
+}
+
+func TestGetFailedObjs(t *testing.T) {
+	pod1 := newTestPod("ns", "pod1")
+	pod2 := newTestPod("ns", "pod2")
+	addErr := errors.New("add failed")
+	r := newTestRetryFramework(map[string]interface{}{"ns/pod1": pod1, "ns/pod2": pod2})
+	r.ResourceHandler.EventHandler.(*fakeInformerHandler).addErrs = map[string]error{"ns/pod2": addErr}
+
+	for _, pod := range []*kapi.Pod{pod1, pod2} {
+		assert.NoError(t, r.AddRetryObjWithAddNoBackoff(pod))
+	}
+	// objects that have not been attempted yet are not failing
+	assert.Empty(t, r.GetFailedObjs())
+
+	r.iterateRetryResources()
+	assert.Equal(t, []FailedObj{{Key: "ns/pod2", FailedAttempts: 1, LastError: addErr}}, r.GetFailedObjs())
+
+	SetRetryObjWithNoBackoff("ns/pod2", r)
+	r.iterateRetryResources()
+	assert.Equal(t, []FailedObj{{Key: "ns/pod2", FailedAttempts: 2, LastError: addErr}}, r.GetFailedObjs())
+
+	// a new event for the object resets its failures
+	InitRetryObjWithAdd(pod2, "ns/pod2", r)
+	assert.Empty(t, r.GetFailedObjs())
+}
+
+func TestGetBackoffStates(t *testing.T) {
+	pod1 := newTestPod("ns", "pod1")
+	pod2 := newTestPod("ns", "pod2")
+	r := newTestRetryFramework(map[string]interface{}{"ns/pod1": pod1, "ns/pod2": pod2})
+	r.ResourceHandler.EventHandler.(*fakeInformerHandler).addErrs = map[string]error{"ns/pod2": errors.New("add failed")}
+
+	for _, pod := range []*kapi.Pod{pod1, pod2} {
+		assert.NoError(t, r.AddRetryObjWithAddNoBackoff(pod))
+	}
+	states := r.GetBackoffStates()
+	assert.Len(t, states, 2)
+	for _, state := range states {
+		assert.Equal(t, time.Duration(0), state.Backoff)
+	}
+
+	// the backoff doubles with each failed attempt, starting from the next one
+	start := time.Now()
+	r.iterateRetryResources()
+	states = r.GetBackoffStates()
+	assert.Len(t, states, 1)
+	assert.Equal(t, "ns/pod2", states[0].Key)
+	assert.Equal(t, 1, states[0].FailedAttempts)
+	assert.Equal(t, 2*time.Second, states[0].Backoff)
+	assert.False(t, states[0].NextRetry.Before(start.Add(2*time.Second)))
+	assert.False(t, states[0].NextRetry.After(time.Now().Add(2*time.Second)))
+
+	start = time.Now()
+	r.resourceRetry("ns/pod2", start.Add(time.Minute))
+	states = r.GetBackoffStates()
+	assert.Equal(t, 2, states[0].FailedAttempts)
+	assert.Equal(t, 4*time.Second, states[0].Backoff)
+	assert.False(t, states[0].NextRetry.Before(start.Add(4*time.Second)))
+
+	// an immediate retry request resets the backoff
+	SetRetryObjWithNoBackoff("ns/pod2", r)
+	states = r.GetBackoffStates()
+	assert.Equal(t, time.Duration(0), states[0].Backoff)
+}
+
+func TestDeadLetterObjs(t *testing.T) {
+	pod1 := newTestPod("ns", "pod1")
+	pod2 := newTestPod("ns", "pod2")
+	addErr := errors.New("add failed")
+	r := newTestRetryFramework(map[string]interface{}{"ns/pod1": pod1, "ns/pod2": pod2})
+	handler := r.ResourceHandler.EventHandler.(*fakeInformerHandler)
+	handler.addErrs = map[string]error{"ns/pod1": addErr}
+	r.SetMaxFailedAttempts(2)
+
+	for _, pod := range []*kapi.Pod{pod1, pod2} {
+		assert.NoError(t, r.AddRetryObjWithAddNoBackoff(pod))
+	}
+	r.iterateRetryResources()
+	SetRetryObjWithNoBackoff("ns/pod1", r)
+	r.iterateRetryResources()
+	assert.Equal(t, []FailedObj{{Key: "ns/pod1", FailedAttempts: 2, LastError: addErr}}, r.GetFailedObjs())
+	assert.Empty(t, r.GetDeadLetterObjs())
+
+	// the next retry gives up on the object
+	SetRetryObjWithNoBackoff("ns/pod1", r)
+	r.iterateRetryResources()
+	assert.Equal(t, 0, RetryObjsLen(r))
+	assert.Equal(t, []FailedObj{{Key: "ns/pod1", FailedAttempts: 2, LastError: addErr}}, r.GetDeadLetterObjs())
+	assert.Equal(t, []string{"RetryGaveUp"}, handler.errorEvents)
+
+	// a new event for the object takes it out of the dead-letter set
+	InitRetryObjWithAdd(pod1, "ns/pod1", r)
+	assert.Empty(t, r.GetDeadLetterObjs())
+}
@@ -0,0 +1,189 @@
+package libovsdb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	libovsdbclient "github.com/ovn-org/libovsdb/client"
+	"github.com/ovn-org/libovsdb/ovsdb"
+)
+
+// ChangeRecorder is a libovsdb client that records the transactions that
+// would change the contents of the database, as seen in the client cache
+// before each transaction. Transactions that only update or mutate rows to
+// the values they already have are not recorded.
+type ChangeRecorder struct {
+	libovsdbclient.Client
+	lock    sync.Mutex
+	changes [][]ovsdb.Operation
+}
+
+// NewChangeRecorder returns a ChangeRecorder that transacts through client
+func NewChangeRecorder(client libovsdbclient.Client) *ChangeRecorder {
+	return &ChangeRecorder{Client: client}
+}
+
+func (r *ChangeRecorder) Transact(ctx context.Context, ops ...ovsdb.Operation) ([]ovsdb.OperationResult, error) {
+	changes, err := WouldChange(r.Client, ops...)
+	if err != nil {
+		return nil, err
+	}
+	if changes {
+		r.lock.Lock()
+		r.changes = append(r.changes, ops)
+		r.lock.Unlock()
+	}
+	return r.Client.Transact(ctx, ops...)
+}
+
+// Changes returns the operations of the recorded transactions
+func (r *ChangeRecorder) Changes() [][]ovsdb.Operation {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([][]ovsdb.Operation{}, r.changes...)
+}
+
+// WouldChange returns whether any of the operations would change the rows
+// in the client cache
+func WouldChange(client libovsdbclient.Client, ops ...ovsdb.Operation) (bool, error) {
+	for _, op := range ops {
+		changes, err := opWouldChange(client, op)
+		if err != nil || changes {
+			return changes, err
+		}
+	}
+	return false, nil
+}
+
+func opWouldChange(client libovsdbclient.Client, op ovsdb.Operation) (bool, error) {
+	switch op.Op {
+	case ovsdb.OperationWait, ovsdb.OperationComment, ovsdb.OperationAssert, ovsdb.OperationSelect:
+		return false, nil
+	case ovsdb.OperationInsert:
+		return true, nil
+	}
+
+	cache := client.Cache()
+	table := cache.Table(op.Table)
+	if table == nil {
+		return false, fmt.Errorf("table %s not found in the cache", op.Table)
+	}
+	rows, err := table.RowsByCondition(op.Where)
+	if err != nil {
+		return false, err
+	}
+	if op.Op == ovsdb.OperationDelete {
+		return len(rows) > 0, nil
+	}
+
+	schema := cache.Mapper().Schema.Table(op.Table)
+	for _, row := range rows {
+		info, err := cache.DatabaseModel().NewModelInfo(row)
+		if err != nil {
+			return false, err
+		}
+		switch op.Op {
+		case ovsdb.OperationUpdate:
+			for column, value := range op.Row {
+				current, err := info.FieldByColumn(column)
+				if err != nil {
+					return false, err
+				}
+				native, err := ovsdb.OvsToNative(schema.Column(column), value)
+				if err != nil {
+					return false, err
+				}
+				if !isEqualValue(current, native) {
+					return true, nil
+				}
+			}
+		case ovsdb.OperationMutate:
+			for _, mutation := range op.Mutations {
+				current, err := info.FieldByColumn(mutation.Column)
+				if err != nil {
+					return false, err
+				}
+				changes, err := mutationWouldChange(schema.Column(mutation.Column), current, mutation)
+				if err != nil || changes {
+					return changes, err
+				}
+			}
+		default:
+			return false, fmt.Errorf("unsupported operation %s", op.Op)
+		}
+	}
+	return false, nil
+}
+
+// mutationWouldChange returns whether an insert or delete mutation would change
+// the current value of a set or map column. Any other mutation is considered a
+// change.
+func mutationWouldChange(column *ovsdb.ColumnSchema, current interface{}, mutation ovsdb.Mutation) (bool, error) {
+	if mutation.Mutator != ovsdb.MutateOperationInsert && mutation.Mutator != ovsdb.MutateOperationDelete {
+		return true, nil
+	}
+	var value interface{}
+	var err error
+	if mutation.Mutator == ovsdb.MutateOperationDelete && column.Type == ovsdb.TypeMap &&
+		reflect.TypeOf(mutation.Value) != reflect.TypeOf(ovsdb.OvsMap{}) {
+		// map entries can be deleted by key
+		value, err = ovsdb.OvsToNativeSlice(column.TypeObj.Key.Type, mutation.Value)
+	} else {
+		value, err = ovsdb.OvsToNative(column, mutation.Value)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	insert := mutation.Mutator == ovsdb.MutateOperationInsert
+	currentValue := reflect.ValueOf(current)
+	mutationValue := reflect.ValueOf(value)
+	switch {
+	case mutationValue.Kind() == reflect.Map:
+		for _, key := range mutationValue.MapKeys() {
+			existing := currentValue.MapIndex(key)
+			if insert && !existing.IsValid() {
+				return true, nil
+			}
+			if !insert && existing.IsValid() && existing.Interface() == mutationValue.MapIndex(key).Interface() {
+				return true, nil
+			}
+		}
+	case mutationValue.Kind() == reflect.Slice && currentValue.Kind() == reflect.Map:
+		for i := 0; i < mutationValue.Len(); i++ {
+			if currentValue.MapIndex(mutationValue.Index(i)).IsValid() {
+				return true, nil
+			}
+		}
+	case mutationValue.Kind() == reflect.Slice:
+		for i := 0; i < mutationValue.Len(); i++ {
+			if insert != sliceContains(currentValue, mutationValue.Index(i).Interface()) {
+				return true, nil
+			}
+		}
+	default:
+		return true, nil
+	}
+	return false, nil
+}
+
+// isEqualValue compares column values, considering nil and empty sets and maps
+// equal as the database does not tell them apart
+func isEqualValue(x, y interface{}) bool {
+	vx, vy := reflect.ValueOf(x), reflect.ValueOf(y)
+	if (vx.Kind() == reflect.Slice || vx.Kind() == reflect.Map) && vx.Kind() == vy.Kind() && vx.Len() == 0 && vy.Len() == 0 {
+		return true
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+func sliceContains(slice reflect.Value, elem interface{}) bool {
+	for i := 0; i < slice.Len(); i++ {
+		if slice.Index(i).Interface() == elem {
+			return true
+		}
+	}
+	return false
+}
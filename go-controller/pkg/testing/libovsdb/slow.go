@@ -0,0 +1,53 @@
+package libovsdb
+
+import (
+	"context"
+	"sync"
+
+	libovsdbclient "github.com/ovn-org/libovsdb/client"
+	"github.com/ovn-org/libovsdb/ovsdb"
+)
+
+// SlowClient is a libovsdb client whose transactions operating on some tables
+// hang until they are released or their context is done, as they would against
+// an overloaded database
+type SlowClient struct {
+	libovsdbclient.Client
+	tables      map[string]bool
+	release     chan struct{}
+	releaseOnce sync.Once
+}
+
+// NewSlowClient returns a SlowClient that transacts through client and hangs
+// the transactions operating on any of the given tables
+func NewSlowClient(client libovsdbclient.Client, tables ...string) *SlowClient {
+	c := &SlowClient{
+		Client:  client,
+		tables:  map[string]bool{},
+		release: make(chan struct{}),
+	}
+	for _, table := range tables {
+		c.tables[table] = true
+	}
+	return c
+}
+
+func (c *SlowClient) Transact(ctx context.Context, ops ...ovsdb.Operation) ([]ovsdb.OperationResult, error) {
+	for _, op := range ops {
+		if !c.tables[op.Table] {
+			continue
+		}
+		select {
+		case <-c.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		break
+	}
+	return c.Client.Transact(ctx, ops...)
+}
+
+// Release lets the hanging and later transactions through
+func (c *SlowClient) Release() {
+	c.releaseOnce.Do(func() { close(c.release) })
+}
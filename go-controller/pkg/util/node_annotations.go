@@ -6,9 +6,12 @@ import (
 	"math"
 	"net"
 	"strconv"
+	"strings"
+	"time"
 
 	kapi "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
+	utilnet "k8s.io/utils/net"
 
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/config"
 	"github.com/ovn-org/ovn-kubernetes/go-controller/pkg/kube"
@@ -63,12 +66,55 @@ const (
 	// ovnNodeGRLRPAddr is the CIDR form representation of Gate Router LRP IP address to join switch (i.e: 100.64.0.5/24)
 	ovnNodeGRLRPAddr = "k8s.ovn.org/node-gateway-router-lrp-ifaddr"
 
+	// ovnNodeGatewayIPs is the CIDR form representation of the per IP family gateway addresses of
+	// the node subnets, as set on the node's cluster router port (i.e: {"ipv4":"10.244.0.1/24"})
+	ovnNodeGatewayIPs = "k8s.ovn.org/node-gateway-ips"
+
+	// ovnNodeSubnetsAllocatedAt is the RFC 3339 time the node got its current default
+	// network host subnets allocated (i.e: 2022-11-04T10:15:00Z)
+	ovnNodeSubnetsAllocatedAt = "k8s.ovn.org/node-subnets-allocated-at"
+
+	// ovnNodeLRPMAC is the MAC address of the node's cluster router port as derived by
+	// the controller from the node subnets (i.e: 0a:58:0a:f4:00:01)
+	ovnNodeLRPMAC = "k8s.ovn.org/node-lrp-mac"
+
 	// OvnNodeEgressLabel is a user assigned node label indicating to ovn-kubernetes that the node is to be used for egress IP assignment
 	ovnNodeEgressLabel = "k8s.ovn.org/egress-assignable"
 
 	// ovnNodeHostAddresses is used to track the different host IP addresses on the node
 	ovnNodeHostAddresses = "k8s.ovn.org/host-addresses"
 
+	// ovnNodeIPFamilies is a user assigned comma separated list of the IP families ("ipv4",
+	// "ipv6") a node supports, for nodes that are single-stack in a dual-stack cluster
+	ovnNodeIPFamilies = "k8s.ovn.org/node-ip-families"
+
+	// ovnNodeSwitchOtherConfig is a user assigned JSON object of the other_config
+	// entries to set on the logical switch of the node
+	ovnNodeSwitchOtherConfig = "k8s.ovn.org/node-switch-other-config"
+
+	// ovnNodeFreezeOVN is a user assigned annotation that, when set to "true", stops the
+	// OVN objects of the node from being reconciled so they can be tweaked for debugging
+	ovnNodeFreezeOVN = "k8s.ovn.org/freeze-ovn"
+
+	// ovnNodeAlwaysLearnFromARPRequest is a user assigned annotation that, when set to "true",
+	// makes the cluster router port of the node learn MAC bindings from every ARP request it
+	// receives, for nodes bridging to legacy L2 segments
+	ovnNodeAlwaysLearnFromARPRequest = "k8s.ovn.org/always-learn-from-arp-request"
+
+	// ovnNodeExcludeLoadBalancerGroup is a user assigned annotation that, when set to "true",
+	// keeps the cluster load balancer group off the logical switch of the node, for nodes
+	// that only run host network workloads
+	ovnNodeExcludeLoadBalancerGroup = "k8s.ovn.org/exclude-load-balancer-group"
+
+	// ovnNodeBackupChassis is a user assigned comma separated list of the IDs of the chassis
+	// backing up the node's own chassis as gateway chassis of its cluster router port, by
+	// descending priority
+	ovnNodeBackupChassis = "k8s.ovn.org/node-backup-chassis"
+
+	// ovnNodeExcludeSubnets is a user assigned comma separated list of CIDRs within the host
+	// subnets of the node that are kept out of the addressing of its switch
+	ovnNodeExcludeSubnets = "k8s.ovn.org/node-exclude-subnets"
+
 	// egressIPConfigAnnotationKey is used to indicate the cloud subnet and
 	// capacity for each node. It is set by
 	// openshift/cloud-network-config-controller
@@ -308,6 +354,102 @@ func ParseNodeChassisIDAnnotation(node *kapi.Node) (string, error) {
 	return chassisID, nil
 }
 
+// ParseNodeBackupChassisAnnotation returns the IDs of the chassis a node is annotated to
+// be backed up by, by descending priority
+func ParseNodeBackupChassisAnnotation(node *kapi.Node) ([]string, error) {
+	annotation, ok := node.Annotations[ovnNodeBackupChassis]
+	if !ok {
+		return nil, newAnnotationNotSetError("%s annotation not found for node %s", ovnNodeBackupChassis, node.Name)
+	}
+	chassisIDs := []string{}
+	for _, chassisID := range strings.Split(annotation, ",") {
+		if chassisID = strings.TrimSpace(chassisID); chassisID != "" {
+			chassisIDs = append(chassisIDs, chassisID)
+		}
+	}
+	return chassisIDs, nil
+}
+
+// NodeExcludeSubnetsAnnotationChanged returns true if the subnet exclusion annotation of
+// the node changed
+func NodeExcludeSubnetsAnnotationChanged(oldNode, newNode *kapi.Node) bool {
+	return oldNode.Annotations[ovnNodeExcludeSubnets] != newNode.Annotations[ovnNodeExcludeSubnets]
+}
+
+// ParseNodeExcludeSubnetsAnnotation returns the CIDRs a node is annotated to exclude from
+// the addressing of its logical switch
+func ParseNodeExcludeSubnetsAnnotation(node *kapi.Node) ([]*net.IPNet, error) {
+	annotation, ok := node.Annotations[ovnNodeExcludeSubnets]
+	if !ok {
+		return nil, newAnnotationNotSetError("%s annotation not found for node %s", ovnNodeExcludeSubnets, node.Name)
+	}
+	subnets := []*net.IPNet{}
+	for _, cidr := range strings.Split(annotation, ",") {
+		if cidr = strings.TrimSpace(cidr); cidr == "" {
+			continue
+		}
+		_, subnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q in %s annotation of node %s: %v",
+				cidr, ovnNodeExcludeSubnets, node.Name, err)
+		}
+		subnets = append(subnets, subnet)
+	}
+	return subnets, nil
+}
+
+// ParseNodeIPFamiliesAnnotation returns the IP families a node is annotated to support
+func ParseNodeIPFamiliesAnnotation(node *kapi.Node) (ipv4, ipv6 bool, err error) {
+	families, ok := node.Annotations[ovnNodeIPFamilies]
+	if !ok {
+		return false, false, newAnnotationNotSetError("%s annotation not found for node %s", ovnNodeIPFamilies, node.Name)
+	}
+	for _, family := range strings.Split(families, ",") {
+		switch strings.TrimSpace(family) {
+		case "ipv4":
+			ipv4 = true
+		case "ipv6":
+			ipv6 = true
+		default:
+			return false, false, fmt.Errorf("invalid IP family %q in %s annotation of node %s",
+				family, ovnNodeIPFamilies, node.Name)
+		}
+	}
+	return ipv4, ipv6, nil
+}
+
+// ParseNodeSwitchOtherConfigAnnotation returns the logical switch other_config entries
+// a node is annotated with
+func ParseNodeSwitchOtherConfigAnnotation(node *kapi.Node) (map[string]string, error) {
+	annotation, ok := node.Annotations[ovnNodeSwitchOtherConfig]
+	if !ok {
+		return nil, newAnnotationNotSetError("%s annotation not found for node %s", ovnNodeSwitchOtherConfig, node.Name)
+	}
+	otherConfig := map[string]string{}
+	if err := json.Unmarshal([]byte(annotation), &otherConfig); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s annotation %q of node %s: %v",
+			ovnNodeSwitchOtherConfig, annotation, node.Name, err)
+	}
+	return otherConfig, nil
+}
+
+// IsNodeOVNFrozen returns whether the OVN objects of a node are annotated to be frozen
+func IsNodeOVNFrozen(node *kapi.Node) bool {
+	return node.Annotations[ovnNodeFreezeOVN] == "true"
+}
+
+// IsNodeExcludedFromLoadBalancerGroup returns whether the node is annotated to keep the
+// cluster load balancer group off its logical switch
+func IsNodeExcludedFromLoadBalancerGroup(node *kapi.Node) bool {
+	return node.Annotations[ovnNodeExcludeLoadBalancerGroup] == "true"
+}
+
+// NodeAlwaysLearnsFromARPRequest returns whether the node is annotated to have its cluster
+// router port learn from every ARP request
+func NodeAlwaysLearnsFromARPRequest(node *kapi.Node) bool {
+	return node.Annotations[ovnNodeAlwaysLearnFromARPRequest] == "true"
+}
+
 func SetNodeManagementPortMACAddress(nodeAnnotator kube.Annotator, macAddress net.HardwareAddr) error {
 	return nodeAnnotator.Set(ovnNodeManagementPortMacAddress, macAddress.String())
 }
@@ -359,6 +501,103 @@ func CreateNodeGatewayRouterLRPAddrAnnotation(nodeAnnotation map[string]string,
 	return nodeAnnotation, nil
 }
 
+// CreateNodeGatewayIPsAnnotation sets the IPv4 / IPv6 gateway addresses of the given node host
+// subnets, which are the networks of the node's cluster router port.
+func CreateNodeGatewayIPsAnnotation(nodeAnnotation map[string]string, hostSubnets []*net.IPNet) (map[string]string, error) {
+	if nodeAnnotation == nil {
+		nodeAnnotation = map[string]string{}
+	}
+	gatewayIPsAnnotation := primaryIfAddrAnnotation{}
+	for _, hostSubnet := range hostSubnets {
+		gwIfAddr := GetNodeGatewayIfAddr(hostSubnet)
+		if utilnet.IsIPv6CIDR(hostSubnet) {
+			gatewayIPsAnnotation.IPv6 = gwIfAddr.String()
+		} else {
+			gatewayIPsAnnotation.IPv4 = gwIfAddr.String()
+		}
+	}
+	bytes, err := json.Marshal(gatewayIPsAnnotation)
+	if err != nil {
+		return nil, err
+	}
+	nodeAnnotation[ovnNodeGatewayIPs] = string(bytes)
+	return nodeAnnotation, nil
+}
+
+// ParseNodeGatewayIPs returns the gateway addresses of the node subnets, IPv4 first
+func ParseNodeGatewayIPs(node *kapi.Node) ([]*net.IPNet, error) {
+	gatewayIPsAnnotation, ok := node.Annotations[ovnNodeGatewayIPs]
+	if !ok {
+		return nil, newAnnotationNotSetError("%s annotation not found for node %q", ovnNodeGatewayIPs, node.Name)
+	}
+	gatewayIPs := primaryIfAddrAnnotation{}
+	if err := json.Unmarshal([]byte(gatewayIPsAnnotation), &gatewayIPs); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal annotation: %s for node %q, err: %v", ovnNodeGatewayIPs, node.Name, err)
+	}
+	var gwIfAddrs []*net.IPNet
+	for _, gatewayIP := range []string{gatewayIPs.IPv4, gatewayIPs.IPv6} {
+		if gatewayIP == "" {
+			continue
+		}
+		ip, ipNet, err := net.ParseCIDR(gatewayIP)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse annotation: %s for node %q, err: %v", ovnNodeGatewayIPs, node.Name, err)
+		}
+		gwIfAddrs = append(gwIfAddrs, &net.IPNet{IP: ip, Mask: ipNet.Mask})
+	}
+	if len(gwIfAddrs) == 0 {
+		return nil, fmt.Errorf("node: %q does not have any IP information set", node.Name)
+	}
+	return gwIfAddrs, nil
+}
+
+// CreateNodeSubnetsAllocatedAtAnnotation sets the time the node got its current host
+// subnets allocated in nodeAnnotation
+func CreateNodeSubnetsAllocatedAtAnnotation(nodeAnnotation map[string]string, allocatedAt time.Time) map[string]string {
+	if nodeAnnotation == nil {
+		nodeAnnotation = map[string]string{}
+	}
+	nodeAnnotation[ovnNodeSubnetsAllocatedAt] = allocatedAt.UTC().Format(time.RFC3339)
+	return nodeAnnotation
+}
+
+// ParseNodeSubnetsAllocatedAt returns the time the node got its current host subnets
+// allocated
+func ParseNodeSubnetsAllocatedAt(node *kapi.Node) (time.Time, error) {
+	allocatedAt, ok := node.Annotations[ovnNodeSubnetsAllocatedAt]
+	if !ok {
+		return time.Time{}, newAnnotationNotSetError("%s annotation not found for node %q", ovnNodeSubnetsAllocatedAt, node.Name)
+	}
+	t, err := time.Parse(time.RFC3339, allocatedAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse annotation: %s for node %q, err: %v", ovnNodeSubnetsAllocatedAt, node.Name, err)
+	}
+	return t, nil
+}
+
+// CreateNodeLRPMACAnnotation sets the MAC address of the node's cluster router port in
+// nodeAnnotation
+func CreateNodeLRPMACAnnotation(nodeAnnotation map[string]string, mac net.HardwareAddr) map[string]string {
+	if nodeAnnotation == nil {
+		nodeAnnotation = map[string]string{}
+	}
+	nodeAnnotation[ovnNodeLRPMAC] = mac.String()
+	return nodeAnnotation
+}
+
+// ParseNodeLRPMACAnnotation returns the MAC address of the node's cluster router port
+func ParseNodeLRPMACAnnotation(node *kapi.Node) (net.HardwareAddr, error) {
+	mac, ok := node.Annotations[ovnNodeLRPMAC]
+	if !ok {
+		return nil, newAnnotationNotSetError("%s annotation not found for node %q", ovnNodeLRPMAC, node.Name)
+	}
+	hwAddr, err := net.ParseMAC(mac)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse annotation: %s for node %q, err: %v", ovnNodeLRPMAC, node.Name, err)
+	}
+	return hwAddr, nil
+}
+
 const UnlimitedNodeCapacity = math.MaxInt32
 
 type ifAddr struct {
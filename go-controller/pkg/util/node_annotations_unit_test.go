@@ -5,6 +5,7 @@ import (
 	"net"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 
@@ -514,6 +515,118 @@ func TestParseNodeGatewayRouterLRPAddr(t *testing.T) {
 	}
 }
 
+func TestNodeAlwaysLearnsFromARPRequest(t *testing.T) {
+	tests := []struct {
+		desc       string
+		annotation *string
+		expOutput  bool
+	}{
+		{
+			desc: "annotation not found",
+		},
+		{
+			desc:       "opted in",
+			annotation: stringPtr("true"),
+			expOutput:  true,
+		},
+		{
+			desc:       "opted out",
+			annotation: stringPtr("false"),
+		},
+	}
+
+	for i, tc := range tests {
+		t.Run(fmt.Sprintf("%d:%s", i, tc.desc), func(t *testing.T) {
+			node := v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+			if tc.annotation != nil {
+				node.Annotations = map[string]string{"k8s.ovn.org/always-learn-from-arp-request": *tc.annotation}
+			}
+			assert.Equal(t, tc.expOutput, NodeAlwaysLearnsFromARPRequest(&node))
+		})
+	}
+}
+
+func TestNodeGatewayIPsAnnotation(t *testing.T) {
+	tests := []struct {
+		desc        string
+		hostSubnets []string
+		expOutput   []string
+	}{
+		{
+			desc:        "IPv4 subnet",
+			hostSubnets: []string{"10.244.1.0/24"},
+			expOutput:   []string{"10.244.1.1/24"},
+		},
+		{
+			desc:        "IPv6 subnet",
+			hostSubnets: []string{"fd00:10:244:1::/64"},
+			expOutput:   []string{"fd00:10:244:1::1/64"},
+		},
+		{
+			desc:        "dual stack subnets are returned IPv4 first",
+			hostSubnets: []string{"fd00:10:244:1::/64", "10.244.1.0/24"},
+			expOutput:   []string{"10.244.1.1/24", "fd00:10:244:1::1/64"},
+		},
+	}
+
+	for i, tc := range tests {
+		t.Run(fmt.Sprintf("%d:%s", i, tc.desc), func(t *testing.T) {
+			hostSubnets := ovntest.MustParseIPNets(tc.hostSubnets...)
+			annotations, err := CreateNodeGatewayIPsAnnotation(nil, hostSubnets)
+			assert.NoError(t, err)
+			node := v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Annotations: annotations}}
+			gatewayIPs, err := ParseNodeGatewayIPs(&node)
+			assert.NoError(t, err)
+			var output []string
+			for _, gatewayIP := range gatewayIPs {
+				output = append(output, gatewayIP.String())
+			}
+			assert.Equal(t, tc.expOutput, output)
+		})
+	}
+}
+
+func TestParseNodeGatewayIPs(t *testing.T) {
+	tests := []struct {
+		desc        string
+		annotations map[string]string
+		errExpected bool
+	}{
+		{
+			desc:        "annotation not found",
+			errExpected: true,
+		},
+		{
+			desc:        "no gateway IP set",
+			annotations: map[string]string{"k8s.ovn.org/node-gateway-ips": `{}`},
+			errExpected: true,
+		},
+		{
+			desc:        "gateway IP is not in CIDR form",
+			annotations: map[string]string{"k8s.ovn.org/node-gateway-ips": `{"ipv4":"10.244.1.1"}`},
+			errExpected: true,
+		},
+		{
+			desc:        "success",
+			annotations: map[string]string{"k8s.ovn.org/node-gateway-ips": `{"ipv4":"10.244.1.1/24"}`},
+		},
+	}
+
+	for i, tc := range tests {
+		t.Run(fmt.Sprintf("%d:%s", i, tc.desc), func(t *testing.T) {
+			node := v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Annotations: tc.annotations}}
+			gatewayIPs, err := ParseNodeGatewayIPs(&node)
+			if tc.errExpected {
+				assert.Error(t, err)
+				assert.Nil(t, gatewayIPs)
+			} else {
+				assert.NoError(t, err)
+				assert.Len(t, gatewayIPs, 1)
+			}
+		})
+	}
+}
+
 func TestSetGatewayMTUSupport(t *testing.T) {
 	mockAnnotator := new(annotatorMock.Annotator)
 
@@ -616,3 +729,295 @@ func TestParseNodeGatewayMTUSupport(t *testing.T) {
 		})
 	}
 }
+
+func TestParseNodeIPFamiliesAnnotation(t *testing.T) {
+	tests := []struct {
+		desc        string
+		annotation  *string
+		errExpected bool
+		expIPv4     bool
+		expIPv6     bool
+	}{
+		{
+			desc:        "annotation not found",
+			errExpected: true,
+		},
+		{
+			desc:       "IPv4 only",
+			annotation: stringPtr("ipv4"),
+			expIPv4:    true,
+		},
+		{
+			desc:       "IPv6 only",
+			annotation: stringPtr("ipv6"),
+			expIPv6:    true,
+		},
+		{
+			desc:       "both families",
+			annotation: stringPtr("ipv4, ipv6"),
+			expIPv4:    true,
+			expIPv6:    true,
+		},
+		{
+			desc:        "empty annotation",
+			annotation:  stringPtr(""),
+			errExpected: true,
+		},
+		{
+			desc:        "invalid family",
+			annotation:  stringPtr("ipv4,ipx"),
+			errExpected: true,
+		},
+	}
+
+	for i, tc := range tests {
+		t.Run(fmt.Sprintf("%d:%s", i, tc.desc), func(t *testing.T) {
+			node := v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+			if tc.annotation != nil {
+				node.Annotations = map[string]string{"k8s.ovn.org/node-ip-families": *tc.annotation}
+			}
+			ipv4, ipv6, e := ParseNodeIPFamiliesAnnotation(&node)
+			if tc.errExpected {
+				assert.Error(t, e)
+				assert.Equal(t, tc.annotation == nil, IsAnnotationNotSetError(e))
+				return
+			}
+			assert.NoError(t, e)
+			assert.Equal(t, tc.expIPv4, ipv4)
+			assert.Equal(t, tc.expIPv6, ipv6)
+		})
+	}
+}
+
+func TestParseNodeSwitchOtherConfigAnnotation(t *testing.T) {
+	tests := []struct {
+		desc        string
+		annotation  *string
+		errExpected bool
+		expOutput   map[string]string
+	}{
+		{
+			desc:        "annotation not found",
+			errExpected: true,
+		},
+		{
+			desc:       "success: parse other config",
+			annotation: stringPtr(`{"mcast_table_size":"4096","vlan-passthru":"true"}`),
+			expOutput:  map[string]string{"mcast_table_size": "4096", "vlan-passthru": "true"},
+		},
+		{
+			desc:        "error: values must be strings",
+			annotation:  stringPtr(`{"mcast_table_size":4096}`),
+			errExpected: true,
+		},
+	}
+
+	for i, tc := range tests {
+		t.Run(fmt.Sprintf("%d:%s", i, tc.desc), func(t *testing.T) {
+			node := v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+			if tc.annotation != nil {
+				node.Annotations = map[string]string{"k8s.ovn.org/node-switch-other-config": *tc.annotation}
+			}
+			otherConfig, e := ParseNodeSwitchOtherConfigAnnotation(&node)
+			if tc.errExpected {
+				assert.Error(t, e)
+				assert.Equal(t, tc.annotation == nil, IsAnnotationNotSetError(e))
+				return
+			}
+			assert.NoError(t, e)
+			assert.Equal(t, tc.expOutput, otherConfig)
+		})
+	}
+}
+
+func TestIsNodeOVNFrozen(t *testing.T) {
+	tests := []struct {
+		desc       string
+		annotation *string
+		expOutput  bool
+	}{
+		{
+			desc: "annotation not found",
+		},
+		{
+			desc:       "frozen",
+			annotation: stringPtr("true"),
+			expOutput:  true,
+		},
+		{
+			desc:       "not frozen",
+			annotation: stringPtr("false"),
+		},
+	}
+
+	for i, tc := range tests {
+		t.Run(fmt.Sprintf("%d:%s", i, tc.desc), func(t *testing.T) {
+			node := v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+			if tc.annotation != nil {
+				node.Annotations = map[string]string{"k8s.ovn.org/freeze-ovn": *tc.annotation}
+			}
+			assert.Equal(t, tc.expOutput, IsNodeOVNFrozen(&node))
+		})
+	}
+}
+
+func TestIsNodeExcludedFromLoadBalancerGroup(t *testing.T) {
+	tests := []struct {
+		desc       string
+		annotation *string
+		expOutput  bool
+	}{
+		{
+			desc: "annotation not found",
+		},
+		{
+			desc:       "excluded",
+			annotation: stringPtr("true"),
+			expOutput:  true,
+		},
+		{
+			desc:       "not excluded",
+			annotation: stringPtr("false"),
+		},
+	}
+
+	for i, tc := range tests {
+		t.Run(fmt.Sprintf("%d:%s", i, tc.desc), func(t *testing.T) {
+			node := v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+			if tc.annotation != nil {
+				node.Annotations = map[string]string{"k8s.ovn.org/exclude-load-balancer-group": *tc.annotation}
+			}
+			assert.Equal(t, tc.expOutput, IsNodeExcludedFromLoadBalancerGroup(&node))
+		})
+	}
+}
+
+func TestNodeSubnetsAllocatedAtAnnotation(t *testing.T) {
+	allocatedAt := time.Date(2022, 11, 4, 10, 30, 0, 0, time.FixedZone("CET", 3600))
+	annotations := CreateNodeSubnetsAllocatedAtAnnotation(map[string]string{"foo": "bar"}, allocatedAt)
+	assert.Equal(t, "bar", annotations["foo"])
+	assert.Equal(t, "2022-11-04T09:30:00Z", annotations["k8s.ovn.org/node-subnets-allocated-at"])
+
+	node := v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Annotations: annotations}}
+	parsed, err := ParseNodeSubnetsAllocatedAt(&node)
+	assert.NoError(t, err)
+	assert.True(t, allocatedAt.Equal(parsed))
+
+	node.Annotations = nil
+	_, err = ParseNodeSubnetsAllocatedAt(&node)
+	assert.True(t, IsAnnotationNotSetError(err))
+
+	node.Annotations = map[string]string{"k8s.ovn.org/node-subnets-allocated-at": "yesterday"}
+	_, err = ParseNodeSubnetsAllocatedAt(&node)
+	assert.Error(t, err)
+	assert.False(t, IsAnnotationNotSetError(err))
+}
+
+func TestNodeLRPMACAnnotation(t *testing.T) {
+	mac, _ := net.ParseMAC("0a:58:0a:f4:00:01")
+	annotations := CreateNodeLRPMACAnnotation(map[string]string{"foo": "bar"}, mac)
+	assert.Equal(t, "bar", annotations["foo"])
+	assert.Equal(t, "0a:58:0a:f4:00:01", annotations["k8s.ovn.org/node-lrp-mac"])
+
+	node := v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Annotations: annotations}}
+	parsed, err := ParseNodeLRPMACAnnotation(&node)
+	assert.NoError(t, err)
+	assert.Equal(t, mac, parsed)
+
+	node.Annotations = nil
+	_, err = ParseNodeLRPMACAnnotation(&node)
+	assert.True(t, IsAnnotationNotSetError(err))
+
+	node.Annotations = map[string]string{"k8s.ovn.org/node-lrp-mac": "not-a-mac"}
+	_, err = ParseNodeLRPMACAnnotation(&node)
+	assert.Error(t, err)
+	assert.False(t, IsAnnotationNotSetError(err))
+}
+
+func TestParseNodeBackupChassisAnnotation(t *testing.T) {
+	tests := []struct {
+		desc       string
+		annotation *string
+		expOutput  []string
+		expErr     bool
+	}{
+		{
+			desc:   "annotation not found",
+			expErr: true,
+		},
+		{
+			desc:       "single chassis",
+			annotation: stringPtr("chassis1"),
+			expOutput:  []string{"chassis1"},
+		},
+		{
+			desc:       "chassis in priority order, spaces and empty entries ignored",
+			annotation: stringPtr("chassis2, chassis1,,"),
+			expOutput:  []string{"chassis2", "chassis1"},
+		},
+	}
+
+	for i, tc := range tests {
+		t.Run(fmt.Sprintf("%d:%s", i, tc.desc), func(t *testing.T) {
+			node := v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+			if tc.annotation != nil {
+				node.Annotations = map[string]string{"k8s.ovn.org/node-backup-chassis": *tc.annotation}
+			}
+			chassisIDs, err := ParseNodeBackupChassisAnnotation(&node)
+			if tc.expErr {
+				assert.True(t, IsAnnotationNotSetError(err))
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expOutput, chassisIDs)
+		})
+	}
+}
+
+func TestParseNodeExcludeSubnetsAnnotation(t *testing.T) {
+	tests := []struct {
+		desc       string
+		annotation *string
+		expOutput  []*net.IPNet
+		expErr     bool
+	}{
+		{
+			desc: "annotation not found",
+		},
+		{
+			desc:       "CIDRs with spaces and empty entries ignored",
+			annotation: stringPtr("10.1.1.16/28, 10.1.1.200/32,,"),
+			expOutput:  ovntest.MustParseIPNets("10.1.1.16/28", "10.1.1.200/32"),
+		},
+		{
+			desc:       "CIDR host bits are masked",
+			annotation: stringPtr("10.1.1.20/28"),
+			expOutput:  ovntest.MustParseIPNets("10.1.1.16/28"),
+		},
+		{
+			desc:       "invalid CIDR",
+			annotation: stringPtr("10.1.1.16/28,10.1.1.300"),
+			expErr:     true,
+		},
+	}
+
+	for i, tc := range tests {
+		t.Run(fmt.Sprintf("%d:%s", i, tc.desc), func(t *testing.T) {
+			node := v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+			if tc.annotation != nil {
+				node.Annotations = map[string]string{"k8s.ovn.org/node-exclude-subnets": *tc.annotation}
+			}
+			subnets, err := ParseNodeExcludeSubnetsAnnotation(&node)
+			switch {
+			case tc.expErr:
+				assert.Error(t, err)
+				assert.False(t, IsAnnotationNotSetError(err))
+			case tc.annotation == nil:
+				assert.True(t, IsAnnotationNotSetError(err))
+			default:
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expOutput, subnets)
+		})
+	}
+}
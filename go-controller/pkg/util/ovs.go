@@ -784,6 +784,46 @@ func DetectSCTPSupport() (bool, error) {
 	return false, nil
 }
 
+// DetectMulticastSupport checks if OVN supports IGMP snooping, which multicast support relies on
+func DetectMulticastSupport() bool {
+	_, _, err := RunOVNSbctl("--columns=_uuid", "list", "IGMP_Group")
+	return err == nil
+}
+
+// OVNCapabilities are the optional features of the OVN in use that the network
+// controllers rely on
+type OVNCapabilities struct {
+	// SCTP is set if OVN load balancers support SCTP
+	SCTP bool
+	// Multicast is set if multicast is enabled and OVN supports IGMP snooping
+	Multicast bool
+}
+
+// DetectOVNCapabilities probes the OVN databases for the optional features the network
+// controllers rely on. OVN is only probed for multicast support if multicast is enabled.
+func DetectOVNCapabilities() (OVNCapabilities, error) {
+	var capabilities OVNCapabilities
+	var err error
+	capabilities.SCTP, err = DetectSCTPSupport()
+	if err != nil {
+		return capabilities, err
+	}
+	if !capabilities.SCTP {
+		klog.Warningf("SCTP unsupported by this version of OVN. Kubernetes service creation with SCTP will not work ")
+	} else {
+		klog.Info("SCTP support detected in OVN")
+	}
+
+	if config.EnableMulticast {
+		capabilities.Multicast = DetectMulticastSupport()
+		if !capabilities.Multicast {
+			klog.Warningf("Multicast support enabled, however version of OVN in use does not support IGMP Group. " +
+				"Disabling Multicast Support")
+		}
+	}
+	return capabilities, nil
+}
+
 // NBTxn hold parts of an ovn-nbctl transaction request
 type NBTxn struct {
 	args    []string
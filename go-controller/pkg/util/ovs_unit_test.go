@@ -1824,6 +1824,77 @@ func TestDetectSCTPSupport(t *testing.T) {
 	}
 }
 
+func TestDetectOVNCapabilities(t *testing.T) {
+	const (
+		lbColumnsCmd = "ovsdb-client list-columns  --data=bare --no-heading --format=json OVN_Northbound Load_Balancer"
+		igmpGroupCmd = "ovn-sbctl --timeout=15 --no-leader-only --columns=_uuid list IGMP_Group"
+		sctpColumns  = `{"data":[["protocol",{"key":{"enum":["set",["sctp","tcp","udp"]],"type":"string"},"min":0}]],"headings":["Column","Type"]}`
+		tcpColumns   = `{"data":[["protocol",{"key":{"enum":["set",["tcp","udp"]],"type":"string"},"min":0}]],"headings":["Column","Type"]}`
+	)
+	defer func() {
+		config.EnableMulticast = false
+		runCmdExecRunner = &defaultExecRunner{}
+	}()
+
+	tests := []struct {
+		desc            string
+		enableMulticast bool
+		cmds            []*ovntest.ExpectedCmd
+		expCapabilities OVNCapabilities
+		expErr          bool
+	}{
+		{
+			desc:            "SCTP supported, multicast not probed when disabled",
+			cmds:            []*ovntest.ExpectedCmd{{Cmd: lbColumnsCmd, Output: sctpColumns}},
+			expCapabilities: OVNCapabilities{SCTP: true},
+		},
+		{
+			desc:            "SCTP unsupported, multicast enabled and supported",
+			enableMulticast: true,
+			cmds: []*ovntest.ExpectedCmd{
+				{Cmd: lbColumnsCmd, Output: tcpColumns},
+				{Cmd: igmpGroupCmd},
+			},
+			expCapabilities: OVNCapabilities{Multicast: true},
+		},
+		{
+			desc:            "multicast enabled but unsupported",
+			enableMulticast: true,
+			cmds: []*ovntest.ExpectedCmd{
+				{Cmd: lbColumnsCmd, Output: sctpColumns},
+				{Cmd: igmpGroupCmd, Err: fmt.Errorf("no IGMP_Group table")},
+			},
+			expCapabilities: OVNCapabilities{SCTP: true},
+		},
+		{
+			desc:            "fails when the SCTP probe fails",
+			enableMulticast: true,
+			cmds:            []*ovntest.ExpectedCmd{{Cmd: lbColumnsCmd, Err: fmt.Errorf("NB unreachable")}},
+			expErr:          true,
+		},
+	}
+	for i, tc := range tests {
+		t.Run(fmt.Sprintf("%d:%s", i, tc.desc), func(t *testing.T) {
+			runCmdExecRunner = &defaultExecRunner{}
+			fexec := ovntest.NewFakeExec()
+			for _, cmd := range tc.cmds {
+				fexec.AddFakeCmd(cmd)
+			}
+			assert.NoError(t, SetExec(fexec))
+			config.EnableMulticast = tc.enableMulticast
+
+			capabilities, err := DetectOVNCapabilities()
+			if tc.expErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expCapabilities, capabilities)
+			}
+			assert.True(t, fexec.CalledMatchesExpected(), fexec.ErrorDesc())
+		})
+	}
+}
+
 func TestFindMaxArgsUsable(t *testing.T) {
 	tests := []struct {
 		desc            string
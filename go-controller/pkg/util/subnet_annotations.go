@@ -168,13 +168,20 @@ func DeleteNodeHostSubnetAnnotation(nodeAnnotator kube.Annotator) {
 // ParseNodeHostSubnetAnnotation parses the "k8s.ovn.org/node-subnets" annotation
 // on a node and returns the host subnet for the given network.
 func ParseNodeHostSubnetAnnotation(node *kapi.Node, netName string) ([]*net.IPNet, error) {
-	subnetsMap, err := parseSubnetAnnotation(node.Annotations, ovnNodeSubnets)
+	return ParseNodeHostSubnetAnnotationFromKey(node, ovnNodeSubnets, netName)
+}
+
+// ParseNodeHostSubnetAnnotationFromKey parses a node subnets annotation stored under the
+// given annotation key, in the format of "k8s.ovn.org/node-subnets", and returns the host
+// subnet for the given network.
+func ParseNodeHostSubnetAnnotationFromKey(node *kapi.Node, annotationName, netName string) ([]*net.IPNet, error) {
+	subnetsMap, err := parseSubnetAnnotation(node.Annotations, annotationName)
 	if err != nil {
 		return nil, err
 	}
 	subnets, ok := subnetsMap[netName]
 	if !ok {
-		return nil, newAnnotationNotSetError("node %q has no %q annotation for network %s", node.Name, ovnNodeSubnets, netName)
+		return nil, newAnnotationNotSetError("node %q has no %q annotation for network %s", node.Name, annotationName, netName)
 	}
 
 	return subnets, nil
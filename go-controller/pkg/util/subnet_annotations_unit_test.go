@@ -359,3 +359,53 @@ func TestParseNodeHostSubnetAnnotation(t *testing.T) {
 		})
 	}
 }
+
+func TestParseNodeHostSubnetAnnotationFromKey(t *testing.T) {
+	tests := []struct {
+		desc        string
+		annotations map[string]string
+		expSubnets  []string
+		errExp      bool
+		notSetExp   bool
+	}{
+		{
+			desc:        "reads the subnets under the given key",
+			annotations: map[string]string{"k8s.ovn.org/node-subnets-legacy": "{\"default\":\"10.244.0.0/24\"}"},
+			expSubnets:  []string{"10.244.0.0/24"},
+		},
+		{
+			desc:        "ignores the current key",
+			annotations: map[string]string{"k8s.ovn.org/node-subnets": "{\"default\":\"10.244.0.0/24\"}"},
+			errExp:      true,
+			notSetExp:   true,
+		},
+		{
+			desc:        "reports a missing network as not set",
+			annotations: map[string]string{"k8s.ovn.org/node-subnets-legacy": "{\"other\":\"10.244.0.0/24\"}"},
+			errExp:      true,
+			notSetExp:   true,
+		},
+		{
+			desc:        "fails on a corrupt annotation",
+			annotations: map[string]string{"k8s.ovn.org/node-subnets-legacy": "10.244.0.0/24"},
+			errExp:      true,
+		},
+	}
+	for i, tc := range tests {
+		t.Run(fmt.Sprintf("%d:%s", i, tc.desc), func(t *testing.T) {
+			node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "testNode", Annotations: tc.annotations}}
+			res, err := ParseNodeHostSubnetAnnotationFromKey(node, "k8s.ovn.org/node-subnets-legacy", types.DefaultNetworkName)
+			if tc.errExp {
+				assert.Error(t, err)
+				assert.Equal(t, tc.notSetExp, IsAnnotationNotSetError(err))
+				return
+			}
+			assert.NoError(t, err)
+			var subnets []string
+			for _, subnet := range res {
+				subnets = append(subnets, subnet.String())
+			}
+			assert.Equal(t, tc.expSubnets, subnets)
+		})
+	}
+}